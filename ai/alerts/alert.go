@@ -0,0 +1,108 @@
+// Package alerts tracks the lifecycle of alerts raised by the baseline
+// monitor, anomaly detectors and alert rules
+package alerts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Alert states. An alert moves from pending to firing, may be acknowledged,
+// and ends resolved; it can be resolved from any open state.
+const (
+	StatePending      = "pending"
+	StateFiring       = "firing"
+	StateAcknowledged = "acknowledged"
+	StateResolved     = "resolved"
+)
+
+// OpenStates are the states of alerts that still need attention
+var OpenStates = []string{StatePending, StateFiring, StateAcknowledged}
+
+var (
+	ErrNotFound          = errors.New("alert not found")
+	ErrInvalidTransition = errors.New("invalid alert state transition")
+)
+
+// Alert is one occurrence of a problem. Occurrences of the same problem
+// share a fingerprint; each has its own ID.
+type Alert struct {
+	ID          string     `json:"id"`
+	Fingerprint string     `json:"fingerprint"`
+	State       string     `json:"state"`
+	StartsAt    time.Time  `json:"starts_at"`
+	FiringAt    *time.Time `json:"firing_at,omitempty"`
+	LastSeen    time.Time  `json:"last_seen"`
+	AckedBy     string     `json:"acked_by,omitempty"`
+	AckedAt     *time.Time `json:"acked_at,omitempty"`
+	ResolvedBy  string     `json:"resolved_by,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	SilencedBy  []string   `json:"silenced_by,omitempty"` // IDs of the silences matching the alert
+	models.Alert
+}
+
+// Open reports whether the alert still needs attention
+func (a Alert) Open() bool {
+	return a.State != StateResolved
+}
+
+// Transition is one recorded state change
+type Transition struct {
+	State     string    `json:"state"`
+	Timestamp time.Time `json:"timestamp"`
+	User      string    `json:"user,omitempty"` // Empty for automatic transitions
+}
+
+// Changes reported by events that leave an open alert in the same state
+const (
+	ChangeSeverity   = "severity"   // Severity rose, e.g. warning to critical
+	ChangeUnsilenced = "unsilenced" // The silences covering the alert ended
+)
+
+// Event is broadcast to subscribers on every state change, and on changes
+// to an open alert that subscribers may route differently
+type Event struct {
+	Type   string `json:"type"` // "alert", or "escalation" for escalation notices
+	State  string `json:"state"`
+	Change string `json:"change,omitempty"` // Empty for state changes
+	User   string `json:"user,omitempty"`
+	Alert  Alert  `json:"alert"`
+}
+
+// severityRank orders severities from least to most urgent
+var severityRank = map[string]int{"info": 1, "warning": 2, "critical": 3}
+
+// Fingerprint identifies the problem an alert describes: the clinic, the
+// rule or detector and metric that raised it, and its labels. Values and
+// descriptions change between evaluations and are not part of it.
+func Fingerprint(a models.Alert) string {
+	source := a.Rule
+	if source == "" {
+		source = a.Detector + ":" + a.Metric
+	}
+	if a.Rule == "" && a.Detector == "" && a.Metric == "" {
+		source = a.Description
+	}
+
+	keys := make([]string, 0, len(a.Labels))
+	for k := range a.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	h.Write([]byte(a.ClinicID))
+	h.Write([]byte{0})
+	h.Write([]byte(source))
+	for _, k := range keys {
+		h.Write([]byte{0})
+		h.Write([]byte(k + "=" + a.Labels[k]))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
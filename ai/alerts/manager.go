@@ -0,0 +1,452 @@
+package alerts
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Config controls alert deduplication
+type Config struct {
+	// How long a firing alert may go unreported before it is resolved
+	// automatically; reports within this window update the same alert
+	ResolveAfter time.Duration `yaml:"resolve_after"`
+}
+
+const defaultResolveAfter = 5 * time.Minute
+
+// Filter selects alerts to list
+type Filter struct {
+	ClinicID string
+	States   []string  // Empty means every state
+	From     time.Time // Started at or after; zero means no lower bound
+	To       time.Time // Started before; zero means no upper bound
+	Limit    int
+}
+
+// Manager deduplicates incoming alerts into stored, stateful alerts
+type Manager struct {
+	db     *sql.DB
+	config Config
+
+	mu          sync.Mutex // Serialises state changes
+	subsMu      sync.RWMutex
+	subscribers []func(Event)
+
+	silencesMu sync.RWMutex
+	silences   map[string]Silence // Silences that have not expired, by ID
+}
+
+// NewManager creates the alert tables in db
+func NewManager(db *sql.DB, config Config) (*Manager, error) {
+	if config.ResolveAfter <= 0 {
+		config.ResolveAfter = defaultResolveAfter
+	}
+
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS alerts (
+			id TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			clinic_id TEXT NOT NULL,
+			state TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			starts_at INTEGER NOT NULL,
+			firing_at INTEGER,
+			last_seen INTEGER NOT NULL,
+			acked_by TEXT NOT NULL DEFAULT '',
+			acked_at INTEGER,
+			resolved_by TEXT NOT NULL DEFAULT '',
+			resolved_at INTEGER,
+			updated_at INTEGER NOT NULL,
+			payload BLOB NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_clinic_state ON alerts (clinic_id, state)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_fingerprint ON alerts (fingerprint)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_starts_at ON alerts (starts_at)`,
+		`CREATE TABLE IF NOT EXISTS alert_transitions (
+			alert_id TEXT NOT NULL,
+			ts INTEGER NOT NULL,
+			state TEXT NOT NULL,
+			user_id TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_transitions_alert ON alert_transitions (alert_id, ts)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("failed to create alert tables: %v", err)
+		}
+	}
+
+	if err := createSilenceTable(db); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{db: db, config: config, silences: make(map[string]Silence)}
+	if err := m.loadSilences(time.Now()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Subscribe registers fn to be called after every state change, when an
+// open alert's severity rises and when its silences end. Events for
+// silenced alerts are delivered too, with Alert.Silenced set; notification
+// channels should skip them.
+func (m *Manager) Subscribe(fn func(Event)) {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	m.subscribers = append(m.subscribers, fn)
+}
+
+func (m *Manager) publish(events []Event) {
+	m.subsMu.RLock()
+	defer m.subsMu.RUnlock()
+	for _, e := range events {
+		e.Type = "alert"
+		for _, fn := range m.subscribers {
+			fn(e)
+		}
+	}
+}
+
+// Sync reconciles a clinic's stored alerts with one evaluation: pending
+// holds alerts whose condition has not lasted long enough to fire, firing
+// those that should fire. Open alerts missing from both are resolved once
+// they have gone unreported for ResolveAfter; pending ones immediately.
+func (m *Manager) Sync(ctx context.Context, clinicID string, pending, firing []models.Alert, now time.Time) error {
+	m.mu.Lock()
+	events, err := m.sync(ctx, clinicID, pending, firing, now)
+	m.mu.Unlock()
+
+	m.publish(events)
+	return err
+}
+
+func (m *Manager) sync(ctx context.Context, clinicID string, pending, firing []models.Alert, now time.Time) ([]Event, error) {
+	open, err := m.List(ctx, Filter{ClinicID: clinicID, States: OpenStates})
+	if err != nil {
+		return nil, err
+	}
+	byFingerprint := make(map[string]Alert, len(open))
+	for _, a := range open {
+		byFingerprint[a.Fingerprint] = a
+	}
+
+	var events []Event
+	var changed []Alert
+	seen := make(map[string]bool)
+
+	report := func(incoming models.Alert, fire bool) {
+		incoming.ClinicID = clinicID
+		fp := Fingerprint(incoming)
+		if seen[fp] {
+			return
+		}
+		seen[fp] = true
+
+		a, exists := byFingerprint[fp]
+		if !exists {
+			a = Alert{ID: newID(), Fingerprint: fp, State: StatePending, StartsAt: now}
+		}
+		raised := exists && severityRank[incoming.Severity] > severityRank[a.Severity]
+		wasSilenced := exists && a.Silenced
+		a.Alert = incoming
+		a.SilencedBy = m.SilencedBy(incoming, now)
+		a.Silenced = len(a.SilencedBy) > 0
+		a.LastSeen = now
+		a.UpdatedAt = now
+
+		switch {
+		case !exists && !fire:
+			events = append(events, Event{State: StatePending, Alert: a})
+		case fire && a.State == StatePending:
+			a.State = StateFiring
+			a.FiringAt = timePtr(now)
+			events = append(events, Event{State: StateFiring, Alert: a})
+		case wasSilenced && !a.Silenced:
+			// Notifications were suppressed while silenced; report the
+			// alert again now that they are not
+			events = append(events, Event{State: a.State, Change: ChangeUnsilenced, Alert: a})
+		case raised:
+			events = append(events, Event{State: a.State, Change: ChangeSeverity, Alert: a})
+		}
+		changed = append(changed, a)
+	}
+
+	for _, a := range firing {
+		report(a, true)
+	}
+	for _, a := range pending {
+		report(a, false)
+	}
+
+	for fp, a := range byFingerprint {
+		if seen[fp] {
+			continue
+		}
+		if a.State == StatePending || now.Sub(a.LastSeen) >= m.config.ResolveAfter {
+			a.State = StateResolved
+			a.ResolvedAt = timePtr(now)
+			a.UpdatedAt = now
+			events = append(events, Event{State: StateResolved, Alert: a})
+			changed = append(changed, a)
+		}
+	}
+
+	if err := m.save(ctx, changed, events, now); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Acknowledge marks an open alert as being handled by user
+func (m *Manager) Acknowledge(ctx context.Context, id, user string) (Alert, error) {
+	return m.transition(ctx, id, user, StateAcknowledged, func(a *Alert, now time.Time) error {
+		if a.State != StatePending && a.State != StateFiring {
+			return fmt.Errorf("%w: cannot acknowledge a %s alert", ErrInvalidTransition, a.State)
+		}
+		a.AckedBy = user
+		a.AckedAt = timePtr(now)
+		return nil
+	})
+}
+
+// Resolve closes an open alert. If its condition still holds, the next
+// evaluation opens a new alert.
+func (m *Manager) Resolve(ctx context.Context, id, user string) (Alert, error) {
+	return m.transition(ctx, id, user, StateResolved, func(a *Alert, now time.Time) error {
+		if a.State == StateResolved {
+			return fmt.Errorf("%w: alert is already resolved", ErrInvalidTransition)
+		}
+		a.ResolvedBy = user
+		a.ResolvedAt = timePtr(now)
+		return nil
+	})
+}
+
+func (m *Manager) transition(ctx context.Context, id, user, state string, apply func(*Alert, time.Time) error) (Alert, error) {
+	m.mu.Lock()
+	a, err := m.Get(ctx, id)
+	if err != nil {
+		m.mu.Unlock()
+		return Alert{}, err
+	}
+
+	now := time.Now()
+	if err := apply(&a, now); err != nil {
+		m.mu.Unlock()
+		return Alert{}, err
+	}
+	a.State = state
+	a.UpdatedAt = now
+
+	event := Event{State: state, User: user, Alert: a}
+	err = m.save(ctx, []Alert{a}, []Event{event}, now)
+	m.mu.Unlock()
+	if err != nil {
+		return Alert{}, err
+	}
+
+	m.publish([]Event{event})
+	return a, nil
+}
+
+// save upserts alerts and records the state changes in events
+func (m *Manager) save(ctx context.Context, changed []Alert, events []Event, now time.Time) error {
+	if len(changed) == 0 {
+		return nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin alert transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, a := range changed {
+		payload, err := json.Marshal(alertPayload{Alert: a.Alert, SilencedBy: a.SilencedBy})
+		if err != nil {
+			return fmt.Errorf("failed to encode alert: %v", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO alerts (id, fingerprint, clinic_id, state, severity, starts_at, firing_at,
+				last_seen, acked_by, acked_at, resolved_by, resolved_at, updated_at, payload)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				state = excluded.state, severity = excluded.severity, firing_at = excluded.firing_at,
+				last_seen = excluded.last_seen, acked_by = excluded.acked_by, acked_at = excluded.acked_at,
+				resolved_by = excluded.resolved_by, resolved_at = excluded.resolved_at,
+				updated_at = excluded.updated_at, payload = excluded.payload`,
+			a.ID, a.Fingerprint, a.ClinicID, a.State, a.Severity, a.StartsAt.UnixMilli(), nullableMillis(a.FiringAt),
+			a.LastSeen.UnixMilli(), a.AckedBy, nullableMillis(a.AckedAt), a.ResolvedBy, nullableMillis(a.ResolvedAt),
+			a.UpdatedAt.UnixMilli(), payload)
+		if err != nil {
+			return fmt.Errorf("failed to store alert: %v", err)
+		}
+	}
+
+	for _, e := range events {
+		if e.Change != "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO alert_transitions (alert_id, ts, state, user_id) VALUES (?, ?, ?, ?)`,
+			e.Alert.ID, now.UnixMilli(), e.State, e.User); err != nil {
+			return fmt.Errorf("failed to record alert transition: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// alertPayload is the JSON stored with each alert row
+type alertPayload struct {
+	models.Alert
+	SilencedBy []string `json:"silenced_by,omitempty"`
+}
+
+const alertColumns = `id, fingerprint, state, starts_at, firing_at, last_seen, acked_by, acked_at,
+	resolved_by, resolved_at, updated_at, payload`
+
+// Get returns one alert
+func (m *Manager) Get(ctx context.Context, id string) (Alert, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id = ?`, id)
+	if err != nil {
+		return Alert{}, fmt.Errorf("failed to load alert: %v", err)
+	}
+	alerts, err := scanAlerts(rows)
+	if err != nil {
+		return Alert{}, err
+	}
+	if len(alerts) == 0 {
+		return Alert{}, ErrNotFound
+	}
+	return alerts[0], nil
+}
+
+// List returns alerts matching filter, most recently started first
+func (m *Manager) List(ctx context.Context, filter Filter) ([]Alert, error) {
+	query := `SELECT ` + alertColumns + ` FROM alerts WHERE 1 = 1`
+	var args []interface{}
+
+	if filter.ClinicID != "" {
+		query += ` AND clinic_id = ?`
+		args = append(args, filter.ClinicID)
+	}
+	if len(filter.States) > 0 {
+		query += ` AND state IN (?` + strings.Repeat(`, ?`, len(filter.States)-1) + `)`
+		for _, s := range filter.States {
+			args = append(args, s)
+		}
+	}
+	if !filter.From.IsZero() {
+		query += ` AND starts_at >= ?`
+		args = append(args, filter.From.UnixMilli())
+	}
+	if !filter.To.IsZero() {
+		query += ` AND starts_at < ?`
+		args = append(args, filter.To.UnixMilli())
+	}
+	query += ` ORDER BY starts_at DESC, id`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %v", err)
+	}
+	return scanAlerts(rows)
+}
+
+// History returns an alert's recorded state changes, oldest first
+func (m *Manager) History(ctx context.Context, id string) ([]Transition, error) {
+	rows, err := m.db.QueryContext(ctx,
+		`SELECT ts, state, user_id FROM alert_transitions WHERE alert_id = ? ORDER BY ts, rowid`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load alert history: %v", err)
+	}
+	defer rows.Close()
+
+	transitions := []Transition{}
+	for rows.Next() {
+		var t Transition
+		var ts int64
+		if err := rows.Scan(&ts, &t.State, &t.User); err != nil {
+			return nil, fmt.Errorf("failed to read alert history: %v", err)
+		}
+		t.Timestamp = time.UnixMilli(ts)
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
+
+func scanAlerts(rows *sql.Rows) ([]Alert, error) {
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		var a Alert
+		var startsAt, lastSeen, updatedAt int64
+		var firingAt, ackedAt, resolvedAt sql.NullInt64
+		var payload []byte
+		if err := rows.Scan(&a.ID, &a.Fingerprint, &a.State, &startsAt, &firingAt, &lastSeen, &a.AckedBy,
+			&ackedAt, &a.ResolvedBy, &resolvedAt, &updatedAt, &payload); err != nil {
+			return nil, fmt.Errorf("failed to read alert: %v", err)
+		}
+		var p alertPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			log.Printf("Skipping alert %s with unreadable payload: %v", a.ID, err)
+			continue
+		}
+		a.Alert = p.Alert
+		a.SilencedBy = p.SilencedBy
+		a.StartsAt = time.UnixMilli(startsAt)
+		a.LastSeen = time.UnixMilli(lastSeen)
+		a.UpdatedAt = time.UnixMilli(updatedAt)
+		a.FiringAt = millisPtr(firingAt)
+		a.AckedAt = millisPtr(ackedAt)
+		a.ResolvedAt = millisPtr(resolvedAt)
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+func newID() string {
+	return newPrefixedID("alt_")
+}
+
+func newPrefixedID(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func nullableMillis(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMilli()
+}
+
+func millisPtr(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.UnixMilli(v.Int64)
+	return &t
+}
@@ -0,0 +1,237 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestManager(t *testing.T) (*Manager, *[]Event) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "alerts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewManager(db, Config{ResolveAfter: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	m.Subscribe(func(e Event) { events = append(events, e) })
+	return m, &events
+}
+
+var t0 = time.Date(2025, 3, 31, 8, 0, 0, 0, time.UTC)
+
+func latencyRule(value float64) models.Alert {
+	return models.Alert{
+		Severity: "critical", Description: "latency high", Rule: "latency-critical",
+		Metric: "latency", Value: value, Labels: map[string]string{"team": "network"},
+	}
+}
+
+func states(events []Event) []string {
+	var s []string
+	for _, e := range events {
+		s = append(s, e.State)
+	}
+	return s
+}
+
+func TestFingerprint(t *testing.T) {
+	a := latencyRule(250)
+	a.ClinicID = "kisumu-east"
+	b := latencyRule(300)
+	b.ClinicID = "kisumu-east"
+	b.Description = "latency very high"
+	if Fingerprint(a) != Fingerprint(b) {
+		t.Error("Value and description changes should keep the fingerprint")
+	}
+
+	c := a
+	c.ClinicID = "siaya"
+	d := a
+	d.Labels = map[string]string{"team": "systems"}
+	e := models.Alert{ClinicID: "kisumu-east", Detector: "cusum", Metric: "latency"}
+	for _, other := range []models.Alert{c, d, e} {
+		if Fingerprint(a) == Fingerprint(other) {
+			t.Errorf("Expected %+v to have a different fingerprint", other)
+		}
+	}
+}
+
+func TestSyncLifecycle(t *testing.T) {
+	ctx := context.Background()
+	m, events := newTestManager(t)
+
+	// Pending while the rule's for duration runs, then firing
+	if err := m.Sync(ctx, "kisumu-east", []models.Alert{latencyRule(210)}, nil, t0); err != nil {
+		t.Fatal(err)
+	}
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(250)}, t0.Add(time.Minute))
+	// Repeated reports are deduplicated into the same alert
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(260)}, t0.Add(2*time.Minute))
+
+	open, err := m.List(ctx, Filter{ClinicID: "kisumu-east", States: OpenStates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 {
+		t.Fatalf("Expected one open alert, got %d", len(open))
+	}
+	a := open[0]
+	if a.State != StateFiring || a.Value != 260 || a.ClinicID != "kisumu-east" ||
+		!a.StartsAt.Equal(t0) || a.FiringAt == nil || !a.FiringAt.Equal(t0.Add(time.Minute)) {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+	if got := states(*events); len(got) != 2 || got[0] != StatePending || got[1] != StateFiring {
+		t.Errorf("Events = %v, want [pending firing]", got)
+	}
+	if (*events)[1].Type != "alert" || (*events)[1].Alert.ID != a.ID {
+		t.Errorf("Unexpected event %+v", (*events)[1])
+	}
+
+	// A short gap is within the grace period
+	m.Sync(ctx, "kisumu-east", nil, nil, t0.Add(2*time.Minute+30*time.Second))
+	if got, _ := m.Get(ctx, a.ID); got.State != StateFiring {
+		t.Errorf("Expected the alert to keep firing during the grace period, got %s", got.State)
+	}
+	m.Sync(ctx, "kisumu-east", nil, nil, t0.Add(3*time.Minute))
+	got, _ := m.Get(ctx, a.ID)
+	if got.State != StateResolved || got.ResolvedAt == nil || got.ResolvedBy != "" {
+		t.Errorf("Expected automatic resolution, got %+v", got)
+	}
+
+	// The problem returning opens a new occurrence with the same fingerprint
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(300)}, t0.Add(10*time.Minute))
+	open, _ = m.List(ctx, Filter{ClinicID: "kisumu-east", States: OpenStates})
+	if len(open) != 1 || open[0].ID == a.ID || open[0].Fingerprint != a.Fingerprint || open[0].State != StateFiring {
+		t.Errorf("Expected a new firing occurrence, got %+v", open)
+	}
+
+	history, err := m.History(ctx, a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].State != StatePending || history[2].State != StateResolved {
+		t.Errorf("Unexpected history %+v", history)
+	}
+}
+
+func TestPendingClearsImmediately(t *testing.T) {
+	ctx := context.Background()
+	m, events := newTestManager(t)
+
+	m.Sync(ctx, "kisumu-east", []models.Alert{latencyRule(210)}, nil, t0)
+	m.Sync(ctx, "kisumu-east", nil, nil, t0.Add(6*time.Second))
+
+	if got := states(*events); len(got) != 2 || got[1] != StateResolved {
+		t.Errorf("Events = %v, want [pending resolved]", got)
+	}
+}
+
+func TestSeverityRiseIsReported(t *testing.T) {
+	ctx := context.Background()
+	m, events := newTestManager(t)
+
+	warning := latencyRule(210)
+	warning.Severity = "warning"
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{warning}, t0)
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(300)}, t0.Add(time.Minute))
+	// Falling back to warning is not news
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{warning}, t0.Add(2*time.Minute))
+
+	if len(*events) != 2 {
+		t.Fatalf("Events = %v, want [firing firing]", states(*events))
+	}
+	e := (*events)[1]
+	if e.State != StateFiring || e.Change != ChangeSeverity || e.Alert.Severity != "critical" {
+		t.Errorf("Unexpected severity event %+v", e)
+	}
+
+	history, err := m.History(ctx, e.Alert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Errorf("Expected only state changes in the history, got %+v", history)
+	}
+}
+
+func TestAcknowledgeAndResolve(t *testing.T) {
+	ctx := context.Background()
+	m, events := newTestManager(t)
+
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(250)}, t0)
+	open, _ := m.List(ctx, Filter{States: OpenStates})
+	id := open[0].ID
+
+	a, err := m.Acknowledge(ctx, id, "12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.State != StateAcknowledged || a.AckedBy != "12" || a.AckedAt == nil {
+		t.Errorf("Unexpected acknowledged alert %+v", a)
+	}
+	if _, err := m.Acknowledge(ctx, id, "12"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition acknowledging twice, got %v", err)
+	}
+
+	// Further reports keep an acknowledged alert acknowledged
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(270)}, t0.Add(time.Minute))
+	if a, _ := m.Get(ctx, id); a.State != StateAcknowledged || a.Value != 270 {
+		t.Errorf("Expected the acknowledged alert to update in place, got %+v", a)
+	}
+
+	a, err = m.Resolve(ctx, id, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.State != StateResolved || a.ResolvedBy != "7" {
+		t.Errorf("Unexpected resolved alert %+v", a)
+	}
+	if _, err := m.Resolve(ctx, id, "7"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition resolving twice, got %v", err)
+	}
+	if _, err := m.Resolve(ctx, "alt_missing", "7"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if got := states(*events); len(got) != 3 || got[1] != StateAcknowledged || got[2] != StateResolved {
+		t.Errorf("Events = %v, want [firing acknowledged resolved]", got)
+	}
+	if (*events)[1].User != "12" || (*events)[2].User != "7" {
+		t.Errorf("Expected events to carry the acting user, got %+v", *events)
+	}
+
+	history, _ := m.History(ctx, id)
+	if len(history) != 3 || history[1].User != "12" || history[2].User != "7" {
+		t.Errorf("Unexpected history %+v", history)
+	}
+}
+
+func TestListTimeWindow(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestManager(t)
+
+	for i, clinic := range []string{"kisumu-east", "siaya", "kombewa"} {
+		m.Sync(ctx, clinic, nil, []models.Alert{latencyRule(250)}, t0.Add(time.Duration(i)*time.Hour))
+	}
+
+	list, err := m.List(ctx, Filter{From: t0.Add(30 * time.Minute), To: t0.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ClinicID != "siaya" {
+		t.Errorf("Expected only the alert started inside the window, got %+v", list)
+	}
+}
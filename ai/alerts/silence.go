@@ -0,0 +1,329 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Silence recurrences
+const (
+	RecurrenceNone   = ""
+	RecurrenceDaily  = "daily"
+	RecurrenceWeekly = "weekly"
+)
+
+var ErrSilenceNotFound = errors.New("silence not found")
+
+// Silence suppresses notifications for matching alerts during a window,
+// such as a scheduled generator test or ISP maintenance. Matching alerts
+// are still recorded, flagged as silenced. Empty matchers match anything.
+type Silence struct {
+	ID string `json:"id"`
+
+	ClinicID string `json:"clinic_id"` // Clinic ID glob, e.g. "kisumu-*"
+	Metric   string `json:"metric"`
+	Severity string `json:"severity"`
+
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// Recurring windows repeat daily or weekly from StartsAt until Until
+	Recurrence string     `json:"recurrence,omitempty"`
+	Until      *time.Time `json:"until,omitempty"`
+
+	CreatedBy   string     `json:"created_by"`
+	Reason      string     `json:"reason"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+}
+
+// Validate checks the matchers and window
+func (s Silence) Validate() error {
+	if s.StartsAt.IsZero() || s.EndsAt.IsZero() {
+		return fmt.Errorf("starts_at and ends_at are required")
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	if _, err := path.Match(s.ClinicID, ""); err != nil {
+		return fmt.Errorf("invalid clinic_id pattern %q: %v", s.ClinicID, err)
+	}
+	if s.Metric != "" && !models.IsMetricName(s.Metric) {
+		return fmt.Errorf("unknown metric %q", s.Metric)
+	}
+	switch s.Severity {
+	case "", "info", "warning", "critical":
+	default:
+		return fmt.Errorf("severity must be info, warning or critical")
+	}
+	switch s.Recurrence {
+	case RecurrenceNone:
+		if s.Until != nil {
+			return fmt.Errorf("until only applies to recurring silences")
+		}
+	case RecurrenceDaily, RecurrenceWeekly:
+		if s.EndsAt.Sub(s.StartsAt) >= s.period() {
+			return fmt.Errorf("a %s window must be shorter than its period", s.Recurrence)
+		}
+		if s.Until != nil && s.Until.Before(s.StartsAt) {
+			return fmt.Errorf("until must be after starts_at")
+		}
+	default:
+		return fmt.Errorf("recurrence must be daily or weekly")
+	}
+	if s.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	return nil
+}
+
+func (s Silence) period() time.Duration {
+	if s.Recurrence == RecurrenceWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// ActiveAt reports whether the silence is in effect at t
+func (s Silence) ActiveAt(t time.Time) bool {
+	if s.CancelledAt != nil && !t.Before(*s.CancelledAt) {
+		return false
+	}
+	if t.Before(s.StartsAt) {
+		return false
+	}
+	if s.Recurrence == RecurrenceNone {
+		return t.Before(s.EndsAt)
+	}
+	if s.Until != nil && t.After(*s.Until) {
+		return false
+	}
+	return t.Sub(s.StartsAt)%s.period() < s.EndsAt.Sub(s.StartsAt)
+}
+
+// ActiveDuring reports whether the silence is in effect at any time in
+// [from, to)
+func (s Silence) ActiveDuring(from, to time.Time) bool {
+	if s.ActiveAt(from) {
+		return true
+	}
+	// Otherwise it must come into effect within the range
+	next := s.StartsAt
+	if from.After(s.StartsAt) {
+		if s.Recurrence == RecurrenceNone {
+			return false
+		}
+		periods := (from.Sub(s.StartsAt) + s.period() - 1) / s.period()
+		next = s.StartsAt.Add(periods * s.period())
+	}
+	return next.Before(to) && s.ActiveAt(next)
+}
+
+// Expired reports whether the silence can no longer become active
+func (s Silence) Expired(t time.Time) bool {
+	if s.CancelledAt != nil && !t.Before(*s.CancelledAt) {
+		return true
+	}
+	if s.Recurrence == RecurrenceNone {
+		return !t.Before(s.EndsAt)
+	}
+	return s.Until != nil && t.After(*s.Until)
+}
+
+// Matches reports whether the silence's matchers select an alert. The metric
+// matcher also selects rule alerts whose expression references the metric.
+func (s Silence) Matches(a models.Alert) bool {
+	if s.ClinicID != "" {
+		if ok, _ := path.Match(s.ClinicID, a.ClinicID); !ok {
+			return false
+		}
+	}
+	if s.Metric != "" && s.Metric != a.Metric && !containsString(a.Metrics, s.Metric) {
+		return false
+	}
+	return s.Severity == "" || s.Severity == a.Severity
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func createSilenceTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS silences (
+		id TEXT PRIMARY KEY,
+		clinic_id TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		starts_at INTEGER NOT NULL,
+		ends_at INTEGER NOT NULL,
+		recurrence TEXT NOT NULL,
+		until INTEGER,
+		created_by TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		cancelled_at INTEGER
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create silences table: %v", err)
+	}
+	return nil
+}
+
+// loadSilences reads every silence that has not expired
+func (m *Manager) loadSilences(now time.Time) error {
+	rows, err := m.db.Query(`SELECT ` + silenceColumns + ` FROM silences`)
+	if err != nil {
+		return fmt.Errorf("failed to load silences: %v", err)
+	}
+	list, err := scanSilences(rows)
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		if !s.Expired(now) {
+			m.silences[s.ID] = s
+		}
+	}
+	return nil
+}
+
+// SilencesDuring returns the silences covering a clinic at any time in
+// [from, to), including expired and cancelled ones, ordered by start time.
+// Only the clinic matcher is considered.
+func (m *Manager) SilencesDuring(ctx context.Context, clinicID string, from, to time.Time) ([]Silence, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT `+silenceColumns+` FROM silences
+		WHERE starts_at < ? ORDER BY starts_at, id`, to.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load silences: %v", err)
+	}
+	list, err := scanSilences(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []Silence{}
+	for _, s := range list {
+		if ok, _ := path.Match(s.ClinicID, clinicID); s.ClinicID != "" && !ok || !s.ActiveDuring(from, to) {
+			continue
+		}
+		matched = append(matched, s)
+	}
+	return matched, nil
+}
+
+const silenceColumns = `id, clinic_id, metric, severity, starts_at, ends_at, recurrence,
+	until, created_by, reason, created_at, cancelled_at`
+
+func scanSilences(rows *sql.Rows) ([]Silence, error) {
+	defer rows.Close()
+
+	var list []Silence
+	for rows.Next() {
+		var s Silence
+		var startsAt, endsAt, createdAt int64
+		var until, cancelledAt sql.NullInt64
+		if err := rows.Scan(&s.ID, &s.ClinicID, &s.Metric, &s.Severity, &startsAt, &endsAt, &s.Recurrence,
+			&until, &s.CreatedBy, &s.Reason, &createdAt, &cancelledAt); err != nil {
+			return nil, fmt.Errorf("failed to read silence: %v", err)
+		}
+		s.StartsAt = time.UnixMilli(startsAt)
+		s.EndsAt = time.UnixMilli(endsAt)
+		s.CreatedAt = time.UnixMilli(createdAt)
+		s.Until = millisPtr(until)
+		s.CancelledAt = millisPtr(cancelledAt)
+		list = append(list, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read silences: %v", err)
+	}
+	return list, nil
+}
+
+// CreateSilence validates and stores a silence
+func (m *Manager) CreateSilence(ctx context.Context, s Silence) (Silence, error) {
+	if err := s.Validate(); err != nil {
+		return Silence{}, err
+	}
+	s.ID = newPrefixedID("sil_")
+	s.CreatedAt = time.Now()
+	s.CancelledAt = nil
+
+	_, err := m.db.ExecContext(ctx, `INSERT INTO silences (id, clinic_id, metric, severity, starts_at,
+		ends_at, recurrence, until, created_by, reason, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.ClinicID, s.Metric, s.Severity, s.StartsAt.UnixMilli(), s.EndsAt.UnixMilli(), s.Recurrence,
+		nullableMillis(s.Until), s.CreatedBy, s.Reason, s.CreatedAt.UnixMilli())
+	if err != nil {
+		return Silence{}, fmt.Errorf("failed to store silence: %v", err)
+	}
+
+	m.silencesMu.Lock()
+	m.silences[s.ID] = s
+	m.silencesMu.Unlock()
+	return s, nil
+}
+
+// CancelSilence ends a silence early
+func (m *Manager) CancelSilence(ctx context.Context, id string) (Silence, error) {
+	m.silencesMu.Lock()
+	defer m.silencesMu.Unlock()
+
+	s, ok := m.silences[id]
+	if !ok {
+		return Silence{}, ErrSilenceNotFound
+	}
+	s.CancelledAt = timePtr(time.Now())
+	if _, err := m.db.ExecContext(ctx, `UPDATE silences SET cancelled_at = ? WHERE id = ?`,
+		s.CancelledAt.UnixMilli(), id); err != nil {
+		return Silence{}, fmt.Errorf("failed to cancel silence: %v", err)
+	}
+	delete(m.silences, id)
+	return s, nil
+}
+
+// Silences returns the silences that have not expired at now, optionally
+// only those active at now, ordered by start time
+func (m *Manager) Silences(now time.Time, activeOnly bool) []Silence {
+	m.silencesMu.RLock()
+	defer m.silencesMu.RUnlock()
+
+	list := []Silence{}
+	for _, s := range m.silences {
+		if s.Expired(now) || activeOnly && !s.ActiveAt(now) {
+			continue
+		}
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].StartsAt.Equal(list[j].StartsAt) {
+			return list[i].StartsAt.Before(list[j].StartsAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// SilencedBy returns the IDs of the silences that apply to an alert at now
+func (m *Manager) SilencedBy(a models.Alert, now time.Time) []string {
+	m.silencesMu.RLock()
+	defer m.silencesMu.RUnlock()
+
+	var ids []string
+	for _, s := range m.silences {
+		if s.ActiveAt(now) && s.Matches(a) {
+			ids = append(ids, s.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,205 @@
+package alerts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func TestSilenceActiveAt(t *testing.T) {
+	until := t0.Add(14 * 24 * time.Hour)
+	tests := []struct {
+		name    string
+		silence Silence
+		at      time.Time
+		want    bool
+	}{
+		{"before", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour)}, t0.Add(-time.Minute), false},
+		{"during", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour)}, t0.Add(30 * time.Minute), true},
+		{"at end", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour)}, t0.Add(time.Hour), false},
+		{"daily next day", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour), Recurrence: RecurrenceDaily}, t0.Add(24*time.Hour + 10*time.Minute), true},
+		{"daily between", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour), Recurrence: RecurrenceDaily}, t0.Add(5 * time.Hour), false},
+		{"weekly next week", Silence{StartsAt: t0, EndsAt: t0.Add(2 * time.Hour), Recurrence: RecurrenceWeekly}, t0.Add(7*24*time.Hour + time.Hour), true},
+		{"weekly next day", Silence{StartsAt: t0, EndsAt: t0.Add(2 * time.Hour), Recurrence: RecurrenceWeekly}, t0.Add(24 * time.Hour), false},
+		{"after until", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour), Recurrence: RecurrenceDaily, Until: &until}, t0.Add(21 * 24 * time.Hour), false},
+		{"cancelled", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour), CancelledAt: timePtr(t0.Add(10 * time.Minute))}, t0.Add(20 * time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.silence.ActiveAt(tt.at); got != tt.want {
+				t.Errorf("ActiveAt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSilenceActiveDuring(t *testing.T) {
+	daily := Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour), Recurrence: RecurrenceDaily}
+	tests := []struct {
+		name     string
+		silence  Silence
+		from, to time.Time
+		want     bool
+	}{
+		{"overlaps start", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour)}, t0.Add(-time.Hour), t0.Add(time.Minute), true},
+		{"ends before", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour)}, t0.Add(2 * time.Hour), t0.Add(3 * time.Hour), false},
+		{"starts after", Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour)}, t0.Add(-2 * time.Hour), t0, false},
+		{"daily next occurrence", daily, t0.Add(23 * time.Hour), t0.Add(24*time.Hour + time.Minute), true},
+		{"daily between", daily, t0.Add(2 * time.Hour), t0.Add(20 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.silence.ActiveDuring(tt.from, tt.to); got != tt.want {
+				t.Errorf("ActiveDuring = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSilenceValidate(t *testing.T) {
+	valid := Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour), Reason: "Generator test"}
+	tests := []struct {
+		name   string
+		modify func(*Silence)
+		ok     bool
+	}{
+		{"valid", func(*Silence) {}, true},
+		{"daily", func(s *Silence) { s.Recurrence = RecurrenceDaily }, true},
+		{"missing end", func(s *Silence) { s.EndsAt = time.Time{} }, false},
+		{"end before start", func(s *Silence) { s.EndsAt = t0.Add(-time.Hour) }, false},
+		{"unknown metric", func(s *Silence) { s.Metric = "temperature" }, false},
+		{"bad severity", func(s *Silence) { s.Severity = "urgent" }, false},
+		{"bad clinic glob", func(s *Silence) { s.ClinicID = "[kisumu" }, false},
+		{"bad recurrence", func(s *Silence) { s.Recurrence = "monthly" }, false},
+		{"window longer than period", func(s *Silence) { s.Recurrence = RecurrenceDaily; s.EndsAt = t0.Add(25 * time.Hour) }, false},
+		{"until without recurrence", func(s *Silence) { s.Until = timePtr(t0.Add(48 * time.Hour)) }, false},
+		{"missing reason", func(s *Silence) { s.Reason = "" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.modify(&s)
+			if err := s.Validate(); (err == nil) != tt.ok {
+				t.Errorf("Validate() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSilenceMatches(t *testing.T) {
+	a := models.Alert{ClinicID: "kisumu-east", Metric: "latency", Severity: "critical"}
+	tests := []struct {
+		silence Silence
+		want    bool
+	}{
+		{Silence{}, true},
+		{Silence{ClinicID: "kisumu-*"}, true},
+		{Silence{ClinicID: "siaya"}, false},
+		{Silence{ClinicID: "kisumu-east", Metric: "latency"}, true},
+		{Silence{Metric: "packet_loss"}, false},
+		{Silence{Severity: "warning"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.silence.Matches(a); got != tt.want {
+			t.Errorf("%+v.Matches = %v, want %v", tt.silence, got, tt.want)
+		}
+	}
+
+	// Rule alerts carry their expression; the metrics it references match
+	rule := models.Alert{Metric: "latency + jitter", Metrics: []string{"latency", "jitter"}, Rule: "slow-link"}
+	if !(Silence{Metric: "jitter"}).Matches(rule) || (Silence{Metric: "packet_loss"}).Matches(rule) {
+		t.Errorf("Expected a metric silence to match the rule's referenced metrics")
+	}
+}
+
+func TestSyncFlagsSilencedAlerts(t *testing.T) {
+	ctx := context.Background()
+	m, events := newTestManager(t)
+
+	now := time.Now()
+	s, err := m.CreateSilence(ctx, Silence{
+		ClinicID: "kisumu-*", Metric: "latency",
+		StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour),
+		CreatedBy: "12", Reason: "ISP fibre splicing",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := models.Alert{Severity: "warning", Detector: "cusum", Metric: "disk_usage"}
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(250), other}, now)
+
+	open, _ := m.List(ctx, Filter{States: OpenStates})
+	if len(open) != 2 {
+		t.Fatalf("Expected both alerts to be recorded, got %d", len(open))
+	}
+	for _, a := range open {
+		silenced := a.Metric == "latency"
+		if a.Silenced != silenced || (silenced && (len(a.SilencedBy) != 1 || a.SilencedBy[0] != s.ID)) {
+			t.Errorf("Alert %s: silenced = %v %v, want %v", a.Metric, a.Silenced, a.SilencedBy, silenced)
+		}
+	}
+	for _, e := range *events {
+		if e.Alert.Silenced != (e.Alert.Metric == "latency") {
+			t.Errorf("Event for %s has silenced = %v", e.Alert.Metric, e.Alert.Silenced)
+		}
+	}
+
+	// Silences survive a restart and can be cancelled
+	reloaded, err := NewManager(m.db, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := reloaded.Silences(time.Now(), true); len(active) != 1 || active[0].Reason != "ISP fibre splicing" {
+		t.Fatalf("Expected the silence to be reloaded, got %+v", active)
+	}
+	if _, err := reloaded.CancelSilence(ctx, s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.SilencedBy(models.Alert{ClinicID: "kisumu-east", Metric: "latency"}, time.Now())) != 0 {
+		t.Error("Expected a cancelled silence to stop matching")
+	}
+	if _, err := reloaded.CancelSilence(ctx, s.ID); err != ErrSilenceNotFound {
+		t.Errorf("Expected ErrSilenceNotFound, got %v", err)
+	}
+
+	// Cancelled silences are still reported for the time they were in effect
+	during, err := reloaded.SilencesDuring(ctx, "kisumu-east", now.Add(-time.Hour), now)
+	if err != nil || len(during) != 1 || during[0].CancelledAt == nil {
+		t.Errorf("Expected the cancelled silence, got %+v (%v)", during, err)
+	}
+	if during, _ := reloaded.SilencesDuring(ctx, "siaya", now.Add(-time.Hour), now); len(during) != 0 {
+		t.Errorf("Expected no silences for another clinic, got %+v", during)
+	}
+}
+
+func TestSyncReportsAlertsWhenSilenceEnds(t *testing.T) {
+	ctx := context.Background()
+	m, events := newTestManager(t)
+
+	if _, err := m.CreateSilence(ctx, Silence{
+		Metric: "latency", StartsAt: t0.Add(-time.Minute), EndsAt: t0.Add(2 * time.Minute),
+		CreatedBy: "12", Reason: "generator test",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(250)}, t0)
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(260)}, t0.Add(time.Minute))
+	if len(*events) != 1 || !(*events)[0].Alert.Silenced {
+		t.Fatalf("Expected one silenced firing event, got %+v", *events)
+	}
+
+	// The outage outlasts the maintenance window
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(270)}, t0.Add(3*time.Minute))
+	m.Sync(ctx, "kisumu-east", nil, []models.Alert{latencyRule(280)}, t0.Add(4*time.Minute))
+	if len(*events) != 2 {
+		t.Fatalf("Expected one more event once the silence ended, got %+v", *events)
+	}
+	e := (*events)[1]
+	if e.Change != ChangeUnsilenced || e.State != StateFiring || e.Alert.Silenced {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
@@ -0,0 +1,138 @@
+package analyzer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CacheConfig sets how long results that cost a model call are reused by
+// the endpoints dashboards poll
+type CacheConfig struct {
+	// A clinic scope's latest result is served for TTL, and for as long as
+	// its input is unchanged until TTL+StaleTTL. Caching is off when 0.
+	TTL time.Duration `yaml:"ttl"`
+	// After TTL, a result for older input is still served for StaleTTL
+	// while a fresh one is computed in the background
+	StaleTTL time.Duration `yaml:"stale_ttl"`
+}
+
+// CacheStats counts how cached results were served
+type CacheStats struct {
+	Hits          int `json:"hits"`
+	StaleHits     int `json:"stale_hits"`
+	Misses        int `json:"misses"`
+	Revalidations int `json:"revalidations"` // Background refreshes started
+	Errors        int `json:"errors"`
+	Entries       int `json:"entries"`
+}
+
+// resultCache keeps the latest result per scope, keyed by the hash of the
+// input it was computed from. Concurrent requests for the same scope and
+// input share one computation.
+type resultCache struct {
+	config CacheConfig
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry  // By scope
+	flights map[string]*cacheFlight // By scope and hash
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	hash  string
+	value interface{}
+	at    time.Time
+}
+
+type cacheFlight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// newResultCache returns nil when config disables caching
+func newResultCache(config CacheConfig) *resultCache {
+	if config.TTL <= 0 {
+		return nil
+	}
+	return &resultCache{
+		config:  config,
+		entries: make(map[string]*cacheEntry),
+		flights: make(map[string]*cacheFlight),
+	}
+}
+
+// get returns the result for scope and the input with hash, calling compute
+// when no cached one may be served. cached reports whether the result was
+// served from the cache. Computations are not cancelled when the caller
+// gives up, so compute must bound its own calls.
+func (c *resultCache) get(ctx context.Context, scope, hash string, compute func(context.Context) (interface{}, error)) (value interface{}, cached bool, err error) {
+	now := time.Now()
+	expires := c.config.TTL + c.config.StaleTTL
+
+	c.mu.Lock()
+	if e := c.entries[scope]; e != nil {
+		age := now.Sub(e.at)
+		switch {
+		case age < c.config.TTL || (e.hash == hash && age < expires):
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.value, true, nil
+		case age < expires:
+			c.stats.StaleHits++
+			if _, started := c.flight(scope, hash, compute); started {
+				c.stats.Revalidations++
+			}
+			c.mu.Unlock()
+			return e.value, true, nil
+		}
+	}
+	c.stats.Misses++
+	f, _ := c.flight(scope, hash, compute)
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, false, f.err
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// flight starts computing the result for scope and hash unless that is
+// already under way. c.mu must be held.
+func (c *resultCache) flight(scope, hash string, compute func(context.Context) (interface{}, error)) (f *cacheFlight, started bool) {
+	key := scope + "\x00" + hash
+	if f := c.flights[key]; f != nil {
+		return f, false
+	}
+	f = &cacheFlight{done: make(chan struct{})}
+	c.flights[key] = f
+
+	go func() {
+		f.value, f.err = compute(context.Background())
+
+		c.mu.Lock()
+		delete(c.flights, key)
+		if f.err != nil {
+			c.stats.Errors++
+		} else {
+			c.entries[scope] = &cacheEntry{hash: hash, value: f.value, at: time.Now()}
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+	return f, true
+}
+
+func (c *resultCache) snapshot() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
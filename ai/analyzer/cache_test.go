@@ -0,0 +1,136 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func TestResultCache(t *testing.T) {
+	c := newResultCache(CacheConfig{TTL: time.Minute, StaleTTL: time.Minute})
+	calls := 0
+	compute := func(value string) func(context.Context) (interface{}, error) {
+		return func(context.Context) (interface{}, error) {
+			calls++
+			return value, nil
+		}
+	}
+	get := func(hash, value string) (interface{}, bool) {
+		t.Helper()
+		v, cached, err := c.get(context.Background(), "scope", hash, compute(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v, cached
+	}
+	age := func(d time.Duration) {
+		c.mu.Lock()
+		c.entries["scope"].at = time.Now().Add(-d)
+		c.mu.Unlock()
+	}
+	wait := func() {
+		// Let a background revalidation finish
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			c.mu.Lock()
+			n := len(c.flights)
+			c.mu.Unlock()
+			if n == 0 {
+				return
+			}
+		}
+		t.Fatal("Revalidation did not finish")
+	}
+
+	if v, cached := get("h1", "first"); v != "first" || cached {
+		t.Fatalf("Expected a computed result, got %v (cached %v)", v, cached)
+	}
+
+	// Within the TTL, even changed input is served from the cache
+	if v, cached := get("h2", "second"); v != "first" || !cached {
+		t.Errorf("Expected a fresh hit, got %v (cached %v)", v, cached)
+	}
+
+	// Past the TTL, unchanged input is still served
+	age(90 * time.Second)
+	if v, cached := get("h1", "second"); v != "first" || !cached {
+		t.Errorf("Expected a hit on unchanged input, got %v (cached %v)", v, cached)
+	}
+
+	// Changed input gets the stale result while a fresh one is computed
+	if v, cached := get("h2", "second"); v != "first" || !cached {
+		t.Errorf("Expected a stale hit, got %v (cached %v)", v, cached)
+	}
+	wait()
+	if v, _ := get("h2", "third"); v != "second" {
+		t.Errorf("Expected the revalidated result, got %v", v)
+	}
+
+	// Past TTL+StaleTTL the caller waits for a new result
+	age(3 * time.Minute)
+	if v, cached := get("h2", "fourth"); v != "fourth" || cached {
+		t.Errorf("Expected a recomputed result, got %v (cached %v)", v, cached)
+	}
+
+	stats := c.snapshot()
+	if calls != 3 || stats.Hits != 3 || stats.StaleHits != 1 || stats.Misses != 2 || stats.Revalidations != 1 {
+		t.Errorf("Unexpected stats %+v after %d calls", stats, calls)
+	}
+}
+
+func TestAnalyzeCached(t *testing.T) {
+	llm := &FakeLLM{Reply: func(LLMRequest) (string, error) {
+		return `{"alerts": [{"severity": "warning", "description": "CPU is high", "recommended": "Check"}]}`, nil
+	}}
+	a := NewAnalyzer(llm, 0.5, 0)
+	a.EnableCache(CacheConfig{TTL: time.Minute})
+
+	window := overloadedWindow()
+	for i := range window {
+		window[i].ClinicID = "a"
+	}
+	first, err := a.AnalyzeCached(context.Background(), window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Alerts[0].ClinicID = "a" // As the handler annotates them
+
+	second, err := a.AnalyzeCached(context.Background(), window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Cached || !second.Cached {
+		t.Errorf("Expected the second analysis to be cached, got %v then %v", first.Cached, second.Cached)
+	}
+	if second.Alerts[0].ClinicID != "" {
+		t.Error("Expected annotating a result to leave the cached one unchanged")
+	}
+
+	// Another clinic is analyzed separately
+	for i := range window {
+		window[i].ClinicID = "b"
+	}
+	if third, _ := a.AnalyzeCached(context.Background(), window); third.Cached {
+		t.Error("Expected a separate analysis for another clinic")
+	}
+	if n := len(llm.Requests()); n != 2 {
+		t.Errorf("Expected 2 model calls, got %d", n)
+	}
+}
+
+func TestAnalyzeCachedDisabled(t *testing.T) {
+	llm := &FakeLLM{}
+	a := NewAnalyzer(llm, 0.5, 0)
+	a.EnableCache(CacheConfig{})
+
+	window := []models.Metrics{{ClinicID: "a", CPUUsage: 10}}
+	for i := 0; i < 2; i++ {
+		if analysis, err := a.AnalyzeCached(context.Background(), window); err != nil || analysis.Cached {
+			t.Fatalf("Unexpected analysis %+v, %v", analysis, err)
+		}
+	}
+	if n := len(llm.Requests()); n != 2 {
+		t.Errorf("Expected every analysis to call the model, got %d calls", n)
+	}
+}
@@ -0,0 +1,377 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Replaying the recordings needs no model. Each records the version of the
+// alerts prompt it was made with, and fails to replay once the template has
+// changed. Record fresh responses from a real model then, and review the
+// diff; never edit a recording's keys or version by hand:
+//
+//	GEMINI_API_KEY=... go test ./analyzer -run TestAlertEval -record
+//
+// EVAL_PROVIDER, EVAL_MODEL and EVAL_BASE_URL select another model.
+// Recordings marked seed were written by hand to exercise the replay and
+// scoring. They answer whatever prompt is sent, in order, so they carry no
+// keys or prompt version; their scores are logged but kept out of the
+// quality gate, which is only evaluated over responses recorded from a
+// model.
+var record = flag.Bool("record", false, "record LLM responses for the alert evaluation")
+
+// Minimum scores of the replayed model recordings. The prompt has no disk
+// usage, so the disk full scenario is a known miss.
+const (
+	minEvalPrecision = 0.9
+	minEvalRecall    = 0.8
+)
+
+// evalScenario is a labelled window of samples: the severity each metric
+// should be classified at, and no alert for the rest
+type evalScenario struct {
+	name    string
+	metrics []models.Metrics
+	want    map[string]string // Metric to severity
+}
+
+// evalMetrics are the metrics scored, with the words that tie a model's
+// alert to them
+var evalMetrics = []struct{ metric, keyword string }{
+	{"cpu_usage", "cpu"},
+	{"memory_usage", "memory"},
+	{"latency", "latency"},
+	{"bandwidth", "bandwidth"},
+	{"disk_usage", "disk"},
+}
+
+func evalScenarios() []evalScenario {
+	const mb = 1024 * 1024
+	window := func(sample func(i int) models.Metrics) []models.Metrics {
+		start := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+		metrics := make([]models.Metrics, 30)
+		for i := range metrics {
+			m := sample(i)
+			m.ClinicID = "eval"
+			m.Timestamp = start.Add(time.Duration(i) * 6 * time.Second)
+			if m.MemoryUsage == 0 {
+				m.MemoryUsage = 45 + float64(i%3)
+			}
+			if m.DiskUsage == 0 {
+				m.DiskUsage = 60
+			}
+			metrics[i] = m
+		}
+		return metrics
+	}
+
+	return []evalScenario{
+		{
+			name: "normal",
+			metrics: window(func(i int) models.Metrics {
+				return models.Metrics{CPUUsage: 20 + float64(i%5), Latency: 40 + float64(i%7), BytesRecvRate: 2 * mb}
+			}),
+			want: map[string]string{},
+		},
+		{
+			name: "congestion",
+			metrics: window(func(i int) models.Metrics {
+				return models.Metrics{CPUUsage: 35, Latency: 120 + 5*float64(i), BytesRecvRate: float64(300+20*i) * mb}
+			}),
+			want: map[string]string{"bandwidth": "critical", "latency": "critical"},
+		},
+		{
+			name: "link_flap",
+			metrics: window(func(i int) models.Metrics {
+				m := models.Metrics{CPUUsage: 25, Latency: 50, BytesRecvRate: mb}
+				switch i % 6 {
+				case 2, 3:
+					m.Unreachable, m.Latency = true, 0
+				case 4:
+					m.Latency = 400 // Recovering
+				}
+				return m
+			}),
+			want: map[string]string{"latency": "critical"},
+		},
+		{
+			name: "cpu_runaway",
+			metrics: window(func(i int) models.Metrics {
+				return models.Metrics{CPUUsage: 30 + 2.3*float64(i), Latency: 60, BytesRecvRate: 3 * mb}
+			}),
+			want: map[string]string{"cpu_usage": "critical"},
+		},
+		{
+			name: "disk_full",
+			metrics: window(func(i int) models.Metrics {
+				return models.Metrics{CPUUsage: 25, Latency: 50, BytesRecvRate: 2 * mb, DiskUsage: 97 + 0.1*float64(i)}
+			}),
+			want: map[string]string{"disk_usage": "critical"},
+		},
+	}
+}
+
+// recording is the model's responses to one scenario's requests
+type recording struct {
+	Scenario      string             `json:"scenario"`
+	Seed          bool               `json:"seed,omitempty"`           // Written by hand, not recorded
+	PromptVersion string             `json:"prompt_version,omitempty"` // Of the alerts template
+	Requests      []recordedExchange `json:"requests"`
+}
+
+// check rejects a model recording made with another version of the alerts
+// prompt than the current one
+func (rec recording) check() error {
+	if rec.Seed {
+		return nil
+	}
+	if current := defaultPrompts.Version(PromptAlerts); rec.PromptVersion != current {
+		return fmt.Errorf("recorded with prompt %q, but the current one is %s; record again with -record",
+			rec.PromptVersion, current)
+	}
+	return nil
+}
+
+type recordedExchange struct {
+	Key    string `json:"key,omitempty"`
+	Prompt string `json:"prompt,omitempty"` // For reviewing re-recordings
+	Text   string `json:"text"`
+	Model  string `json:"model"`
+}
+
+// recordedLLM replays a recording, or with llm set, calls it and records
+// the responses
+type recordedLLM struct {
+	llm LLMClient
+
+	mu       sync.Mutex
+	rec      recording
+	replayed map[string]recordedExchange
+	next     int // Next seed response
+	missing  []string
+}
+
+func (r *recordedLLM) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	key, err := requestKey(req)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+
+	if r.llm != nil {
+		resp, err := r.llm.Generate(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		r.mu.Lock()
+		r.rec.Requests = append(r.rec.Requests, recordedExchange{Key: key, Prompt: req.Prompt, Text: resp.Text, Model: resp.Model})
+		r.mu.Unlock()
+		return resp, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rec.Seed {
+		if r.next >= len(r.rec.Requests) {
+			r.missing = append(r.missing, req.Prompt)
+			return LLMResponse{}, fmt.Errorf("no seed response left for this prompt")
+		}
+		exchange := r.rec.Requests[r.next]
+		r.next++
+		return LLMResponse{Text: exchange.Text, Model: exchange.Model}, nil
+	}
+	exchange, ok := r.replayed[key]
+	if !ok {
+		r.missing = append(r.missing, req.Prompt)
+		return LLMResponse{}, fmt.Errorf("no recorded response for this prompt")
+	}
+	return LLMResponse{Text: exchange.Text, Model: exchange.Model}, nil
+}
+
+func recordingPath(scenario string) string {
+	return filepath.Join("testdata", "eval", scenario+".json")
+}
+
+// evalLLM returns the client a scenario is analyzed with
+func evalLLM(t *testing.T, scenario string) *recordedLLM {
+	t.Helper()
+	if *record {
+		llm, err := NewLLMClient(LLMConfig{
+			Provider: os.Getenv("EVAL_PROVIDER"),
+			Model:    os.Getenv("EVAL_MODEL"),
+			BaseURL:  os.Getenv("EVAL_BASE_URL"),
+		})
+		if err != nil {
+			t.Fatalf("Cannot record without a model: %v", err)
+		}
+		return &recordedLLM{llm: llm, rec: recording{Scenario: scenario, PromptVersion: defaultPrompts.Version(PromptAlerts)}}
+	}
+
+	data, err := os.ReadFile(recordingPath(scenario))
+	if err != nil {
+		t.Fatalf("No recording for %s, record one with -record: %v", scenario, err)
+	}
+	r := &recordedLLM{replayed: make(map[string]recordedExchange)}
+	if err := json.Unmarshal(data, &r.rec); err != nil {
+		t.Fatalf("Invalid recording for %s: %v", scenario, err)
+	}
+	if err := r.rec.check(); err != nil {
+		t.Fatalf("%s: %v", scenario, err)
+	}
+	for _, exchange := range r.rec.Requests {
+		r.replayed[exchange.Key] = exchange
+	}
+	return r
+}
+
+func (r *recordedLLM) save(t *testing.T) {
+	t.Helper()
+	// Keep the prompts readable in diffs
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r.rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(recordingPath(r.rec.Scenario)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(recordingPath(r.rec.Scenario), b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// classify returns the highest severity the alerts give each metric. Rule
+// alerts name their metric; the model's are matched by description. Info
+// alerts do not count.
+func classify(alerts []models.Alert) map[string]string {
+	rank := map[string]int{"warning": 1, "critical": 2}
+	got := make(map[string]string)
+	for _, alert := range alerts {
+		if rank[alert.Severity] == 0 {
+			continue
+		}
+		description := strings.ToLower(alert.Description)
+		for _, m := range evalMetrics {
+			if alert.Metric == m.metric || (alert.Metric == "" && strings.Contains(description, m.keyword)) {
+				if rank[alert.Severity] > rank[got[m.metric]] {
+					got[m.metric] = alert.Severity
+				}
+			}
+		}
+	}
+	return got
+}
+
+// evalScore counts severity classifications over metrics and scenarios. A
+// metric classified at the wrong severity counts against both precision
+// and recall.
+type evalScore struct {
+	truePositives, predicted, expected int
+}
+
+func (s *evalScore) add(want, got map[string]string) {
+	for _, m := range evalMetrics {
+		w, g := want[m.metric], got[m.metric]
+		if w != "" {
+			s.expected++
+		}
+		if g != "" {
+			s.predicted++
+		}
+		if w != "" && w == g {
+			s.truePositives++
+		}
+	}
+}
+
+func (s evalScore) precision() float64 {
+	if s.predicted == 0 {
+		return 1
+	}
+	return float64(s.truePositives) / float64(s.predicted)
+}
+
+func (s evalScore) recall() float64 {
+	if s.expected == 0 {
+		return 1
+	}
+	return float64(s.truePositives) / float64(s.expected)
+}
+
+// TestAlertEval replays labelled scenarios through the real prompt, model
+// response parsing and rule fallback, and scores the severity of the alerts
+// for each metric
+func TestAlertEval(t *testing.T) {
+	var total, seeds evalScore
+	recorded := 0
+	for _, scenario := range evalScenarios() {
+		llm := evalLLM(t, scenario.name)
+		analysis, err := NewAnalyzer(llm, 0.5, time.Minute).Analyze(context.Background(), scenario.metrics)
+		if err != nil {
+			t.Fatalf("%s: %v", scenario.name, err)
+		}
+		if *record {
+			llm.save(t)
+		} else if len(llm.missing) > 0 {
+			t.Fatalf("%s: no recorded response for the prompt; record again with -record. Prompt:\n%s",
+				scenario.name, llm.missing[0])
+		}
+		if analysis.Source == SourceRules {
+			t.Errorf("%s: the model's response was not used: %s", scenario.name, analysis.LLMError)
+		}
+
+		got := classify(analysis.Alerts)
+		var score evalScore
+		score.add(scenario.want, got)
+		source := "recorded"
+		if llm.rec.Seed {
+			source = "seed"
+			seeds.add(scenario.want, got)
+		} else {
+			recorded++
+			total.add(scenario.want, got)
+		}
+		t.Logf("%-12s %-8s precision %.2f recall %.2f: want %v, got %v",
+			scenario.name, source, score.precision(), score.recall(), scenario.want, got)
+	}
+
+	if seeds.expected+seeds.predicted > 0 {
+		t.Logf("Seed precision %.2f, recall %.2f (not gated)", seeds.precision(), seeds.recall())
+	}
+	if recorded == 0 {
+		t.Skip("Alert quality not evaluated: every recording is a hand-written seed; record a model's responses with -record")
+	}
+	t.Logf("Overall precision %.2f, recall %.2f over %d recorded scenarios", total.precision(), total.recall(), recorded)
+	if total.precision() < minEvalPrecision || total.recall() < minEvalRecall {
+		t.Errorf("Alert quality regressed: precision %.2f (minimum %.2f), recall %.2f (minimum %.2f)",
+			total.precision(), minEvalPrecision, total.recall(), minEvalRecall)
+	}
+}
+
+func TestRecordingPromptVersion(t *testing.T) {
+	current := defaultPrompts.Version(PromptAlerts)
+	if err := (recording{PromptVersion: current}).check(); err != nil {
+		t.Errorf("Expected a recording of the current prompt to replay, got %v", err)
+	}
+	if err := (recording{PromptVersion: "alerts.en@000000000000"}).check(); err == nil {
+		t.Error("Expected a recording of an older prompt to be rejected")
+	}
+	if err := (recording{}).check(); err == nil {
+		t.Error("Expected a recording without a prompt version to be rejected")
+	}
+	if err := (recording{Seed: true}).check(); err != nil {
+		t.Errorf("Expected seeds to replay against any prompt, got %v", err)
+	}
+}
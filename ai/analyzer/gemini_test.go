@@ -1,77 +1,25 @@
 package analyzer
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/Evarest-ke/healthnetai/models"
 )
 
-// MockModel simulates the Gemini API for testing
-type MockModel struct {
-	generateFunc func(ctx context.Context, input string) (*MockResponse, error)
-}
-
-// MockResponse simulates the API response
-type MockResponse struct {
-	Content string
-}
-
-// GenerateContent simulates the Gemini API's GenerateContent method
-func (m *MockModel) GenerateContent(ctx context.Context, input string) (*MockResponse, error) {
-	if m.generateFunc != nil {
-		return m.generateFunc(ctx, input)
-	}
-	// Default mock response
-	return &MockResponse{Content: `[{"severity":"critical","description":"Latency has exceeded 200ms.","recommended":"Investigate network bottlenecks."}]`}, nil
-}
-
-// MockAnalyzer simulates the Analyzer for testing
-type MockAnalyzer struct {
-	model     *MockModel
-	threshold float64
-}
-
-// NewMockAnalyzer creates a new MockAnalyzer for testing
-func NewMockAnalyzer(threshold float64) *MockAnalyzer {
-	return &MockAnalyzer{
-		model:     &MockModel{},
-		threshold: threshold,
-	}
-}
-
-// AnalyzeMetrics simulates the Analyzer's AnalyzeMetrics method
-func (a *MockAnalyzer) AnalyzeMetrics(metrics []models.Metrics) ([]models.Alert, error) {
-	if len(metrics) == 0 {
-		return nil, fmt.Errorf("no metrics to analyze")
-	}
-
-	// Simulate behavior based on metrics
-	var response string
-	if metrics[0].Latency > 200 {
-		response = `[{"severity":"critical","description":"Latency has exceeded 200ms.","recommended":"Investigate network bottlenecks."}]`
-	} else {
-		response = "[]"
-	}
-
-	resp, err := a.model.GenerateContent(context.Background(), response)
-	if err != nil {
-		return nil, err
-	}
+const latencyAlertJSON = `[{"severity":"critical","description":"Latency has exceeded 200ms.","recommended":"Investigate network bottlenecks."}]`
 
-	var alerts []models.Alert
-	if err := json.Unmarshal([]byte(resp.Content), &alerts); err != nil {
-		return nil, err
-	}
-	return alerts, nil
+// newTestAnalyzer returns an Analyzer whose model always answers reply
+func newTestAnalyzer(reply string, err error) (*Analyzer, *FakeLLM) {
+	llm := &FakeLLM{Reply: func(LLMRequest) (string, error) { return reply, err }}
+	return NewAnalyzer(llm, 0.5, 0), llm
 }
 
 // TestAnalyzeMetrics tests the AnalyzeMetrics function with valid metrics
 func TestAnalyzeMetrics(t *testing.T) {
-	analyzer := NewMockAnalyzer(0.5)
+	analyzer, llm := newTestAnalyzer(latencyAlertJSON, nil)
 
 	// Case: Metrics exceeding thresholds
 	metrics := []models.Metrics{
@@ -94,14 +42,25 @@ func TestAnalyzeMetrics(t *testing.T) {
 		Recommended: "Investigate network bottlenecks.",
 	}
 
-	if len(alerts) != 1 || alerts[0] != expectedAlert {
+	if len(alerts) != 1 || !reflect.DeepEqual(alerts[0], expectedAlert) {
 		t.Errorf("Unexpected alerts received: got %v, want %v", alerts, expectedAlert)
 	}
+
+	// The prompt summarises the window and states the thresholds
+	requests := llm.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("Expected one LLM request, got %d", len(requests))
+	}
+	for _, want := range []string{"Latency: 275.00ms", "Critical: CPU > 80%", "array of alerts"} {
+		if !strings.Contains(requests[0].Prompt, want) {
+			t.Errorf("Prompt is missing %q:\n%s", want, requests[0].Prompt)
+		}
+	}
 }
 
 // TestEmptyMetrics tests the AnalyzeMetrics function with no metrics
 func TestEmptyMetrics(t *testing.T) {
-	analyzer := NewMockAnalyzer(0.5)
+	analyzer, llm := newTestAnalyzer(latencyAlertJSON, nil)
 	alerts, err := analyzer.AnalyzeMetrics([]models.Metrics{})
 
 	if err == nil {
@@ -111,18 +70,15 @@ func TestEmptyMetrics(t *testing.T) {
 	if len(alerts) != 0 {
 		t.Fatalf("Expected no alerts for empty metrics, got: %v", alerts)
 	}
+
+	if len(llm.Requests()) != 0 {
+		t.Errorf("Expected no LLM request for empty metrics")
+	}
 }
 
 // TestLowMetrics tests the AnalyzeMetrics function with metrics below thresholds
 func TestLowMetrics(t *testing.T) {
-	analyzer := &MockAnalyzer{
-		model: &MockModel{
-			generateFunc: func(ctx context.Context, input string) (*MockResponse, error) {
-				return &MockResponse{Content: "[]"}, nil
-			},
-		},
-		threshold: 0.5,
-	}
+	analyzer, _ := newTestAnalyzer("[]", nil)
 
 	metrics := []models.Metrics{
 		{CPUUsage: 10.0, MemoryUsage: 20.0, Latency: 50.0, BytesSent: 1024, BytesReceived: 1024},
@@ -140,14 +96,7 @@ func TestLowMetrics(t *testing.T) {
 
 // TestInvalidJSONResponse tests the AnalyzeMetrics function with an invalid JSON response
 func TestInvalidJSONResponse(t *testing.T) {
-	analyzer := &MockAnalyzer{
-		model: &MockModel{
-			generateFunc: func(ctx context.Context, input string) (*MockResponse, error) {
-				return &MockResponse{Content: "invalid-json"}, nil
-			},
-		},
-		threshold: 0.5,
-	}
+	analyzer, _ := newTestAnalyzer("invalid-json", nil)
 
 	metrics := []models.Metrics{
 		{CPUUsage: 50.0, MemoryUsage: 60.0, Latency: 250.0, BytesSent: 1024 * 1024, BytesReceived: 2048 * 1024},
@@ -166,14 +115,7 @@ func TestInvalidJSONResponse(t *testing.T) {
 
 // TestErrorFromModel tests the AnalyzeMetrics function when the model returns an error
 func TestErrorFromModel(t *testing.T) {
-	analyzer := &MockAnalyzer{
-		model: &MockModel{
-			generateFunc: func(ctx context.Context, input string) (*MockResponse, error) {
-				return nil, errors.New("simulated error from model")
-			},
-		},
-		threshold: 0.5,
-	}
+	analyzer, _ := newTestAnalyzer("", errors.New("simulated error from model"))
 
 	metrics := []models.Metrics{
 		{CPUUsage: 50.0, MemoryUsage: 60.0, Latency: 250.0, BytesSent: 1024 * 1024, BytesReceived: 2048 * 1024},
@@ -192,14 +134,7 @@ func TestErrorFromModel(t *testing.T) {
 
 // TestEmptyAlertsArray tests the AnalyzeMetrics function when the API returns an empty alerts array
 func TestEmptyAlertsArray(t *testing.T) {
-	analyzer := &MockAnalyzer{
-		model: &MockModel{
-			generateFunc: func(ctx context.Context, input string) (*MockResponse, error) {
-				return &MockResponse{Content: "[]"}, nil
-			},
-		},
-		threshold: 0.5,
-	}
+	analyzer, _ := newTestAnalyzer("[]", nil)
 
 	metrics := []models.Metrics{
 		{CPUUsage: 50.0, MemoryUsage: 60.0, Latency: 250.0, BytesSent: 1024 * 1024, BytesReceived: 2048 * 1024},
@@ -214,4 +149,56 @@ func TestEmptyAlertsArray(t *testing.T) {
 	if len(alerts) != 0 {
 		t.Fatalf("Expected no alerts but got: %v", alerts)
 	}
-}
\ No newline at end of file
+}
+
+// TestRepairPrompt tests that an unusable response is retried once with a repair prompt
+func TestRepairPrompt(t *testing.T) {
+	replies := []string{
+		`I found one problem: {"alerts": [{"severity": "severe", "description": "CPU at 90%"}]}`,
+		"```json\n" + `{"alerts": [{"severity": "critical", "description": "CPU at 90%", "recommended": "Check processes"}]}` + "\n```",
+	}
+	llm := &FakeLLM{Reply: func(LLMRequest) (string, error) {
+		reply := replies[0]
+		replies = replies[1:]
+		return reply, nil
+	}}
+	analyzer := NewAnalyzer(llm, 0.5, 0)
+
+	alerts, err := analyzer.AnalyzeMetrics([]models.Metrics{{CPUUsage: 90}})
+	if err != nil {
+		t.Fatalf("AnalyzeMetrics returned an error: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Severity != "critical" {
+		t.Errorf("Unexpected alerts %v", alerts)
+	}
+
+	requests := llm.Requests()
+	if len(requests) != 2 || requests[0].Schema != alertsSchema || requests[1].Schema != alertsSchema {
+		t.Fatalf("Expected two schema-constrained requests, got %d", len(requests))
+	}
+	if !strings.Contains(requests[1].Prompt, `severity must be one of info, warning, critical (got "severe")`) {
+		t.Errorf("Repair prompt does not explain the problem:\n%s", requests[1].Prompt)
+	}
+
+	stats := analyzer.ParseStats()
+	if stats.Responses != 2 || stats.Parsed != 0 || stats.Repaired != 1 || stats.Failed != 0 || stats.Errors[ErrSchema.Error()] != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+// TestRepairFails tests that a response still unusable after repair surfaces as a ParseError
+func TestRepairFails(t *testing.T) {
+	analyzer, llm := newTestAnalyzer("The network looks healthy.", nil)
+
+	alerts, err := analyzer.AnalyzeMetrics([]models.Metrics{{CPUUsage: 10}})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrNoJSON) || parseErr.Raw != "The network looks healthy." {
+		t.Fatalf("Expected a ParseError wrapping ErrNoJSON, got %v", err)
+	}
+	if alerts != nil || len(llm.Requests()) != 2 {
+		t.Errorf("Expected no alerts after two requests, got %v after %d", alerts, len(llm.Requests()))
+	}
+	if stats := analyzer.ParseStats(); stats.Failed != 1 || stats.Errors[ErrNoJSON.Error()] != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,187 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// IncidentContext is what the model is shown when explaining an alert
+type IncidentContext struct {
+	AlertID  string       `json:"alert_id"`
+	State    string       `json:"state"`
+	StartsAt time.Time    `json:"starts_at"`
+	Alert    models.Alert `json:"alert"`
+
+	// Per-metric statistics for the windows before and after onset
+	Window time.Duration          `json:"-"`
+	Before map[string]WindowStats `json:"before_onset"`
+	After  map[string]WindowStats `json:"after_onset"`
+	// Types of injected faults seen in either window
+	InjectedFaults []string `json:"injected_faults,omitempty"`
+
+	TerrainFactor   float64                 `json:"terrain_factor,omitempty"`
+	Related         []RelatedAlert          `json:"related_alerts"`
+	EmergencyShares []models.EmergencyShare `json:"emergency_shares"`
+	Maintenance     []MaintenanceWindow     `json:"maintenance_windows"`
+}
+
+// WindowStats summarises one metric over a window
+type WindowStats struct {
+	Samples int     `json:"samples"`
+	Min     float64 `json:"min"`
+	Avg     float64 `json:"avg"`
+	Max     float64 `json:"max"`
+}
+
+// RelatedAlert is another alert that started near the incident, at the
+// same clinic or a nearby one
+type RelatedAlert struct {
+	AlertID       string    `json:"alert_id"`
+	ClinicID      string    `json:"clinic_id"`
+	DistanceKm    float64   `json:"distance_km"`
+	TerrainFactor float64   `json:"terrain_factor,omitempty"` // Between the two clinics
+	Severity      string    `json:"severity"`
+	Metric        string    `json:"metric,omitempty"`
+	Description   string    `json:"description"`
+	State         string    `json:"state"`
+	StartsAt      time.Time `json:"starts_at"`
+}
+
+// MaintenanceWindow is a silence that covered the clinic around onset
+type MaintenanceWindow struct {
+	ID         string    `json:"id"`
+	Metric     string    `json:"metric,omitempty"`
+	Reason     string    `json:"reason"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	Recurrence string    `json:"recurrence,omitempty"`
+	Cancelled  bool      `json:"cancelled,omitempty"`
+}
+
+// RootCause is one probable cause of an incident
+type RootCause struct {
+	Cause      string   `json:"cause"`
+	Confidence float64  `json:"confidence"` // 0 to 1
+	Evidence   []string `json:"evidence"`
+	NextSteps  []string `json:"next_steps"`
+}
+
+// Explanation is the model's root-cause analysis of an alert
+type Explanation struct {
+	AlertID     string          `json:"alert_id"`
+	Summary     string          `json:"summary"`
+	Causes      []RootCause     `json:"causes"` // Most probable first
+	Model       string          `json:"model"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Context     IncidentContext `json:"context"`
+}
+
+// explanationSchema is the response format for ExplainIncident
+var explanationSchema = objectSchema(map[string]*Schema{
+	"summary": {Type: SchemaString},
+	"causes": {
+		Type: SchemaArray,
+		Items: objectSchema(map[string]*Schema{
+			"cause":      {Type: SchemaString},
+			"confidence": {Type: SchemaNumber, Description: "Probability from 0 to 1"},
+			"evidence":   {Type: SchemaArray, Items: &Schema{Type: SchemaString}},
+			"next_steps": {Type: SchemaArray, Items: &Schema{Type: SchemaString}},
+		}),
+	},
+})
+
+const explanationFormat = `a JSON object of the form {"summary": "...", "causes": [...]}, where each cause has "cause", "confidence" (0 to 1), "evidence" and "next_steps" (arrays of strings)`
+
+// ExplainIncident asks the model for the probable root causes of an alert,
+// ranked by confidence
+func (a *Analyzer) ExplainIncident(ctx context.Context, ic IncidentContext) (Explanation, error) {
+	if a.llm == nil {
+		return Explanation{}, ErrNoLLM
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	data, err := json.MarshalIndent(ic, "", "  ")
+	if err != nil {
+		return Explanation{}, fmt.Errorf("failed to encode incident context: %v", err)
+	}
+	prompt := fmt.Sprintf(`You are helping the on-call ICT officer of a rural health clinic network in Kisumu County, Kenya diagnose an alert.
+
+The context below has the alert, statistics for each metric over the %v before and after it started, alerts at the same or nearby clinics around the same time (with distance and terrain obstruction between the clinics, where 1 is clear line of sight), recent emergency bandwidth sharing involving the clinic, and maintenance windows covering it. Injected faults are deliberate drills.
+
+Rank the most probable root causes, most likely first. For each, give a confidence from 0 to 1, the evidence from the context that supports it, and the next diagnostic steps an ICT officer on site should take. Only cite evidence that is in the context. Start with a one-sentence summary.
+
+Context:
+%s`, ic.Window, data)
+
+	resp, err := a.llm.Generate(ctx, LLMRequest{Prompt: prompt, Schema: explanationSchema, Purpose: "incident"})
+	if err != nil {
+		return Explanation{}, err
+	}
+	a.counters.add(func(s *ParseStats) { s.Responses++ })
+
+	explanation, parseErr := parseExplanation(resp.Text)
+	if parseErr != nil {
+		a.counters.recordError(parseErr)
+		log.Printf("Unusable LLM explanation, retrying with a repair prompt: %v", parseErr)
+
+		resp, err = a.llm.Generate(ctx, LLMRequest{Prompt: repairPrompt(prompt, resp.Text, parseErr, explanationFormat), Schema: explanationSchema, Purpose: "incident"})
+		if err != nil {
+			a.counters.add(func(s *ParseStats) { s.Failed++ })
+			return Explanation{}, err
+		}
+		a.counters.add(func(s *ParseStats) { s.Responses++ })
+
+		if explanation, parseErr = parseExplanation(resp.Text); parseErr != nil {
+			a.counters.recordError(parseErr)
+			a.counters.add(func(s *ParseStats) { s.Failed++ })
+			return Explanation{}, parseErr
+		}
+		a.counters.add(func(s *ParseStats) { s.Repaired++ })
+	} else {
+		a.counters.add(func(s *ParseStats) { s.Parsed++ })
+	}
+
+	explanation.AlertID = ic.AlertID
+	explanation.Model = resp.Model
+	explanation.GeneratedAt = time.Now()
+	explanation.Context = ic
+	return explanation, nil
+}
+
+// parseExplanation reads and checks a root-cause analysis, ordering the
+// causes by confidence
+func parseExplanation(text string) (Explanation, error) {
+	raw, err := extractJSON(text)
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	var e Explanation
+	if err := json.Unmarshal([]byte(raw), &e); err != nil {
+		return Explanation{}, &ParseError{Kind: ErrSchema, Detail: err.Error(), Raw: text}
+	}
+	if len(e.Causes) == 0 {
+		return Explanation{}, &ParseError{Kind: ErrSchema, Detail: "at least one cause is required", Raw: text}
+	}
+	for i, c := range e.Causes {
+		if strings.TrimSpace(c.Cause) == "" {
+			return Explanation{}, &ParseError{Kind: ErrSchema, Detail: fmt.Sprintf("cause %d: cause is required", i+1), Raw: text}
+		}
+		if c.Confidence < 0 || c.Confidence > 1 {
+			return Explanation{}, &ParseError{Kind: ErrSchema,
+				Detail: fmt.Sprintf("cause %d: confidence must be between 0 and 1 (got %v)", i+1, c.Confidence), Raw: text}
+		}
+	}
+	sort.SliceStable(e.Causes, func(i, j int) bool {
+		return e.Causes[i].Confidence > e.Causes[j].Confidence
+	})
+	return e, nil
+}
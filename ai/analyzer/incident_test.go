@@ -0,0 +1,72 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseExplanation(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		causes []string
+		err    error
+	}{
+		{"ranked by confidence", `{"summary": "s", "causes": [{"cause": "a", "confidence": 0.2}, {"cause": "b", "confidence": 0.7}]}`, []string{"b", "a"}, nil},
+		{"fenced", "```json\n" + `{"summary": "s", "causes": [{"cause": "a", "confidence": 1}]}` + "\n```", []string{"a"}, nil},
+		{"no causes", `{"summary": "s", "causes": []}`, nil, ErrSchema},
+		{"empty cause", `{"summary": "s", "causes": [{"cause": " ", "confidence": 0.5}]}`, nil, ErrSchema},
+		{"percent confidence", `{"summary": "s", "causes": [{"cause": "a", "confidence": 70}]}`, nil, ErrSchema},
+		{"prose", "The uplink is probably down.", nil, ErrNoJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseExplanation(tt.text)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseExplanation error = %v, want %v", err, tt.err)
+			}
+			var causes []string
+			for _, c := range e.Causes {
+				causes = append(causes, c.Cause)
+			}
+			if strings.Join(causes, ",") != strings.Join(tt.causes, ",") {
+				t.Errorf("Causes = %v, want %v", causes, tt.causes)
+			}
+		})
+	}
+}
+
+func TestExplainIncidentRepair(t *testing.T) {
+	replies := []string{
+		`{"summary": "s", "causes": []}`,
+		`{"summary": "Uplink down", "causes": [{"cause": "Fibre cut", "confidence": 0.8, "evidence": ["100% loss"], "next_steps": ["Call the ISP"]}]}`,
+	}
+	llm := &FakeLLM{Reply: func(LLMRequest) (string, error) {
+		reply := replies[0]
+		replies = replies[1:]
+		return reply, nil
+	}}
+	analyzer := NewAnalyzer(llm, 0.5, 0)
+
+	e, err := analyzer.ExplainIncident(context.Background(), IncidentContext{AlertID: "a1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.AlertID != "a1" || e.Causes[0].Cause != "Fibre cut" || e.Causes[0].NextSteps[0] != "Call the ISP" {
+		t.Errorf("Unexpected explanation %+v", e)
+	}
+	requests := llm.Requests()
+	if len(requests) != 2 || requests[0].Schema != explanationSchema ||
+		!strings.Contains(requests[1].Prompt, "at least one cause is required") {
+		t.Errorf("Expected a schema-constrained repair request, got %+v", requests)
+	}
+	if stats := analyzer.ParseStats(); stats.Repaired != 1 {
+		t.Errorf("Unexpected parse stats %+v", stats)
+	}
+
+	if _, err := NewAnalyzer(nil, 0.5, 0).ExplainIncident(context.Background(), IncidentContext{}); !errors.Is(err, ErrNoLLM) {
+		t.Errorf("Expected ErrNoLLM, got %v", err)
+	}
+}
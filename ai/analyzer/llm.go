@@ -0,0 +1,191 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// LLM providers
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai" // Any OpenAI-compatible chat completions API, e.g. llama.cpp or Ollama
+	ProviderFake   = "fake"
+)
+
+// ErrNoAPIKey is returned by NewLLMClient when Gemini is selected without a key
+var ErrNoAPIKey = errors.New("GEMINI_API_KEY environment variable not set")
+
+// LLMRequest is one prompt to a language model
+type LLMRequest struct {
+	System string // Optional system instruction
+	Prompt string
+	// Schema, when set, asks for JSON output matching it. Providers that
+	// cannot enforce a schema still get JSON mode where available, so
+	// callers must validate the reply.
+	Schema *Schema
+	// Tools the model may call instead of answering, and the turns of the
+	// conversation so far after Prompt
+	Tools   []Tool
+	History []Message
+	// What the call is for, e.g. analysis, for usage accounting
+	Purpose string
+}
+
+// LLMResponse is a model's reply and what it cost in tokens. When the model
+// calls tools, ToolCalls is set and Text is usually empty.
+type LLMResponse struct {
+	Text         string
+	ToolCalls    []ToolCall
+	Model        string
+	InputTokens  int
+	OutputTokens int
+}
+
+// Tool is a function the model may call
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  *Schema // An object schema
+}
+
+// ToolCall is the model's request to run a tool
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Message roles in LLMRequest.History
+const (
+	RoleUser      = "user"      // A follow-up instruction
+	RoleAssistant = "assistant" // The model's tool calls
+	RoleTool      = "tool"      // The result of one tool call
+)
+
+// Message is one turn of a tool-calling conversation
+type Message struct {
+	Role       string
+	Content    string
+	ToolCalls  []ToolCall // RoleAssistant
+	ToolCallID string     // RoleTool: the call this answers
+	Name       string     // RoleTool: the tool that was called
+}
+
+// LLMClient generates text with a language model. Implementations are safe
+// for concurrent use.
+type LLMClient interface {
+	Generate(ctx context.Context, req LLMRequest) (LLMResponse, error)
+}
+
+// LLMConfig selects and tunes the model used by the analyzers
+type LLMConfig struct {
+	Provider    string        `yaml:"provider"` // gemini (default), openai or fake
+	Model       string        `yaml:"model"`
+	Temperature *float32      `yaml:"temperature"` // Provider default when unset
+	MaxTokens   int           `yaml:"max_tokens"`
+	BaseURL     string        `yaml:"base_url"` // openai only
+	APIKey      string        `yaml:"api_key"`  // May reference the environment as ${NAME}
+	Timeout     time.Duration `yaml:"timeout"`
+
+	RateLimit RateLimit        `yaml:"rate_limit"`
+	Pricing   map[string]Price `yaml:"pricing"` // By model, for cost accounting
+	Cache     CacheConfig      `yaml:"cache"`
+}
+
+const (
+	defaultGeminiModel = "gemini-1.5-flash"
+	defaultOpenAIURL   = "https://api.openai.com/v1"
+	defaultLLMTimeout  = 20 * time.Second
+)
+
+// NewLLMClient creates the client for the configured provider. The Gemini
+// key defaults to GEMINI_API_KEY and the OpenAI key to OPENAI_API_KEY.
+func NewLLMClient(config LLMConfig) (LLMClient, error) {
+	apiKey := os.ExpandEnv(config.APIKey)
+	if config.Timeout <= 0 {
+		config.Timeout = defaultLLMTimeout
+	}
+
+	switch config.Provider {
+	case "", ProviderGemini:
+		if apiKey == "" {
+			apiKey = os.Getenv("GEMINI_API_KEY")
+		}
+		if apiKey == "" {
+			return nil, ErrNoAPIKey
+		}
+		if config.Model == "" {
+			config.Model = defaultGeminiModel
+		}
+		client, err := NewGeminiClient(context.Background(), apiKey, config)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case ProviderOpenAI:
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		if config.Model == "" {
+			return nil, fmt.Errorf("model is required for the openai provider")
+		}
+		if config.BaseURL == "" {
+			config.BaseURL = defaultOpenAIURL
+		}
+		return NewOpenAIClient(os.ExpandEnv(config.BaseURL), apiKey, config), nil
+	case ProviderFake:
+		return &FakeLLM{}, nil
+	default:
+		return nil, fmt.Errorf("provider must be gemini, openai or fake (got %q)", config.Provider)
+	}
+}
+
+// FakeLLM is a deterministic LLMClient for tests and offline development.
+// Reply computes each response; without it every prompt gets "[]".
+// Respond, when set, is used instead and may return tool calls. Every
+// request is recorded.
+type FakeLLM struct {
+	Reply   func(req LLMRequest) (string, error)
+	Respond func(req LLMRequest) (LLMResponse, error)
+
+	mu       sync.Mutex
+	requests []LLMRequest
+}
+
+// Generate records the request and returns Reply's answer
+func (f *FakeLLM) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return LLMResponse{}, err
+	}
+	if f.Respond != nil {
+		resp, err := f.Respond(req)
+		if resp.Model == "" {
+			resp.Model = ProviderFake
+		}
+		return resp, err
+	}
+	text := "[]"
+	if f.Reply != nil {
+		var err error
+		if text, err = f.Reply(req); err != nil {
+			return LLMResponse{}, err
+		}
+	}
+	return LLMResponse{Text: text, Model: ProviderFake, InputTokens: len(req.Prompt) / 4, OutputTokens: len(text) / 4}, nil
+}
+
+// Requests returns the requests received so far
+func (f *FakeLLM) Requests() []LLMRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]LLMRequest(nil), f.requests...)
+}
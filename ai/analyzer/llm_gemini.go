@@ -0,0 +1,135 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// GeminiClient generates text with Google's Gemini API
+type GeminiClient struct {
+	client *genai.Client
+	config LLMConfig
+}
+
+// NewGeminiClient creates a Gemini client for config.Model
+func NewGeminiClient(ctx context.Context, apiKey string, config LLMConfig) (*GeminiClient, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+	}
+	return &GeminiClient{client: client, config: config}, nil
+}
+
+// Generate sends one prompt, or a tool-calling conversation, and joins the
+// text parts of the first candidate
+func (g *GeminiClient) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.config.Timeout)
+	defer cancel()
+
+	// GenerativeModel holds per-request settings, so each call gets its own
+	model := g.client.GenerativeModel(g.config.Model)
+	if g.config.Temperature != nil {
+		model.SetTemperature(*g.config.Temperature)
+	}
+	if g.config.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(g.config.MaxTokens))
+	}
+	if req.System != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(req.System))
+	}
+	if req.Schema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = req.Schema.toGenai()
+	}
+
+	if len(req.Tools) > 0 {
+		tool := &genai.Tool{}
+		for _, t := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, &genai.FunctionDeclaration{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters.toGenai(),
+			})
+		}
+		model.Tools = []*genai.Tool{tool}
+	}
+
+	// Replay the conversation; the last turn is sent as the new message
+	contents := []*genai.Content{genai.NewUserContent(genai.Text(req.Prompt))}
+	for _, m := range req.History {
+		content, err := geminiContent(m)
+		if err != nil {
+			return LLMResponse{}, err
+		}
+		contents = append(contents, content)
+	}
+	chat := model.StartChat()
+	chat.History = contents[:len(contents)-1]
+
+	resp, err := chat.SendMessage(ctx, contents[len(contents)-1].Parts...)
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("gemini API error: %v", err)
+	}
+
+	result := LLMResponse{Model: g.config.Model}
+	if resp.UsageMetadata != nil {
+		result.InputTokens = int(resp.UsageMetadata.PromptTokenCount)
+		result.OutputTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return result, nil
+	}
+
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		switch p := part.(type) {
+		case genai.Text:
+			text.WriteString(string(p))
+		case genai.FunctionCall:
+			args, err := json.Marshal(p.Args)
+			if err != nil {
+				return LLMResponse{}, fmt.Errorf("failed to encode %s arguments: %v", p.Name, err)
+			}
+			// Gemini does not identify calls; results are matched by name and order
+			id := fmt.Sprintf("call_%d", len(result.ToolCalls)+1)
+			result.ToolCalls = append(result.ToolCalls, ToolCall{ID: id, Name: p.Name, Arguments: args})
+		}
+	}
+	result.Text = text.String()
+	return result, nil
+}
+
+// geminiContent converts one turn of a tool-calling conversation
+func geminiContent(m Message) (*genai.Content, error) {
+	switch m.Role {
+	case RoleAssistant:
+		content := &genai.Content{Role: "model"}
+		if m.Content != "" {
+			content.Parts = append(content.Parts, genai.Text(m.Content))
+		}
+		for _, call := range m.ToolCalls {
+			var args map[string]any
+			if err := json.Unmarshal(call.Arguments, &args); err != nil {
+				return nil, fmt.Errorf("invalid %s arguments: %v", call.Name, err)
+			}
+			content.Parts = append(content.Parts, genai.FunctionCall{Name: call.Name, Args: args})
+		}
+		return content, nil
+	case RoleTool:
+		// Responses must be JSON objects
+		var result any
+		if err := json.Unmarshal([]byte(m.Content), &result); err != nil {
+			result = m.Content
+		}
+		return &genai.Content{Role: "function", Parts: []genai.Part{
+			genai.FunctionResponse{Name: m.Name, Response: map[string]any{"result": result}},
+		}}, nil
+	default:
+		return genai.NewUserContent(genai.Text(m.Content)), nil
+	}
+}
@@ -0,0 +1,184 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIClient generates text with an OpenAI-compatible chat completions
+// API. llama.cpp's server and Ollama expose the same API locally.
+type OpenAIClient struct {
+	baseURL string
+	apiKey  string
+	config  LLMConfig
+	client  *http.Client
+}
+
+// NewOpenAIClient creates a client for the API at baseURL, e.g.
+// http://localhost:11434/v1 for Ollama. apiKey may be empty for local servers.
+func NewOpenAIClient(baseURL, apiKey string, config LLMConfig) *OpenAIClient {
+	return &OpenAIClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+	}
+}
+
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON encoded as a string
+	} `json:"function"`
+}
+
+type chatTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string  `json:"name"`
+		Description string  `json:"description"`
+		Parameters  *Schema `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Tools       []chatTool    `json:"tools,omitempty"`
+	Temperature *float32      `json:"temperature,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	// llama.cpp and recent Ollama versions honour json_schema too
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+type responseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string  `json:"name"`
+		Strict bool    `json:"strict"`
+		Schema *Schema `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Generate sends one chat completion request
+func (o *OpenAIClient) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	body := chatRequest{
+		Model:       o.config.Model,
+		Temperature: o.config.Temperature,
+		MaxTokens:   o.config.MaxTokens,
+	}
+	if req.System != "" {
+		body.Messages = append(body.Messages, chatMessage{Role: "system", Content: req.System})
+	}
+	body.Messages = append(body.Messages, chatMessage{Role: "user", Content: req.Prompt})
+	for _, m := range req.History {
+		msg := chatMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			c := chatToolCall{ID: call.ID, Type: "function"}
+			c.Function.Name = call.Name
+			c.Function.Arguments = string(call.Arguments)
+			msg.ToolCalls = append(msg.ToolCalls, c)
+		}
+		body.Messages = append(body.Messages, msg)
+	}
+	for _, tool := range req.Tools {
+		t := chatTool{Type: "function"}
+		t.Function.Name = tool.Name
+		t.Function.Description = tool.Description
+		t.Function.Parameters = tool.Parameters
+		body.Tools = append(body.Tools, t)
+	}
+	if req.Schema != nil {
+		body.ResponseFormat = &responseFormat{Type: "json_schema"}
+		body.ResponseFormat.JSONSchema.Name = "response"
+		body.ResponseFormat.JSONSchema.Strict = true
+		body.ResponseFormat.JSONSchema.Schema = req.Schema
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("failed to encode request: %v", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("LLM API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("failed to read LLM response: %v", err)
+	}
+	var parsed chatResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return LLMResponse{}, fmt.Errorf("LLM API error: %s", resp.Status)
+		}
+		return LLMResponse{}, fmt.Errorf("failed to decode LLM response: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		if parsed.Error != nil {
+			return LLMResponse{}, fmt.Errorf("LLM API error: %s: %s", resp.Status, parsed.Error.Message)
+		}
+		return LLMResponse{}, fmt.Errorf("LLM API error: %s", resp.Status)
+	}
+
+	result := LLMResponse{
+		Model:        parsed.Model,
+		InputTokens:  parsed.Usage.PromptTokens,
+		OutputTokens: parsed.Usage.CompletionTokens,
+	}
+	if result.Model == "" {
+		result.Model = o.config.Model
+	}
+	if len(parsed.Choices) > 0 {
+		msg := parsed.Choices[0].Message
+		result.Text = msg.Content
+		for _, c := range msg.ToolCalls {
+			args := json.RawMessage(c.Function.Arguments)
+			if !json.Valid(args) {
+				// Passed on as a string so the tool reports the bad arguments
+				args, _ = json.Marshal(c.Function.Arguments)
+			}
+			result.ToolCalls = append(result.ToolCalls, ToolCall{ID: c.ID, Name: c.Function.Name, Arguments: args})
+		}
+	}
+	return result, nil
+}
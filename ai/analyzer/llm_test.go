@@ -0,0 +1,152 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestOpenAIClient(t *testing.T) {
+	var got chatRequest
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"model":"llama3.2:3b","choices":[{"message":{"role":"assistant","content":"[]"}}],
+			"usage":{"prompt_tokens":120,"completion_tokens":2}}`))
+	}))
+	defer server.Close()
+
+	temperature := float32(0.2)
+	client := NewOpenAIClient(server.URL+"/v1/", "secret", LLMConfig{Model: "llama3.2:3b", Temperature: &temperature, MaxTokens: 512})
+	resp, err := client.Generate(context.Background(), LLMRequest{System: "You are a network analyst.", Prompt: "Analyze", Schema: alertsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Text != "[]" || resp.Model != "llama3.2:3b" || resp.InputTokens != 120 || resp.OutputTokens != 2 {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if got.Model != "llama3.2:3b" || got.Temperature == nil || *got.Temperature != 0.2 || got.MaxTokens != 512 ||
+		len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[1].Content != "Analyze" {
+		t.Errorf("Unexpected request %+v", got)
+	}
+	if f := got.ResponseFormat; f == nil || f.Type != "json_schema" || !f.JSONSchema.Strict ||
+		f.JSONSchema.Schema.Properties["alerts"].Items.Properties["severity"].Enum[2] != "critical" {
+		t.Errorf("Unexpected response format %+v", got.ResponseFormat)
+	}
+}
+
+func TestOpenAIClientToolCalls(t *testing.T) {
+	var got chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":null,"tool_calls":[
+			{"id":"call_9","type":"function","function":{"name":"list_alerts","arguments":"{\"severity\":\"critical\"}"}},
+			{"id":"call_10","type":"function","function":{"name":"list_alerts","arguments":"{severity"}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(server.URL, "", LLMConfig{Model: "gpt-4o-mini"})
+	resp, err := client.Generate(context.Background(), LLMRequest{
+		Prompt: "Any critical alerts?",
+		Tools:  []Tool{{Name: "list_clinics", Description: "List clinics", Parameters: &Schema{Type: SchemaObject}}},
+		History: []Message{
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "list_clinics", Arguments: json.RawMessage(`{}`)}}},
+			{Role: RoleTool, ToolCallID: "call_1", Name: "list_clinics", Content: `{"rows":[]}`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.ToolCalls) != 2 || resp.ToolCalls[0].ID != "call_9" || string(resp.ToolCalls[0].Arguments) != `{"severity":"critical"}` {
+		t.Errorf("Unexpected tool calls %+v", resp.ToolCalls)
+	}
+	// Malformed arguments are passed on as a string for the tool to reject
+	if string(resp.ToolCalls[1].Arguments) != `"{severity"` {
+		t.Errorf("Unexpected malformed arguments %s", resp.ToolCalls[1].Arguments)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Type != "function" || got.Tools[0].Function.Name != "list_clinics" {
+		t.Errorf("Unexpected tools %+v", got.Tools)
+	}
+	if len(got.Messages) != 3 || got.Messages[1].ToolCalls[0].Function.Arguments != "{}" ||
+		got.Messages[2].Role != "tool" || got.Messages[2].ToolCallID != "call_1" {
+		t.Errorf("Unexpected messages %+v", got.Messages)
+	}
+}
+
+func TestOpenAIClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"message":"model \"llama9\" not found"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAIClient(server.URL, "", LLMConfig{Model: "llama9"}).Generate(context.Background(), LLMRequest{Prompt: "hi"})
+	if err == nil || !strings.Contains(err.Error(), `model "llama9" not found`) {
+		t.Errorf("Expected the API error message, got %v", err)
+	}
+}
+
+func TestNewLLMClient(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "")
+	tests := []struct {
+		name   string
+		config LLMConfig
+		want   string
+	}{
+		{"gemini without key", LLMConfig{}, "GEMINI_API_KEY"},
+		{"openai without model", LLMConfig{Provider: ProviderOpenAI}, "model is required"},
+		{"unknown provider", LLMConfig{Provider: "claude"}, "provider must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLLMClient(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewLLMClient error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	client, err := NewLLMClient(LLMConfig{Provider: ProviderOpenAI, Model: "llama3.2:3b", BaseURL: "http://localhost:11434/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := client.(*OpenAIClient); c.baseURL != "http://localhost:11434/v1" {
+		t.Errorf("Unexpected base URL %q", c.baseURL)
+	}
+}
+
+func TestGeminiContent(t *testing.T) {
+	call, err := geminiContent(Message{Role: RoleAssistant, ToolCalls: []ToolCall{
+		{ID: "call_1", Name: "list_alerts", Arguments: json.RawMessage(`{"severity":"critical"}`)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc, ok := call.Parts[0].(genai.FunctionCall); call.Role != "model" || !ok || fc.Args["severity"] != "critical" {
+		t.Errorf("Unexpected function call content %+v", call)
+	}
+
+	result, err := geminiContent(Message{Role: RoleTool, Name: "list_alerts", Content: `{"rows":[["a1"]]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr, ok := result.Parts[0].(genai.FunctionResponse)
+	if !ok || fr.Name != "list_alerts" || fr.Response["result"].(map[string]any)["rows"] == nil {
+		t.Errorf("Unexpected function response content %+v", result)
+	}
+}
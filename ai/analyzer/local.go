@@ -0,0 +1,251 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Analysis sources
+const (
+	SourceLLM    = "llm"    // The model's alerts
+	SourceRules  = "rules"  // The local thresholds only; the model was unavailable
+	SourceHybrid = "hybrid" // The model's alerts plus critical findings it missed
+)
+
+// ErrNoLLM is returned by AnalyzeMetrics when no model is configured
+var ErrNoLLM = errors.New("no LLM configured")
+
+// Analysis is the outcome of Analyze
+type Analysis struct {
+	Source   string         `json:"source"`
+	Alerts   []models.Alert `json:"alerts"`
+	LLMError string         `json:"llm_error,omitempty"` // Why the model's answer was not used
+	Cached   bool           `json:"cached,omitempty"`    // Served by AnalyzeCached without a new analysis
+	// The prompt template the model was asked with
+	PromptVersion string `json:"prompt_version,omitempty"`
+}
+
+// metricSummary describes one metric over the analysis window
+type metricSummary struct {
+	Avg, Max, Trend float64
+}
+
+// windowSummary is what both the prompt and the local rules see
+type windowSummary struct {
+	CPU, Memory, Latency, Bandwidth metricSummary
+}
+
+// summarize calculates averages, maximums and trends (last minus first)
+func summarize(metrics []models.Metrics) windowSummary {
+	var (
+		s            windowSummary
+		latencyCount float64
+	)
+
+	for i, m := range metrics {
+		// Calculate averages
+		s.CPU.Avg += m.CPUUsage
+		s.Memory.Avg += m.MemoryUsage
+		if !m.Unreachable {
+			s.Latency.Avg += m.Latency
+			latencyCount++
+		}
+		bandwidth := m.Bandwidth()
+		s.Bandwidth.Avg += bandwidth
+
+		// Track maximums
+		s.CPU.Max = math.Max(s.CPU.Max, m.CPUUsage)
+		s.Memory.Max = math.Max(s.Memory.Max, m.MemoryUsage)
+		if !m.Unreachable {
+			s.Latency.Max = math.Max(s.Latency.Max, m.Latency)
+		}
+		s.Bandwidth.Max = math.Max(s.Bandwidth.Max, bandwidth)
+
+		// Calculate trends (change over time)
+		if i > 0 {
+			s.CPU.Trend += m.CPUUsage - metrics[i-1].CPUUsage
+			s.Memory.Trend += m.MemoryUsage - metrics[i-1].MemoryUsage
+			if !m.Unreachable && !metrics[i-1].Unreachable {
+				s.Latency.Trend += m.Latency - metrics[i-1].Latency
+			}
+			s.Bandwidth.Trend += bandwidth - metrics[i-1].Bandwidth()
+		}
+	}
+
+	count := float64(len(metrics))
+	s.CPU.Avg /= count
+	s.Memory.Avg /= count
+	if latencyCount > 0 {
+		s.Latency.Avg /= latencyCount
+	}
+	s.Bandwidth.Avg /= count
+	return s
+}
+
+// localThreshold is one metric's limits, matching those in the prompt
+type localThreshold struct {
+	metric, label, unit string
+	keyword             string // How the model refers to the metric
+	critical, warning   float64
+	trend               float64 // Increase over the window that warrants a warning
+	recommended         string
+	value               func(windowSummary) metricSummary
+}
+
+var localThresholds = []localThreshold{
+	{"cpu_usage", "CPU usage", "%", "cpu", 80, 70, 20,
+		"Investigate high CPU processes and potential resource constraints",
+		func(s windowSummary) metricSummary { return s.CPU }},
+	{"memory_usage", "Memory usage", "%", "memory", 90, 80, 15,
+		"Check for memory leaks and high memory consumers",
+		func(s windowSummary) metricSummary { return s.Memory }},
+	{"latency", "Latency", "ms", "latency", 200, 150, 50,
+		"Investigate network bottlenecks and check the WAN uplink",
+		func(s windowSummary) metricSummary { return s.Latency }},
+	{"bandwidth", "Bandwidth", " MB/s", "bandwidth", 800, 600, 100,
+		"Identify the heaviest traffic sources and throttle non-clinical use",
+		func(s windowSummary) metricSummary { return s.Bandwidth }},
+}
+
+// ruleAlerts applies the prompt's thresholds to the window. Levels are
+// judged on the peak, so a spike the model would flag is flagged here too.
+func ruleAlerts(s windowSummary, thresholds []localThreshold) []models.Alert {
+	alerts := []models.Alert{}
+	for _, t := range thresholds {
+		v := t.value(s)
+		level, limit := "", 0.0
+		switch {
+		case v.Max > t.critical:
+			level, limit = "critical", t.critical
+		case v.Max > t.warning:
+			level, limit = "warning", t.warning
+		}
+		if level != "" {
+			alerts = append(alerts, models.Alert{
+				Severity: level,
+				Description: fmt.Sprintf("%s peaked at %.2f%s (average %.2f%s), above the %s threshold of %.0f%s",
+					t.label, v.Max, t.unit, v.Avg, t.unit, level, limit, t.unit),
+				Recommended: t.recommended,
+				Metric:      t.metric,
+				Value:       v.Max,
+				Expected:    limit,
+				Source:      SourceRules,
+			})
+		}
+		if v.Trend > t.trend {
+			alerts = append(alerts, models.Alert{
+				Severity: "warning",
+				Description: fmt.Sprintf("%s rose by %.2f%s over the window (trend warning above %.0f%s)",
+					t.label, v.Trend, t.unit, t.trend, t.unit),
+				Recommended: t.recommended,
+				Metric:      t.metric,
+				Value:       v.Trend,
+				Expected:    t.trend,
+				Source:      SourceRules,
+			})
+		}
+	}
+	return alerts
+}
+
+// Analyze produces alerts for a window of samples. The model is asked
+// first, within the analyzer's timeout; if it is unavailable, too slow or
+// answers unusably, the local thresholds are used instead. Critical local
+// findings the model did not mention are added to its alerts.
+func (a *Analyzer) Analyze(ctx context.Context, metrics []models.Metrics) (Analysis, error) {
+	if len(metrics) == 0 {
+		return Analysis{}, fmt.Errorf("no metrics to analyze")
+	}
+	s := summarize(metrics)
+	local := ruleAlerts(s, a.prompts.thresholds)
+
+	if a.llm == nil {
+		return Analysis{Source: SourceRules, Alerts: local, LLMError: ErrNoLLM.Error()}, nil
+	}
+
+	llmCtx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	alerts, version, err := a.llmAlerts(llmCtx, clinicScope(metrics), s)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The caller gave up; there is no one to answer
+			return Analysis{}, ctx.Err()
+		}
+		log.Printf("LLM analysis failed, using local rules: %v", err)
+		return Analysis{Source: SourceRules, Alerts: local, LLMError: err.Error(), PromptVersion: version}, nil
+	}
+
+	result := Analysis{Source: SourceLLM, Alerts: make([]models.Alert, 0, len(alerts)), PromptVersion: version}
+	for _, alert := range alerts {
+		alert.Source = SourceLLM
+		result.Alerts = append(result.Alerts, alert)
+	}
+	for _, alert := range local {
+		if alert.Severity == "critical" && !mentions(alerts, a.prompts.keyword(alert.Metric)) {
+			result.Alerts = append(result.Alerts, alert)
+			result.Source = SourceHybrid
+		}
+	}
+	return result, nil
+}
+
+// AnalyzeCached is Analyze for endpoints that are polled. Results are cached
+// per clinic, keyed by the window's summary, so that polling does not call
+// the model each time.
+func (a *Analyzer) AnalyzeCached(ctx context.Context, metrics []models.Metrics) (Analysis, error) {
+	if a.cache == nil || len(metrics) == 0 {
+		return a.Analyze(ctx, metrics)
+	}
+
+	// The summary at the precision the model sees it
+	hash := hashOf(fmt.Sprintf("%.2f", summarize(metrics)))
+	value, cached, err := a.cache.get(ctx, "analysis:"+clinicScope(metrics), hash,
+		func(ctx context.Context) (interface{}, error) {
+			return a.Analyze(ctx, metrics)
+		})
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	// Callers annotate the alerts; leave the cached ones as they are
+	analysis := value.(Analysis)
+	analysis.Alerts = append(make([]models.Alert, 0, len(analysis.Alerts)), analysis.Alerts...)
+	analysis.Cached = cached
+	return analysis, nil
+}
+
+// clinicScope names the clinics a window of samples covers
+func clinicScope(metrics []models.Metrics) string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, m := range metrics {
+		if m.ClinicID != "" && !seen[m.ClinicID] {
+			seen[m.ClinicID] = true
+			ids = append(ids, m.ClinicID)
+		}
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// mentions reports whether any alert's description refers to keyword
+func mentions(alerts []models.Alert, keyword string) bool {
+	for _, a := range alerts {
+		if strings.Contains(strings.ToLower(a.Description), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// Thresholds returns the default warning and critical limits of a metric
+func Thresholds(metric string) (warning, critical float64, ok bool) {
+	return defaultPrompts.Thresholds(metric)
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// slowLLM answers only when its context ends
+type slowLLM struct{}
+
+func (slowLLM) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	<-ctx.Done()
+	return LLMResponse{}, ctx.Err()
+}
+
+// overloadedWindow has every metric above its critical threshold at the end
+func overloadedWindow() []models.Metrics {
+	return []models.Metrics{
+		{CPUUsage: 40, MemoryUsage: 50, Latency: 80},
+		{CPUUsage: 90, MemoryUsage: 95, Latency: 300, BytesSentRate: 900 * 1024 * 1024},
+	}
+}
+
+func TestRuleAlerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary windowSummary
+		want    []string // metric:severity
+	}{
+		{"quiet", windowSummary{CPU: metricSummary{Avg: 20, Max: 30}, Latency: metricSummary{Avg: 40, Max: 60}}, nil},
+		{"cpu warning", windowSummary{CPU: metricSummary{Avg: 60, Max: 75}}, []string{"cpu_usage:warning"}},
+		{"cpu critical", windowSummary{CPU: metricSummary{Avg: 60, Max: 85}}, []string{"cpu_usage:critical"}},
+		{"memory at the limit", windowSummary{Memory: metricSummary{Avg: 80, Max: 90}}, []string{"memory_usage:warning"}},
+		{"latency trend", windowSummary{Latency: metricSummary{Avg: 90, Max: 120, Trend: 60}}, []string{"latency:warning"}},
+		{"bandwidth critical and rising", windowSummary{Bandwidth: metricSummary{Avg: 500, Max: 850, Trend: 150}},
+			[]string{"bandwidth:critical", "bandwidth:warning"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range ruleAlerts(tt.summary, localThresholds) {
+				if a.Source != SourceRules || a.Recommended == "" {
+					t.Errorf("Unexpected alert %+v", a)
+				}
+				got = append(got, a.Metric+":"+a.Severity)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ruleAlerts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeWithoutLLM(t *testing.T) {
+	analysis, err := NewAnalyzer(nil, 0.5, 0).Analyze(context.Background(), overloadedWindow())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Source != SourceRules || analysis.LLMError != ErrNoLLM.Error() {
+		t.Errorf("Unexpected analysis %+v", analysis)
+	}
+	critical := 0
+	for _, a := range analysis.Alerts {
+		if a.Severity == "critical" {
+			critical++
+		}
+	}
+	if critical != 4 {
+		t.Errorf("Expected all four metrics to be critical, got %+v", analysis.Alerts)
+	}
+}
+
+func TestAnalyzeHealthyWindow(t *testing.T) {
+	window := []models.Metrics{
+		{CPUUsage: 30, MemoryUsage: 40, Latency: 60},
+		{CPUUsage: 32, MemoryUsage: 41, Latency: 65},
+	}
+	llm := &FakeLLM{}
+	analysis, err := NewAnalyzer(llm, 0.5, 0).Analyze(context.Background(), window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Source != SourceLLM || len(analysis.Alerts) != 0 {
+		t.Errorf("Expected no alerts for a healthy window, got %+v", analysis)
+	}
+	// The samples reach the model as measured
+	if window[1].CPUUsage != 32 || !strings.Contains(llm.Requests()[0].Prompt, "max: 32.00%") {
+		t.Errorf("Window was altered before analysis: %+v", window[1])
+	}
+}
+
+func TestAnalyzeFallsBack(t *testing.T) {
+	tests := []struct {
+		name string
+		llm  LLMClient
+		want string
+	}{
+		{"error", &FakeLLM{Reply: func(LLMRequest) (string, error) { return "", errors.New("connection refused") }}, "connection refused"},
+		{"timeout", slowLLM{}, "deadline exceeded"},
+		{"unusable", &FakeLLM{Reply: func(LLMRequest) (string, error) { return "Everything is on fire.", nil }}, ErrNoJSON.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			analysis, err := NewAnalyzer(tt.llm, 0.5, 50*time.Millisecond).Analyze(context.Background(), overloadedWindow())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if time.Since(start) > time.Second {
+				t.Errorf("Fallback took %v", time.Since(start))
+			}
+			if analysis.Source != SourceRules || !strings.Contains(analysis.LLMError, tt.want) || len(analysis.Alerts) == 0 {
+				t.Errorf("Unexpected analysis %+v", analysis)
+			}
+		})
+	}
+}
+
+func TestAnalyzeHybrid(t *testing.T) {
+	llm := &FakeLLM{Reply: func(LLMRequest) (string, error) {
+		return `{"alerts": [
+			{"severity": "critical", "description": "Latency peaked at 300ms", "recommended": "Check the uplink"},
+			{"severity": "critical", "description": "CPU is saturated", "recommended": "Check processes"},
+			{"severity": "warning", "description": "Memory pressure is high", "recommended": "Check consumers"}
+		]}`, nil
+	}}
+	analysis, err := NewAnalyzer(llm, 0.5, 0).Analyze(context.Background(), overloadedWindow())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The model missed the bandwidth breach, so the local finding is added
+	if analysis.Source != SourceHybrid || len(analysis.Alerts) != 4 {
+		t.Fatalf("Unexpected analysis %+v", analysis)
+	}
+	for i, a := range analysis.Alerts[:3] {
+		if a.Source != SourceLLM {
+			t.Errorf("Alert %d source = %q, want llm", i, a.Source)
+		}
+	}
+	if added := analysis.Alerts[3]; added.Source != SourceRules || added.Metric != "bandwidth" {
+		t.Errorf("Unexpected added alert %+v", added)
+	}
+
+}
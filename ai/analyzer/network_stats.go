@@ -2,200 +2,374 @@ package analyzer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"regexp"
-	"strconv"
+	"math"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/Evarest-ke/healthnetai/models"
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
 )
 
+// StatsConfig holds the dashboard statistics settings loaded from
+// config.yaml
+type StatsConfig struct {
+	// Statistics cover this long before now and are compared with the
+	// equally long window before it; defaults to 1h
+	Window time.Duration `yaml:"window"`
+	// Uplink capacity in MB/s that network load is measured against.
+	// Without one, load is not reported.
+	LinkCapacity float64 `yaml:"link_capacity"`
+	// Per-clinic capacities in MB/s, overriding LinkCapacity
+	LinkCapacities map[string]float64 `yaml:"link_capacities"`
+}
+
+const defaultStatsWindow = time.Hour
+
+// Stat trends
+const (
+	TrendUp     = "up"
+	TrendDown   = "down"
+	TrendStable = "stable"
+)
+
+// Stat is one dashboard tile
+type Stat struct {
+	Title  string `json:"title"`
+	Value  string `json:"value"`
+	Icon   string `json:"icon"`
+	Trend  string `json:"trend"`  // Against the previous window: up, down or stable
+	Change string `json:"change"` // Difference from the previous window
+
+	// The figures behind Value and Change; nil without data
+	Current  *float64 `json:"current"`
+	Previous *float64 `json:"previous"`
+}
+
+// NetworkStats is the computed dashboard statistics, with optional
+// commentary from the model
+type NetworkStats struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Stats []Stat    `json:"stats"`
+
+	Commentary       string `json:"commentary,omitempty"`
+	CommentaryModel  string `json:"commentary_model,omitempty"`
+	CommentaryError  string `json:"commentary_error,omitempty"`
+	CommentaryCached bool   `json:"commentary_cached,omitempty"`
+	// The prompt template the commentary was asked for with
+	CommentaryPromptVersion string `json:"commentary_prompt_version,omitempty"`
+}
+
+// StatsInput is the data the statistics are computed from. Statuses,
+// shares and metrics should cover both the current and previous windows.
+type StatsInput struct {
+	Now      time.Time
+	Clinics  []models.Clinic // Current directory snapshot
+	Statuses []models.ClinicStatus
+	Shares   []models.EmergencyShare
+	Metrics  []models.Metrics
+	// Ask the model to comment on the figures
+	Commentary bool
+}
+
+// NetworkStatsAnalyzer computes the network dashboard statistics
 type NetworkStatsAnalyzer struct {
-	model genai.GenerativeModel
+	llm     LLMClient
+	config  StatsConfig
+	cache   *resultCache // nil unless EnableCache is called
+	prompts *Prompts
 }
 
-func NewNetworkStatsAnalyzer(apiKey string) (*NetworkStatsAnalyzer, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+func NewNetworkStatsAnalyzer(llm LLMClient, config StatsConfig) *NetworkStatsAnalyzer {
+	if config.Window <= 0 {
+		config.Window = defaultStatsWindow
 	}
-	return &NetworkStatsAnalyzer{
-		model: *client.GenerativeModel("gemini-pro"),
-	}, nil
+	return &NetworkStatsAnalyzer{llm: llm, config: config, prompts: defaultPrompts}
 }
 
-func (a *NetworkStatsAnalyzer) AnalyzeNetworkStats(metrics []models.Metrics, clinics []models.Clinic) ([]map[string]interface{}, error) {
-	ctx := context.Background()
+// UsePrompts replaces the built-in English commentary prompt. It must be
+// called before the analyzer is used.
+func (a *NetworkStatsAnalyzer) UsePrompts(p *Prompts) {
+	a.prompts = p
+}
+
+// EnableCache makes the commentary reused as config describes, keyed by the
+// figures it comments on. It must be called before the analyzer is used.
+func (a *NetworkStatsAnalyzer) EnableCache(config CacheConfig) {
+	a.cache = newResultCache(config)
+}
 
-	// Prepare network data summary
-	activeCount := 0
-	totalBandwidth := float64(0)
-	activeShares := 0
+// CacheStats reports how commentary was served
+func (a *NetworkStatsAnalyzer) CacheStats() CacheStats {
+	return a.cache.snapshot()
+}
 
-	for _, clinic := range clinics {
+// Window returns how far back the current window reaches
+func (a *NetworkStatsAnalyzer) Window() time.Duration {
+	return a.config.Window
+}
+
+// AnalyzeNetworkStats computes uptime, active facilities, emergency shares
+// and network load for the window ending at in.Now and compares each with
+// the window before it. The model is only asked for commentary, and only
+// when in.Commentary is set.
+func (a *NetworkStatsAnalyzer) AnalyzeNetworkStats(ctx context.Context, in StatsInput) (NetworkStats, error) {
+	to := in.Now
+	from := to.Add(-a.config.Window)
+	prevFrom := from.Add(-a.config.Window)
+
+	stats := NetworkStats{From: from, To: to}
+
+	// Network uptime, from the clinics' status history
+	stats.Stats = append(stats.Stats, percentStat("Network Uptime", "Signal",
+		statusUptime(in.Statuses, from, to), statusUptime(in.Statuses, prevFrom, from)))
+
+	// Active facilities now, against those online at the end of the
+	// previous window
+	active := 0
+	for _, clinic := range in.Clinics {
 		if clinic.NetworkStatus == "online" {
-			activeCount++
+			active++
 		}
-		if clinic.EmergencyMode {
-			activeShares++
+	}
+	activeStat := Stat{
+		Title:   "Active Facilities",
+		Value:   fmt.Sprintf("%d/%d", active, len(in.Clinics)),
+		Icon:    "Server",
+		Current: float64Ptr(float64(active)),
+	}
+	if prevActive, prevTotal := statusesAt(in.Statuses, from); prevTotal > 0 {
+		activeStat.Previous = float64Ptr(float64(prevActive))
+	}
+	activeStat.Trend, activeStat.Change = compare(activeStat.Current, activeStat.Previous, "%+.0f")
+	stats.Stats = append(stats.Stats, activeStat)
+
+	// Emergency bandwidth shares granted in each window
+	granted, prevGranted := 0, 0
+	for _, share := range in.Shares {
+		if !share.CanShare {
+			continue
 		}
+		switch {
+		case within(share.Timestamp, from, to):
+			granted++
+		case within(share.Timestamp, prevFrom, from):
+			prevGranted++
+		}
+	}
+	sharesStat := Stat{
+		Title:    "Active Shares",
+		Value:    fmt.Sprintf("%d", granted),
+		Icon:     "Share2",
+		Current:  float64Ptr(float64(granted)),
+		Previous: float64Ptr(float64(prevGranted)),
 	}
+	sharesStat.Trend, sharesStat.Change = compare(sharesStat.Current, sharesStat.Previous, "%+.0f")
+	stats.Stats = append(stats.Stats, sharesStat)
 
-	// Calculate average bandwidth from metrics
-	for _, metric := range metrics {
-		totalBandwidth += float64(metric.BytesReceived+metric.BytesSent) / 1024 / 1024 // Convert to MB
+	// Network load, as bandwidth against link capacity
+	stats.Stats = append(stats.Stats, percentStat("Network Load", "Activity",
+		a.load(in.Metrics, from, to), a.load(in.Metrics, prevFrom, from)))
+
+	if in.Commentary {
+		if a.llm == nil {
+			stats.CommentaryError = ErrNoLLM.Error()
+		} else if err := a.comment(ctx, &stats, len(in.Clinics)); err != nil {
+			stats.CommentaryError = err.Error()
+		}
 	}
-	avgBandwidth := totalBandwidth / float64(len(metrics))
+	return stats, nil
+}
 
-	// Prepare prompt for AI analysis
-	prompt := fmt.Sprintf(`Analyze this healthcare network data and generate key statistics:
-	- Active facilities: %d out of %d
-	- Average bandwidth usage: %.2f MB
-	- Active bandwidth shares: %d
-	- Recent network metrics count: %d
+// commentary is the model's comment on a set of figures
+type commentary struct {
+	text, model, version string
+}
 
-	Generate 4 key network statistics including:
-	1. Network uptime percentage
-	2. Active facilities ratio
-	3. Bandwidth sharing status
-	4. Overall network load
+// comment asks the model for a short commentary on the computed figures,
+// reusing a cached one when enabled
+func (a *NetworkStatsAnalyzer) comment(ctx context.Context, stats *NetworkStats, clinics int) error {
+	data, err := json.MarshalIndent(stats.Stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode stats: %v", err)
+	}
+	prompt, version, err := a.prompts.render(PromptCommentary, commentaryPrompt{
+		Clinics: clinics,
+		Window:  a.config.Window.String(),
+		To:      stats.To.Format(time.RFC3339),
+		Stats:   string(data),
+	})
+	if err != nil {
+		return err
+	}
 
-	Format each stat with a title, value, trend (up/down/stable), and change value.
-	`, activeCount, len(clinics), avgBandwidth, activeShares, len(metrics))
+	generate := func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, defaultAnalysisTimeout)
+		defer cancel()
+		resp, err := a.llm.Generate(ctx, LLMRequest{Prompt: prompt, Purpose: "commentary"})
+		if err != nil {
+			return nil, err
+		}
+		return commentary{text: strings.TrimSpace(resp.Text), model: resp.Model, version: version}, nil
+	}
 
-	response, err := a.model.GenerateContent(ctx, genai.Text(prompt))
+	var value interface{}
+	if a.cache == nil {
+		value, err = generate(ctx)
+	} else {
+		// The figures, not the time they were computed at
+		value, stats.CommentaryCached, err = a.cache.get(ctx, "commentary", hashOf(string(data)), generate)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate analysis: %v", err)
+		return err
 	}
+	c := value.(commentary)
+	stats.Commentary, stats.CommentaryModel, stats.CommentaryPromptVersion = c.text, c.model, c.version
+	return nil
+}
 
-	// Calculate previous network uptime from metrics
-	var previousUptime float64
-	if len(metrics) > 1 {
-		onlineCount := 0
-		for _, metric := range metrics[:len(metrics)-1] {
-			clinic := findClinicByID(clinics, metric.ClinicID)
-			if clinic != nil && clinic.NetworkStatus == "online" {
-				onlineCount++
-			}
+// load averages each clinic's bandwidth over [from, to) as a percentage of
+// its link capacity, then averages over the clinics
+func (a *NetworkStatsAnalyzer) load(metrics []models.Metrics, from, to time.Time) *float64 {
+	type sum struct {
+		bandwidth float64
+		count     int
+	}
+	clinics := make(map[string]*sum)
+	for _, m := range metrics {
+		if !within(m.Timestamp, from, to) {
+			continue
+		}
+		s := clinics[m.ClinicID]
+		if s == nil {
+			s = &sum{}
+			clinics[m.ClinicID] = s
 		}
-		previousUptime = float64(onlineCount) / float64(len(metrics)-1) * 100
+		s.bandwidth += m.Bandwidth()
+		s.count++
 	}
 
-	// Parse AI response and format stats
-	networkUptimeValue := "N/A"
-	networkUptimeFloat := float64(0)
-	if len(response.Candidates) > 0 {
-		content := response.Candidates[0].Content
-		var textResponse string
+	var total float64
+	var n int
+	for id, s := range clinics {
+		capacity := a.config.LinkCapacity
+		if c, ok := a.config.LinkCapacities[id]; ok {
+			capacity = c
+		}
+		if capacity <= 0 {
+			continue
+		}
+		total += s.bandwidth / float64(s.count) / capacity * 100
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	return float64Ptr(total / float64(n))
+}
 
-		// Iterate over the Parts slice to extract text content
-		for _, part := range content.Parts {
-			if text, ok := part.(genai.Text); ok {
-				textResponse += string(text)
+// statusUptime returns the share of observed clinic time in [from, to)
+// spent online. Each observation holds until the clinic's next one.
+func statusUptime(statuses []models.ClinicStatus, from, to time.Time) *float64 {
+	var online, observed time.Duration
+	for _, list := range statusesByClinic(statuses) {
+		for i, s := range list {
+			start, end := s.Timestamp, to
+			if i+1 < len(list) && list[i+1].Timestamp.Before(to) {
+				end = list[i+1].Timestamp
+			}
+			if start.Before(from) {
+				start = from
+			}
+			if !end.After(start) {
+				continue
+			}
+			observed += end.Sub(start)
+			if s.Status == "online" {
+				online += end.Sub(start)
 			}
 		}
+	}
+	if observed == 0 {
+		return nil
+	}
+	return float64Ptr(100 * float64(online) / float64(observed))
+}
 
-		// Parse the network uptime value using string manipulation
-		lines := strings.Split(textResponse, "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if strings.Contains(strings.ToLower(line), "network uptime") {
-				// Extract the percentage value using regex
-				re := regexp.MustCompile(`(\d+\.?\d*)%`)
-				if matches := re.FindStringSubmatch(line); len(matches) > 1 {
-					networkUptimeValue = matches[1] + "%"
-					break
-				}
+// statusesAt counts the clinics online at t, and those observed before it,
+// from each clinic's latest observation before t
+func statusesAt(statuses []models.ClinicStatus, t time.Time) (online, total int) {
+	for _, list := range statusesByClinic(statuses) {
+		var last *models.ClinicStatus
+		for i := range list {
+			if !list[i].Timestamp.Before(t) {
+				break
 			}
+			last = &list[i]
 		}
-
-		// Convert networkUptimeValue to float for comparison
-		re := regexp.MustCompile(`(\d+\.?\d*)%`)
-		if matches := re.FindStringSubmatch(networkUptimeValue); len(matches) > 1 {
-			networkUptimeFloat, _ = strconv.ParseFloat(matches[1], 64)
+		if last == nil {
+			continue
+		}
+		total++
+		if last.Status == "online" {
+			online++
 		}
 	}
+	return online, total
+}
 
-	// Calculate uptime change
-	uptimeChange := networkUptimeFloat - previousUptime
-	uptimeChangeStr := fmt.Sprintf("%+.1f%%", uptimeChange)
-	uptimeTrend := "stable"
-	if uptimeChange > 0 {
-		uptimeTrend = "up"
-	} else if uptimeChange < 0 {
-		uptimeTrend = "down"
-	}
-
-	stats := []map[string]interface{}{
-		{
-			"title":  "Network Uptime",
-			"value":  networkUptimeValue,
-			"icon":   "Signal",
-			"trend":  uptimeTrend,
-			"change": uptimeChangeStr,
-		},
-		{
-			"title":  "Active Facilities",
-			"value":  fmt.Sprintf("%d/%d", activeCount, len(clinics)),
-			"icon":   "Server",
-			"trend":  getActiveFacilitiesTrend(activeCount, len(clinics)),
-			"change": fmt.Sprintf("%+d", activeCount-len(clinics)/2),
-		},
-		{
-			"title":  "Active Shares",
-			"value":  fmt.Sprintf("%d", activeShares),
-			"icon":   "Share2",
-			"trend":  getSharesTrend(activeShares),
-			"change": fmt.Sprintf("+%d", activeShares),
-		},
-		{
-			"title":  "Network Load",
-			"value":  fmt.Sprintf("%.1f%%", avgBandwidth/100),
-			"icon":   "Activity",
-			"trend":  getLoadTrend(avgBandwidth),
-			"change": fmt.Sprintf("%+.1f Mbps", avgBandwidth-50),
-		},
+// statusesByClinic groups observations by clinic, oldest first
+func statusesByClinic(statuses []models.ClinicStatus) map[string][]models.ClinicStatus {
+	byClinic := make(map[string][]models.ClinicStatus)
+	for _, s := range statuses {
+		byClinic[s.ClinicID] = append(byClinic[s.ClinicID], s)
 	}
-
-	return stats, nil
+	for _, list := range byClinic {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Timestamp.Before(list[j].Timestamp) })
+	}
+	return byClinic
 }
 
-func getActiveFacilitiesTrend(active, total int) string {
-	ratio := float64(active) / float64(total)
-	if ratio > 0.8 {
-		return "up"
-	} else if ratio < 0.6 {
-		return "down"
+// percentStat builds a tile for a percentage, N/A without data
+func percentStat(title, icon string, current, previous *float64) Stat {
+	s := Stat{Title: title, Value: "N/A", Icon: icon, Current: roundPtr(current), Previous: roundPtr(previous)}
+	if s.Current != nil {
+		s.Value = fmt.Sprintf("%.1f%%", *s.Current)
 	}
-	return "stable"
+	s.Trend, s.Change = compare(s.Current, s.Previous, "%+.1f%%")
+	return s
 }
 
-func getSharesTrend(shares int) string {
-	if shares > 2 {
-		return "up"
-	} else if shares == 0 {
-		return "down"
+// compare returns the trend and formatted change from previous to current.
+// Without both figures the trend is stable and the change N/A.
+func compare(current, previous *float64, format string) (trend, change string) {
+	if current == nil || previous == nil {
+		return TrendStable, "N/A"
+	}
+	diff := *current - *previous
+	switch {
+	case math.Abs(diff) < 0.05:
+		return TrendStable, fmt.Sprintf(format, 0.0)
+	case diff > 0:
+		return TrendUp, fmt.Sprintf(format, diff)
+	default:
+		return TrendDown, fmt.Sprintf(format, diff)
 	}
-	return "stable"
 }
 
-func getLoadTrend(load float64) string {
-	if load > 75 {
-		return "up"
-	} else if load < 25 {
-		return "down"
-	}
-	return "stable"
+func within(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
 }
 
-func findClinicByID(clinics []models.Clinic, clinicID string) *models.Clinic {
-	for i := range clinics {
-		if clinics[i].ID == clinicID {
-			return &clinics[i]
-		}
+func roundPtr(v *float64) *float64 {
+	if v == nil {
+		return nil
 	}
-	return nil
+	return float64Ptr(math.Round(*v*10) / 10)
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
 }
@@ -0,0 +1,113 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func TestAnalyzeNetworkStats(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	at := func(minutesAgo int) time.Time { return now.Add(-time.Duration(minutesAgo) * time.Minute) }
+
+	in := StatsInput{
+		Now: now,
+		Clinics: []models.Clinic{
+			{ID: "a", NetworkStatus: "online"},
+			{ID: "b", NetworkStatus: "online"},
+			{ID: "c", NetworkStatus: "offline"},
+		},
+		Statuses: []models.ClinicStatus{
+			// Previous window: a online throughout, b offline throughout
+			{ClinicID: "a", Status: "online", Timestamp: at(120)},
+			{ClinicID: "b", Status: "offline", Timestamp: at(120)},
+			// Current window: a online, b online from the half hour
+			{ClinicID: "b", Status: "online", Timestamp: at(30)},
+		},
+		Shares: []models.EmergencyShare{
+			{SourceID: "a", TargetID: "b", CanShare: true, Timestamp: at(10)},
+			{SourceID: "a", TargetID: "c", CanShare: false, Timestamp: at(10)}, // Refused
+			{SourceID: "b", TargetID: "c", CanShare: true, Timestamp: at(20)},
+			{SourceID: "a", TargetID: "b", CanShare: true, Timestamp: at(90)},
+		},
+		Metrics: []models.Metrics{
+			// 5 and 3 MB/s against 10 MB/s links, 2 MB/s before
+			{ClinicID: "a", Timestamp: at(10), BytesRecvRate: 5 * 1024 * 1024},
+			{ClinicID: "b", Timestamp: at(10), BytesRecvRate: 3 * 1024 * 1024},
+			{ClinicID: "a", Timestamp: at(70), BytesRecvRate: 2 * 1024 * 1024},
+		},
+	}
+
+	stats, err := NewNetworkStatsAnalyzer(nil, StatsConfig{LinkCapacity: 10}).AnalyzeNetworkStats(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.From.Equal(at(60)) || !stats.To.Equal(now) {
+		t.Errorf("Unexpected window %v to %v", stats.From, stats.To)
+	}
+
+	want := []struct{ title, value, trend, change string }{
+		{"Network Uptime", "75.0%", TrendUp, "+25.0%"},
+		{"Active Facilities", "2/3", TrendUp, "+1"},
+		{"Active Shares", "2", TrendUp, "+1"},
+		{"Network Load", "40.0%", TrendUp, "+20.0%"},
+	}
+	if len(stats.Stats) != len(want) {
+		t.Fatalf("Expected %d stats, got %+v", len(want), stats.Stats)
+	}
+	for i, w := range want {
+		s := stats.Stats[i]
+		if s.Title != w.title || s.Value != w.value || s.Trend != w.trend || s.Change != w.change {
+			t.Errorf("Stat %d = %+v, want %+v", i, s, w)
+		}
+	}
+	if stats.Commentary != "" || stats.CommentaryError != "" {
+		t.Errorf("Expected no commentary unless asked for, got %+v", stats)
+	}
+}
+
+func TestAnalyzeNetworkStatsWithoutData(t *testing.T) {
+	// No metrics, statuses or capacity must not divide by zero
+	stats, err := NewNetworkStatsAnalyzer(nil, StatsConfig{}).AnalyzeNetworkStats(context.Background(),
+		StatsInput{Now: time.Now(), Commentary: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stats.Stats {
+		if s.Title == "Active Facilities" {
+			if s.Value != "0/0" || s.Change != "N/A" {
+				t.Errorf("Unexpected active facilities %+v", s)
+			}
+			continue
+		}
+		if s.Title == "Active Shares" {
+			continue
+		}
+		if s.Value != "N/A" || s.Trend != TrendStable || s.Current != nil {
+			t.Errorf("Expected %s to be N/A, got %+v", s.Title, s)
+		}
+	}
+	if stats.CommentaryError != ErrNoLLM.Error() {
+		t.Errorf("Expected ErrNoLLM for commentary, got %q", stats.CommentaryError)
+	}
+}
+
+func TestNetworkStatsCommentary(t *testing.T) {
+	llm := &FakeLLM{Reply: func(LLMRequest) (string, error) {
+		return " Uptime is steady. ", nil
+	}}
+	stats, err := NewNetworkStatsAnalyzer(llm, StatsConfig{}).AnalyzeNetworkStats(context.Background(),
+		StatsInput{Now: time.Now(), Commentary: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Commentary != "Uptime is steady." || stats.CommentaryModel != ProviderFake {
+		t.Errorf("Unexpected commentary %+v", stats)
+	}
+	if prompt := llm.Requests()[0].Prompt; !strings.Contains(prompt, `"title": "Network Uptime"`) {
+		t.Errorf("Expected the computed stats in the prompt:\n%s", prompt)
+	}
+}
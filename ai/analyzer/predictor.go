@@ -2,231 +2,320 @@
 package analyzer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/store"
 )
 
-type Predictor struct {
-	historicalData []models.Metrics
-	windowSize     int
+// ErrInsufficientHistory is returned when no metric has enough stored
+// history to fit a forecast
+var ErrInsufficientHistory = errors.New("insufficient historical data")
+
+// ForecastMetrics are the metrics forecast, in the order returned
+var ForecastMetrics = []string{"latency", "bandwidth", "cpu_usage", "memory_usage", "disk_usage"}
+
+// ForecastConfig sets how forecasts are fitted, loaded from config.yaml
+type ForecastConfig struct {
+	// How far ahead to forecast; defaults to 15m, 1h and 24h
+	Horizons []time.Duration `yaml:"horizons"`
+	// History fitted, as Step averages; defaults to 7 days of 5 minutes
+	Lookback time.Duration `yaml:"lookback"`
+	Step     time.Duration `yaml:"step"`
+	// Length of the seasonal cycle; defaults to 24h. The season is modelled
+	// once the history covers two cycles.
+	Season time.Duration `yaml:"season"`
+	// Coverage of the prediction intervals; defaults to 0.95
+	Level float64 `yaml:"level"`
 }
 
-func NewPredictor(windowSize int) *Predictor {
-	return &Predictor{
-		historicalData: make([]models.Metrics, 0),
-		windowSize:     windowSize,
-	}
-}
+const (
+	// minForecastPoints is the history needed to forecast a metric
+	minForecastPoints = 12
+	// forecastDamping flattens the trend further ahead, so that a short
+	// rise is not extrapolated across a day
+	forecastDamping = 0.98
+)
 
-// AddMetrics adds new metrics to the historical data
-func (p *Predictor) AddMetrics(metrics models.Metrics) {
-	p.historicalData = append(p.historicalData, metrics)
-	if len(p.historicalData) > p.windowSize {
-		p.historicalData = p.historicalData[1:]
+// Forecast models
+const (
+	ModelHoltWinters = "holt_winters" // Damped trend with additive season
+	ModelHolt        = "holt"         // Damped trend, before two seasons of history
+)
+
+func (c ForecastConfig) withDefaults() ForecastConfig {
+	if len(c.Horizons) == 0 {
+		c.Horizons = []time.Duration{15 * time.Minute, time.Hour, 24 * time.Hour}
+	}
+	if c.Lookback == 0 {
+		c.Lookback = 7 * 24 * time.Hour
+	}
+	if c.Step == 0 {
+		c.Step = 5 * time.Minute
 	}
+	if c.Season == 0 {
+		c.Season = 24 * time.Hour
+	}
+	if c.Level == 0 {
+		c.Level = 0.95
+	}
+	return c
 }
 
-// PredictNextHour predicts metrics for the next hour
-func (p *Predictor) PredictNextHour() ([]models.Prediction, error) {
-	if len(p.historicalData) < 2 {
-		return nil, fmt.Errorf("insufficient historical data")
+// Validate checks the horizons, step, season and level
+func (c ForecastConfig) Validate() error {
+	c = c.withDefaults()
+	for _, h := range c.Horizons {
+		if h <= 0 {
+			return fmt.Errorf("horizons must be positive (got %v)", h)
+		}
 	}
+	if c.Step < 0 || c.Lookback < 0 || c.Season < 0 {
+		return fmt.Errorf("lookback, step and season must not be negative")
+	}
+	if c.Season%c.Step != 0 {
+		return fmt.Errorf("season %v must be a multiple of step %v", c.Season, c.Step)
+	}
+	if c.Lookback < minForecastPoints*c.Step {
+		return fmt.Errorf("lookback must cover at least %d steps", minForecastPoints)
+	}
+	if c.Level <= 0 || c.Level >= 1 {
+		return fmt.Errorf("level must be between 0 and 1 (got %v)", c.Level)
+	}
+	return nil
+}
 
-	predictions := make([]models.Prediction, 0)
-
-	// Predict bandwidth usage
-	bandwidthPred := p.predictMetric(func(m models.Metrics) float64 {
-		return float64(m.BytesSent + m.BytesReceived)
-	})
-	predictions = append(predictions, models.Prediction{
-		Timestamp:  time.Now().Add(time.Hour),
-		Metric:     "bandwidth",
-		Value:      bandwidthPred,
-		Confidence: p.calculateConfidence(),
-	})
+// Predictor forecasts a clinic's metrics from the stored history
+type Predictor struct {
+	metrics store.Querier
+	config  ForecastConfig
+}
 
-	// Predict latency
-	latencyPred := p.predictMetric(func(m models.Metrics) float64 {
-		return m.Latency
-	})
-	predictions = append(predictions, models.Prediction{
-		Timestamp:  time.Now().Add(time.Hour),
-		Metric:     "latency",
-		Value:      latencyPred,
-		Confidence: p.calculateConfidence(),
-	})
+// NewPredictor creates a predictor that fits the history in metrics
+func NewPredictor(metrics store.Querier, config ForecastConfig) *Predictor {
+	return &Predictor{metrics: metrics, config: config.withDefaults()}
+}
 
-	return predictions, nil
+// Horizons returns the configured forecast horizons
+func (p *Predictor) Horizons() []time.Duration {
+	return p.config.Horizons
 }
 
-// predictMetric uses simple linear regression for prediction
-func (p *Predictor) predictMetric(getter func(models.Metrics) float64) float64 {
-	if len(p.historicalData) < 2 {
-		return 0.0
+// Forecast predicts each metric at each horizon after now, fitted on the
+// history before now. Metrics without enough history are left out.
+func (p *Predictor) Forecast(ctx context.Context, clinicID string, now time.Time, horizons []time.Duration) ([]models.Prediction, error) {
+	if len(horizons) == 0 {
+		horizons = p.config.Horizons
 	}
-
-	// Calculate moving average
-	var sum float64
-	for _, m := range p.historicalData {
-		sum += getter(m)
+	z := math.Sqrt2 * math.Erfinv(p.config.Level)
+
+	predictions := make([]models.Prediction, 0, len(ForecastMetrics)*len(horizons))
+	for _, metric := range ForecastMetrics {
+		series, last, err := p.series(ctx, clinicID, metric, now)
+		if err != nil {
+			return nil, err
+		}
+		if len(series) < minForecastPoints {
+			continue
+		}
+
+		fit := fitForecast(series, int(p.config.Season/p.config.Step))
+		for _, h := range horizons {
+			// Steps from the last point, which may be some time before now
+			steps := int(math.Ceil(float64(now.Add(h).Sub(last)) / float64(p.config.Step)))
+			if steps < 1 {
+				steps = 1
+			}
+			value, sd := fit.forecast(steps)
+			predictions = append(predictions, models.Prediction{
+				ClinicID:  clinicID,
+				Metric:    metric,
+				Horizon:   formatHorizon(h),
+				Timestamp: now.Add(h),
+				Value:     clampMetric(metric, value),
+				Lower:     clampMetric(metric, value-z*sd),
+				Upper:     clampMetric(metric, value+z*sd),
+				Level:     p.config.Level,
+				Model:     fit.model,
+				Points:    len(series),
+			})
+		}
 	}
-	average := sum / float64(len(p.historicalData))
-
-	// Use linear regression for trend
-	prediction := p.calculatePrediction(getter)
-
-	// Blend prediction with moving average
-	blendedPrediction := (prediction + average) / 2
-
-	// Apply reasonable bounds
-	switch {
-	case getter(p.historicalData[0]) > 1000000: // Bandwidth
-		return math.Min(blendedPrediction, 10*1024*1024*1024) // Max 10 GB/s
-	case getter(p.historicalData[0]) < 1000: // Latency
-		return math.Min(blendedPrediction, 1000) // Max 1000ms
-	default:
-		return blendedPrediction
+	if len(predictions) == 0 {
+		return nil, ErrInsufficientHistory
 	}
+	return predictions, nil
 }
 
-func (p *Predictor) linearRegression(x, y []float64) (float64, float64) {
-	n := float64(len(x))
-	if n < 2 {
-		return 0, 0
+// series returns a metric's step averages over the lookback, with gaps
+// interpolated, and the time of the last one
+func (p *Predictor) series(ctx context.Context, clinicID, metric string, now time.Time) ([]float64, time.Time, error) {
+	step := p.config.Step
+	points, err := p.metrics.Query(ctx, store.Query{
+		ClinicID:    clinicID,
+		Metric:      metric,
+		From:        now.Add(-p.config.Lookback).Truncate(step),
+		To:          now,
+		Step:        step,
+		Aggregation: store.AggAvg,
+	})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to load %s history: %v", metric, err)
 	}
-
-	sumX, sumY := 0.0, 0.0
-	sumXY, sumXX := 0.0, 0.0
-
-	for i := 0; i < len(x); i++ {
-		sumX += x[i]
-		sumY += y[i]
-		sumXY += x[i] * y[i]
-		sumXX += x[i] * x[i]
+	if len(points) == 0 {
+		return nil, time.Time{}, nil
 	}
 
-	// Avoid division by zero
-	denominator := n*sumXX - sumX*sumX
-	if denominator == 0 {
-		return 0, sumY / n
+	first := points[0].Timestamp
+	series := make([]float64, int(points[len(points)-1].Timestamp.Sub(first)/step)+1)
+	prev := -1
+	for _, pt := range points {
+		i := int(pt.Timestamp.Sub(first) / step)
+		series[i] = pt.Value
+		for j := prev + 1; j < i; j++ {
+			// Linear between the points either side of the gap
+			series[j] = series[prev] + (pt.Value-series[prev])*float64(j-prev)/float64(i-prev)
+		}
+		prev = i
 	}
-
-	slope := (n*sumXY - sumX*sumY) / denominator
-	intercept := (sumY - slope*sumX) / n
-
-	return slope, intercept
+	return series, points[len(points)-1].Timestamp, nil
 }
 
-func (p *Predictor) calculateConfidence() float64 {
-	if len(p.historicalData) < 5 {
-		return 0.5 // Return 50% confidence when insufficient data
-	}
-
-	// Get predictions and actuals
-	predictions := make([]float64, len(p.historicalData))
-	actuals := make([]float64, len(p.historicalData))
+// forecastFit is a fitted exponential smoothing model in error correction
+// form, with its state after the last point
+type forecastFit struct {
+	model                     string
+	alpha, beta, gamma, sigma float64
+	level, trend              float64
+	season                    []float64 // By position in the cycle; nil without a season
+	next                      int       // Position of the step after the last point
+}
 
-	for i, metrics := range p.historicalData {
-		actuals[i] = float64(metrics.BytesSent + metrics.BytesReceived)
-		predictions[i] = p.calculatePrediction(func(m models.Metrics) float64 {
-			return float64(m.BytesSent + m.BytesReceived)
-		})
+// fitForecast fits a damped Holt-Winters model with a season of period
+// points, or Holt's damped trend when the series is shorter than two
+// seasons. The smoothing parameters minimise the one-step-ahead squared
+// error over a grid.
+func fitForecast(series []float64, period int) forecastFit {
+	seasonal := period > 1 && len(series) >= 2*period
+
+	best := forecastFit{sigma: math.Inf(1)}
+	for _, alpha := range []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9} {
+		for _, b := range []float64{0.01, 0.05, 0.1, 0.3} {
+			gammas := []float64{0}
+			if seasonal {
+				gammas = []float64{0.01, 0.05, 0.1, 0.2}
+			}
+			for _, gamma := range gammas {
+				if gamma > 1-alpha {
+					continue
+				}
+				fit := runForecast(series, period, seasonal, alpha, alpha*b, gamma)
+				if fit.sigma < best.sigma {
+					best = fit
+				}
+			}
+		}
 	}
-
-	// Calculate R-squared
-	rSquared := calculateRSquared(predictions, actuals)
-
-	// Calculate variance and normalize it
-	variance := p.calculateVariance()
-	varianceWeight := math.Exp(-variance / 1e12) // Normalize for large bandwidth numbers
-
-	// Combine R-squared and variance for final confidence
-	// Higher variance reduces confidence, higher R-squared increases it
-	confidence := (rSquared*0.7 + varianceWeight*0.3)
-
-	// Ensure confidence is between 0.1 and 1.0
-	return math.Max(math.Min(confidence, 1.0), 0.1)
+	return best
 }
 
-func (p *Predictor) calculateVariance() float64 {
-	if len(p.historicalData) < 2 {
-		return 0.0
+// runForecast smooths the series with the given parameters
+func runForecast(series []float64, period int, seasonal bool, alpha, beta, gamma float64) forecastFit {
+	fit := forecastFit{model: ModelHolt, alpha: alpha, beta: beta, gamma: gamma}
+	start := 1
+	fit.level = series[0]
+	fit.trend = series[1] - series[0]
+
+	if seasonal {
+		// Start from the first cycle's mean, trend between the first two
+		// cycles, and each point's difference from the mean
+		fit.model = ModelHoltWinters
+		first, second := mean(series[:period]), mean(series[period:2*period])
+		fit.level = first
+		fit.trend = (second - first) / float64(period)
+		fit.season = make([]float64, period)
+		for i := range fit.season {
+			fit.season[i] = series[i] - first
+		}
+		start = period
 	}
 
-	var sum float64
-	var sumSquares float64
-
-	// Calculate variance for bandwidth
-	for _, metrics := range p.historicalData {
-		value := float64(metrics.BytesSent + metrics.BytesReceived)
-		sum += value
-		sumSquares += value * value
+	var sse float64
+	for t := start; t < len(series); t++ {
+		var s float64
+		if seasonal {
+			s = fit.season[t%period]
+		}
+		e := series[t] - (fit.level + forecastDamping*fit.trend + s)
+		sse += e * e
+
+		fit.level += forecastDamping*fit.trend + alpha*e
+		fit.trend = forecastDamping*fit.trend + beta*e
+		if seasonal {
+			fit.season[t%period] += gamma * e
+		}
 	}
-
-	n := float64(len(p.historicalData))
-	mean := sum / n
-
-	// Calculate variance
-	variance := (sumSquares/n - mean*mean)
-
-	return variance
+	fit.sigma = math.Sqrt(sse / float64(len(series)-start))
+	fit.next = len(series)
+	return fit
 }
 
-func calculateRSquared(predictions, actuals []float64) float64 {
-	if len(predictions) != len(actuals) || len(predictions) < 2 {
-		return 0.0
+// forecast returns the prediction h steps after the last point and its
+// standard deviation
+func (f forecastFit) forecast(h int) (value, sd float64) {
+	// Damped trend sum phi + phi^2 + ... + phi^j
+	damped := func(j int) float64 {
+		return forecastDamping * (1 - math.Pow(forecastDamping, float64(j))) / (1 - forecastDamping)
 	}
 
-	var sumPredictions, sumActuals, sumPredictedSquares, sumActualSquares, sumPredictedActuals float64
-
-	for i := 0; i < len(predictions); i++ {
-		sumPredictions += predictions[i]
-		sumActuals += actuals[i]
-		sumPredictedSquares += predictions[i] * predictions[i]
-		sumActualSquares += actuals[i] * actuals[i]
-		sumPredictedActuals += predictions[i] * actuals[i]
+	value = f.level + damped(h)*f.trend
+	period := len(f.season)
+	if period > 0 {
+		value += f.season[(f.next+h-1)%period]
 	}
 
-	n := float64(len(predictions))
-
-	// Avoid division by zero
-	if n == 0 {
-		return 0.0
+	variance := 1.0
+	for j := 1; j < h; j++ {
+		c := f.alpha + f.beta*damped(j)
+		if period > 0 && j%period == 0 {
+			c += f.gamma
+		}
+		variance += c * c
 	}
+	return value, f.sigma * math.Sqrt(variance)
+}
 
-	meanPredicted := sumPredictions / n
-	meanActual := sumActuals / n
-
-	variancePredicted := sumPredictedSquares/n - meanPredicted*meanPredicted
-	varianceActual := sumActualSquares/n - meanActual*meanActual
-
-	// Avoid division by zero
-	if variancePredicted == 0 || varianceActual == 0 {
-		return 0.0
+// clampMetric keeps a forecast within the metric's possible values
+func clampMetric(metric string, v float64) float64 {
+	v = math.Max(v, 0)
+	switch metric {
+	case "cpu_usage", "memory_usage", "disk_usage":
+		v = math.Min(v, 100)
 	}
-
-	covariance := sumPredictedActuals/n - meanPredicted*meanActual
-	rSquared := math.Pow(covariance/math.Sqrt(variancePredicted*varianceActual), 2)
-
-	return math.Max(math.Min(rSquared, 1.0), 0.0) // Ensure between 0 and 1
+	return math.Round(v*100) / 100
 }
 
-func (p *Predictor) calculatePrediction(getter func(models.Metrics) float64) float64 {
-	x := make([]float64, len(p.historicalData))
-	y := make([]float64, len(p.historicalData))
-
-	for i, metrics := range p.historicalData {
-		x[i] = float64(i)
-		y[i] = getter(metrics)
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
 	}
+	return sum / float64(len(values))
+}
 
-	// Calculate linear regression
-	slope, intercept := p.linearRegression(x, y)
-
-	// Predict next value
-	nextX := float64(len(x))
-	return slope*nextX + intercept
+// formatHorizon writes a horizon without zero units, e.g. 15m or 24h
+func formatHorizon(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
 }
@@ -0,0 +1,126 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/store"
+)
+
+// seriesQuerier answers every metric with value at each step, skipping the
+// steps where it reports false
+type seriesQuerier struct {
+	start time.Time
+	value func(metric string, t time.Time) (float64, bool)
+}
+
+func (q seriesQuerier) Query(ctx context.Context, query store.Query) ([]store.Point, error) {
+	var points []store.Point
+	for t := query.From; t.Before(query.To); t = t.Add(query.Step) {
+		if t.Before(q.start) {
+			continue
+		}
+		if v, ok := q.value(query.Metric, t); ok {
+			points = append(points, store.Point{Timestamp: t, Value: v, Count: 1})
+		}
+	}
+	return points, nil
+}
+
+func TestForecastSeasonal(t *testing.T) {
+	now := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)
+	// Latency peaks each afternoon, with a little noise and a gap
+	daily := func(t time.Time) float64 {
+		hours := float64(t.Hour()) + float64(t.Minute())/60
+		return 100 + 50*math.Sin(2*math.Pi*(hours-9)/24)
+	}
+	q := seriesQuerier{start: now.Add(-4 * 24 * time.Hour), value: func(metric string, t time.Time) (float64, bool) {
+		if metric != "latency" || (t.After(now.Add(-30*time.Hour)) && t.Before(now.Add(-29*time.Hour))) {
+			return 0, false
+		}
+		return daily(t) + 3*math.Sin(float64(t.Unix()/300)), true
+	}}
+
+	predictions, err := NewPredictor(q, ForecastConfig{}).Forecast(context.Background(), "kisumu-001", now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predictions) != 3 {
+		t.Fatalf("Expected latency at three horizons, got %+v", predictions)
+	}
+	for i, want := range []string{"15m", "1h", "24h"} {
+		p := predictions[i]
+		if p.Metric != "latency" || p.Horizon != want || p.Model != ModelHoltWinters || p.ClinicID != "kisumu-001" {
+			t.Errorf("Unexpected prediction %+v", p)
+		}
+		actual := daily(p.Timestamp)
+		if math.Abs(p.Value-actual) > 10 || p.Lower > actual || p.Upper < actual {
+			t.Errorf("%s: forecast %.1f [%.1f, %.1f], actual %.1f", p.Horizon, p.Value, p.Lower, p.Upper, actual)
+		}
+		if i > 0 && p.Upper-p.Lower < predictions[i-1].Upper-predictions[i-1].Lower {
+			t.Errorf("Expected the interval to widen with the horizon, got %+v", predictions)
+		}
+	}
+}
+
+func TestForecastWithoutSeason(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	start := now.Add(-3 * time.Hour)
+	// CPU climbing steadily for three hours; disk filling up
+	q := seriesQuerier{start: start, value: func(metric string, t time.Time) (float64, bool) {
+		switch metric {
+		case "cpu_usage":
+			return 20 + 10*t.Sub(start).Hours(), true
+		case "disk_usage":
+			return 90 + 3*t.Sub(start).Hours(), true
+		}
+		return 0, false
+	}}
+
+	predictions, err := NewPredictor(q, ForecastConfig{}).Forecast(context.Background(), "a", now, []time.Duration{time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predictions) != 2 {
+		t.Fatalf("Expected CPU and disk, got %+v", predictions)
+	}
+	cpu, disk := predictions[0], predictions[1]
+	if cpu.Metric != "cpu_usage" || cpu.Model != ModelHolt || cpu.Value < 55 || cpu.Value > 65 {
+		t.Errorf("Expected the trend to continue to about 60%%, got %+v", cpu)
+	}
+	if disk.Value != 100 || disk.Upper != 100 {
+		t.Errorf("Expected disk usage capped at 100%%, got %+v", disk)
+	}
+}
+
+func TestForecastInsufficientHistory(t *testing.T) {
+	now := time.Now().Truncate(time.Minute)
+	q := seriesQuerier{start: now.Add(-20 * time.Minute), value: func(string, time.Time) (float64, bool) { return 1, true }}
+	if _, err := NewPredictor(q, ForecastConfig{}).Forecast(context.Background(), "a", now, nil); !errors.Is(err, ErrInsufficientHistory) {
+		t.Errorf("Expected ErrInsufficientHistory, got %v", err)
+	}
+}
+
+func TestForecastConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ForecastConfig
+		wantErr bool
+	}{
+		{"defaults", ForecastConfig{}, false},
+		{"negative horizon", ForecastConfig{Horizons: []time.Duration{-time.Hour}}, true},
+		{"season not a multiple of step", ForecastConfig{Step: 7 * time.Minute}, true},
+		{"short lookback", ForecastConfig{Lookback: 30 * time.Minute}, true},
+		{"level", ForecastConfig{Level: 95}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package analyzer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed prompts/*.tmpl
+var promptFiles embed.FS
+
+// Prompt locales
+const (
+	LocaleEnglish = "en"
+	LocaleSwahili = "sw"
+)
+
+// Prompt templates, each stored as prompts/<name>.<locale>.tmpl
+const (
+	PromptAlerts     = "alerts"
+	PromptCommentary = "stats_commentary"
+)
+
+var promptNames = []string{PromptAlerts, PromptCommentary}
+
+// Threshold overrides a metric's alert limits. Zero keeps the default.
+type Threshold struct {
+	Warning  float64 `yaml:"warning"`
+	Critical float64 `yaml:"critical"`
+	Trend    float64 `yaml:"trend"` // Increase over the window that warrants a warning
+}
+
+// PromptConfig selects the prompt templates and the thresholds they state
+type PromptConfig struct {
+	Locale string `yaml:"locale"` // en (default) or sw
+	// Directory of templates named <name>.<locale>.tmpl that replace the
+	// built-in ones
+	Dir string `yaml:"dir"`
+	// By metric: cpu_usage, memory_usage, latency or bandwidth. The local
+	// rules use the same limits.
+	Thresholds map[string]Threshold `yaml:"thresholds"`
+}
+
+// Prompts renders the analyzers' prompts in one locale
+type Prompts struct {
+	locale     string
+	thresholds []localThreshold
+	templates  map[string]promptTemplate
+}
+
+type promptTemplate struct {
+	template *template.Template
+	version  string
+}
+
+var promptFuncs = template.FuncMap{
+	"num":    func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"signed": func(v float64) string { return fmt.Sprintf("%+.2f", v) },
+}
+
+// defaultPrompts are the built-in English templates with the default
+// thresholds
+var defaultPrompts = func() *Prompts {
+	p, err := LoadPrompts(PromptConfig{})
+	if err != nil {
+		panic(err)
+	}
+	return p
+}()
+
+// LoadPrompts parses the templates for the configured locale. Each
+// template's version is its name, locale and a hash of its text, so any
+// edit changes it.
+func LoadPrompts(config PromptConfig) (*Prompts, error) {
+	if config.Locale == "" {
+		config.Locale = LocaleEnglish
+	}
+	if config.Locale != LocaleEnglish && config.Locale != LocaleSwahili {
+		return nil, fmt.Errorf("locale must be en or sw (got %q)", config.Locale)
+	}
+
+	thresholds, err := applyThresholds(config.Thresholds)
+	if err != nil {
+		return nil, err
+	}
+	p := &Prompts{locale: config.Locale, thresholds: thresholds, templates: make(map[string]promptTemplate)}
+
+	for _, name := range promptNames {
+		file := name + "." + config.Locale + ".tmpl"
+		text, err := readPrompt(config.Dir, file)
+		if err != nil {
+			return nil, err
+		}
+		t, err := template.New(file).Funcs(promptFuncs).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt %s: %v", file, err)
+		}
+		sum := sha256.Sum256(text)
+		p.templates[name] = promptTemplate{
+			template: t,
+			version:  name + "." + config.Locale + "@" + hex.EncodeToString(sum[:])[:12],
+		}
+	}
+	return p, nil
+}
+
+// readPrompt reads a template from dir, falling back to the built-in one
+func readPrompt(dir, file string) ([]byte, error) {
+	if dir != "" {
+		text, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return text, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read prompt %s: %v", file, err)
+		}
+	}
+	text, err := promptFiles.ReadFile("prompts/" + file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt %s: %v", file, err)
+	}
+	return text, nil
+}
+
+// applyThresholds returns the default thresholds with the overrides applied
+func applyThresholds(overrides map[string]Threshold) ([]localThreshold, error) {
+	thresholds := append([]localThreshold(nil), localThresholds...)
+	for metric, o := range overrides {
+		i := thresholdIndex(thresholds, metric)
+		if i < 0 {
+			return nil, fmt.Errorf("thresholds: unknown metric %q", metric)
+		}
+		t := &thresholds[i]
+		if o.Warning != 0 {
+			t.warning = o.Warning
+		}
+		if o.Critical != 0 {
+			t.critical = o.Critical
+		}
+		if o.Trend != 0 {
+			t.trend = o.Trend
+		}
+		if t.warning < 0 || t.trend < 0 || t.critical < t.warning {
+			return nil, fmt.Errorf("thresholds.%s: need 0 <= warning <= critical and trend >= 0", metric)
+		}
+	}
+	return thresholds, nil
+}
+
+func thresholdIndex(thresholds []localThreshold, metric string) int {
+	for i, t := range thresholds {
+		if t.metric == metric {
+			return i
+		}
+	}
+	return -1
+}
+
+// Locale returns the language the prompts ask for
+func (p *Prompts) Locale() string {
+	return p.locale
+}
+
+// Version returns the version of a template
+func (p *Prompts) Version(name string) string {
+	return p.templates[name].version
+}
+
+// Thresholds returns the warning and critical limits of a metric
+func (p *Prompts) Thresholds(metric string) (warning, critical float64, ok bool) {
+	if i := thresholdIndex(p.thresholds, metric); i >= 0 {
+		return p.thresholds[i].warning, p.thresholds[i].critical, true
+	}
+	return 0, 0, false
+}
+
+// keyword returns how the model refers to a metric
+func (p *Prompts) keyword(metric string) string {
+	if i := thresholdIndex(p.thresholds, metric); i >= 0 {
+		return p.thresholds[i].keyword
+	}
+	return metric
+}
+
+// render executes a template, returning the prompt and its version
+func (p *Prompts) render(name string, data interface{}) (prompt, version string, err error) {
+	t, ok := p.templates[name]
+	if !ok {
+		return "", "", fmt.Errorf("no prompt named %s", name)
+	}
+	var b bytes.Buffer
+	if err := t.template.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("failed to render prompt %s: %v", t.version, err)
+	}
+	return strings.TrimSpace(b.String()), t.version, nil
+}
+
+// alertsPrompt is what the alerts template sees
+type alertsPrompt struct {
+	Clinic     string // The clinics the samples are from
+	Summary    windowSummary
+	Thresholds map[string]Threshold // By metric
+}
+
+func (p *Prompts) alerts(clinic string, s windowSummary) (prompt, version string, err error) {
+	thresholds := make(map[string]Threshold, len(p.thresholds))
+	for _, t := range p.thresholds {
+		thresholds[t.metric] = Threshold{Warning: t.warning, Critical: t.critical, Trend: t.trend}
+	}
+	return p.render(PromptAlerts, alertsPrompt{Clinic: clinic, Summary: s, Thresholds: thresholds})
+}
+
+// commentaryPrompt is what the stats commentary template sees
+type commentaryPrompt struct {
+	Clinics int    // In the network
+	Window  string // e.g. 1h0m0s
+	To      string // End of the window, RFC 3339
+	Stats   string // The statistics as indented JSON
+}
@@ -0,0 +1,102 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrompts(t *testing.T) {
+	summary := summarize(overloadedWindow())
+	for _, locale := range []string{LocaleEnglish, LocaleSwahili} {
+		t.Run(locale, func(t *testing.T) {
+			p, err := LoadPrompts(PromptConfig{Locale: locale})
+			if err != nil {
+				t.Fatal(err)
+			}
+			prompt, version, err := p.alerts("kisumu-001", summary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(version, "alerts."+locale+"@") {
+				t.Errorf("Unexpected version %q", version)
+			}
+			for _, want := range []string{"kisumu-001", "CPU > 80%", "90.00%", `{"alerts": []}`} {
+				if !strings.Contains(prompt, want) {
+					t.Errorf("Prompt is missing %q:\n%s", want, prompt)
+				}
+			}
+			if _, _, err := p.render(PromptCommentary, commentaryPrompt{Clinics: 3, Window: "1h0m0s", Stats: "[]"}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoadPromptsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config PromptConfig
+		want   string
+	}{
+		{"locale", PromptConfig{Locale: "fr"}, "locale must be en or sw"},
+		{"unknown metric", PromptConfig{Thresholds: map[string]Threshold{"disk": {Critical: 95}}}, `unknown metric "disk"`},
+		{"critical below warning", PromptConfig{Thresholds: map[string]Threshold{"cpu_usage": {Critical: 60}}}, "warning <= critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadPrompts(tt.config); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPromptThresholdsAndOverrides(t *testing.T) {
+	dir := t.TempDir()
+	custom := `Clinic {{.Clinic}}: CPU peaked at {{num .Summary.CPU.Max}}%, critical above {{.Thresholds.cpu_usage.Critical}}%. Reply {"alerts": []}.`
+	if err := os.WriteFile(filepath.Join(dir, "alerts.en.tmpl"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPrompts(PromptConfig{Dir: dir, Thresholds: map[string]Threshold{"cpu_usage": {Warning: 85, Critical: 95}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version(PromptAlerts) == defaultPrompts.Version(PromptAlerts) {
+		t.Error("Expected the replaced template to have a new version")
+	}
+	if p.Version(PromptCommentary) != defaultPrompts.Version(PromptCommentary) {
+		t.Error("Expected the built-in commentary template to be kept")
+	}
+
+	llm := &FakeLLM{Reply: func(LLMRequest) (string, error) { return `{"alerts": []}`, nil }}
+	a := NewAnalyzer(llm, 0.5, time.Second)
+	a.UsePrompts(p)
+	window := overloadedWindow()
+	for i := range window {
+		window[i].ClinicID = "kisumu-001"
+	}
+	analysis, err := a.Analyze(context.Background(), window)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prompt := llm.Requests()[0].Prompt; prompt != `Clinic kisumu-001: CPU peaked at 90.00%, critical above 95%. Reply {"alerts": []}.` {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+	if analysis.PromptVersion != p.Version(PromptAlerts) {
+		t.Errorf("Expected prompt version %q, got %q", p.Version(PromptAlerts), analysis.PromptVersion)
+	}
+	// The local rules apply the same limits: CPU at 90% is now a warning
+	for _, alert := range analysis.Alerts {
+		if alert.Metric == "cpu_usage" {
+			t.Errorf("Expected no critical CPU finding, got %+v", alert)
+		}
+	}
+	if warning, critical, _ := a.Thresholds("cpu_usage"); warning != 85 || critical != 95 {
+		t.Errorf("Unexpected thresholds %v, %v", warning, critical)
+	}
+}
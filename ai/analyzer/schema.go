@@ -0,0 +1,84 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Schema types
+const (
+	SchemaObject = "object"
+	SchemaArray  = "array"
+	SchemaString = "string"
+	SchemaNumber = "number"
+)
+
+// Schema is the subset of JSON Schema that both Gemini and OpenAI-style
+// structured output understand
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// Always false for objects; strict OpenAI schemas require it
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+}
+
+// objectSchema builds an object schema whose properties are all required
+func objectSchema(properties map[string]*Schema) *Schema {
+	closed := false
+	s := &Schema{Type: SchemaObject, Properties: properties, AdditionalProperties: &closed}
+	for name := range properties {
+		s.Required = append(s.Required, name)
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// Severities are the values an LLM may use for an alert's severity
+var Severities = []string{"info", "warning", "critical"}
+
+// alertsSchema is the response format for AnalyzeMetrics. Strict OpenAI
+// schemas must have an object at the root, so the array is wrapped.
+var alertsSchema = objectSchema(map[string]*Schema{
+	"alerts": {
+		Type: SchemaArray,
+		Items: objectSchema(map[string]*Schema{
+			"severity":    {Type: SchemaString, Enum: Severities},
+			"description": {Type: SchemaString},
+			"recommended": {Type: SchemaString},
+		}),
+	},
+})
+
+// toGenai converts the schema for the Gemini API
+func (s *Schema) toGenai() *genai.Schema {
+	if s == nil {
+		return nil
+	}
+	g := &genai.Schema{Description: s.Description, Required: s.Required, Items: s.Items.toGenai()}
+	switch s.Type {
+	case SchemaObject:
+		g.Type = genai.TypeObject
+	case SchemaArray:
+		g.Type = genai.TypeArray
+	case SchemaNumber:
+		g.Type = genai.TypeNumber
+	default:
+		g.Type = genai.TypeString
+	}
+	if len(s.Enum) > 0 {
+		g.Format = "enum"
+		g.Enum = s.Enum
+	}
+	if len(s.Properties) > 0 {
+		g.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, p := range s.Properties {
+			g.Properties[name] = p.toGenai()
+		}
+	}
+	return g
+}
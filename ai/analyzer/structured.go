@@ -0,0 +1,197 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Kinds of unusable LLM responses. ParseError wraps one of these, so callers
+// can test with errors.Is.
+var (
+	ErrEmptyResponse = errors.New("empty response")
+	ErrNoJSON        = errors.New("no JSON in response")
+	ErrInvalidJSON   = errors.New("invalid JSON")
+	ErrSchema        = errors.New("response does not match schema")
+)
+
+// ParseError is returned when a model's response cannot be used, even after
+// a repair attempt
+type ParseError struct {
+	Kind   error  // One of the Err* values above
+	Detail string // What was wrong
+	Raw    string // The final response
+}
+
+func (e *ParseError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("unusable LLM response: %v", e.Kind)
+	}
+	return fmt.Sprintf("unusable LLM response: %v: %s", e.Kind, e.Detail)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Kind
+}
+
+// extractJSON returns the first JSON array or object in text, ignoring
+// markdown code fences and any prose around it
+func extractJSON(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", &ParseError{Kind: ErrEmptyResponse}
+	}
+
+	start := strings.IndexAny(text, "[{")
+	if start < 0 {
+		return "", &ParseError{Kind: ErrNoJSON, Raw: text}
+	}
+
+	// Find the matching close bracket, skipping brackets inside strings
+	var stack []byte
+	inString, escaped := false, false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '[' || c == '{':
+			stack = append(stack, c)
+		case c == ']' || c == '}':
+			open := byte('[')
+			if c == '}' {
+				open = '{'
+			}
+			if len(stack) == 0 || stack[len(stack)-1] != open {
+				return "", &ParseError{Kind: ErrInvalidJSON, Detail: fmt.Sprintf("unexpected %q at offset %d", c, i), Raw: text}
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return text[start : i+1], nil
+			}
+		}
+	}
+	return "", &ParseError{Kind: ErrInvalidJSON, Detail: "unterminated JSON", Raw: text}
+}
+
+// parseAlerts reads alerts from a model response. It accepts the schema's
+// {"alerts": [...]} object, a bare array, or a single alert object, and
+// checks each alert's fields.
+func parseAlerts(text string) ([]models.Alert, error) {
+	raw, err := extractJSON(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []json.RawMessage
+	if raw[0] == '[' {
+		err = json.Unmarshal([]byte(raw), &items)
+	} else {
+		var obj map[string]json.RawMessage
+		if err = json.Unmarshal([]byte(raw), &obj); err == nil {
+			if list, ok := obj["alerts"]; ok {
+				err = json.Unmarshal(list, &items)
+			} else {
+				items = []json.RawMessage{json.RawMessage(raw)}
+			}
+		}
+	}
+	if err != nil {
+		return nil, &ParseError{Kind: ErrInvalidJSON, Detail: err.Error(), Raw: text}
+	}
+
+	alerts := make([]models.Alert, 0, len(items))
+	for i, item := range items {
+		var a models.Alert
+		if err := json.Unmarshal(item, &a); err != nil {
+			return nil, &ParseError{Kind: ErrSchema, Detail: fmt.Sprintf("alert %d: %v", i+1, err), Raw: text}
+		}
+		a.Severity = strings.ToLower(strings.TrimSpace(a.Severity))
+		if !contains(Severities, a.Severity) {
+			return nil, &ParseError{Kind: ErrSchema,
+				Detail: fmt.Sprintf("alert %d: severity must be one of %s (got %q)", i+1, strings.Join(Severities, ", "), a.Severity),
+				Raw:    text}
+		}
+		if strings.TrimSpace(a.Description) == "" {
+			return nil, &ParseError{Kind: ErrSchema, Detail: fmt.Sprintf("alert %d: description is required", i+1), Raw: text}
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, nil
+}
+
+// alertsFormat describes alertsSchema in repair prompts
+var alertsFormat = fmt.Sprintf(`a JSON object of the form {"alerts": [...]}, where each alert has "severity" (one of %s), "description" and "recommended"`,
+	strings.Join(Severities, ", "))
+
+// repairPrompt asks the model to correct a response that failed to parse.
+// format describes the expected JSON.
+func repairPrompt(prompt, response string, err error, format string) string {
+	return fmt.Sprintf(`%s
+
+Your previous response could not be used (%v):
+%s
+
+Reply again with ONLY %s. No markdown, no commentary.`,
+		prompt, err, response, format)
+}
+
+// ParseStats counts how model responses were handled
+type ParseStats struct {
+	Responses int64            `json:"responses"` // Responses received, including repair attempts
+	Parsed    int64            `json:"parsed"`    // Usable on the first attempt
+	Repaired  int64            `json:"repaired"`  // Usable after the repair prompt
+	Failed    int64            `json:"failed"`    // Unusable after the repair prompt
+	Errors    map[string]int64 `json:"errors"`    // Unusable responses by error kind
+}
+
+// parseCounters accumulates ParseStats across requests
+type parseCounters struct {
+	mu    sync.Mutex
+	stats ParseStats
+}
+
+func (c *parseCounters) add(fn func(s *ParseStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stats.Errors == nil {
+		c.stats.Errors = make(map[string]int64)
+	}
+	fn(&c.stats)
+}
+
+func (c *parseCounters) recordError(err error) {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		c.add(func(s *ParseStats) { s.Errors[pe.Kind.Error()]++ })
+	}
+}
+
+func (c *parseCounters) snapshot() ParseStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Errors = make(map[string]int64, len(c.stats.Errors))
+	for k, v := range c.stats.Errors {
+		s.Errors[k] = v
+	}
+	return s
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
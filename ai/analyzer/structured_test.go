@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAlerts(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []string // Severities
+		err      error
+	}{
+		{"schema object", `{"alerts": [{"severity": "warning", "description": "High latency"}]}`, []string{"warning"}, nil},
+		{"empty", `{"alerts": []}`, []string{}, nil},
+		{"bare array", `[{"severity": "critical", "description": "a"}, {"severity": "info", "description": "b"}]`, []string{"critical", "info"}, nil},
+		{"single object", `{"severity": "Critical", "description": "CPU at 95%"}`, []string{"critical"}, nil},
+		{"fenced", "```json\n[{\"severity\": \"warning\", \"description\": \"x\"}]\n```", []string{"warning"}, nil},
+		{"trailing prose", `[{"severity": "warning", "description": "uses ] and } in text"}] These alerts need attention.`, []string{"warning"}, nil},
+		{"leading prose", `Here is the analysis: {"alerts": []}`, []string{}, nil},
+		{"blank", "  \n", nil, ErrEmptyResponse},
+		{"no json", "All metrics are within thresholds.", nil, ErrNoJSON},
+		{"truncated", `{"alerts": [{"severity": "warning"`, nil, ErrInvalidJSON},
+		{"mismatched", `[{"severity": "warning"]`, nil, ErrInvalidJSON},
+		{"bad severity", `[{"severity": "high", "description": "x"}]`, nil, ErrSchema},
+		{"no description", `[{"severity": "info"}]`, nil, ErrSchema},
+		{"wrong type", `{"alerts": [{"severity": 3, "description": "x"}]}`, nil, ErrSchema},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts, err := parseAlerts(tt.response)
+			if tt.err != nil {
+				var parseErr *ParseError
+				if !errors.Is(err, tt.err) || !errors.As(err, &parseErr) {
+					t.Fatalf("parseAlerts error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAlerts returned an error: %v", err)
+			}
+			if len(alerts) != len(tt.want) {
+				t.Fatalf("Got %d alerts, want %d", len(alerts), len(tt.want))
+			}
+			for i, a := range alerts {
+				if a.Severity != tt.want[i] {
+					t.Errorf("Alert %d severity = %q, want %q", i, a.Severity, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ExecutiveSummary asks the model for a short plain-text summary of a
+// report for county health managers. It returns the summary and the model
+// that wrote it.
+func (a *Analyzer) ExecutiveSummary(ctx context.Context, report interface{}) (string, string, error) {
+	if a.llm == nil {
+		return "", "", ErrNoLLM
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode report: %v", err)
+	}
+	prompt := fmt.Sprintf(`You are writing the executive summary of a network health report for county health managers in Kisumu County, Kenya, who oversee a network of rural health clinics.
+
+In at most five sentences of plain text, say how the network performed over the period, which clinics need attention and why, and what should be done next. Use only figures from the report. Uptime, latency percentiles (ms), alerts, emergency bandwidth sharing and forecast risk are given per clinic.
+
+Report:
+%s`, data)
+
+	resp, err := a.llm.Generate(ctx, LLMRequest{Prompt: prompt, Purpose: "summary"})
+	if err != nil {
+		return "", "", err
+	}
+	summary := strings.TrimSpace(resp.Text)
+	if summary == "" {
+		return "", "", &ParseError{Kind: ErrEmptyResponse, Raw: resp.Text}
+	}
+	return summary, resp.Model, nil
+}
@@ -0,0 +1,317 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a call would have to wait for the rate
+// limiter past its deadline
+var ErrRateLimited = errors.New("LLM rate limit exceeded")
+
+// RateLimit bounds the calls made to the model's API
+type RateLimit struct {
+	PerMinute float64 `yaml:"per_minute"` // Unlimited when 0
+	Burst     int     `yaml:"burst"`      // Calls allowed at once; defaults to 1
+}
+
+// Price is what a model charges in US dollars per million tokens
+type Price struct {
+	Input  float64 `yaml:"input" json:"input"`
+	Output float64 `yaml:"output" json:"output"`
+}
+
+// UsageTotals counts calls to the model and what they cost
+type UsageTotals struct {
+	Calls        int     `json:"calls"`
+	Errors       int     `json:"errors"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost_usd"`
+}
+
+// Call is one request sent to the model
+type Call struct {
+	At           time.Time `json:"at"`
+	Purpose      string    `json:"purpose,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cost         float64   `json:"cost_usd"`
+	DurationMs   int64     `json:"duration_ms"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Usage reports the calls made through a MeteredClient since it was created
+type Usage struct {
+	Since time.Time `json:"since"`
+	UsageTotals
+	// Requests answered by an identical call already in flight
+	Deduplicated int `json:"deduplicated"`
+	// Calls that waited for the rate limiter, and those that gave up
+	Throttled   int `json:"throttled"`
+	RateLimited int `json:"rate_limited"`
+
+	Models   map[string]UsageTotals `json:"models"`
+	Purposes map[string]UsageTotals `json:"purposes"`
+	Recent   []Call                 `json:"recent"` // Newest first
+}
+
+const maxRecentCalls = 100
+
+// MeteredClient wraps an LLMClient with a token-bucket rate limit,
+// deduplication of identical concurrent requests and token and cost
+// accounting
+type MeteredClient struct {
+	llm     LLMClient
+	limiter *limiter // nil when unlimited
+	pricing map[string]Price
+	model   string // Priced when a response does not name its model
+
+	flightMu sync.Mutex
+	flights  map[string]*llmFlight
+
+	mu       sync.Mutex
+	usage    Usage
+	models   map[string]*UsageTotals
+	purposes map[string]*UsageTotals
+	recent   []Call // Ring of the last maxRecentCalls
+	next     int
+}
+
+type llmFlight struct {
+	done chan struct{}
+	resp LLMResponse
+	err  error
+}
+
+// NewMeteredClient wraps llm with the rate limit and pricing in config
+func NewMeteredClient(llm LLMClient, config LLMConfig) *MeteredClient {
+	m := &MeteredClient{
+		llm:      llm,
+		pricing:  config.Pricing,
+		model:    config.Model,
+		flights:  make(map[string]*llmFlight),
+		usage:    Usage{Since: time.Now()},
+		models:   make(map[string]*UsageTotals),
+		purposes: make(map[string]*UsageTotals),
+	}
+	if config.RateLimit.PerMinute > 0 {
+		m.limiter = newLimiter(config.RateLimit.PerMinute/60, config.RateLimit.Burst)
+	}
+	return m
+}
+
+// Generate sends the request unless an identical one is already in flight,
+// in which case it waits for that call's response
+func (m *MeteredClient) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	key, err := requestKey(req)
+	if err != nil {
+		return m.call(ctx, req)
+	}
+
+	m.flightMu.Lock()
+	f, ok := m.flights[key]
+	if !ok {
+		f = &llmFlight{done: make(chan struct{})}
+		m.flights[key] = f
+
+		// The call outlives a caller that gives up, so that the others
+		// waiting on it still get an answer. It keeps the caller's
+		// deadline and the provider's timeout.
+		callCtx := context.WithoutCancel(ctx)
+		cancel := context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			callCtx, cancel = context.WithDeadline(callCtx, deadline)
+		}
+		go func() {
+			defer cancel()
+			f.resp, f.err = m.call(callCtx, req)
+			m.flightMu.Lock()
+			delete(m.flights, key)
+			m.flightMu.Unlock()
+			close(f.done)
+		}()
+	}
+	m.flightMu.Unlock()
+
+	if ok {
+		m.mu.Lock()
+		m.usage.Deduplicated++
+		m.mu.Unlock()
+	}
+	select {
+	case <-f.done:
+		return f.resp, f.err
+	case <-ctx.Done():
+		return LLMResponse{}, ctx.Err()
+	}
+}
+
+// call waits for the rate limiter, then calls the model and records it
+func (m *MeteredClient) call(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	if m.limiter != nil {
+		waited, err := m.limiter.wait(ctx)
+		m.mu.Lock()
+		if waited {
+			m.usage.Throttled++
+		}
+		if err != nil {
+			m.usage.RateLimited++
+		}
+		m.mu.Unlock()
+		if err != nil {
+			return LLMResponse{}, err
+		}
+	}
+
+	start := time.Now()
+	resp, err := m.llm.Generate(ctx, req)
+	m.record(req, resp, err, start)
+	return resp, err
+}
+
+func (m *MeteredClient) record(req LLMRequest, resp LLMResponse, err error, start time.Time) {
+	call := Call{
+		At:           start,
+		Purpose:      req.Purpose,
+		Model:        resp.Model,
+		InputTokens:  resp.InputTokens,
+		OutputTokens: resp.OutputTokens,
+		DurationMs:   time.Since(start).Milliseconds(),
+	}
+	if call.Model == "" {
+		call.Model = m.model
+	}
+	if price, ok := m.pricing[call.Model]; ok {
+		call.Cost = (float64(call.InputTokens)*price.Input + float64(call.OutputTokens)*price.Output) / 1e6
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	add := func(t *UsageTotals) {
+		t.Calls++
+		if err != nil {
+			t.Errors++
+		}
+		t.InputTokens += call.InputTokens
+		t.OutputTokens += call.OutputTokens
+		t.Cost += call.Cost
+	}
+	add(&m.usage.UsageTotals)
+	add(totalsFor(m.models, call.Model))
+	add(totalsFor(m.purposes, call.Purpose))
+
+	if len(m.recent) < maxRecentCalls {
+		m.recent = append(m.recent, call)
+	} else {
+		m.recent[m.next] = call
+	}
+	m.next = (m.next + 1) % maxRecentCalls
+}
+
+// Usage returns the calls made so far
+func (m *MeteredClient) Usage() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := m.usage
+	usage.Models = make(map[string]UsageTotals, len(m.models))
+	for name, t := range m.models {
+		usage.Models[name] = *t
+	}
+	usage.Purposes = make(map[string]UsageTotals, len(m.purposes))
+	for name, t := range m.purposes {
+		usage.Purposes[name] = *t
+	}
+	usage.Recent = make([]Call, 0, len(m.recent))
+	for i := 1; i <= len(m.recent); i++ {
+		usage.Recent = append(usage.Recent, m.recent[(m.next-i+maxRecentCalls)%maxRecentCalls])
+	}
+	return usage
+}
+
+func totalsFor(totals map[string]*UsageTotals, name string) *UsageTotals {
+	if name == "" {
+		name = "other"
+	}
+	t := totals[name]
+	if t == nil {
+		t = &UsageTotals{}
+		totals[name] = t
+	}
+	return t
+}
+
+// requestKey identifies identical requests
+func requestKey(req LLMRequest) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return hashOf(string(data)), nil
+}
+
+func hashOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// limiter is a token bucket refilled at rate tokens a second
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait takes a token, sleeping until one is available. It fails at once
+// with ErrRateLimited when that would be after ctx's deadline.
+func (l *limiter) wait(ctx context.Context) (waited bool, err error) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	if delay <= 0 {
+		l.mu.Unlock()
+		return false, nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		l.tokens++
+		l.mu.Unlock()
+		return false, ErrRateLimited
+	}
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		// Give the reservation back to later callers
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return true, ctx.Err()
+	}
+}
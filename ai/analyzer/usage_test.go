@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMeteredClientAccounting(t *testing.T) {
+	llm := &FakeLLM{Respond: func(req LLMRequest) (LLMResponse, error) {
+		if req.Prompt == "fail" {
+			return LLMResponse{}, errors.New("upstream error")
+		}
+		return LLMResponse{Text: "ok", Model: "m", InputTokens: 1000, OutputTokens: 500}, nil
+	}}
+	m := NewMeteredClient(llm, LLMConfig{Pricing: map[string]Price{"m": {Input: 1, Output: 2}}})
+
+	for _, req := range []LLMRequest{
+		{Prompt: "a", Purpose: "analysis"},
+		{Prompt: "b", Purpose: "commentary"},
+		{Prompt: "fail", Purpose: "analysis"},
+	} {
+		m.Generate(context.Background(), req)
+	}
+
+	usage := m.Usage()
+	if usage.Calls != 3 || usage.Errors != 1 || usage.InputTokens != 2000 || usage.OutputTokens != 1000 {
+		t.Errorf("Unexpected totals %+v", usage.UsageTotals)
+	}
+	if usage.Cost != 0.004 {
+		t.Errorf("Expected $0.004, got %v", usage.Cost)
+	}
+	if got := usage.Purposes["analysis"]; got.Calls != 2 || got.Errors != 1 {
+		t.Errorf("Unexpected analysis totals %+v", got)
+	}
+	if len(usage.Recent) != 3 || usage.Recent[0].Error == "" || usage.Recent[2].Purpose != "analysis" {
+		t.Errorf("Expected the recent calls newest first, got %+v", usage.Recent)
+	}
+}
+
+func TestMeteredClientDeduplicates(t *testing.T) {
+	release := make(chan struct{})
+	llm := &FakeLLM{Respond: func(LLMRequest) (LLMResponse, error) {
+		<-release
+		return LLMResponse{Text: "ok"}, nil
+	}}
+	m := NewMeteredClient(llm, LLMConfig{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := m.Generate(context.Background(), LLMRequest{Prompt: "same"}); err != nil || resp.Text != "ok" {
+				t.Errorf("Unexpected response %+v, %v", resp, err)
+			}
+		}()
+	}
+	// Let every caller join the first call before it returns
+	for deadline := time.Now().Add(time.Second); m.Usage().Deduplicated < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := len(llm.Requests()); n != 1 {
+		t.Errorf("Expected one upstream call, got %d", n)
+	}
+	if usage := m.Usage(); usage.Calls != 1 || usage.Deduplicated != 4 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+}
+
+func TestMeteredClientRateLimit(t *testing.T) {
+	// One call a minute: the second cannot be made before its deadline
+	m := NewMeteredClient(&FakeLLM{}, LLMConfig{RateLimit: RateLimit{PerMinute: 1}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := m.Generate(ctx, LLMRequest{Prompt: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Generate(ctx, LLMRequest{Prompt: "second"}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if usage := m.Usage(); usage.Calls != 1 || usage.RateLimited != 1 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+}
+
+func TestLimiterWaitsForToken(t *testing.T) {
+	l := newLimiter(100, 1) // A token every 10ms
+	if waited, err := l.wait(context.Background()); waited || err != nil {
+		t.Fatalf("Expected the burst to pass at once, got %v, %v", waited, err)
+	}
+	start := time.Now()
+	if waited, err := l.wait(context.Background()); !waited || err != nil {
+		t.Fatalf("Expected to wait, got %v, %v", waited, err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("Expected to wait about 10ms, waited %v", elapsed)
+	}
+}
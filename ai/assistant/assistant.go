@@ -0,0 +1,197 @@
+// Package assistant answers natural-language questions about the network.
+// The LLM answers by calling a fixed set of read-only tools backed by the
+// API's own query functions; it never sees the database directly.
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/store"
+)
+
+var ErrInvalidQuestion = errors.New("invalid question")
+
+// maxQuestionLength bounds the question sent to the model
+const maxQuestionLength = 1000
+
+// maxSteps bounds the rounds of tool calls before the model must answer
+const maxSteps = 6
+
+// maxToolRows bounds the rows of each table shown to the model; the full
+// table is still returned to the caller
+const maxToolRows = 100
+
+// MetricsSource answers metric history queries. *store.SQLiteStore
+// implements it.
+type MetricsSource interface {
+	Query(ctx context.Context, q store.Query) ([]store.Point, error)
+	ClinicIDs(ctx context.Context) ([]string, error)
+}
+
+// Directory locates clinics. *kisumu.NetworkService implements it.
+type Directory interface {
+	Clinics() []models.Clinic
+	Clinic(id string) (models.Clinic, bool)
+	CalculateDistance(p1, p2 models.GeoPoint) float64
+}
+
+// Assistant answers questions with the LLM and the tools in tools.go
+type Assistant struct {
+	llm       analyzer.LLMClient
+	metrics   MetricsSource
+	alerts    *alerts.Manager
+	directory Directory // May be nil, in which case only clinics with metrics are known
+	tools     map[string]tool
+	now       func() time.Time
+}
+
+// New creates an assistant. llm may be nil, in which case every question
+// fails with analyzer.ErrNoLLM.
+func New(llm analyzer.LLMClient, metrics MetricsSource, alertManager *alerts.Manager, directory Directory) *Assistant {
+	a := &Assistant{
+		llm:       llm,
+		metrics:   metrics,
+		alerts:    alertManager,
+		directory: directory,
+		now:       time.Now,
+	}
+	a.tools = a.registry()
+	return a
+}
+
+// Table is the result of one tool call
+type Table struct {
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Note      string          `json:"note,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Answer is the model's reply and the data it was based on
+type Answer struct {
+	Question string  `json:"question"`
+	Answer   string  `json:"answer"`
+	Tables   []Table `json:"tables"` // In the order the tools were called
+	Model    string  `json:"model"`
+	Steps    int     `json:"steps"` // Rounds of tool calls
+}
+
+// Query answers a question, letting the model call tools until it has the
+// data it needs
+func (a *Assistant) Query(ctx context.Context, question string) (Answer, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return Answer{}, fmt.Errorf("%w: question is required", ErrInvalidQuestion)
+	}
+	if len(question) > maxQuestionLength {
+		return Answer{}, fmt.Errorf("%w: must be at most %d characters", ErrInvalidQuestion, maxQuestionLength)
+	}
+	if a.llm == nil {
+		return Answer{}, analyzer.ErrNoLLM
+	}
+
+	answer := Answer{Question: question, Tables: []Table{}}
+	req := analyzer.LLMRequest{
+		System:  a.systemPrompt(),
+		Prompt:  question,
+		Tools:   a.definitions(),
+		Purpose: "assistant",
+	}
+
+	for {
+		if answer.Steps == maxSteps {
+			// Out of tool calls; answer with what has been gathered
+			req.Tools = nil
+			req.History = append(req.History, analyzer.Message{Role: analyzer.RoleUser,
+				Content: "Answer the question now using only the data gathered so far."})
+		}
+
+		resp, err := a.llm.Generate(ctx, req)
+		if err != nil {
+			return Answer{}, err
+		}
+		answer.Model = resp.Model
+		if len(resp.ToolCalls) == 0 || req.Tools == nil {
+			answer.Answer = strings.TrimSpace(resp.Text)
+			return answer, nil
+		}
+
+		answer.Steps++
+		req.History = append(req.History, analyzer.Message{
+			Role:      analyzer.RoleAssistant,
+			Content:   resp.Text,
+			ToolCalls: resp.ToolCalls,
+		})
+		for _, call := range resp.ToolCalls {
+			table := a.run(ctx, call)
+			answer.Tables = append(answer.Tables, table)
+			req.History = append(req.History, analyzer.Message{
+				Role:       analyzer.RoleTool,
+				Content:    toolResult(table),
+				ToolCallID: call.ID,
+				Name:       call.Name,
+			})
+		}
+	}
+}
+
+// run executes one tool call. Failures are reported in the table so the
+// model can correct its arguments.
+func (a *Assistant) run(ctx context.Context, call analyzer.ToolCall) Table {
+	args := call.Arguments
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	t, ok := a.tools[call.Name]
+	if !ok {
+		return Table{Tool: call.Name, Arguments: args, Error: fmt.Sprintf("unknown tool %q", call.Name)}
+	}
+	log.Printf("🤖 Assistant called %s %s", call.Name, args)
+
+	table, err := t.run(ctx, args)
+	table.Tool = call.Name
+	table.Arguments = args
+	if err != nil {
+		table.Error = err.Error()
+	}
+	if table.Rows == nil {
+		table.Rows = [][]interface{}{}
+	}
+	return table
+}
+
+// toolResult encodes a table for the model, truncating long tables
+func toolResult(t Table) string {
+	result := struct {
+		Columns   []string        `json:"columns,omitempty"`
+		Rows      [][]interface{} `json:"rows,omitempty"`
+		Truncated int             `json:"truncated_rows,omitempty"`
+		Note      string          `json:"note,omitempty"`
+		Error     string          `json:"error,omitempty"`
+	}{Columns: t.Columns, Rows: t.Rows, Note: t.Note, Error: t.Error}
+	if len(result.Rows) > maxToolRows {
+		result.Truncated = len(result.Rows) - maxToolRows
+		result.Rows = result.Rows[:maxToolRows]
+	}
+	data, _ := json.Marshal(result)
+	return string(data)
+}
+
+func (a *Assistant) systemPrompt() string {
+	return fmt.Sprintf(`You answer questions from county health managers about the network connecting health clinics in Kisumu County, Kenya. The current time is %s.
+
+Use the tools to look up the data you need before answering; call several tools at once when they are independent. Base every figure in your answer on tool results, mention the clinics and time range you used, and say so when the data needed is missing. Latency and jitter are in ms, bandwidth in MB/s, packet loss, uptime and usage in percent. Answer in plain text, briefly.`,
+		a.now().Format(time.RFC3339))
+}
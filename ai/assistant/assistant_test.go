@@ -0,0 +1,214 @@
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/store"
+)
+
+// fakeDirectory places clinics on a line one kilometre per unit of longitude
+type fakeDirectory []models.Clinic
+
+func (d fakeDirectory) Clinics() []models.Clinic { return d }
+
+func (d fakeDirectory) Clinic(id string) (models.Clinic, bool) {
+	for _, c := range d {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return models.Clinic{}, false
+}
+
+func (d fakeDirectory) CalculateDistance(p1, p2 models.GeoPoint) float64 {
+	if p1.Longitude > p2.Longitude {
+		return p1.Longitude - p2.Longitude
+	}
+	return p2.Longitude - p1.Longitude
+}
+
+var directory = fakeDirectory{
+	{ID: "jootrh", Name: "Jaramogi Oginga Odinga Teaching & Referral Hospital", Coordinates: models.GeoPoint{Latitude: -0.1, Longitude: 1}},
+	{ID: "kombewa", Name: "Kombewa Sub-County Hospital", Coordinates: models.GeoPoint{Latitude: -0.1, Longitude: 12}},
+	{ID: "ahero", Name: "Ahero Sub-County Hospital", Coordinates: models.GeoPoint{Latitude: -0.1, Longitude: 25}},
+}
+
+// newTestAssistant stores two hours of samples: jootrh is unreachable for
+// the second half hour, kombewa never
+func newTestAssistant(t *testing.T, llm analyzer.LLMClient) (*Assistant, *alerts.Manager, time.Time) {
+	t.Helper()
+	s, err := store.Open(store.Config{Path: filepath.Join(t.TempDir(), "metrics.db"), BatchSize: 1000, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	now := time.Now().Truncate(time.Hour)
+	start := now.Add(-2 * time.Hour)
+	var samples []models.Metrics
+	for i := 0; i < 120; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		down := i >= 30 && i < 60
+		samples = append(samples,
+			models.Metrics{ClinicID: "jootrh", Timestamp: ts, Latency: 40, Unreachable: down},
+			models.Metrics{ClinicID: "kombewa", Timestamp: ts, Latency: 60})
+	}
+	if err := s.Write(context.Background(), samples); err != nil {
+		t.Fatal(err)
+	}
+
+	am, err := alerts.NewManager(s.DB(), alerts.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(llm, s, am, directory)
+	a.now = func() time.Time { return now }
+	return a, am, start
+}
+
+func runTool(t *testing.T, a *Assistant, name, args string) Table {
+	t.Helper()
+	table := a.run(context.Background(), analyzer.ToolCall{Name: name, Arguments: json.RawMessage(args)})
+	if table.Error != "" {
+		t.Fatalf("%s failed: %s", name, table.Error)
+	}
+	return table
+}
+
+func TestComputeUptime(t *testing.T) {
+	a, _, start := newTestAssistant(t, nil)
+	table := runTool(t, a, "compute_uptime", `{"from": "`+start.Format(time.RFC3339)+`"}`)
+
+	if len(table.Rows) != 2 {
+		t.Fatalf("Expected a row per clinic, got %v", table.Rows)
+	}
+	jootrh, kombewa := table.Rows[0], table.Rows[1]
+	if jootrh[0] != "jootrh" || jootrh[1] != 75.0 || jootrh[2] != 0.5 || jootrh[3] != 0.0 || jootrh[4] != 120 {
+		t.Errorf("Unexpected jootrh uptime %v", jootrh)
+	}
+	if kombewa[1] != 100.0 || kombewa[2] != 0.0 {
+		t.Errorf("Unexpected kombewa uptime %v", kombewa)
+	}
+
+	// A day with only two hours of data
+	table = runTool(t, a, "compute_uptime", `{"clinic_id": "kombewa"}`)
+	if row := table.Rows[0]; row[3].(float64) < 165 {
+		t.Errorf("Expected the hours without samples to be reported, got %v", row)
+	}
+}
+
+func TestTools(t *testing.T) {
+	a, am, start := newTestAssistant(t, nil)
+	am.Sync(context.Background(), "jootrh", nil, []models.Alert{
+		{Severity: "critical", Detector: "connectivity", Description: "uplink down"},
+	}, start.Add(30*time.Minute))
+
+	tests := []struct {
+		name, tool, args string
+		rows             int
+		check            func(rows [][]interface{}) bool
+	}{
+		{"clinics", "list_clinics", `{}`, 3, func(r [][]interface{}) bool { return r[1][0] == "jootrh" && r[1][4] == true && r[0][4] == false }},
+		{"clinic filter", "list_clinics", `{"name_contains": "kombewa"}`, 1, nil},
+		{"history", "query_metric_history", `{"clinic_id": "kombewa", "metric": "latency", "from": "` + start.Format(time.RFC3339) + `", "step": "1h"}`, 2,
+			func(r [][]interface{}) bool { return r[0][1] == 60.0 && r[0][2] == 60 }},
+		{"alerts", "list_alerts", `{"severity": "critical"}`, 1, func(r [][]interface{}) bool { return r[0][5] == "uplink down" }},
+		{"no warnings", "list_alerts", `{"severity": "warning"}`, 0, nil},
+		{"nearest", "find_nearest_facilities", `{"clinic_id": "jootrh", "within_km": 15}`, 1, func(r [][]interface{}) bool { return r[0][0] == "kombewa" && r[0][2] == 11.0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := runTool(t, a, tt.tool, tt.args)
+			if len(table.Rows) != tt.rows || tt.check != nil && !tt.check(table.Rows) {
+				t.Errorf("Unexpected rows %v", table.Rows)
+			}
+		})
+	}
+}
+
+func TestToolErrors(t *testing.T) {
+	a, _, _ := newTestAssistant(t, nil)
+	tests := []struct {
+		name, tool, args, want string
+	}{
+		{"unknown tool", "run_sql", `{"query": "DROP TABLE metrics"}`, "unknown tool"},
+		{"bad metric", "query_metric_history", `{"clinic_id": "jootrh", "metric": "payload"}`, "unknown metric"},
+		{"bad time", "compute_uptime", `{"from": "last week"}`, "invalid time"},
+		{"range too long", "list_alerts", `{"from": "2020-01-01"}`, "at most 92 days"},
+		{"bad arguments", "list_alerts", `"not json"`, "invalid arguments"},
+		{"unknown clinic", "find_nearest_facilities", `{"clinic_id": "siaya"}`, "unknown clinic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := a.run(context.Background(), analyzer.ToolCall{Name: tt.tool, Arguments: json.RawMessage(tt.args)})
+			if !strings.Contains(table.Error, tt.want) {
+				t.Errorf("Error = %q, want %q", table.Error, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	llm := &analyzer.FakeLLM{Respond: func(req analyzer.LLMRequest) (analyzer.LLMResponse, error) {
+		if len(req.History) == 0 {
+			return analyzer.LLMResponse{ToolCalls: []analyzer.ToolCall{
+				{ID: "call_1", Name: "compute_uptime", Arguments: json.RawMessage(`{}`)},
+				{ID: "call_2", Name: "list_clinics", Arguments: json.RawMessage(`{}`)},
+			}}, nil
+		}
+		return analyzer.LLMResponse{Text: " jootrh had 0.5 hours of downtime. "}, nil
+	}}
+	a, _, _ := newTestAssistant(t, llm)
+
+	answer, err := a.Query(context.Background(), "Which clinics had downtime this week?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Answer != "jootrh had 0.5 hours of downtime." || answer.Steps != 1 || len(answer.Tables) != 2 {
+		t.Errorf("Unexpected answer %+v", answer)
+	}
+
+	requests := llm.Requests()
+	if len(requests) != 2 || len(requests[0].Tools) != 5 || !strings.Contains(requests[0].System, "current time") {
+		t.Fatalf("Unexpected requests %+v", requests)
+	}
+	history := requests[1].History
+	if len(history) != 3 || history[0].Role != analyzer.RoleAssistant || history[1].ToolCallID != "call_1" ||
+		!strings.Contains(history[1].Content, `"jootrh",75`) {
+		t.Errorf("Unexpected conversation %+v", history)
+	}
+}
+
+func TestQueryStopsCallingTools(t *testing.T) {
+	llm := &analyzer.FakeLLM{Respond: func(req analyzer.LLMRequest) (analyzer.LLMResponse, error) {
+		if req.Tools == nil {
+			return analyzer.LLMResponse{Text: "Not enough data."}, nil
+		}
+		return analyzer.LLMResponse{ToolCalls: []analyzer.ToolCall{{ID: "c", Name: "list_clinics"}}}, nil
+	}}
+	a, _, _ := newTestAssistant(t, llm)
+
+	answer, err := a.Query(context.Background(), "Loop forever")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Steps != maxSteps || answer.Answer != "Not enough data." || len(llm.Requests()) != maxSteps+1 {
+		t.Errorf("Unexpected answer %+v after %d requests", answer, len(llm.Requests()))
+	}
+
+	if _, err := a.Query(context.Background(), "  "); !errors.Is(err, ErrInvalidQuestion) {
+		t.Errorf("Expected ErrInvalidQuestion, got %v", err)
+	}
+	if _, err := New(nil, nil, nil, nil).Query(context.Background(), "Uptime?"); !errors.Is(err, analyzer.ErrNoLLM) {
+		t.Errorf("Expected ErrNoLLM, got %v", err)
+	}
+}
@@ -0,0 +1,419 @@
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/store"
+)
+
+// tool is one function the model may call
+type tool struct {
+	def analyzer.Tool
+	run func(ctx context.Context, args json.RawMessage) (Table, error)
+}
+
+const (
+	maxRange     = 92 * 24 * time.Hour
+	maxPoints    = 200
+	maxAlertRows = 200
+)
+
+var (
+	str     = &analyzer.Schema{Type: analyzer.SchemaString}
+	num     = &analyzer.Schema{Type: analyzer.SchemaNumber}
+	timeArg = &analyzer.Schema{Type: analyzer.SchemaString, Description: "RFC 3339 time or YYYY-MM-DD date"}
+)
+
+// params builds a closed object schema for a tool's arguments
+func params(properties map[string]*analyzer.Schema, required ...string) *analyzer.Schema {
+	closed := false
+	return &analyzer.Schema{
+		Type:                 analyzer.SchemaObject,
+		Properties:           properties,
+		Required:             required,
+		AdditionalProperties: &closed,
+	}
+}
+
+func (a *Assistant) registry() map[string]tool {
+	tools := []tool{
+		{
+			def: analyzer.Tool{
+				Name:        "list_clinics",
+				Description: "List the clinics in the network with their location and whether metrics are recorded for them.",
+				Parameters: params(map[string]*analyzer.Schema{
+					"name_contains": {Type: analyzer.SchemaString, Description: "Case-insensitive filter on the clinic ID or name"},
+				}),
+			},
+			run: a.listClinics,
+		},
+		{
+			def: analyzer.Tool{
+				Name:        "query_metric_history",
+				Description: "Aggregate one metric for one clinic into time buckets. Defaults to the last 24 hours.",
+				Parameters: params(map[string]*analyzer.Schema{
+					"clinic_id":   str,
+					"metric":      {Type: analyzer.SchemaString, Enum: models.MetricNames},
+					"from":        timeArg,
+					"to":          timeArg,
+					"step":        {Type: analyzer.SchemaString, Description: "Bucket size as a Go duration, e.g. 15m or 1h"},
+					"aggregation": {Type: analyzer.SchemaString, Enum: []string{store.AggAvg, store.AggMin, store.AggMax, store.AggP95}},
+				}, "clinic_id", "metric"),
+			},
+			run: a.queryMetricHistory,
+		},
+		{
+			def: analyzer.Tool{
+				Name:        "list_alerts",
+				Description: "List alerts that started in a time range, newest first. Defaults to the last 7 days.",
+				Parameters: params(map[string]*analyzer.Schema{
+					"clinic_id": str,
+					"severity":  {Type: analyzer.SchemaString, Enum: analyzer.Severities},
+					"states": {Type: analyzer.SchemaArray, Items: &analyzer.Schema{Type: analyzer.SchemaString,
+						Enum: []string{alerts.StatePending, alerts.StateFiring, alerts.StateAcknowledged, alerts.StateResolved}}},
+					"from":  timeArg,
+					"to":    timeArg,
+					"limit": num,
+				}),
+			},
+			run: a.listAlerts,
+		},
+		{
+			def: analyzer.Tool{
+				Name:        "compute_uptime",
+				Description: "Compute uptime and downtime hours from the latency probes, for one clinic or every clinic with metrics. Defaults to the last 7 days. Hours without any samples are reported separately as no_data_hours.",
+				Parameters: params(map[string]*analyzer.Schema{
+					"clinic_id": str,
+					"from":      timeArg,
+					"to":        timeArg,
+				}),
+			},
+			run: a.computeUptime,
+		},
+		{
+			def: analyzer.Tool{
+				Name:        "find_nearest_facilities",
+				Description: "Find the facilities nearest to a clinic or to a point, with their distance in km.",
+				Parameters: params(map[string]*analyzer.Schema{
+					"clinic_id": str,
+					"latitude":  num,
+					"longitude": num,
+					"limit":     num,
+					"within_km": num,
+				}),
+			},
+			run: a.findNearestFacilities,
+		},
+	}
+
+	registry := make(map[string]tool, len(tools))
+	for _, t := range tools {
+		registry[t.def.Name] = t
+	}
+	return registry
+}
+
+// definitions returns the tool declarations sent to the model
+func (a *Assistant) definitions() []analyzer.Tool {
+	defs := make([]analyzer.Tool, 0, len(a.tools))
+	for _, t := range a.tools {
+		defs = append(defs, t.def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+func decodeArgs(args json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// parseTime accepts RFC 3339 times and dates, or returns def when s is empty
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 or YYYY-MM-DD", s)
+}
+
+// parseRange reads a [from, to) range, defaulting to the last def
+func (a *Assistant) parseRange(from, to string, def time.Duration) (time.Time, time.Time, error) {
+	now := a.now()
+	end, err := parseTime(to, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start, err := parseTime(from, end.Add(-def))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	if end.Sub(start) > maxRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("range must be at most %d days", int(maxRange.Hours()/24))
+	}
+	return start, end, nil
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+func (a *Assistant) listClinics(ctx context.Context, args json.RawMessage) (Table, error) {
+	var p struct {
+		NameContains string `json:"name_contains"`
+	}
+	if err := decodeArgs(args, &p); err != nil {
+		return Table{}, err
+	}
+
+	ids, err := a.metrics.ClinicIDs(ctx)
+	if err != nil {
+		return Table{}, err
+	}
+	withMetrics := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		withMetrics[id] = true
+	}
+
+	clinics := make(map[string]models.Clinic)
+	if a.directory != nil {
+		for _, c := range a.directory.Clinics() {
+			clinics[c.ID] = c
+		}
+	}
+	for _, id := range ids {
+		if _, ok := clinics[id]; !ok {
+			clinics[id] = models.Clinic{ID: id}
+		}
+	}
+
+	filter := strings.ToLower(p.NameContains)
+	table := Table{Columns: []string{"clinic_id", "name", "latitude", "longitude", "has_metrics"}}
+	for _, c := range clinics {
+		if filter != "" && !strings.Contains(strings.ToLower(c.ID+" "+c.Name), filter) {
+			continue
+		}
+		var lat, lon interface{}
+		if c.Coordinates.Latitude != 0 || c.Coordinates.Longitude != 0 {
+			lat, lon = c.Coordinates.Latitude, c.Coordinates.Longitude
+		}
+		table.Rows = append(table.Rows, []interface{}{c.ID, c.Name, lat, lon, withMetrics[c.ID]})
+	}
+	sort.Slice(table.Rows, func(i, j int) bool { return table.Rows[i][0].(string) < table.Rows[j][0].(string) })
+	return table, nil
+}
+
+func (a *Assistant) queryMetricHistory(ctx context.Context, args json.RawMessage) (Table, error) {
+	var p struct {
+		ClinicID    string `json:"clinic_id"`
+		Metric      string `json:"metric"`
+		From        string `json:"from"`
+		To          string `json:"to"`
+		Step        string `json:"step"`
+		Aggregation string `json:"aggregation"`
+	}
+	if err := decodeArgs(args, &p); err != nil {
+		return Table{}, err
+	}
+	from, to, err := a.parseRange(p.From, p.To, 24*time.Hour)
+	if err != nil {
+		return Table{}, err
+	}
+
+	table := Table{Columns: []string{"timestamp", "value", "samples"}}
+	step := to.Sub(from) / 48
+	if p.Step != "" {
+		if step, err = time.ParseDuration(p.Step); err != nil || step <= 0 {
+			return Table{}, fmt.Errorf("invalid step %q", p.Step)
+		}
+	}
+	if min := to.Sub(from) / maxPoints; step < min {
+		step = min
+		table.Note = "step widened to stay within " + fmt.Sprint(maxPoints) + " points"
+	}
+	// Whole minutes, rounding up
+	step = (step + time.Minute - 1).Truncate(time.Minute)
+
+	points, err := a.metrics.Query(ctx, store.Query{
+		ClinicID:    p.ClinicID,
+		Metric:      p.Metric,
+		From:        from,
+		To:          to,
+		Step:        step,
+		Aggregation: p.Aggregation,
+	})
+	if err != nil {
+		return Table{}, err
+	}
+	for _, pt := range points {
+		table.Rows = append(table.Rows, []interface{}{pt.Timestamp.Format(time.RFC3339), round(pt.Value, 2), pt.Count})
+	}
+	if len(points) == 0 {
+		table.Note = "no samples in range"
+	}
+	return table, nil
+}
+
+func (a *Assistant) listAlerts(ctx context.Context, args json.RawMessage) (Table, error) {
+	var p struct {
+		ClinicID string   `json:"clinic_id"`
+		Severity string   `json:"severity"`
+		States   []string `json:"states"`
+		From     string   `json:"from"`
+		To       string   `json:"to"`
+		Limit    int      `json:"limit"`
+	}
+	if err := decodeArgs(args, &p); err != nil {
+		return Table{}, err
+	}
+	from, to, err := a.parseRange(p.From, p.To, 7*24*time.Hour)
+	if err != nil {
+		return Table{}, err
+	}
+	if p.Limit <= 0 || p.Limit > maxAlertRows {
+		p.Limit = maxAlertRows
+	}
+
+	list, err := a.alerts.List(ctx, alerts.Filter{ClinicID: p.ClinicID, States: p.States, From: from, To: to})
+	if err != nil {
+		return Table{}, err
+	}
+
+	table := Table{Columns: []string{"alert_id", "clinic_id", "severity", "state", "metric", "description",
+		"starts_at", "resolved_at", "duration_minutes"}}
+	now := a.now()
+	for _, al := range list {
+		if p.Severity != "" && al.Severity != p.Severity {
+			continue
+		}
+		if len(table.Rows) == p.Limit {
+			table.Note = fmt.Sprintf("limited to %d alerts", p.Limit)
+			break
+		}
+		end, resolved := now, interface{}(nil)
+		if al.ResolvedAt != nil {
+			end, resolved = *al.ResolvedAt, al.ResolvedAt.Format(time.RFC3339)
+		}
+		table.Rows = append(table.Rows, []interface{}{al.ID, al.ClinicID, al.Severity, al.State, al.Metric,
+			al.Description, al.StartsAt.Format(time.RFC3339), resolved, round(end.Sub(al.StartsAt).Minutes(), 1)})
+	}
+	return table, nil
+}
+
+func (a *Assistant) computeUptime(ctx context.Context, args json.RawMessage) (Table, error) {
+	var p struct {
+		ClinicID string `json:"clinic_id"`
+		From     string `json:"from"`
+		To       string `json:"to"`
+	}
+	if err := decodeArgs(args, &p); err != nil {
+		return Table{}, err
+	}
+	from, to, err := a.parseRange(p.From, p.To, 7*24*time.Hour)
+	if err != nil {
+		return Table{}, err
+	}
+
+	clinics := []string{p.ClinicID}
+	if p.ClinicID == "" {
+		if clinics, err = a.metrics.ClinicIDs(ctx); err != nil {
+			return Table{}, err
+		}
+	}
+
+	table := Table{Columns: []string{"clinic_id", "uptime_pct", "downtime_hours", "no_data_hours", "samples"}}
+	for _, id := range clinics {
+		u, err := store.ComputeUptime(ctx, a.metrics, id, from, to)
+		if err != nil {
+			return Table{}, err
+		}
+		var pct interface{}
+		if u.Samples > 0 {
+			pct = round(u.Percent, 2)
+		}
+		table.Rows = append(table.Rows, []interface{}{id, pct, round(u.DowntimeHours, 2), round(u.NoDataHours, 2), u.Samples})
+	}
+	// Most downtime first
+	sort.SliceStable(table.Rows, func(i, j int) bool { return table.Rows[i][2].(float64) > table.Rows[j][2].(float64) })
+	return table, nil
+}
+
+func (a *Assistant) findNearestFacilities(ctx context.Context, args json.RawMessage) (Table, error) {
+	var p struct {
+		ClinicID  string   `json:"clinic_id"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		Limit     int      `json:"limit"`
+		WithinKm  float64  `json:"within_km"`
+	}
+	if err := decodeArgs(args, &p); err != nil {
+		return Table{}, err
+	}
+	if a.directory == nil {
+		return Table{}, errors.New("no facility directory is available")
+	}
+	if p.Limit <= 0 || p.Limit > 20 {
+		p.Limit = 5
+	}
+
+	var origin models.GeoPoint
+	switch {
+	case p.ClinicID != "":
+		c, ok := a.directory.Clinic(p.ClinicID)
+		if !ok {
+			return Table{}, fmt.Errorf("unknown clinic %q", p.ClinicID)
+		}
+		origin = c.Coordinates
+	case p.Latitude != nil && p.Longitude != nil:
+		origin = models.GeoPoint{Latitude: *p.Latitude, Longitude: *p.Longitude}
+	default:
+		return Table{}, errors.New("clinic_id or latitude and longitude are required")
+	}
+
+	type facility struct {
+		clinic   models.Clinic
+		distance float64
+	}
+	var nearby []facility
+	for _, c := range a.directory.Clinics() {
+		if c.ID == p.ClinicID {
+			continue
+		}
+		d := a.directory.CalculateDistance(origin, c.Coordinates)
+		if p.WithinKm > 0 && d > p.WithinKm {
+			continue
+		}
+		nearby = append(nearby, facility{c, d})
+	}
+	sort.Slice(nearby, func(i, j int) bool { return nearby[i].distance < nearby[j].distance })
+	if len(nearby) > p.Limit {
+		nearby = nearby[:p.Limit]
+	}
+
+	table := Table{Columns: []string{"clinic_id", "name", "distance_km", "latitude", "longitude"}}
+	for _, f := range nearby {
+		table.Rows = append(table.Rows, []interface{}{f.clinic.ID, f.clinic.Name, round(f.distance, 1),
+			f.clinic.Coordinates.Latitude, f.clinic.Coordinates.Longitude})
+	}
+	return table, nil
+}
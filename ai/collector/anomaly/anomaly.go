@@ -0,0 +1,193 @@
+// Package anomaly implements streaming anomaly detectors for single metric
+// series. Each detector scores a new value against the state learned from
+// the values before it, so checking and learning are separate steps.
+package anomaly
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Detector types
+const (
+	TypeEWMA        = "ewma"
+	TypeCUSUM       = "cusum"
+	TypeSeasonalESD = "seasonal-esd"
+)
+
+// Directions a detector alerts on
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+	DirectionBoth = "both"
+)
+
+// Sample is one value of a metric series
+type Sample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Result explains why a detector flagged a sample
+type Result struct {
+	Detector  string
+	Score     float64  // Detector statistic, comparable to Threshold
+	Threshold float64  // Score at which the detector alerts
+	Expected  float64  // Value the detector expected
+	Window    []Sample // Samples that make up the evidence, oldest first
+}
+
+// Detector scores samples of one metric series
+type Detector interface {
+	Name() string
+	// Check scores s against the current state without changing it
+	Check(s Sample) (Result, bool)
+	// Observe folds s into the detector's state
+	Observe(s Sample)
+}
+
+// Config selects and tunes the detector for one metric
+type Config struct {
+	Metric    string `yaml:"metric" json:"metric"`
+	Type      string `yaml:"type" json:"type"`
+	Direction string `yaml:"direction" json:"direction"` // up, down or both (default up)
+	Severity  string `yaml:"severity" json:"severity"`   // default warning
+	Warmup    int    `yaml:"warmup" json:"warmup"`       // Samples used to learn the reference (ewma, cusum)
+	Evidence  int    `yaml:"evidence" json:"evidence"`   // Maximum samples reported as evidence
+
+	// EWMA control chart
+	Lambda float64 `yaml:"lambda" json:"lambda"` // Smoothing weight (default 0.1)
+	Limit  float64 `yaml:"limit" json:"limit"`   // Control limit in standard errors (default 3.5)
+
+	// CUSUM
+	K float64 `yaml:"k" json:"k"` // Allowance in standard deviations (default 0.5)
+	H float64 `yaml:"h" json:"h"` // Decision interval in standard deviations (default 8)
+
+	// Seasonal ESD
+	Window       int     `yaml:"window" json:"window"`               // Samples tested (default 360)
+	Period       int     `yaml:"period" json:"period"`               // Seasonal period in samples, 0 for none
+	MaxAnomalies float64 `yaml:"max_anomalies" json:"max_anomalies"` // Upper bound on the outlier fraction (default 0.1)
+	Alpha        float64 `yaml:"alpha" json:"alpha"`                 // Significance level (default 0.05)
+}
+
+// DefaultConfigs are used when no detectors are configured. They cover the
+// metrics the fixed-ratio checks miss and add drift detection to latency.
+var DefaultConfigs = []Config{
+	{Metric: "latency", Type: TypeCUSUM},
+	{Metric: "packet_loss", Type: TypeCUSUM},
+	{Metric: "disk_usage", Type: TypeEWMA},
+	{Metric: "packets_rate", Type: TypeSeasonalESD, Direction: DirectionBoth},
+	{Metric: "connections", Type: TypeCUSUM, Direction: DirectionBoth},
+	{Metric: "errors_rate", Type: TypeEWMA},
+}
+
+// withDefaults returns a copy of c with unset tuning filled in
+func (c Config) withDefaults() Config {
+	if c.Direction == "" {
+		c.Direction = DirectionUp
+	}
+	if c.Severity == "" {
+		c.Severity = "warning"
+	}
+	if c.Warmup == 0 {
+		c.Warmup = 120
+	}
+	if c.Evidence == 0 {
+		c.Evidence = 30
+	}
+	if c.Lambda == 0 {
+		c.Lambda = 0.1
+	}
+	if c.Limit == 0 {
+		c.Limit = 3.5
+	}
+	if c.K == 0 {
+		c.K = 0.5
+	}
+	if c.H == 0 {
+		c.H = 8
+	}
+	if c.Window == 0 {
+		c.Window = 360
+	}
+	if c.MaxAnomalies == 0 {
+		c.MaxAnomalies = 0.1
+	}
+	if c.Alpha == 0 {
+		c.Alpha = 0.05
+	}
+	return c
+}
+
+// Validate checks a detector configuration
+func (c Config) Validate() error {
+	if !models.IsMetricName(c.Metric) {
+		return fmt.Errorf("unknown metric %q", c.Metric)
+	}
+	switch c.Type {
+	case TypeEWMA, TypeCUSUM, TypeSeasonalESD:
+	default:
+		return fmt.Errorf("metric %s: unknown detector type %q", c.Metric, c.Type)
+	}
+	switch c.Direction {
+	case "", DirectionUp, DirectionDown, DirectionBoth:
+	default:
+		return fmt.Errorf("metric %s: direction must be up, down or both", c.Metric)
+	}
+	switch c.Severity {
+	case "", "info", "warning", "critical":
+	default:
+		return fmt.Errorf("metric %s: severity must be info, warning or critical", c.Metric)
+	}
+	if c.Lambda < 0 || c.Lambda > 1 {
+		return fmt.Errorf("metric %s: lambda must be in (0, 1]", c.Metric)
+	}
+	if c.MaxAnomalies < 0 || c.MaxAnomalies >= 0.5 {
+		return fmt.Errorf("metric %s: max_anomalies must be below 0.5", c.Metric)
+	}
+	if c.Alpha < 0 || c.Alpha >= 1 {
+		return fmt.Errorf("metric %s: alpha must be in (0, 1)", c.Metric)
+	}
+	if c.Warmup < 0 || c.Evidence < 0 || c.Window < 0 || c.Period < 0 || c.K < 0 || c.H < 0 || c.Limit < 0 {
+		return fmt.Errorf("metric %s: detector settings must not be negative", c.Metric)
+	}
+	if c.Type == TypeSeasonalESD && c.Window > 0 && c.Window < 30 {
+		return fmt.Errorf("metric %s: window must be at least 30 samples", c.Metric)
+	}
+	if c.Type == TypeSeasonalESD && c.Period > 0 && c.withDefaults().Window < 4*c.Period {
+		return fmt.Errorf("metric %s: window must cover at least four periods", c.Metric)
+	}
+	return nil
+}
+
+// New builds the detector described by c
+func New(c Config) (Detector, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	c = c.withDefaults()
+
+	switch c.Type {
+	case TypeEWMA:
+		return newEWMA(c), nil
+	case TypeCUSUM:
+		return newCUSUM(c), nil
+	default:
+		return newSeasonalESD(c), nil
+	}
+}
+
+// directional folds a signed score according to the configured direction
+func directional(direction string, score float64) float64 {
+	switch direction {
+	case DirectionDown:
+		return -score
+	case DirectionBoth:
+		if score < 0 {
+			return -score
+		}
+	}
+	return score
+}
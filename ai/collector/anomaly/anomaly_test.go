@@ -0,0 +1,186 @@
+package anomaly
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+
+// series generates n samples one minute apart from f plus gaussian noise
+func series(seed int64, n int, noise float64, f func(i int) float64) []Sample {
+	rng := rand.New(rand.NewSource(seed))
+	samples := make([]Sample, n)
+	for i := range samples {
+		samples[i] = Sample{
+			Timestamp: epoch.Add(time.Duration(i) * time.Minute),
+			Value:     f(i) + rng.NormFloat64()*noise,
+		}
+	}
+	return samples
+}
+
+// firstAlert feeds samples through d and returns the index of the first
+// flagged sample, or -1
+func firstAlert(d Detector, samples []Sample) (int, Result) {
+	for i, s := range samples {
+		result, anomalous := d.Check(s)
+		d.Observe(s)
+		if anomalous {
+			return i, result
+		}
+	}
+	return -1, Result{}
+}
+
+func mustNew(t *testing.T, c Config) Detector {
+	t.Helper()
+	d, err := New(c)
+	if err != nil {
+		t.Fatalf("New(%+v): %v", c, err)
+	}
+	return d
+}
+
+func TestDetectorsQuietOnStationarySeries(t *testing.T) {
+	for _, typ := range []string{TypeEWMA, TypeCUSUM, TypeSeasonalESD} {
+		d := mustNew(t, Config{Metric: "latency", Type: typ})
+		samples := series(1, 2000, 2, func(int) float64 { return 40 })
+		if i, r := firstAlert(d, samples); i >= 0 {
+			t.Errorf("%s: false alarm at sample %d: %+v", typ, i, r)
+		}
+	}
+}
+
+func TestSlowDegradation(t *testing.T) {
+	// A failing microwave link: latency creeps up 0.02ms per sample from a
+	// 40ms baseline. The old 1.5x ratio fires only once latency passes 60ms.
+	const start = 200
+	degrade := func(i int) float64 {
+		if i < start {
+			return 40
+		}
+		return 40 + 0.02*float64(i-start)
+	}
+	ratioIndex := start + int(20/0.02)
+
+	for _, typ := range []string{TypeEWMA, TypeCUSUM} {
+		d := mustNew(t, Config{Metric: "latency", Type: typ})
+		i, r := firstAlert(d, series(2, 3000, 2, degrade))
+		if i < start || i >= ratioIndex/2 {
+			t.Errorf("%s: detected at sample %d, want between %d and %d", typ, i, start, ratioIndex/2)
+			continue
+		}
+		if r.Detector != typ || r.Score < r.Threshold || math.Abs(r.Expected-40) > 1 {
+			t.Errorf("%s: unexpected result %+v", typ, r)
+		}
+		if len(r.Window) == 0 || r.Window[len(r.Window)-1].Timestamp != epoch.Add(time.Duration(i)*time.Minute) {
+			t.Errorf("%s: evidence should end at the flagged sample", typ)
+		}
+	}
+}
+
+func TestCUSUMEvidenceStartsAtChangePoint(t *testing.T) {
+	const shift = 300
+	d := mustNew(t, Config{Metric: "packet_loss", Type: TypeCUSUM, Evidence: 100})
+	i, r := firstAlert(d, series(3, 600, 1, func(i int) float64 {
+		if i >= shift {
+			return 11.5 // A 1.5 standard deviation step
+		}
+		return 10
+	}))
+	if i < shift || i > shift+20 {
+		t.Fatalf("Detected at sample %d, want shortly after %d", i, shift)
+	}
+	changePoint := r.Window[0].Timestamp.Sub(epoch) / time.Minute
+	if changePoint < shift-10 || changePoint > shift+5 {
+		t.Errorf("Evidence starts at sample %d, want near %d", changePoint, shift)
+	}
+}
+
+func TestDirection(t *testing.T) {
+	drop := func(i int) float64 {
+		if i >= 200 {
+			return 30
+		}
+		return 40
+	}
+	up := mustNew(t, Config{Metric: "connections", Type: TypeCUSUM})
+	if i, _ := firstAlert(up, series(4, 400, 1, drop)); i >= 0 {
+		t.Errorf("Upward detector flagged a drop at %d", i)
+	}
+	both := mustNew(t, Config{Metric: "connections", Type: TypeCUSUM, Direction: DirectionBoth})
+	if i, _ := firstAlert(both, series(4, 400, 1, drop)); i < 200 {
+		t.Errorf("Two-sided detector missed the drop, got %d", i)
+	}
+}
+
+func TestSeasonalESD(t *testing.T) {
+	// Daily-style cycle of 48 samples swinging between 20 and 180
+	cycle := func(i int) float64 { return 100 + 80*math.Sin(2*math.Pi*float64(i)/48) }
+	samples := series(5, 420, 3, cycle)
+
+	d := mustNew(t, Config{Metric: "packets_rate", Type: TypeSeasonalESD, Period: 48, Window: 240})
+	if i, r := firstAlert(d, samples); i >= 0 {
+		t.Fatalf("False alarm on the seasonal cycle at %d: %+v", i, r)
+	}
+
+	// Sample 420 falls in the trough, where 140 is far above normal even
+	// though it is well inside the series' overall range
+	spike := Sample{Timestamp: epoch.Add(420 * time.Minute), Value: 140}
+	result, anomalous := d.Check(spike)
+	if !anomalous || result.Score <= 1 || math.Abs(result.Expected-cycle(420)) > 5 {
+		t.Errorf("Expected a seasonal outlier, got %v %+v", anomalous, result)
+	}
+
+	// Without seasonal decomposition the same value looks ordinary
+	flat := mustNew(t, Config{Metric: "packets_rate", Type: TypeSeasonalESD, Window: 240})
+	firstAlert(flat, samples)
+	if _, anomalous := flat.Check(spike); anomalous {
+		t.Error("Expected the non-seasonal test to accept an in-range value")
+	}
+}
+
+func TestStudentTQuantile(t *testing.T) {
+	tests := []struct {
+		p, df, want float64
+	}{
+		{0.975, 10, 2.228},
+		{0.995, 30, 2.750},
+		{0.9999, 200, 3.789},
+	}
+	for _, tt := range tests {
+		if got := studentTQuantile(tt.p, tt.df); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("studentTQuantile(%v, %v) = %v, want %v", tt.p, tt.df, got, tt.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"valid", Config{Metric: "disk_usage", Type: TypeEWMA}, false},
+		{"unknown metric", Config{Metric: "temperature", Type: TypeEWMA}, true},
+		{"unknown type", Config{Metric: "latency", Type: "prophet"}, true},
+		{"bad direction", Config{Metric: "latency", Type: TypeCUSUM, Direction: "sideways"}, true},
+		{"bad severity", Config{Metric: "latency", Type: TypeCUSUM, Severity: "page"}, true},
+		{"window too small for period", Config{Metric: "latency", Type: TypeSeasonalESD, Window: 120, Period: 48}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	for _, c := range DefaultConfigs {
+		if err := c.Validate(); err != nil {
+			t.Errorf("Default config %+v invalid: %v", c, err)
+		}
+	}
+}
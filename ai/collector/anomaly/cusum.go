@@ -0,0 +1,89 @@
+package anomaly
+
+import "math"
+
+// CUSUM is a tabular cumulative-sum change-point detector. It accumulates
+// standardised deviations beyond an allowance of K standard deviations and
+// alerts once the sum passes H, which catches slow, sustained degradation.
+type CUSUM struct {
+	config  Config
+	ref     reference
+	upper   float64 // Cumulative sum of upward deviations
+	lower   float64 // Cumulative sum of downward deviations
+	upRun   int     // Samples since upper was last zero
+	downRun int     // Samples since lower was last zero
+	history recent
+}
+
+func newCUSUM(c Config) *CUSUM {
+	return &CUSUM{
+		config:  c,
+		ref:     reference{warmup: c.Warmup},
+		history: recent{n: c.Evidence},
+	}
+}
+
+func (c *CUSUM) Name() string { return TypeCUSUM }
+
+// next returns the sums after x
+func (c *CUSUM) next(x float64) (upper, lower float64) {
+	z := (x - c.ref.mean) / c.ref.stdDev()
+	upper = math.Max(0, c.upper+z-c.config.K)
+	lower = math.Max(0, c.lower-z-c.config.K)
+	return upper, lower
+}
+
+func (c *CUSUM) Check(s Sample) (Result, bool) {
+	if !c.ref.ready() {
+		return Result{}, false
+	}
+
+	upper, lower := c.next(s.Value)
+	score, run := 0.0, 0
+	if c.config.Direction != DirectionDown && upper > score {
+		score, run = upper, c.upRun
+	}
+	if c.config.Direction != DirectionUp && lower > score {
+		score, run = lower, c.downRun
+	}
+	if score < c.config.H {
+		return Result{}, false
+	}
+
+	// The evidence starts where the sum last left zero: the estimated change point
+	return Result{
+		Detector:  TypeCUSUM,
+		Score:     score,
+		Threshold: c.config.H,
+		Expected:  c.ref.mean,
+		Window:    c.history.last(run, s),
+	}, true
+}
+
+func (c *CUSUM) Observe(s Sample) {
+	c.history.add(s)
+	if !c.ref.ready() {
+		c.ref.learn(s.Value)
+		return
+	}
+
+	c.upper, c.lower = c.next(s.Value)
+	c.upRun = nextRun(c.upRun, c.upper)
+	c.downRun = nextRun(c.downRun, c.lower)
+
+	// Restart the sums after a signal so a persistent shift keeps alerting
+	// periodically rather than on every sample
+	if c.upper >= c.config.H {
+		c.upper, c.upRun = 0, 0
+	}
+	if c.lower >= c.config.H {
+		c.lower, c.downRun = 0, 0
+	}
+}
+
+func nextRun(run int, sum float64) int {
+	if sum == 0 {
+		return 0
+	}
+	return run + 1
+}
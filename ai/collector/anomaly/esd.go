@@ -0,0 +1,191 @@
+package anomaly
+
+import (
+	"math"
+	"sort"
+)
+
+// SeasonalESD runs the seasonal hybrid generalized ESD test over a sliding
+// window: the seasonal component and median are removed, then Rosner's
+// generalized extreme Studentized deviate test, using the median and MAD so
+// the outliers themselves do not mask each other, finds the outliers among
+// the residuals. A sample is anomalous when it is one of them.
+type SeasonalESD struct {
+	config Config
+	window recent
+}
+
+func newSeasonalESD(c Config) *SeasonalESD {
+	return &SeasonalESD{config: c, window: recent{n: c.Window - 1}}
+}
+
+func (e *SeasonalESD) Name() string { return TypeSeasonalESD }
+
+// minSamples is the smallest window the test is run on. Per-phase medians
+// over fewer cycles track the noise too closely to separate outliers.
+func (e *SeasonalESD) minSamples() int {
+	if n := 4 * e.config.Period; n > 30 {
+		return n
+	}
+	return 30
+}
+
+func (e *SeasonalESD) Check(s Sample) (Result, bool) {
+	samples := e.window.last(len(e.window.samples), s)
+	if len(samples) < e.minSamples() {
+		return Result{}, false
+	}
+
+	values := make([]float64, len(samples))
+	for i, sample := range samples {
+		values[i] = sample.Value
+	}
+	residuals, expected := seasonalResiduals(values, e.config.Period)
+
+	candidate := len(values) - 1
+	ratio, found := generalizedESD(residuals, e.config.MaxAnomalies, e.config.Alpha, candidate)
+	if !found || directional(e.config.Direction, residuals[candidate]) <= 0 {
+		return Result{}, false
+	}
+
+	evidence := samples
+	if len(evidence) > e.config.Evidence {
+		evidence = evidence[len(evidence)-e.config.Evidence:]
+	}
+	return Result{
+		Detector:  TypeSeasonalESD,
+		Score:     ratio,
+		Threshold: 1,
+		Expected:  expected,
+		Window:    evidence,
+	}, true
+}
+
+func (e *SeasonalESD) Observe(s Sample) {
+	e.window.add(s)
+}
+
+// seasonalResiduals removes the per-phase median (when period > 0) and the
+// overall median from values. It also returns the expected value of the
+// last sample.
+func seasonalResiduals(values []float64, period int) ([]float64, float64) {
+	seasonal := make([]float64, len(values))
+	if period > 0 {
+		for phase := 0; phase < period; phase++ {
+			var same []float64
+			for i := phase; i < len(values); i += period {
+				same = append(same, values[i])
+			}
+			m := median(same)
+			for i := phase; i < len(values); i += period {
+				seasonal[i] = m
+			}
+		}
+	}
+
+	deseasoned := make([]float64, len(values))
+	for i, v := range values {
+		deseasoned[i] = v - seasonal[i]
+	}
+	level := median(deseasoned)
+
+	residuals := make([]float64, len(values))
+	for i := range deseasoned {
+		residuals[i] = deseasoned[i] - level
+	}
+	last := len(values) - 1
+	return residuals, seasonal[last] + level
+}
+
+// generalizedESD tests up to maxFraction of residuals for outliers and
+// reports whether index target is one of them, along with its test
+// statistic relative to the critical value at the step it was removed.
+func generalizedESD(residuals []float64, maxFraction, alpha float64, target int) (float64, bool) {
+	n := len(residuals)
+	maxOutliers := int(math.Floor(float64(n) * maxFraction))
+	if maxOutliers < 1 {
+		return 0, false
+	}
+
+	remaining := make([]int, n)
+	for i := range remaining {
+		remaining[i] = i
+	}
+	values := make([]float64, 0, n)
+
+	outliers := 0
+	targetStep, targetRatio := -1, 0.0
+	for step := 1; step <= maxOutliers; step++ {
+		values = values[:0]
+		for _, i := range remaining {
+			values = append(values, residuals[i])
+		}
+		center := median(values)
+		scale := mad(values, center)
+		if scale == 0 {
+			break
+		}
+
+		worst, stat := 0, -1.0
+		for pos, i := range remaining {
+			if d := math.Abs(residuals[i]-center) / scale; d > stat {
+				worst, stat = pos, d
+			}
+		}
+
+		// Rosner's critical value for the step-th most extreme residual
+		m := float64(n - step + 1)
+		p := 1 - alpha/(2*m)
+		t := studentTQuantile(p, m-2)
+		critical := (m - 1) * t / math.Sqrt((m-2+t*t)*m)
+
+		if stat > critical {
+			outliers = step
+		}
+		if remaining[worst] == target {
+			targetStep, targetRatio = step, stat/critical
+		}
+		remaining = append(remaining[:worst], remaining[worst+1:]...)
+	}
+
+	if targetStep < 1 || targetStep > outliers {
+		return 0, false
+	}
+	return targetRatio, true
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// mad returns the median absolute deviation scaled to estimate a normal
+// standard deviation
+func mad(values []float64, center float64) float64 {
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - center)
+	}
+	return 1.4826 * median(deviations)
+}
+
+// studentTQuantile approximates the p-quantile of Student's t distribution
+// with df degrees of freedom using the Cornish-Fisher expansion around the
+// normal quantile (Abramowitz & Stegun 26.7.5), accurate for df above ~5.
+func studentTQuantile(p, df float64) float64 {
+	z := math.Sqrt2 * math.Erfinv(2*p-1)
+	z2 := z * z
+	g1 := (z2 + 1) * z / 4
+	g2 := ((5*z2+16)*z2 + 3) * z / 96
+	g3 := (((3*z2+19)*z2+17)*z2 - 15) * z / 384
+	g4 := ((((79*z2+776)*z2+1482)*z2-1920)*z2 - 945) * z / 92160
+	return z + g1/df + g2/(df*df) + g3/(df*df*df) + g4/(df*df*df*df)
+}
@@ -0,0 +1,63 @@
+package anomaly
+
+import "math"
+
+// EWMA is an exponentially weighted moving average control chart. Small
+// persistent shifts pull the smoothed statistic outside its control limits
+// long before any single sample looks unusual.
+type EWMA struct {
+	config   Config
+	ref      reference
+	smoothed float64
+	history  recent
+}
+
+func newEWMA(c Config) *EWMA {
+	return &EWMA{
+		config:  c,
+		ref:     reference{warmup: c.Warmup},
+		history: recent{n: c.Evidence},
+	}
+}
+
+func (e *EWMA) Name() string { return TypeEWMA }
+
+// next returns the smoothed statistic after x and its standardised score
+func (e *EWMA) next(x float64) (smoothed, score float64) {
+	lambda := e.config.Lambda
+	smoothed = lambda*x + (1-lambda)*e.smoothed
+	stdErr := e.ref.stdDev() * math.Sqrt(lambda/(2-lambda))
+	return smoothed, (smoothed - e.ref.mean) / stdErr
+}
+
+func (e *EWMA) Check(s Sample) (Result, bool) {
+	if !e.ref.ready() {
+		return Result{}, false
+	}
+
+	_, score := e.next(s.Value)
+	score = directional(e.config.Direction, score)
+	if score < e.config.Limit {
+		return Result{}, false
+	}
+
+	// The statistic remembers roughly 2/lambda samples
+	span := int(math.Ceil(2 / e.config.Lambda))
+	return Result{
+		Detector:  TypeEWMA,
+		Score:     score,
+		Threshold: e.config.Limit,
+		Expected:  e.ref.mean,
+		Window:    e.history.last(span, s),
+	}, true
+}
+
+func (e *EWMA) Observe(s Sample) {
+	e.history.add(s)
+	if !e.ref.ready() {
+		e.ref.learn(s.Value)
+		e.smoothed = e.ref.mean
+		return
+	}
+	e.smoothed, _ = e.next(s.Value)
+}
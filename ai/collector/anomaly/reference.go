@@ -0,0 +1,68 @@
+package anomaly
+
+import "math"
+
+// reference is the in-control mean and deviation an EWMA or CUSUM detector
+// measures against. It is learned over the warmup samples and then held
+// fixed, so gradual drift accumulates in the statistic instead of being
+// absorbed into the reference.
+type reference struct {
+	warmup int
+	count  int
+	mean   float64
+	m2     float64
+}
+
+func (r *reference) ready() bool {
+	return r.count >= r.warmup
+}
+
+// learn adds x to the reference while it is still warming up
+func (r *reference) learn(x float64) {
+	if r.ready() {
+		return
+	}
+	r.count++
+	delta := x - r.mean
+	r.mean += delta / float64(r.count)
+	r.m2 += delta * (x - r.mean)
+}
+
+// stdDev returns the reference sample deviation, floored so a perfectly
+// flat warmup does not make every later change infinitely significant
+func (r *reference) stdDev() float64 {
+	std := 0.0
+	if r.count > 1 {
+		std = math.Sqrt(r.m2 / float64(r.count-1))
+	}
+	if floor := math.Abs(r.mean) * 0.05; std < floor {
+		std = floor
+	}
+	if std == 0 {
+		std = 1e-9
+	}
+	return std
+}
+
+// recent keeps the last n samples for evidence, oldest first
+type recent struct {
+	n       int
+	samples []Sample
+}
+
+func (r *recent) add(s Sample) {
+	r.samples = append(r.samples, s)
+	if len(r.samples) > r.n {
+		r.samples = r.samples[len(r.samples)-r.n:]
+	}
+}
+
+// last returns up to n of the most recent samples followed by extra
+func (r *recent) last(n int, extra Sample) []Sample {
+	if n > len(r.samples) {
+		n = len(r.samples)
+	}
+	window := make([]Sample, 0, n+1)
+	window = append(window, r.samples[len(r.samples)-n:]...)
+	return append(window, extra)
+}
@@ -2,13 +2,17 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/Evarest-ke/healthnetai/collector/anomaly"
 	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/store"
 )
 
 type BaselineMetrics struct {
@@ -21,34 +25,70 @@ type BaselineMetrics struct {
 	UpdatedAt        time.Time
 }
 
+// Seasonal baseline tuning: a slot needs seasonalMinSamples observations
+// before its own stats are trusted, and samples more than zScoreWarning
+// (zScoreCritical) standard deviations above the mean raise an alert.
+const (
+	seasonalMinSamples = 30
+	zScoreWarning      = 3.0
+	zScoreCritical     = 6.0
+)
+
+// seasonalMetrics are the metrics learned per weekday × hour-of-day slot
+var seasonalMetrics = []string{"bandwidth", "latency", "cpu_usage", "memory_usage"}
+
+// baselineFile is the on-disk layout of baseline.json. The flat baseline is
+// embedded so files written before seasonal profiles existed still load.
+type baselineFile struct {
+	BaselineMetrics
+	Seasonal map[string]*SeasonalProfile `json:"seasonal,omitempty"`
+}
+
+// metricDetector is a configured statistical detector for one metric
+type metricDetector struct {
+	config   anomaly.Config
+	detector anomaly.Detector
+}
+
 type BaselineMonitor struct {
-	baseline       BaselineMetrics
-	samples        []models.Metrics
-	sampleSize     int
-	updatePeriod   time.Duration
-	mutex          sync.RWMutex
-	baselinePath   string
-	lastAlerts     map[string]time.Time // Track when alerts were last sent
-	alertThreshold time.Duration        // Minimum time between similar alerts
+	baseline     BaselineMetrics
+	seasonal     map[string]*SeasonalProfile
+	detectors    []metricDetector
+	history      store.History
+	clinicID     string
+	sampleSize   int
+	updatePeriod time.Duration
+	mutex        sync.RWMutex
+	baselinePath string
 }
 
-func NewBaselineMonitor(sampleSize int, updatePeriod time.Duration, alertThreshold time.Duration) *BaselineMonitor {
+func NewBaselineMonitor(history store.History, clinicID string, detectors []anomaly.Config, sampleSize int, updatePeriod time.Duration) *BaselineMonitor {
 	bm := &BaselineMonitor{
-		sampleSize:     sampleSize,
-		updatePeriod:   updatePeriod,
-		baselinePath:   "baseline.json",
-		alertThreshold: alertThreshold,
-		lastAlerts:     make(map[string]time.Time),
+		history:      history,
+		clinicID:     clinicID,
+		sampleSize:   sampleSize,
+		updatePeriod: updatePeriod,
+		baselinePath: "baseline.json",
+		seasonal:     make(map[string]*SeasonalProfile),
 		baseline: BaselineMetrics{
-			AverageBandwidth: 100 * 1024 * 1024, // Start with 100 MB/s
-			AverageLatency:   100,               // Start with 100ms
-			CPUBaseline:      50,                // Start with 50%
-			MemoryBaseline:   50,                // Start with 50%
-			DiskBaseline:     50,                // Start with 50%
+			AverageBandwidth: 100, // Start with 100 MB/s
+			AverageLatency:   100, // Start with 100ms
+			CPUBaseline:      50,  // Start with 50%
+			MemoryBaseline:   50,  // Start with 50%
+			DiskBaseline:     50,  // Start with 50%
 			UpdatedAt:        time.Now(),
 		},
 	}
 
+	if len(detectors) == 0 {
+		detectors = anomaly.DefaultConfigs
+	}
+	for _, config := range detectors {
+		if err := bm.addDetector(config); err != nil {
+			log.Printf("Skipping anomaly detector: %v", err)
+		}
+	}
+
 	if err := bm.loadBaseline(); err != nil {
 		// If loading fails, we'll use the default values above
 		bm.saveBaseline() // Save the defaults for next time
@@ -58,14 +98,13 @@ func NewBaselineMonitor(sampleSize int, updatePeriod time.Duration, alertThresho
 	return bm
 }
 
-func (bm *BaselineMonitor) AddMetrics(metrics models.Metrics) {
-	bm.mutex.Lock()
-	defer bm.mutex.Unlock()
-
-	bm.samples = append(bm.samples, metrics)
-	if len(bm.samples) > bm.sampleSize {
-		bm.samples = bm.samples[1:]
+func (bm *BaselineMonitor) addDetector(config anomaly.Config) error {
+	detector, err := anomaly.New(config)
+	if err != nil {
+		return err
 	}
+	bm.detectors = append(bm.detectors, metricDetector{config: config, detector: detector})
+	return nil
 }
 
 func (bm *BaselineMonitor) GetBaseline() BaselineMetrics {
@@ -75,28 +114,53 @@ func (bm *BaselineMonitor) GetBaseline() BaselineMetrics {
 }
 
 func (bm *BaselineMonitor) updateBaseline() {
+	samples, err := bm.history.Recent(context.Background(), bm.clinicID, bm.sampleSize)
+	if err != nil {
+		log.Printf("Failed to load samples for baseline: %v", err)
+		return
+	}
+
+	// Injected faults are drills, not behaviour to learn from
+	real := samples[:0]
+	for _, m := range samples {
+		if len(m.Faults) == 0 {
+			real = append(real, m)
+		}
+	}
+	samples = real
+
 	bm.mutex.Lock()
 	defer bm.mutex.Unlock()
 
-	if len(bm.samples) < bm.sampleSize/2 {
-		return // Not enough samples
+	if len(samples) < bm.sampleSize/2 {
+		bm.saveBaseline() // Still persist what the seasonal profiles learned
+		return
 	}
 
 	var totals BaselineMetrics
-	count := float64(len(bm.samples))
+	count := float64(len(samples))
+	latencyCount := 0.0
 
-	for _, m := range bm.samples {
-		totals.AverageBandwidth += float64(m.BytesSent+m.BytesReceived) / (1024 * 1024) // MB/s
-		totals.AverageLatency += m.Latency
+	for _, m := range samples {
+		totals.AverageBandwidth += m.Bandwidth() // MB/s
+		if !m.Unreachable {
+			totals.AverageLatency += m.Latency
+			latencyCount++
+		}
 		totals.CPUBaseline += m.CPUUsage
 		totals.MemoryBaseline += m.MemoryUsage
 		totals.DiskBaseline += m.DiskUsage
-		totals.PacketsBaseline += float64(m.PacketsSent + m.PacketsRecv)
+		totals.PacketsBaseline += m.PacketRate()
+	}
+
+	averageLatency := bm.baseline.AverageLatency
+	if latencyCount > 0 {
+		averageLatency = totals.AverageLatency / latencyCount
 	}
 
 	bm.baseline = BaselineMetrics{
 		AverageBandwidth: totals.AverageBandwidth / count,
-		AverageLatency:   totals.AverageLatency / count,
+		AverageLatency:   averageLatency,
 		CPUBaseline:      totals.CPUBaseline / count,
 		MemoryBaseline:   totals.MemoryBaseline / count,
 		DiskBaseline:     totals.DiskBaseline / count,
@@ -116,8 +180,55 @@ func (bm *BaselineMonitor) periodicUpdate() {
 	}
 }
 
+// Observe feeds a sample into the seasonal profiles. It should be called
+// once per collected sample, after the sample was checked for anomalies.
+// Samples carrying injected faults are ignored.
+func (bm *BaselineMonitor) Observe(metrics models.Metrics) {
+	if len(metrics.Faults) > 0 {
+		return
+	}
+
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	if bm.seasonal == nil {
+		bm.seasonal = make(map[string]*SeasonalProfile)
+	}
+
+	ts := sampleTime(metrics)
+	for _, name := range seasonalMetrics {
+		value, ok := metrics.Value(name)
+		if !ok {
+			continue
+		}
+		profile, exists := bm.seasonal[name]
+		if !exists {
+			profile = &SeasonalProfile{}
+			bm.seasonal[name] = profile
+		}
+		profile.Observe(ts, value)
+	}
+
+	for _, d := range bm.detectors {
+		if value, ok := metrics.Value(d.config.Metric); ok {
+			d.detector.Observe(anomaly.Sample{Timestamp: metrics.Timestamp, Value: value})
+		}
+	}
+}
+
+// sampleTime returns the local wall-clock time used to pick a sample's slot
+func sampleTime(metrics models.Metrics) time.Time {
+	if metrics.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return metrics.Timestamp.Local()
+}
+
 func (bm *BaselineMonitor) saveBaseline() {
-	data, err := json.MarshalIndent(bm.baseline, "", "  ")
+	data, err := json.MarshalIndent(baselineFile{
+		BaselineMetrics: bm.baseline,
+		Seasonal:        bm.seasonal,
+	}, "", "  ")
 	if err != nil {
 		return
 	}
@@ -129,69 +240,173 @@ func (bm *BaselineMonitor) loadBaseline() error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, &bm.baseline)
+
+	file := baselineFile{BaselineMetrics: bm.baseline}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	bm.baseline = file.BaselineMetrics
+	if file.Seasonal != nil {
+		bm.seasonal = file.Seasonal
+	}
+	return nil
+}
+
+// metricInfo describes a metric for alert messages
+type metricInfo struct {
+	label       string
+	unit        string
+	recommended string
+}
+
+var metricInfos = map[string]metricInfo{
+	"latency":         {"Network latency", "ms", "Check network connectivity and routing"},
+	"jitter":          {"Jitter", "ms", "Check for congestion or an unstable link that affects telemedicine calls"},
+	"packet_loss":     {"Packet loss", "%", "Check the link quality, cabling and radio alignment"},
+	"uptime":          {"Uptime", "%", "Review recent outages with the ISP"},
+	"bandwidth":       {"Bandwidth usage", "MB/s", "Investigate potential network congestion or unusual traffic patterns"},
+	"bytes_sent_rate": {"Upload rate", "B/s", "Investigate potential network congestion or unusual traffic patterns"},
+	"bytes_recv_rate": {"Download rate", "B/s", "Investigate potential network congestion or unusual traffic patterns"},
+	"packets_rate":    {"Packet rate", "pkt/s", "Look for broadcast storms, scans or unusual traffic patterns"},
+	"errors_rate":     {"Interface error rate", "err/s", "Check cabling, duplex settings and the network card"},
+	"drops_rate":      {"Interface drop rate", "drops/s", "Check for buffer exhaustion and link saturation"},
+	"cpu_usage":       {"CPU usage", "%", "Investigate high CPU processes and potential resource constraints"},
+	"memory_usage":    {"Memory usage", "%", "Check for memory leaks and high memory consumers"},
+	"disk_usage":      {"Disk usage", "%", "Free disk space before records and backups start failing"},
+	"connections":     {"Active interfaces", "", "Check whether an interface went down or an unexpected one appeared"},
 }
 
-// DetectAnomalies checks current metrics against baseline
+// anomalyCheck describes how one metric is compared against its baseline
+type anomalyCheck struct {
+	metric     string
+	severity   string
+	flat       func(BaselineMetrics) float64 // Fallback baseline value
+	flatFactor float64                       // Fallback alert threshold as a multiple of flat
+}
+
+var anomalyChecks = []anomalyCheck{
+	{"bandwidth", "warning", func(b BaselineMetrics) float64 { return b.AverageBandwidth }, 2},
+	{"latency", "warning", func(b BaselineMetrics) float64 { return b.AverageLatency }, 1.5},
+	{"cpu_usage", "critical", func(b BaselineMetrics) float64 { return b.CPUBaseline }, 1.8},
+	{"memory_usage", "warning", func(b BaselineMetrics) float64 { return b.MemoryBaseline }, 1.5},
+}
+
+// DetectAnomalies checks current metrics against baseline. Each metric is
+// scored against the mean and standard deviation of its weekday × hour slot;
+// until a slot has enough samples the metric's global stats are used, and
+// until those exist the flat baseline with a fixed multiplier is used. The
+// configured statistical detectors then run over their metrics.
 func (bm *BaselineMonitor) DetectAnomalies(metrics models.Metrics) []models.Alert {
-	bm.mutex.Lock()
-	defer bm.mutex.Unlock()
+	bm.mutex.RLock()
+	defer bm.mutex.RUnlock()
+
+	var alerts []models.Alert
 
-	if bm.lastAlerts == nil {
-		bm.lastAlerts = make(map[string]time.Time)
+	// Connectivity loss: no probe target answered
+	if metrics.Unreachable {
+		alerts = append(alerts, models.Alert{
+			Severity:    "critical",
+			Description: "All latency probe targets are unreachable",
+			Recommended: "Check the WAN uplink and upstream ISP connectivity",
+			Detector:    "connectivity",
+		})
 	}
 
-	baseline := bm.baseline
-	var alerts []models.Alert
-	now := time.Now()
-
-	// Helper function to check alert throttling
-	canSendAlert := func(alertType string) bool {
-		lastSent, exists := bm.lastAlerts[alertType]
-		if !exists || now.Sub(lastSent) > bm.alertThreshold {
-			bm.lastAlerts[alertType] = now
-			return true
+	ts := sampleTime(metrics)
+	for _, check := range anomalyChecks {
+		value, ok := metrics.Value(check.metric)
+		if !ok {
+			continue
+		}
+
+		if alert, anomalous := bm.checkMetric(check, value, ts); anomalous {
+			alerts = append(alerts, alert)
 		}
-		return false
 	}
 
-	// Bandwidth anomaly (with better thresholds)
-	currentBandwidth := float64(metrics.BytesSent+metrics.BytesReceived) / (1024 * 1024)
-	if currentBandwidth > baseline.AverageBandwidth*2 && canSendAlert("bandwidth") {
-		alerts = append(alerts, models.Alert{
-			Severity: "warning",
-			Description: fmt.Sprintf("Bandwidth usage %.2f MB/s exceeds baseline %.2f MB/s",
-				currentBandwidth, baseline.AverageBandwidth),
-			Recommended: "Investigate potential network congestion or unusual traffic patterns",
-		})
+	for _, d := range bm.detectors {
+		value, ok := metrics.Value(d.config.Metric)
+		if !ok {
+			continue
+		}
+		if result, anomalous := d.detector.Check(anomaly.Sample{Timestamp: metrics.Timestamp, Value: value}); anomalous {
+			alerts = append(alerts, detectorAlert(d.config, value, result))
+		}
 	}
 
-	// Latency anomaly detection
-	if metrics.Latency > baseline.AverageLatency*1.5 {
-		alerts = append(alerts, models.Alert{
-			Severity:    "warning",
-			Description: "Network latency above normal levels",
-			Recommended: "Check network connectivity and routing",
-		})
+	for i := range alerts {
+		alerts[i].ClinicID = bm.clinicID
 	}
+	return alerts
+}
 
-	// CPU usage anomaly
-	if metrics.CPUUsage > baseline.CPUBaseline*1.8 {
-		alerts = append(alerts, models.Alert{
-			Severity:    "critical",
-			Description: "CPU usage significantly elevated",
-			Recommended: "Investigate high CPU processes and potential resource constraints",
-		})
+// baselineDetector names alerts from checkMetric whichever baseline scored
+// them, so an ongoing condition keeps one fingerprint as a slot fills up
+const baselineDetector = "baseline"
+
+// checkMetric scores a single value and builds its alert if it is anomalous
+func (bm *BaselineMonitor) checkMetric(check anomalyCheck, value float64, ts time.Time) (models.Alert, bool) {
+	info := metricInfos[check.metric]
+	alert := models.Alert{
+		Severity:    check.severity,
+		Recommended: info.recommended,
+		Metric:      check.metric,
+		Value:       value,
+		Detector:    baselineDetector,
 	}
 
-	// Memory usage anomaly
-	if metrics.MemoryUsage > baseline.MemoryBaseline*1.5 {
-		alerts = append(alerts, models.Alert{
-			Severity:    "warning",
-			Description: "Memory usage above baseline",
-			Recommended: "Check for memory leaks and high memory consumers",
-		})
+	profile := bm.seasonal[check.metric]
+	if profile == nil || profile.Global.Count < seasonalMinSamples {
+		expected := check.flat(bm.baseline)
+		if value <= expected*check.flatFactor {
+			return alert, false
+		}
+		alert.Score = value / expected
+		alert.Expected = expected
+		alert.Description = fmt.Sprintf("%s %.2f %s is %.1fx the baseline of %.2f %s",
+			info.label, value, info.unit, value/expected, expected, info.unit)
+		return alert, true
 	}
 
-	return alerts
+	stats, seasonal := profile.Expected(ts, seasonalMinSamples)
+	z := zScore(value, stats)
+	if z < zScoreWarning {
+		return alert, false
+	}
+	if z >= zScoreCritical {
+		alert.Severity = "critical"
+	}
+
+	window := "overall"
+	if seasonal {
+		window = fmt.Sprintf("%s %02d:00", ts.Weekday().String()[:3], ts.Hour())
+	}
+	alert.Score = z
+	alert.Expected = stats.Mean
+	alert.ZScore = z
+	alert.Description = fmt.Sprintf("%s %.2f %s is %.1fσ above the %s baseline of %.2f ± %.2f %s",
+		info.label, value, info.unit, z, window, stats.Mean, stats.StdDev(), info.unit)
+	return alert, true
+}
+
+// detectorAlert builds the alert for a statistical detector finding
+func detectorAlert(config anomaly.Config, value float64, result anomaly.Result) models.Alert {
+	info := metricInfos[config.Metric]
+	evidence := make([]models.EvidencePoint, len(result.Window))
+	for i, s := range result.Window {
+		evidence[i] = models.EvidencePoint{Timestamp: s.Timestamp, Value: s.Value}
+	}
+
+	return models.Alert{
+		Severity: config.Severity,
+		Description: fmt.Sprintf("%s %.2f %s deviates from its expected %.2f %s (%s score %.1f, threshold %.1f, over %d samples)",
+			info.label, value, info.unit, result.Expected, info.unit, result.Detector, result.Score, result.Threshold, len(evidence)),
+		Recommended: info.recommended,
+		Metric:      config.Metric,
+		Value:       value,
+		Expected:    result.Expected,
+		Detector:    result.Detector,
+		Score:       result.Score,
+		Evidence:    evidence,
+	}
 }
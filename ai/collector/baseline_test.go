@@ -0,0 +1,179 @@
+package collector
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/collector/anomaly"
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func TestBucketStatsMatchesPopulationVariance(t *testing.T) {
+	var b BucketStats
+	for _, x := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		b.add(x)
+	}
+	if b.Mean != 5 {
+		t.Errorf("Mean = %v, want 5", b.Mean)
+	}
+	if math.Abs(b.StdDev()-2) > 1e-9 {
+		t.Errorf("StdDev = %v, want 2", b.StdDev())
+	}
+}
+
+func newTestBaselineMonitor(t *testing.T) *BaselineMonitor {
+	return &BaselineMonitor{
+		baselinePath: filepath.Join(t.TempDir(), "baseline.json"),
+		seasonal:     make(map[string]*SeasonalProfile),
+		baseline:     BaselineMetrics{AverageLatency: 100, CPUBaseline: 50, MemoryBaseline: 50, AverageBandwidth: 100},
+	}
+}
+
+// seasonalLatency trains four weeks of one-minute samples where the 08:00
+// intake hour runs around 200ms and every other hour around 40ms
+func seasonalLatency(bm *BaselineMonitor, start time.Time) {
+	for ts := start; ts.Before(start.Add(28 * 24 * time.Hour)); ts = ts.Add(time.Minute) {
+		latency := 40.0
+		if ts.Hour() == 8 {
+			latency = 200
+		}
+		latency += float64(ts.Minute()%5) - 2 // ±2ms of noise
+		bm.Observe(models.Metrics{Timestamp: ts, Latency: latency})
+	}
+}
+
+func TestDetectAnomaliesUsesTimeOfDayBuckets(t *testing.T) {
+	bm := newTestBaselineMonitor(t)
+	start := time.Date(2025, 3, 3, 0, 0, 0, 0, time.Local) // Monday
+	seasonalLatency(bm, start)
+
+	latencyAlert := func(ts time.Time, latency float64) *models.Alert {
+		m := models.Metrics{Timestamp: ts, Latency: latency, Unreachable: latency == 0}
+		for _, a := range bm.DetectAnomalies(m) {
+			if a.Metric == "latency" {
+				return &a
+			}
+		}
+		return nil
+	}
+
+	morning := time.Date(2025, 3, 31, 8, 30, 0, 0, time.Local)
+	night := time.Date(2025, 3, 31, 2, 30, 0, 0, time.Local)
+
+	if a := latencyAlert(morning, 205); a != nil {
+		t.Errorf("Expected normal intake-hour latency to pass, got %q", a.Description)
+	}
+
+	a := latencyAlert(night, 205)
+	if a == nil {
+		t.Fatal("Expected intake-level latency at 02:00 to alert")
+	}
+	if a.Severity != "critical" || math.Abs(a.Expected-40) > 1 || a.ZScore < zScoreCritical {
+		t.Errorf("Unexpected alert: %+v", *a)
+	}
+
+	if a := latencyAlert(night, 52); a == nil || a.Severity != "warning" {
+		t.Errorf("Expected a warning for a moderate night-time rise, got %+v", a)
+	}
+
+	// Unreachable samples carry no latency to score
+	if a := latencyAlert(night, 0); a != nil {
+		t.Errorf("Expected no latency alert while unreachable, got %+v", *a)
+	}
+}
+
+func TestDetectAnomaliesFallsBack(t *testing.T) {
+	bm := newTestBaselineMonitor(t)
+	ts := time.Date(2025, 3, 31, 10, 0, 0, 0, time.Local)
+
+	// No seasonal data yet: the flat 1.5x latency rule applies
+	alerts := bm.DetectAnomalies(models.Metrics{Timestamp: ts, Latency: 160})
+	if len(alerts) != 1 || alerts[0].Metric != "latency" || alerts[0].Expected != 100 || alerts[0].ZScore != 0 {
+		t.Fatalf("Expected a flat-baseline latency alert, got %+v", alerts)
+	}
+
+	// Enough global samples but an empty slot: the global stats apply
+	other := time.Date(2025, 3, 31, 3, 0, 0, 0, time.Local)
+	for i := 0; i < seasonalMinSamples; i++ {
+		bm.Observe(models.Metrics{Timestamp: other, Latency: 40 + float64(i%3)})
+	}
+	flat := alerts[0]
+	alerts = bm.DetectAnomalies(models.Metrics{Timestamp: ts, Latency: 90})
+	if len(alerts) != 1 || math.Abs(alerts[0].Expected-41) > 0.1 || alerts[0].ZScore == 0 {
+		t.Fatalf("Expected a global-baseline latency alert, got %+v", alerts)
+	}
+
+	// Switching baselines must not change the alert's identity, or the same
+	// condition would resolve and reopen under a new fingerprint
+	if alerts[0].Detector != flat.Detector || alerts[0].Metric != flat.Metric {
+		t.Errorf("Alert identity changed from %s:%s to %s:%s",
+			flat.Detector, flat.Metric, alerts[0].Detector, alerts[0].Metric)
+	}
+}
+
+func TestBaselinePersistsSeasonalProfiles(t *testing.T) {
+	bm := newTestBaselineMonitor(t)
+	ts := time.Date(2025, 3, 31, 8, 0, 0, 0, time.Local)
+	bm.Observe(models.Metrics{Timestamp: ts, Latency: 42, CPUUsage: 10})
+	bm.saveBaseline()
+
+	loaded := &BaselineMonitor{baselinePath: bm.baselinePath}
+	if err := loaded.loadBaseline(); err != nil {
+		t.Fatalf("loadBaseline: %v", err)
+	}
+	if loaded.baseline.AverageLatency != 100 {
+		t.Errorf("Flat baseline not restored: %+v", loaded.baseline)
+	}
+	bucket := loaded.seasonal["latency"].Buckets[ts.Weekday()][8]
+	if bucket.Count != 1 || bucket.Mean != 42 {
+		t.Errorf("Seasonal bucket not restored: %+v", bucket)
+	}
+}
+
+func TestDetectAnomaliesRunsDetectors(t *testing.T) {
+	bm := newTestBaselineMonitor(t)
+	if err := bm.addDetector(anomaly.Config{Metric: "disk_usage", Type: anomaly.TypeCUSUM, Warmup: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 3, 31, 10, 0, 0, 0, time.Local)
+	sample := func(i int, disk float64) models.Metrics {
+		return models.Metrics{Timestamp: start.Add(time.Duration(i) * time.Minute), Latency: 40, DiskUsage: disk}
+	}
+
+	for i := 0; i < 20; i++ {
+		bm.Observe(sample(i, 50+float64(i%3)))
+	}
+
+	// Disk usage creeps up well below any fixed ratio
+	var found *models.Alert
+	for i := 20; i < 60 && found == nil; i++ {
+		m := sample(i, 55+0.1*float64(i-20))
+		for _, a := range bm.DetectAnomalies(m) {
+			if a.Detector == anomaly.TypeCUSUM {
+				found = &a
+			}
+		}
+		bm.Observe(m)
+	}
+	if found == nil {
+		t.Fatal("Expected a CUSUM disk usage alert")
+	}
+	if found.Metric != "disk_usage" || found.Score < 8 || len(found.Evidence) == 0 || math.Abs(found.Expected-51) > 0.5 {
+		t.Errorf("Unexpected alert: %+v", *found)
+	}
+}
+
+func TestObserveSkipsInjectedFaults(t *testing.T) {
+	bm := newTestBaselineMonitor(t)
+	ts := time.Date(2025, 3, 31, 8, 0, 0, 0, time.Local)
+	bm.Observe(models.Metrics{Timestamp: ts, Latency: 42})
+	bm.Observe(models.Metrics{Timestamp: ts, Latency: 442, Faults: []string{"latency"}})
+
+	bucket := bm.seasonal["latency"].Buckets[ts.Weekday()][8]
+	if bucket.Count != 1 || bucket.Mean != 42 {
+		t.Errorf("Faulted sample was learned: %+v", bucket)
+	}
+}
@@ -0,0 +1,261 @@
+// Package faults injects synthetic problems into collected samples for
+// demos and drills. Faults are opt-in, scoped to clinics and time-boxed;
+// every sample they touch is tagged so it can be told apart from real data,
+// and the metrics store keeps tagged samples out of the history.
+package faults
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Fault types
+const (
+	TypeLatency   = "latency"   // Adds Magnitude ms to the measured latency
+	TypeOutage    = "outage"    // Every probe fails and traffic stops
+	TypeCPU       = "cpu"       // Raises CPU usage to Magnitude %
+	TypeBandwidth = "bandwidth" // Adds Magnitude MB/s of received traffic
+)
+
+// MaxDuration bounds how long a single fault may run
+const MaxDuration = 24 * time.Hour
+
+// Default magnitudes per type
+var defaultMagnitude = map[string]float64{
+	TypeLatency:   400,
+	TypeCPU:       95,
+	TypeBandwidth: 900,
+}
+
+var ErrNotFound = errors.New("fault not found")
+
+// Spec describes a fault to inject, from config.yaml or the API
+type Spec struct {
+	Type      string        `yaml:"type" json:"type"`
+	ClinicID  string        `yaml:"clinic_id" json:"clinic_id"` // Clinic ID glob; empty matches every clinic
+	Magnitude float64       `yaml:"magnitude" json:"magnitude"` // Type default when zero
+	StartsAt  time.Time     `yaml:"starts_at" json:"starts_at"` // Now when zero
+	Duration  time.Duration `yaml:"duration" json:"duration"`
+	Reason    string        `yaml:"reason" json:"reason"`
+}
+
+// UnmarshalJSON accepts Duration as a duration string such as "15m"
+func (s *Spec) UnmarshalJSON(data []byte) error {
+	type plain Spec
+	var v struct {
+		plain
+		Duration string `json:"duration"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = Spec(v.plain)
+	s.Duration = 0
+	if v.Duration != "" {
+		d, err := time.ParseDuration(v.Duration)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %v", v.Duration, err)
+		}
+		s.Duration = d
+	}
+	return nil
+}
+
+// Validate checks the type, scope and time box
+func (s Spec) Validate() error {
+	switch s.Type {
+	case TypeLatency, TypeOutage, TypeCPU, TypeBandwidth:
+	default:
+		return fmt.Errorf("type must be latency, outage, cpu or bandwidth (got %q)", s.Type)
+	}
+	if _, err := path.Match(s.ClinicID, ""); err != nil {
+		return fmt.Errorf("invalid clinic_id pattern %q: %v", s.ClinicID, err)
+	}
+	if s.Duration <= 0 || s.Duration > MaxDuration {
+		return fmt.Errorf("duration must be between 0 and %v", MaxDuration)
+	}
+	if s.Magnitude < 0 || s.Type == TypeCPU && s.Magnitude > 100 {
+		return fmt.Errorf("magnitude out of range for a %s fault", s.Type)
+	}
+	return nil
+}
+
+// Fault is a scheduled or running injection
+type Fault struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	ClinicID  string    `json:"clinic_id"`
+	Magnitude float64   `json:"magnitude"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ActiveAt reports whether the fault is running at t
+func (f Fault) ActiveAt(t time.Time) bool {
+	return !t.Before(f.StartsAt) && t.Before(f.EndsAt)
+}
+
+// Matches reports whether the fault applies to a clinic
+func (f Fault) Matches(clinicID string) bool {
+	if f.ClinicID == "" {
+		return true
+	}
+	ok, _ := path.Match(f.ClinicID, clinicID)
+	return ok
+}
+
+// apply distorts one sample
+func (f Fault) apply(m *models.Metrics) {
+	switch f.Type {
+	case TypeLatency:
+		if !m.Unreachable {
+			m.Latency += f.Magnitude
+			m.Network.Latency = m.Latency
+		}
+	case TypeOutage:
+		m.Unreachable = true
+		m.Latency = 0
+		m.Network.Latency = 0
+		m.Network.PacketLoss = 100
+		m.Network.Bandwidth = 0
+		for i := range m.Probes {
+			m.Probes[i].Received = 0
+			m.Probes[i].RTTs = nil
+			m.Probes[i].Error = "injected outage"
+		}
+		m.BytesSentRate, m.BytesRecvRate = 0, 0
+		m.PacketsSentRate, m.PacketsRecvRate = 0, 0
+	case TypeCPU:
+		if m.CPUUsage < f.Magnitude {
+			m.CPUUsage = f.Magnitude
+		}
+	case TypeBandwidth:
+		m.BytesRecvRate += f.Magnitude * 1024 * 1024
+		m.Network.Bandwidth = m.Bandwidth() * 8 // Mbps
+	}
+}
+
+// Injector holds the configured and API-created faults. Faults are kept in
+// memory only, so a restart ends every drill.
+type Injector struct {
+	mu     sync.RWMutex
+	faults map[string]Fault
+}
+
+// NewInjector schedules the faults in specs, starting from now
+func NewInjector(specs []Spec, now time.Time) (*Injector, error) {
+	in := &Injector{faults: make(map[string]Fault)}
+	for i, s := range specs {
+		if _, err := in.Add(s, "config", now); err != nil {
+			return nil, fmt.Errorf("fault %d: %v", i+1, err)
+		}
+	}
+	return in, nil
+}
+
+// Add validates and schedules a fault
+func (in *Injector) Add(s Spec, createdBy string, now time.Time) (Fault, error) {
+	if err := s.Validate(); err != nil {
+		return Fault{}, err
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if s.Magnitude == 0 {
+		s.Magnitude = defaultMagnitude[s.Type]
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	f := Fault{
+		ID:        "flt_" + hex.EncodeToString(b),
+		Type:      s.Type,
+		ClinicID:  s.ClinicID,
+		Magnitude: s.Magnitude,
+		StartsAt:  s.StartsAt,
+		EndsAt:    s.StartsAt.Add(s.Duration),
+		Reason:    s.Reason,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.prune(now)
+	in.faults[f.ID] = f
+	return f, nil
+}
+
+// Cancel ends a fault early
+func (in *Injector) Cancel(id string) (Fault, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	f, ok := in.faults[id]
+	if !ok {
+		return Fault{}, ErrNotFound
+	}
+	delete(in.faults, id)
+	return f, nil
+}
+
+// List returns the faults that have not ended at now, optionally only
+// those running, ordered by start time
+func (in *Injector) List(now time.Time, activeOnly bool) []Fault {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+
+	list := []Fault{}
+	for _, f := range in.faults {
+		if !now.Before(f.EndsAt) || activeOnly && !f.ActiveAt(now) {
+			continue
+		}
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].StartsAt.Equal(list[j].StartsAt) {
+			return list[i].StartsAt.Before(list[j].StartsAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Apply distorts a sample with every fault running at now for its clinic
+// and records the fault types in m.Faults
+func (in *Injector) Apply(m *models.Metrics, now time.Time) {
+	copied := false
+	for _, f := range in.List(now, true) {
+		if !f.Matches(m.ClinicID) {
+			continue
+		}
+		if !copied {
+			// Don't write through to probe results shared with the caller
+			m.Probes = append([]models.ProbeResult(nil), m.Probes...)
+			copied = true
+		}
+		f.apply(m)
+		m.Faults = append(m.Faults, f.Type)
+	}
+}
+
+// prune drops faults that have ended. Callers hold in.mu.
+func (in *Injector) prune(now time.Time) {
+	for id, f := range in.faults {
+		if !now.Before(f.EndsAt) {
+			delete(in.faults, id)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package faults
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+var now = time.Date(2025, 4, 2, 10, 0, 0, 0, time.UTC)
+
+func sample(clinicID string) models.Metrics {
+	return models.Metrics{
+		ClinicID:      clinicID,
+		Latency:       40,
+		CPUUsage:      20,
+		BytesRecvRate: 1024 * 1024,
+		Network:       models.NetworkMetrics{Latency: 40, PacketLoss: 0},
+		Probes:        []models.ProbeResult{{Target: "dns", Sent: 3, Received: 3, RTTs: []float64{39, 40, 41}}},
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec Spec
+		want string
+	}{
+		{"unknown type", Spec{Type: "disk", Duration: time.Minute}, "type must be"},
+		{"no duration", Spec{Type: TypeOutage}, "duration"},
+		{"too long", Spec{Type: TypeOutage, Duration: 48 * time.Hour}, "duration"},
+		{"bad pattern", Spec{Type: TypeOutage, ClinicID: "[", Duration: time.Minute}, "clinic_id"},
+		{"cpu over 100", Spec{Type: TypeCPU, Magnitude: 150, Duration: time.Minute}, "magnitude"},
+		{"valid", Spec{Type: TypeLatency, ClinicID: "jootrh", Duration: 15 * time.Minute}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate()
+			if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("Validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpecUnmarshalJSON(t *testing.T) {
+	var s Spec
+	if err := json.Unmarshal([]byte(`{"type":"latency","clinic_id":"jootrh","duration":"15m","magnitude":250}`), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Duration != 15*time.Minute || s.Magnitude != 250 || s.ClinicID != "jootrh" {
+		t.Errorf("Unexpected spec %+v", s)
+	}
+	if err := json.Unmarshal([]byte(`{"type":"latency","duration":"soon"}`), &s); err == nil {
+		t.Error("Expected an invalid duration to be rejected")
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  Spec
+		check func(m models.Metrics) bool
+	}{
+		{"latency", Spec{Type: TypeLatency}, func(m models.Metrics) bool {
+			return m.Latency == 440 && m.Network.Latency == 440
+		}},
+		{"outage", Spec{Type: TypeOutage}, func(m models.Metrics) bool {
+			return m.Unreachable && m.Network.PacketLoss == 100 && m.BytesRecvRate == 0 && m.Probes[0].Received == 0
+		}},
+		{"cpu", Spec{Type: TypeCPU}, func(m models.Metrics) bool { return m.CPUUsage == 95 }},
+		{"bandwidth", Spec{Type: TypeBandwidth, Magnitude: 500}, func(m models.Metrics) bool {
+			return m.Bandwidth() == 501 && m.Network.Bandwidth == 501*8
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.spec.Duration = time.Hour
+			in, err := NewInjector([]Spec{tt.spec}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			orig := sample("jootrh")
+			m := orig
+			in.Apply(&m, now.Add(time.Minute))
+			if !tt.check(m) || len(m.Faults) != 1 || m.Faults[0] != tt.spec.Type {
+				t.Errorf("Unexpected sample %+v", m)
+			}
+			// The measured sample is left alone
+			if orig.Probes[0].Received != 3 || len(orig.Faults) != 0 {
+				t.Errorf("Apply modified the original sample: %+v", orig)
+			}
+		})
+	}
+}
+
+func TestInjectorScope(t *testing.T) {
+	in, _ := NewInjector(nil, now)
+	outage, err := in.Add(Spec{Type: TypeOutage, ClinicID: "jootrh", StartsAt: now.Add(time.Hour), Duration: 30 * time.Minute}, "7", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Add(Spec{Type: TypeCPU, ClinicID: "siaya-*", Duration: 2 * time.Hour}, "7", now); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		clinicID string
+		at       time.Time
+		want     []string
+	}{
+		{"before the outage", "jootrh", now.Add(30 * time.Minute), nil},
+		{"during the outage", "jootrh", now.Add(70 * time.Minute), []string{TypeOutage}},
+		{"after the outage", "jootrh", now.Add(90 * time.Minute), nil},
+		{"other clinic", "siaya-bondo", now.Add(70 * time.Minute), []string{TypeCPU}},
+		{"unscoped clinic", "kisumu", now.Add(70 * time.Minute), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := sample(tt.clinicID)
+			in.Apply(&m, tt.at)
+			if strings.Join(m.Faults, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Faults = %v, want %v", m.Faults, tt.want)
+			}
+		})
+	}
+
+	if got := in.List(now, true); len(got) != 1 || got[0].Type != TypeCPU {
+		t.Errorf("Expected only the CPU fault to be active, got %+v", got)
+	}
+	if got := in.List(now, false); len(got) != 2 || got[1].ID != outage.ID {
+		t.Errorf("Expected both faults to be listed, got %+v", got)
+	}
+
+	if _, err := in.Cancel(outage.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Cancel(outage.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	m := sample("jootrh")
+	in.Apply(&m, now.Add(70*time.Minute))
+	if len(m.Faults) != 0 {
+		t.Errorf("Cancelled fault still applied: %v", m.Faults)
+	}
+}
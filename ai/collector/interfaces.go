@@ -0,0 +1,137 @@
+// collector/interfaces.go
+package collector
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/Evarest-ke/healthnetai/models"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// InterfaceConfig selects which interfaces the collector reports on.
+// Include and Exclude take shell-style globs such as "veth*".
+type InterfaceConfig struct {
+	Include []string `yaml:"include"` // Empty means every interface
+	Exclude []string `yaml:"exclude"`
+	Uplink  string   `yaml:"uplink"` // The clinic's WAN-facing interface
+}
+
+// Validate checks that every include and exclude pattern is a valid glob
+func (ic InterfaceConfig) Validate() error {
+	for _, patterns := range [][]string{ic.Include, ic.Exclude} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid interface pattern %q: %v", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Allows reports whether an interface passes the include and exclude filters.
+// The uplink is always allowed so it cannot be filtered out by accident.
+func (ic InterfaceConfig) Allows(name string) bool {
+	if name == ic.Uplink {
+		return true
+	}
+	if matchAny(ic.Exclude, name) {
+		return false
+	}
+	return len(ic.Include) == 0 || matchAny(ic.Include, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// buildInterfaceMetrics merges interface details, raw counters and rates into
+// a per-interface breakdown, keeping only interfaces allowed by the config
+func buildInterfaceMetrics(cfg InterfaceConfig, ifaces []psnet.InterfaceStat,
+	counters map[string]psnet.IOCountersStat, rates map[string]ifaceRates) []models.InterfaceMetrics {
+
+	details := make(map[string]psnet.InterfaceStat, len(ifaces))
+	names := make(map[string]bool)
+	for _, iface := range ifaces {
+		details[iface.Name] = iface
+		names[iface.Name] = true
+	}
+	for name := range counters {
+		names[name] = true
+	}
+
+	var result []models.InterfaceMetrics
+	for name := range names {
+		if !cfg.Allows(name) {
+			continue
+		}
+
+		im := models.InterfaceMetrics{
+			Name:   name,
+			Uplink: name == cfg.Uplink,
+		}
+		if iface, ok := details[name]; ok {
+			im.MTU = iface.MTU
+			im.Flags = iface.Flags
+			for _, flag := range iface.Flags {
+				if flag == "up" {
+					im.Up = true
+				}
+			}
+		}
+		if c, ok := counters[name]; ok {
+			im.BytesSent = c.BytesSent
+			im.BytesReceived = c.BytesRecv
+			im.PacketsSent = c.PacketsSent
+			im.PacketsRecv = c.PacketsRecv
+			im.ErrorsIn = c.Errin
+			im.ErrorsOut = c.Errout
+			im.DropsIn = c.Dropin
+			im.DropsOut = c.Dropout
+		}
+		if r, ok := rates[name]; ok {
+			im.BytesSentRate = r.BytesSent
+			im.BytesRecvRate = r.BytesRecv
+			im.PacketsSentRate = r.PacketsSent
+			im.PacketsRecvRate = r.PacketsRecv
+			im.ErrorsRate = r.Errors
+			im.DropsRate = r.Drops
+		}
+		result = append(result, im)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// summarizeInterfaces picks the counters and rates reported at the top level
+// of a sample: the uplink on its own when configured, otherwise the sum of
+// every interface that passed the filters. missing is set when an uplink is
+// configured but absent, so callers can tell the signal changed.
+func summarizeInterfaces(cfg InterfaceConfig, stats []models.InterfaceMetrics) (total models.InterfaceMetrics, uplink string, missing bool) {
+	for _, im := range stats {
+		if im.Uplink {
+			return im, im.Name, false
+		}
+	}
+
+	for _, im := range stats {
+		total.BytesSent += im.BytesSent
+		total.BytesReceived += im.BytesReceived
+		total.PacketsSent += im.PacketsSent
+		total.PacketsRecv += im.PacketsRecv
+		total.BytesSentRate += im.BytesSentRate
+		total.BytesRecvRate += im.BytesRecvRate
+		total.PacketsSentRate += im.PacketsSentRate
+		total.PacketsRecvRate += im.PacketsRecvRate
+		total.ErrorsRate += im.ErrorsRate
+		total.DropsRate += im.DropsRate
+	}
+	return total, "", cfg.Uplink != ""
+}
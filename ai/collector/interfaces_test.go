@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/Evarest-ke/healthnetai/models"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+func TestInterfaceConfigAllows(t *testing.T) {
+	cfg := InterfaceConfig{
+		Exclude: []string{"lo", "veth*"},
+		Uplink:  "wwan0",
+	}
+
+	tests := []struct {
+		name  string
+		iface string
+		want  bool
+	}{
+		{name: "Ethernet passes", iface: "eth0", want: true},
+		{name: "Loopback excluded", iface: "lo", want: false},
+		{name: "Glob exclusion", iface: "veth12ab", want: false},
+		{name: "Uplink always allowed", iface: "wwan0", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.Allows(tt.iface); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.iface, got, tt.want)
+			}
+		})
+	}
+
+	include := InterfaceConfig{Include: []string{"eth*"}, Exclude: []string{"eth9"}}
+	if !include.Allows("eth0") || include.Allows("wlan0") || include.Allows("eth9") {
+		t.Errorf("Include filter did not restrict interfaces as expected")
+	}
+
+	if err := (InterfaceConfig{Exclude: []string{"[eth"}}).Validate(); err == nil {
+		t.Errorf("Expected an error for a malformed glob")
+	}
+}
+
+func TestBuildInterfaceMetrics(t *testing.T) {
+	cfg := InterfaceConfig{Exclude: []string{"lo"}, Uplink: "eth0"}
+	ifaces := []psnet.InterfaceStat{
+		{Name: "lo", MTU: 65536, Flags: []string{"up", "loopback"}},
+		{Name: "eth0", MTU: 1500, Flags: []string{"up", "broadcast"}},
+		{Name: "wlan0", MTU: 1500, Flags: []string{"broadcast"}},
+	}
+	counters := map[string]psnet.IOCountersStat{
+		"lo":   {Name: "lo", BytesSent: 10},
+		"eth0": {Name: "eth0", BytesSent: 100, Errin: 3},
+	}
+	rates := map[string]ifaceRates{
+		"eth0": {BytesSent: 50, Errors: 0.5},
+	}
+
+	stats := buildInterfaceMetrics(cfg, ifaces, counters, rates)
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 interfaces after filtering, got %d: %+v", len(stats), stats)
+	}
+
+	eth0, wlan0 := stats[0], stats[1]
+	if eth0.Name != "eth0" || !eth0.Uplink || !eth0.Up || eth0.MTU != 1500 {
+		t.Errorf("Unexpected eth0 details: %+v", eth0)
+	}
+	if eth0.BytesSent != 100 || eth0.ErrorsIn != 3 || eth0.BytesSentRate != 50 || eth0.ErrorsRate != 0.5 {
+		t.Errorf("Unexpected eth0 counters: %+v", eth0)
+	}
+	if wlan0.Name != "wlan0" || wlan0.Up || wlan0.Uplink {
+		t.Errorf("Unexpected wlan0 details: %+v", wlan0)
+	}
+}
+
+func TestSummarizeInterfaces(t *testing.T) {
+	stats := []models.InterfaceMetrics{
+		{Name: "eth0", BytesSentRate: 10},
+		{Name: "wlan0", BytesSentRate: 5},
+	}
+
+	total, uplink, missing := summarizeInterfaces(InterfaceConfig{}, stats)
+	if total.BytesSentRate != 15 || uplink != "" || missing {
+		t.Errorf("Without an uplink expected the sum, got %+v uplink=%q missing=%v", total, uplink, missing)
+	}
+
+	withUplink := append([]models.InterfaceMetrics(nil), stats...)
+	withUplink[1].Uplink = true
+	total, uplink, missing = summarizeInterfaces(InterfaceConfig{Uplink: "wlan0"}, withUplink)
+	if total.BytesSentRate != 5 || uplink != "wlan0" || missing {
+		t.Errorf("Expected the uplink alone, got %+v uplink=%q missing=%v", total, uplink, missing)
+	}
+
+	total, uplink, missing = summarizeInterfaces(InterfaceConfig{Uplink: "wwan0"}, stats)
+	if total.BytesSentRate != 15 || uplink != "" || !missing {
+		t.Errorf("Expected the fallback sum flagged as missing, got %+v uplink=%q missing=%v", total, uplink, missing)
+	}
+}
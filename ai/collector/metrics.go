@@ -51,23 +51,33 @@ func (c *Collector) CalculateAverages(metrics []models.Metrics) models.Metrics {
 	}
 
 	for _, m := range metrics {
-		totals.BytesSent += m.BytesSent
-		totals.BytesReceived += m.BytesReceived
-		totals.PacketsSent += m.PacketsSent
-		totals.PacketsRecv += m.PacketsRecv
+		totals.BytesSentRate += m.BytesSentRate
+		totals.BytesRecvRate += m.BytesRecvRate
+		totals.PacketsSentRate += m.PacketsSentRate
+		totals.PacketsRecvRate += m.PacketsRecvRate
+		totals.ErrorsRate += m.ErrorsRate
+		totals.DropsRate += m.DropsRate
 		totals.Latency += m.Latency
 		totals.CPUUsage += m.CPUUsage
 	}
 
+	latest := metrics[len(metrics)-1]
+
 	return models.Metrics{
-		Timestamp:     time.Now(),
-		BytesSent:     uint64(float64(totals.BytesSent) / count),
-		BytesReceived: uint64(float64(totals.BytesReceived) / count),
-		PacketsSent:   uint64(float64(totals.PacketsSent) / count),
-		PacketsRecv:   uint64(float64(totals.PacketsRecv) / count),
-		Latency:       totals.Latency / count,
-		CPUUsage:      totals.CPUUsage / count,
-		MemoryUsage:   totals.MemoryUsage,
-		DiskUsage:     totals.DiskUsage,
+		Timestamp:       time.Now(),
+		BytesSent:       latest.BytesSent,
+		BytesReceived:   latest.BytesReceived,
+		PacketsSent:     latest.PacketsSent,
+		PacketsRecv:     latest.PacketsRecv,
+		BytesSentRate:   totals.BytesSentRate / count,
+		BytesRecvRate:   totals.BytesRecvRate / count,
+		PacketsSentRate: totals.PacketsSentRate / count,
+		PacketsRecvRate: totals.PacketsRecvRate / count,
+		ErrorsRate:      totals.ErrorsRate / count,
+		DropsRate:       totals.DropsRate / count,
+		Latency:         totals.Latency / count,
+		CPUUsage:        totals.CPUUsage / count,
+		MemoryUsage:     totals.MemoryUsage,
+		DiskUsage:       totals.DiskUsage,
 	}
 }
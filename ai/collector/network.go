@@ -2,11 +2,17 @@
 package collector
 
 import (
-	stdnet "net"
-	"sort"
+	"context"
+	"fmt"
+	"log"
+	"sync"
 	"time"
 
+	"github.com/Evarest-ke/healthnetai/collector/anomaly"
+	"github.com/Evarest-ke/healthnetai/collector/faults"
+	"github.com/Evarest-ke/healthnetai/collector/probe"
 	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/store"
 	"github.com/shirou/gopsutil/v3/cpu"
 	psnet "github.com/shirou/gopsutil/v3/net"
 )
@@ -24,21 +30,99 @@ type Metrics struct {
 	CPUUsage      float64
 }
 
+// DefaultClinicID identifies samples from this host when no clinic is configured
+const DefaultClinicID = "local"
+
+// Config holds the collector settings loaded from config.yaml
+type Config struct {
+	ClinicID   string          `yaml:"clinic_id"` // Clinic this host monitors
+	Interfaces InterfaceConfig `yaml:"interfaces"`
+	Probes     []probe.Target  `yaml:"probes"` // Latency targets; defaults to public resolvers
+	// Window over which uptime is reported; defaults to one hour
+	UptimeWindow time.Duration `yaml:"uptime_window"`
+	// Statistical anomaly detectors per metric; defaults to anomaly.DefaultConfigs
+	Detectors []anomaly.Config `yaml:"detectors"`
+	// Faults injected into the samples from startup, for demos and drills
+	Faults []faults.Spec `yaml:"faults"`
+}
+
+// Validate checks the interface filters and probe targets
+func (c Config) Validate() error {
+	if err := c.Interfaces.Validate(); err != nil {
+		return fmt.Errorf("interfaces: %v", err)
+	}
+	if err := probe.Validate(c.Probes); err != nil {
+		return fmt.Errorf("probes: %v", err)
+	}
+	for _, d := range c.Detectors {
+		if err := d.Validate(); err != nil {
+			return fmt.Errorf("detectors: %v", err)
+		}
+	}
+	for i, f := range c.Faults {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("faults: fault %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
 type Collector struct {
 	interval time.Duration
+	config   Config
 	metrics  chan models.Metrics
 	Baseline *BaselineMonitor
+	prober   *probe.Runner
+	quality  *qualityTracker
+	// Faults distorts samples after they are measured; nothing is injected
+	// unless a fault is configured or added through the API
+	Faults *faults.Injector
+
+	latest   *models.Metrics
+	latestMu sync.RWMutex
+
+	// Previous counter snapshot used to turn cumulative totals into rates
+	prevCounters map[string]psnet.IOCountersStat
+	prevTime     time.Time
+	// Whether the last sample fell back from a missing uplink, so the
+	// switch is logged once rather than every interval
+	uplinkMissing bool
 }
 
-func NewCollector(interval time.Duration) *Collector {
+func NewCollector(interval time.Duration, config Config, history store.History) *Collector {
+	if config.ClinicID == "" {
+		config.ClinicID = DefaultClinicID
+	}
+
+	prober, err := probe.NewRunner(config.Probes)
+	if err != nil {
+		log.Printf("Invalid probe targets, using defaults: %v", err)
+		prober, _ = probe.NewRunner(nil)
+	}
+
+	injector, err := faults.NewInjector(config.Faults, time.Now())
+	if err != nil {
+		log.Printf("Invalid fault injection config, ignoring it: %v", err)
+		injector, _ = faults.NewInjector(nil, time.Now())
+	}
+
 	return &Collector{
 		interval: interval,
+		config:   config,
+		prober:   prober,
+		quality:  newQualityTracker(uptimeWindowSize(config.UptimeWindow, interval)),
+		Faults:   injector,
 		metrics:  make(chan models.Metrics, 100),
-		Baseline: NewBaselineMonitor(100, 1*time.Hour, 1*time.Minute), // Added alert threshold
+		Baseline: NewBaselineMonitor(history, config.ClinicID, config.Detectors, 100, 1*time.Hour),
 	}
 }
 
 func (c *Collector) Start() chan models.Metrics {
+	// Prime the counter snapshot so the first emitted sample has real rates
+	if _, err := c.collectMetrics(); err != nil {
+		log.Printf("Failed to prime network counters: %v", err)
+	}
+
 	go func() {
 		ticker := time.NewTicker(c.interval)
 		defer ticker.Stop()
@@ -59,19 +143,40 @@ func (c *Collector) collect() (models.Metrics, error) {
 	if err != nil {
 		return models.Metrics{}, err
 	}
+	c.quality.observe(&metrics)
+	// Injected after the quality tracker so drills don't linger in uptime
+	c.Faults.Apply(&metrics, time.Now())
 
-	// Add metrics to baseline monitor
-	c.Baseline.AddMetrics(metrics)
+	c.latestMu.Lock()
+	c.latest = &metrics
+	c.latestMu.Unlock()
 
 	return metrics, nil
 }
 
+// ClinicID returns the clinic this collector's samples are attributed to
+func (c *Collector) ClinicID() string {
+	return c.config.ClinicID
+}
+
+// Latest returns the most recently collected sample, if any
+func (c *Collector) Latest() (models.Metrics, bool) {
+	c.latestMu.RLock()
+	defer c.latestMu.RUnlock()
+
+	if c.latest == nil {
+		return models.Metrics{}, false
+	}
+	return *c.latest, true
+}
+
 func (c *Collector) collectMetrics() (models.Metrics, error) {
 	// Use gopsutil/net for network metrics
 	stats, err := psnet.IOCounters(true)
 	if err != nil {
 		return models.Metrics{}, err
 	}
+	now := time.Now()
 
 	cpuPercent, err := cpu.Percent(time.Second, false)
 	if err != nil {
@@ -83,76 +188,83 @@ func (c *Collector) collectMetrics() (models.Metrics, error) {
 		return models.Metrics{}, err
 	}
 
-	var totalBytesSent, totalBytesRecv, totalPacketsSent, totalPacketsRecv uint64
-	var ifaceNames []string
-
+	counters := make(map[string]psnet.IOCountersStat, len(stats))
 	for _, stat := range stats {
-		totalBytesSent += stat.BytesSent
-		totalBytesRecv += stat.BytesRecv
-		totalPacketsSent += stat.PacketsSent
-		totalPacketsRecv += stat.PacketsRecv
+		counters[stat.Name] = stat
 	}
 
-	for _, iface := range interfaces {
-		ifaceNames = append(ifaceNames, iface.Name)
+	var rates map[string]ifaceRates
+	if c.prevCounters != nil {
+		rates = computeRates(c.prevCounters, counters, now.Sub(c.prevTime).Seconds())
 	}
+	c.prevCounters = counters
+	c.prevTime = now
 
-	// Measure latency without passing the unused host parameter
-	latency := measureLatency()
-
-	return models.Metrics{
-		Timestamp:     time.Now(),
-		BytesSent:     totalBytesSent,
-		BytesReceived: totalBytesRecv,
-		PacketsSent:   totalPacketsSent,
-		PacketsRecv:   totalPacketsRecv,
-		Latency:       latency,
-		Connections:   len(interfaces),
-		Interfaces:    ifaceNames,
-		CPUUsage:      cpuPercent[0],
-	}, nil
-}
-
-func measureLatency() float64 {
-	hosts := []string{"8.8.8.8:80", "1.1.1.1:80", "google.com:80"}
-	var latencies []float64
+	ifaceStats := buildInterfaceMetrics(c.config.Interfaces, interfaces, counters, rates)
 
-	for _, h := range hosts {
-		if lat := pingHost(h); lat > 0 {
-			latencies = append(latencies, lat)
+	total, uplink, uplinkMissing := summarizeInterfaces(c.config.Interfaces, ifaceStats)
+	if uplinkMissing != c.uplinkMissing {
+		if uplinkMissing {
+			log.Printf("Uplink interface %q not found, reporting the sum of %d filtered interfaces", c.config.Interfaces.Uplink, len(ifaceStats))
+		} else {
+			log.Printf("Uplink interface %q is back, reporting it alone", c.config.Interfaces.Uplink)
 		}
+		c.uplinkMissing = uplinkMissing
 	}
-
-	if len(latencies) == 0 {
-		return 1000.0
+	var ifaceNames []string
+	for _, im := range ifaceStats {
+		ifaceNames = append(ifaceNames, im.Name)
 	}
-	return calculateMedian(latencies)
-}
 
-func pingHost(host string) float64 {
-	start := time.Now()
-	conn, err := stdnet.DialTimeout("tcp", host, time.Second)
-	if err == nil {
-		latency := float64(time.Since(start).Milliseconds())
-		conn.Close()
-		return latency
+	// Memory and disk are best effort; network metrics are still useful without them
+	var memoryUsage, diskUsage float64
+	if sys, err := c.SystemMetrics(); err == nil {
+		memoryUsage = sys.MemoryUsage
+		diskUsage = sys.DiskUsage
 	}
-	return -1.0
+
+	probes := c.prober.Run(context.Background())
+	latency, reachable := summarizeProbes(probes)
+
+	return models.Metrics{
+		Timestamp:       now,
+		ClinicID:        c.config.ClinicID,
+		BytesSent:       total.BytesSent,
+		BytesReceived:   total.BytesReceived,
+		PacketsSent:     total.PacketsSent,
+		PacketsRecv:     total.PacketsRecv,
+		BytesSentRate:   total.BytesSentRate,
+		BytesRecvRate:   total.BytesRecvRate,
+		PacketsSentRate: total.PacketsSentRate,
+		PacketsRecvRate: total.PacketsRecvRate,
+		ErrorsRate:      total.ErrorsRate,
+		DropsRate:       total.DropsRate,
+		Latency:         latency,
+		Unreachable:     !reachable,
+		Probes:          probes,
+		Connections:     len(ifaceStats),
+		Interfaces:      ifaceNames,
+		InterfaceStats:  ifaceStats,
+		Uplink:          uplink,
+		UplinkMissing:   uplinkMissing,
+		CPUUsage:        cpuPercent[0],
+		MemoryUsage:     memoryUsage,
+		DiskUsage:       diskUsage,
+	}, nil
 }
 
-func calculateMedian(numbers []float64) float64 {
-	n := len(numbers)
-	if n == 0 {
-		return 0.0
+// summarizeProbes reduces per-target results to a single latency figure: the
+// median RTT of the targets that answered. It reports false when none did.
+func summarizeProbes(results []models.ProbeResult) (float64, bool) {
+	var rtts []float64
+	for _, r := range results {
+		if r.Received > 0 {
+			rtts = append(rtts, r.RTT)
+		}
 	}
 
-	sorted := make([]float64, n)
-	copy(sorted, numbers)
-	sort.Float64s(sorted)
-
-	middle := n / 2
-	if n%2 == 0 {
-		return (sorted[middle-1] + sorted[middle]) / 2.0
+	if len(rtts) == 0 {
+		return 0, false
 	}
-	return sorted[middle]
+	return probe.Median(rtts), true
 }
@@ -0,0 +1,32 @@
+// collector/probe/dns.go
+package probe
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// DNSProber measures how long it takes to resolve a hostname. When the
+// target names a resolver it is queried directly, bypassing the system
+// configuration.
+type DNSProber struct{}
+
+func (DNSProber) Probe(ctx context.Context, target Target) (time.Duration, error) {
+	resolver := net.DefaultResolver
+	if target.Resolver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, target.Resolver)
+			},
+		}
+	}
+
+	start := time.Now()
+	if _, err := resolver.LookupHost(ctx, target.Address); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,52 @@
+// collector/probe/http.go
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPProber measures the time until response headers arrive for a GET
+// request. Keep-alives are disabled so every attempt includes the connection
+// and TLS setup a clinic workstation would pay.
+type HTTPProber struct {
+	client *http.Client
+}
+
+func NewHTTPProber() *HTTPProber {
+	return &HTTPProber{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:             http.ProxyFromEnvironment,
+				DisableKeepAlives: true,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (p *HTTPProber) Probe(ctx context.Context, target Target) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.Address, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return rtt, nil
+}
@@ -0,0 +1,89 @@
+// collector/probe/icmp.go
+package probe
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ICMPProber sends echo requests over an unprivileged datagram socket, so no
+// root or CAP_NET_RAW is needed. On Linux the process group must fall inside
+// net.ipv4.ping_group_range.
+type ICMPProber struct{}
+
+func (ICMPProber) Probe(ctx context.Context, target Target) (time.Duration, error) {
+	ipAddr, err := net.DefaultResolver.LookupIPAddr(ctx, target.Address)
+	if err != nil {
+		return 0, err
+	}
+	if len(ipAddr) == 0 {
+		return 0, fmt.Errorf("no addresses for %s", target.Address)
+	}
+	ip := ipAddr[0].IP
+
+	network, listenAddr := "udp4", "0.0.0.0"
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	proto := 1 // ICMP for IPv4
+	if ip.To4() == nil {
+		network, listenAddr = "udp6", "::"
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		proto = 58 // ICMP for IPv6
+	}
+
+	conn, err := icmp.ListenPacket(network, listenAddr)
+	if err != nil {
+		return 0, fmt.Errorf("unprivileged ICMP unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// The kernel rewrites the ID to the socket's port for datagram sockets,
+	// so replies are matched on sequence number
+	seq := rand.Intn(1 << 16)
+	msg := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{
+			ID:   os.Getpid() & 0xffff,
+			Seq:  seq,
+			Data: []byte("healthnet-probe"),
+		},
+	}
+	payload, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(payload, &net.UDPAddr{IP: ip}); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		if reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq {
+			return time.Since(start), nil
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// collector/probe/probe.go
+package probe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Probe types supported by the runner
+const (
+	TypeTCP  = "tcp"
+	TypeHTTP = "http"
+	TypeDNS  = "dns"
+	TypeICMP = "icmp"
+)
+
+const (
+	defaultCount    = 3
+	defaultTimeout  = time.Second
+	defaultInterval = 100 * time.Millisecond
+)
+
+// Target describes a single endpoint to probe, e.g. the county data center
+// or the KHIS server
+type Target struct {
+	Name     string        `yaml:"name" json:"name"`
+	Type     string        `yaml:"type" json:"type"`                   // tcp, http, dns or icmp
+	Address  string        `yaml:"address" json:"address"`             // host:port, URL, hostname or IP
+	Resolver string        `yaml:"resolver" json:"resolver,omitempty"` // DNS server for dns probes
+	Count    int           `yaml:"count" json:"count"`                 // Attempts per collection interval
+	Timeout  time.Duration `yaml:"timeout" json:"timeout"`
+	Interval time.Duration `yaml:"interval" json:"interval"` // Gap between attempts
+}
+
+// DefaultTargets are used when no probes are configured
+var DefaultTargets = []Target{
+	{Name: "google-dns", Type: TypeTCP, Address: "8.8.8.8:80"},
+	{Name: "cloudflare-dns", Type: TypeTCP, Address: "1.1.1.1:80"},
+	{Name: "google", Type: TypeTCP, Address: "google.com:80"},
+}
+
+// Prober performs a single round-trip measurement against a target
+type Prober interface {
+	Probe(ctx context.Context, target Target) (time.Duration, error)
+}
+
+// NewProber returns the prober implementation for a probe type
+func NewProber(probeType string) (Prober, error) {
+	switch probeType {
+	case TypeTCP:
+		return TCPProber{}, nil
+	case TypeHTTP:
+		return NewHTTPProber(), nil
+	case TypeDNS:
+		return DNSProber{}, nil
+	case TypeICMP:
+		return ICMPProber{}, nil
+	default:
+		return nil, fmt.Errorf("unknown probe type %q", probeType)
+	}
+}
+
+// Validate checks a list of targets for missing fields and unknown types
+func Validate(targets []Target) error {
+	seen := make(map[string]bool)
+	for i, t := range targets {
+		if t.Name == "" {
+			return fmt.Errorf("probe %d: name is required", i)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("probe %q: duplicate name", t.Name)
+		}
+		seen[t.Name] = true
+
+		if t.Address == "" {
+			return fmt.Errorf("probe %q: address is required", t.Name)
+		}
+		if _, err := NewProber(t.Type); err != nil {
+			return fmt.Errorf("probe %q: %v", t.Name, err)
+		}
+		if t.Count < 0 || t.Timeout < 0 || t.Interval < 0 {
+			return fmt.Errorf("probe %q: count, timeout and interval must not be negative", t.Name)
+		}
+	}
+	return nil
+}
+
+func (t Target) withDefaults() Target {
+	if t.Count == 0 {
+		t.Count = defaultCount
+	}
+	if t.Timeout == 0 {
+		t.Timeout = defaultTimeout
+	}
+	if t.Interval == 0 {
+		t.Interval = defaultInterval
+	}
+	return t
+}
+
+// Runner probes a fixed set of targets concurrently
+type Runner struct {
+	targets []Target
+	probers map[string]Prober
+}
+
+// NewRunner validates the targets and prepares a prober for each type.
+// An empty list falls back to DefaultTargets.
+func NewRunner(targets []Target) (*Runner, error) {
+	if len(targets) == 0 {
+		targets = DefaultTargets
+	}
+	if err := Validate(targets); err != nil {
+		return nil, err
+	}
+
+	r := &Runner{probers: make(map[string]Prober)}
+	for _, t := range targets {
+		t = t.withDefaults()
+		r.targets = append(r.targets, t)
+		if _, ok := r.probers[t.Type]; !ok {
+			p, _ := NewProber(t.Type)
+			r.probers[t.Type] = p
+		}
+	}
+	return r, nil
+}
+
+// Targets returns the targets the runner probes, with defaults applied
+func (r *Runner) Targets() []Target {
+	return r.targets
+}
+
+// Run probes every target once and returns one result per target in
+// configuration order
+func (r *Runner) Run(ctx context.Context) []models.ProbeResult {
+	results := make([]models.ProbeResult, len(r.targets))
+
+	var wg sync.WaitGroup
+	for i, t := range r.targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			results[i] = Measure(ctx, r.probers[t.Type], t)
+		}(i, t)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Measure sends target.Count attempts and summarises round-trip time,
+// jitter and packet loss. RTTs are reported in milliseconds with
+// sub-millisecond resolution. Jitter here is the mean RTT difference within
+// this burst only; the collector smooths it across intervals.
+func Measure(ctx context.Context, p Prober, target Target) models.ProbeResult {
+	target = target.withDefaults()
+	result := models.ProbeResult{
+		Target:    target.Name,
+		Type:      target.Type,
+		Address:   target.Address,
+		Timestamp: time.Now(),
+	}
+
+	var rtts []float64
+	var lastErr error
+	for i := 0; i < target.Count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				lastErr = ctx.Err()
+			case <-time.After(target.Interval):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, target.Timeout)
+		rtt, err := p.Probe(attemptCtx, target)
+		cancel()
+
+		result.Sent++
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		result.Received++
+		rtts = append(rtts, durationMillis(rtt))
+	}
+
+	result.RTTs = rtts
+	if result.Sent > 0 {
+		result.PacketLoss = float64(result.Sent-result.Received) / float64(result.Sent) * 100
+	}
+	if len(rtts) == 0 {
+		if lastErr != nil {
+			result.Error = lastErr.Error()
+		}
+		return result
+	}
+
+	result.RTT = Median(rtts)
+	result.MinRTT, result.MaxRTT = rtts[0], rtts[0]
+	for i, v := range rtts {
+		if v < result.MinRTT {
+			result.MinRTT = v
+		}
+		if v > result.MaxRTT {
+			result.MaxRTT = v
+		}
+		if i > 0 {
+			d := v - rtts[i-1]
+			if d < 0 {
+				d = -d
+			}
+			result.Jitter += d
+		}
+	}
+	if len(rtts) > 1 {
+		result.Jitter /= float64(len(rtts) - 1)
+	}
+	return result
+}
+
+// Median returns the median of a set of values, or 0 when it is empty
+func Median(numbers []float64) float64 {
+	n := len(numbers)
+	if n == 0 {
+		return 0.0
+	}
+
+	sorted := make([]float64, n)
+	copy(sorted, numbers)
+	sort.Float64s(sorted)
+
+	middle := n / 2
+	if n%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2.0
+	}
+	return sorted[middle]
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
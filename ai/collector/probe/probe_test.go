@@ -0,0 +1,185 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestTCPProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	result := Measure(context.Background(), TCPProber{}, Target{
+		Name: "local", Type: TypeTCP, Address: ln.Addr().String(), Count: 4, Interval: time.Millisecond,
+	})
+
+	if result.Sent != 4 || result.Received != 4 || result.PacketLoss != 0 {
+		t.Fatalf("Expected 4/4 successful attempts, got %+v", result)
+	}
+	if result.RTT <= 0 || result.RTT > 1000 {
+		t.Errorf("Expected a sub-second RTT, got %v ms", result.RTT)
+	}
+	if result.MinRTT > result.RTT || result.RTT > result.MaxRTT {
+		t.Errorf("RTT %v outside [%v, %v]", result.RTT, result.MinRTT, result.MaxRTT)
+	}
+}
+
+func TestTCPProbeFailure(t *testing.T) {
+	// Grab a free port and close it so nothing is listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	result := Measure(context.Background(), TCPProber{}, Target{
+		Name: "closed", Type: TypeTCP, Address: addr, Count: 2, Interval: time.Millisecond,
+	})
+
+	if result.Received != 0 || result.PacketLoss != 100 {
+		t.Errorf("Expected 100%% loss, got %+v", result)
+	}
+	if result.RTT != 0 || result.Error == "" {
+		t.Errorf("Expected no RTT and an error for a failed target, got %+v", result)
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ok.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	p := NewHTTPProber()
+
+	result := Measure(context.Background(), p, Target{Name: "emr", Type: TypeHTTP, Address: ok.URL, Count: 2})
+	if result.Received != 2 || result.RTT <= 0 {
+		t.Errorf("Expected successful HTTP probes, got %+v", result)
+	}
+
+	result = Measure(context.Background(), p, Target{Name: "khis", Type: TypeHTTP, Address: failing.URL, Count: 1})
+	if result.Received != 0 || !strings.Contains(result.Error, "502") {
+		t.Errorf("Expected a 5xx response to count as a failure, got %+v", result)
+	}
+}
+
+func TestDNSProbe(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer pc.Close()
+	go serveDNS(pc)
+
+	result := Measure(context.Background(), DNSProber{}, Target{
+		Name:     "county-dc",
+		Type:     TypeDNS,
+		Address:  "dc.kisumu.example",
+		Resolver: pc.LocalAddr().String(),
+		Count:    2,
+	})
+
+	if result.Received != 2 || result.RTT <= 0 {
+		t.Errorf("Expected successful DNS probes, got %+v", result)
+	}
+}
+
+// serveDNS answers every A query with 10.0.0.1 and everything else with an
+// empty response
+func serveDNS(pc net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+			continue
+		}
+
+		q := msg.Questions[0]
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: msg.Header.ID, Response: true, Authoritative: true},
+			Questions: msg.Questions,
+		}
+		if q.Type == dnsmessage.TypeA {
+			resp.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}},
+			}}
+		}
+
+		packed, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		pc.WriteTo(packed, addr)
+	}
+}
+
+func TestICMPProbe(t *testing.T) {
+	result := Measure(context.Background(), ICMPProber{}, Target{
+		Name: "loopback", Type: TypeICMP, Address: "127.0.0.1", Count: 1,
+	})
+	if strings.Contains(result.Error, "unprivileged ICMP unavailable") {
+		t.Skipf("Skipping: %s", result.Error)
+	}
+	if result.Received != 1 {
+		t.Errorf("Expected an echo reply from loopback, got %+v", result)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []Target
+		wantErr string
+	}{
+		{name: "Valid", targets: []Target{{Name: "khis", Type: TypeHTTP, Address: "https://hiskenya.org"}}},
+		{name: "Missing name", targets: []Target{{Type: TypeTCP, Address: "10.0.0.1:80"}}, wantErr: "name is required"},
+		{name: "Unknown type", targets: []Target{{Name: "x", Type: "snmp", Address: "10.0.0.1"}}, wantErr: "unknown probe type"},
+		{name: "Duplicate", targets: []Target{
+			{Name: "x", Type: TypeTCP, Address: "10.0.0.1:80"},
+			{Name: "x", Type: TypeTCP, Address: "10.0.0.2:80"},
+		}, wantErr: "duplicate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.targets)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
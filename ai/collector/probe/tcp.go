@@ -0,0 +1,25 @@
+// collector/probe/tcp.go
+package probe
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// TCPProber measures the time to complete a TCP handshake
+type TCPProber struct{}
+
+func (TCPProber) Probe(ctx context.Context, target Target) (time.Duration, error) {
+	var d net.Dialer
+
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", target.Address)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	conn.Close()
+
+	return rtt, nil
+}
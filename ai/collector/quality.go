@@ -0,0 +1,113 @@
+// collector/quality.go
+package collector
+
+import (
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// jitterGain is the 1/16 smoothing factor from RFC 3550 section 6.4.1
+const jitterGain = 1.0 / 16
+
+// targetJitter is the running RFC 3550 jitter state for one probe target
+type targetJitter struct {
+	jitter  float64
+	lastRTT float64
+	primed  bool
+}
+
+// qualityTracker turns per-interval probe bursts into the link quality
+// figures telemedicine cares about: smoothed jitter, loss and rolling uptime
+type qualityTracker struct {
+	targets map[string]*targetJitter
+	window  []bool // Reachability of the most recent intervals, oldest first
+	size    int
+}
+
+func newQualityTracker(windowSize int) *qualityTracker {
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	return &qualityTracker{
+		targets: make(map[string]*targetJitter),
+		size:    windowSize,
+	}
+}
+
+// observe folds one interval of probe results into the tracker. Each
+// result's Jitter is replaced with the smoothed per-target estimate.
+func (q *qualityTracker) observe(m *models.Metrics) {
+	var sent, received int
+	var jitterSum float64
+	var jitterCount int
+
+	for i := range m.Probes {
+		r := &m.Probes[i]
+		sent += r.Sent
+		received += r.Received
+
+		state, ok := q.targets[r.Target]
+		if !ok {
+			state = &targetJitter{}
+			q.targets[r.Target] = state
+		}
+
+		// With round-trip probes the transit-time difference D(i,j) of
+		// RFC 3550 reduces to the difference between consecutive RTTs
+		for _, rtt := range r.RTTs {
+			if state.primed {
+				d := rtt - state.lastRTT
+				if d < 0 {
+					d = -d
+				}
+				state.jitter += (d - state.jitter) * jitterGain
+			}
+			state.lastRTT = rtt
+			state.primed = true
+		}
+
+		r.Jitter = state.jitter
+		if r.Received > 0 {
+			jitterSum += state.jitter
+			jitterCount++
+		}
+	}
+
+	q.window = append(q.window, !m.Unreachable)
+	if len(q.window) > q.size {
+		q.window = q.window[len(q.window)-q.size:]
+	}
+	up := 0
+	for _, ok := range q.window {
+		if ok {
+			up++
+		}
+	}
+
+	network := models.NetworkMetrics{
+		Bandwidth: (m.BytesSentRate + m.BytesRecvRate) * 8 / 1e6,
+		Latency:   m.Latency,
+		Uptime:    float64(up) / float64(len(q.window)) * 100,
+		LastCheck: m.Timestamp,
+	}
+	if sent > 0 {
+		network.PacketLoss = float64(sent-received) / float64(sent) * 100
+	}
+	if jitterCount > 0 {
+		network.Jitter = jitterSum / float64(jitterCount)
+	}
+	m.Network = network
+}
+
+// uptimeWindowSize converts the configured uptime window into a number of
+// collection intervals
+func uptimeWindowSize(window, interval time.Duration) int {
+	if window <= 0 {
+		window = time.Hour
+	}
+	if interval <= 0 {
+		return 1
+	}
+	return int(window / interval)
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func TestQualityTrackerJitter(t *testing.T) {
+	q := newQualityTracker(10)
+
+	// Alternating 20ms/30ms RTTs converge towards a 10ms jitter
+	for i := 0; i < 40; i++ {
+		m := models.Metrics{
+			Probes: []models.ProbeResult{{
+				Target: "emr", Sent: 2, Received: 2, RTT: 25, RTTs: []float64{20, 30},
+			}},
+		}
+		q.observe(&m)
+		if i == 0 && m.Probes[0].Jitter >= 10 {
+			t.Errorf("Expected the first burst to start below the steady state, got %v", m.Probes[0].Jitter)
+		}
+		if i == 39 {
+			if math.Abs(m.Network.Jitter-10) > 0.5 {
+				t.Errorf("Expected jitter near 10ms, got %v", m.Network.Jitter)
+			}
+			if m.Network.Jitter != m.Probes[0].Jitter {
+				t.Errorf("Expected network jitter to match the only target, got %v vs %v",
+					m.Network.Jitter, m.Probes[0].Jitter)
+			}
+		}
+	}
+
+	// A steady link decays the estimate
+	m := models.Metrics{}
+	for i := 0; i < 100; i++ {
+		m = models.Metrics{
+			Probes: []models.ProbeResult{{Target: "emr", Sent: 1, Received: 1, RTTs: []float64{25}}},
+		}
+		q.observe(&m)
+	}
+	if m.Network.Jitter > 0.1 {
+		t.Errorf("Expected jitter to decay on a steady link, got %v", m.Network.Jitter)
+	}
+}
+
+func TestQualityTrackerLossAndUptime(t *testing.T) {
+	q := newQualityTracker(4)
+
+	samples := []models.Metrics{
+		{Probes: []models.ProbeResult{{Target: "a", Sent: 4, Received: 4, RTTs: []float64{10, 10, 10, 10}}}},
+		{Unreachable: true, Probes: []models.ProbeResult{{Target: "a", Sent: 4}}},
+		{Probes: []models.ProbeResult{
+			{Target: "a", Sent: 4, Received: 3, RTTs: []float64{10, 10, 10}},
+			{Target: "b", Sent: 4, Received: 0},
+		}},
+	}
+
+	var last models.Metrics
+	for _, m := range samples {
+		m.Timestamp = time.Now()
+		m.BytesSentRate = 125000
+		q.observe(&m)
+		last = m
+	}
+
+	if want := 5.0 / 8 * 100; math.Abs(last.Network.PacketLoss-want) > 1e-9 {
+		t.Errorf("PacketLoss = %v, want %v", last.Network.PacketLoss, want)
+	}
+	if want := 2.0 / 3 * 100; math.Abs(last.Network.Uptime-want) > 1e-9 {
+		t.Errorf("Uptime = %v, want %v", last.Network.Uptime, want)
+	}
+	if last.Network.Bandwidth != 1 {
+		t.Errorf("Bandwidth = %v Mbps, want 1", last.Network.Bandwidth)
+	}
+
+	// The window only remembers the last four intervals
+	for i := 0; i < 4; i++ {
+		m := models.Metrics{Probes: []models.ProbeResult{{Target: "a", Sent: 1, Received: 1, RTTs: []float64{10}}}}
+		q.observe(&m)
+		last = m
+	}
+	if last.Network.Uptime != 100 {
+		t.Errorf("Expected the outage to age out of the window, got uptime %v", last.Network.Uptime)
+	}
+}
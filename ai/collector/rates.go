@@ -0,0 +1,64 @@
+// collector/rates.go
+package collector
+
+import (
+	"math"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// ifaceRates holds per-second rates for a single interface
+type ifaceRates struct {
+	BytesSent   float64
+	BytesRecv   float64
+	PacketsSent float64
+	PacketsRecv float64
+	Errors      float64
+	Drops       float64
+}
+
+// counterDelta returns how much a cumulative counter grew between two
+// readings. A reading lower than the previous one means the counter either
+// wrapped (32-bit counters on older drivers) or was reset because the
+// interface was re-created or the host rebooted. In the reset case the
+// current value is all that accumulated since.
+func counterDelta(prev, cur uint64) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	if prev <= math.MaxUint32 {
+		wrapped := math.MaxUint32 - prev + cur + 1
+		if wrapped < math.MaxUint32/2 {
+			return wrapped
+		}
+	}
+	return cur
+}
+
+// computeRates converts two counter snapshots taken elapsed seconds apart into
+// per-second rates. Interfaces missing from the previous snapshot have no
+// reference point yet and are left out until the next interval.
+func computeRates(prev, cur map[string]psnet.IOCountersStat, elapsed float64) map[string]ifaceRates {
+	rates := make(map[string]ifaceRates, len(cur))
+	if elapsed <= 0 {
+		return rates
+	}
+
+	for name, c := range cur {
+		p, ok := prev[name]
+		if !ok {
+			continue
+		}
+		rates[name] = ifaceRates{
+			BytesSent:   float64(counterDelta(p.BytesSent, c.BytesSent)) / elapsed,
+			BytesRecv:   float64(counterDelta(p.BytesRecv, c.BytesRecv)) / elapsed,
+			PacketsSent: float64(counterDelta(p.PacketsSent, c.PacketsSent)) / elapsed,
+			PacketsRecv: float64(counterDelta(p.PacketsRecv, c.PacketsRecv)) / elapsed,
+			Errors: float64(counterDelta(p.Errin, c.Errin)+
+				counterDelta(p.Errout, c.Errout)) / elapsed,
+			Drops: float64(counterDelta(p.Dropin, c.Dropin)+
+				counterDelta(p.Dropout, c.Dropout)) / elapsed,
+		}
+	}
+	return rates
+}
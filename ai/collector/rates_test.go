@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"math"
+	"testing"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name string
+		prev uint64
+		cur  uint64
+		want uint64
+	}{
+		{name: "Normal increase", prev: 1000, cur: 1500, want: 500},
+		{name: "No change", prev: 1000, cur: 1000, want: 0},
+		{name: "32-bit wraparound", prev: math.MaxUint32 - 99, cur: 400, want: 500},
+		{name: "Reset after reboot", prev: 5_000_000_000, cur: 2000, want: 2000},
+		{name: "Reset of small 32-bit counter", prev: 3_000_000, cur: 100, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counterDelta(tt.prev, tt.cur); got != tt.want {
+				t.Errorf("counterDelta(%d, %d) = %d, want %d", tt.prev, tt.cur, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeRates(t *testing.T) {
+	prev := map[string]psnet.IOCountersStat{
+		"eth0":  {Name: "eth0", BytesSent: 1000, BytesRecv: 2000, PacketsSent: 10, PacketsRecv: 20, Errin: 1, Dropout: 2},
+		"wlan0": {Name: "wlan0", BytesSent: 500},
+	}
+	cur := map[string]psnet.IOCountersStat{
+		"eth0":    {Name: "eth0", BytesSent: 7000, BytesRecv: 14000, PacketsSent: 70, PacketsRecv: 140, Errin: 4, Dropout: 8},
+		"docker0": {Name: "docker0", BytesSent: 1 << 30},
+	}
+
+	rates := computeRates(prev, cur, 6)
+
+	if _, ok := rates["docker0"]; ok {
+		t.Errorf("Expected new interface docker0 to be skipped until it has a reference sample")
+	}
+	if _, ok := rates["wlan0"]; ok {
+		t.Errorf("Expected vanished interface wlan0 to be dropped")
+	}
+
+	eth0, ok := rates["eth0"]
+	if !ok {
+		t.Fatalf("Expected rates for eth0")
+	}
+	want := ifaceRates{BytesSent: 1000, BytesRecv: 2000, PacketsSent: 10, PacketsRecv: 20, Errors: 0.5, Drops: 1}
+	if eth0 != want {
+		t.Errorf("Unexpected eth0 rates: got %+v, want %+v", eth0, want)
+	}
+
+	if got := computeRates(prev, cur, 0); len(got) != 0 {
+		t.Errorf("Expected no rates for a zero-length interval, got %+v", got)
+	}
+}
@@ -0,0 +1,75 @@
+// collector/seasonal.go
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+// seasonalMaxCount caps each bucket's effective sample count so the
+// baseline keeps adapting once a bucket has seen a few weeks of data
+const seasonalMaxCount = 1000
+
+// BucketStats holds an incrementally updated mean and variance. Until Count
+// reaches seasonalMaxCount the update is Welford's algorithm; after that it
+// becomes an exponentially weighted mean with weight 1/seasonalMaxCount.
+type BucketStats struct {
+	Count    float64 `json:"count"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+}
+
+func (b *BucketStats) add(x float64) {
+	n := b.Count + 1
+	if n > seasonalMaxCount {
+		n = seasonalMaxCount
+	}
+	alpha := 1 / n
+	delta := x - b.Mean
+	b.Mean += alpha * delta
+	b.Variance = (1 - alpha) * (b.Variance + alpha*delta*delta)
+	b.Count = n
+}
+
+// StdDev returns the bucket's population standard deviation
+func (b BucketStats) StdDev() float64 {
+	return math.Sqrt(b.Variance)
+}
+
+// SeasonalProfile keeps one bucket per weekday × hour-of-day for a metric,
+// plus a global bucket used while the matching slot is still learning.
+type SeasonalProfile struct {
+	Global  BucketStats        `json:"global"`
+	Buckets [7][24]BucketStats `json:"buckets"`
+}
+
+// Observe folds a sample taken at ts into its slot and the global bucket
+func (p *SeasonalProfile) Observe(ts time.Time, value float64) {
+	p.Global.add(value)
+	p.Buckets[ts.Weekday()][ts.Hour()].add(value)
+}
+
+// Expected returns the stats to compare a sample taken at ts against. The
+// slot's own stats are used once it has at least minSamples observations;
+// otherwise the global stats are returned and seasonal is false.
+func (p *SeasonalProfile) Expected(ts time.Time, minSamples float64) (stats BucketStats, seasonal bool) {
+	bucket := p.Buckets[ts.Weekday()][ts.Hour()]
+	if bucket.Count >= minSamples {
+		return bucket, true
+	}
+	return p.Global, false
+}
+
+// zScore returns how many standard deviations value lies from stats' mean.
+// The deviation is floored at a fraction of the mean so a perfectly steady
+// bucket does not turn every tiny wobble into an outlier.
+func zScore(value float64, stats BucketStats) float64 {
+	std := stats.StdDev()
+	if floor := math.Abs(stats.Mean) * 0.05; std < floor {
+		std = floor
+	}
+	if std == 0 {
+		return 0
+	}
+	return (value - stats.Mean) / std
+}
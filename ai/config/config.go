@@ -0,0 +1,64 @@
+// config/config.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/collector"
+	"github.com/Evarest-ke/healthnetai/incident"
+	"github.com/Evarest-ke/healthnetai/notify"
+	"github.com/Evarest-ke/healthnetai/report"
+	"github.com/Evarest-ke/healthnetai/store"
+	"gopkg.in/yaml.v3"
+)
+
+// Config mirrors the layout of config.yaml
+type Config struct {
+	Collector collector.Config        `yaml:"collector"`
+	Store     store.Config            `yaml:"store"`
+	Alerts    alerts.Config           `yaml:"alerts"`
+	Notify    notify.Config           `yaml:"notify"`
+	LLM       analyzer.LLMConfig      `yaml:"llm"`
+	Prompts   analyzer.PromptConfig   `yaml:"prompts"`
+	Stats     analyzer.StatsConfig    `yaml:"network_stats"`
+	Forecast  analyzer.ForecastConfig `yaml:"forecast"`
+	Incidents incident.Config         `yaml:"incidents"`
+	Reports   report.Config           `yaml:"reports"`
+}
+
+// Load reads and validates the YAML config at path. A missing file is not an
+// error; the defaults are used instead.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+
+	if err := cfg.Collector.Validate(); err != nil {
+		return nil, fmt.Errorf("collector: %v", err)
+	}
+	if err := cfg.Store.Retention.Validate(); err != nil {
+		return nil, fmt.Errorf("store.retention: %v", err)
+	}
+	if err := cfg.Forecast.Validate(); err != nil {
+		return nil, fmt.Errorf("forecast: %v", err)
+	}
+	if err := cfg.Reports.Validate(); err != nil {
+		return nil, fmt.Errorf("reports: %v", err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,350 @@
+// Package incident assembles the context around an alert and asks the LLM
+// for its probable root causes. Explanations are stored with the alert so
+// on-call staff have a starting point.
+package incident
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/store"
+)
+
+var ErrNotFound = errors.New("explanation not found")
+
+// Config holds the incident analysis settings loaded from config.yaml
+type Config struct {
+	// Metrics are summarised over this long before and after onset, and
+	// alerts starting this close to onset are related; defaults to 15m
+	Window time.Duration `yaml:"window"`
+	// Alerts at clinics within this distance are related; defaults to 15 km
+	RadiusKm float64 `yaml:"radius_km"`
+	// Explain critical alerts automatically once Window has passed
+	Auto bool `yaml:"auto"`
+}
+
+const (
+	defaultWindow   = 15 * time.Minute
+	defaultRadiusKm = 15
+	// Emergency shares requested this long before onset are included
+	shareLookback = 6 * time.Hour
+)
+
+// Geography locates clinics and records bandwidth shared between them.
+// *kisumu.NetworkService implements it.
+type Geography interface {
+	Clinic(id string) (models.Clinic, bool)
+	CalculateDistance(p1, p2 models.GeoPoint) float64
+	TerrainFactor(p1, p2 models.GeoPoint) float64
+	EmergencyShares(clinicID string, since time.Time) []models.EmergencyShare
+}
+
+// Explainer builds incident contexts and stores the model's explanations
+type Explainer struct {
+	db       *sql.DB
+	alerts   *alerts.Manager
+	history  store.FaultedHistory
+	analyzer *analyzer.Analyzer
+	geo      Geography // May be nil, in which case only the alert's clinic is considered
+	config   Config
+}
+
+// NewExplainer creates the explanations table in db
+func NewExplainer(db *sql.DB, alertManager *alerts.Manager, history store.FaultedHistory,
+	a *analyzer.Analyzer, geo Geography, config Config) (*Explainer, error) {
+	if config.Window <= 0 {
+		config.Window = defaultWindow
+	}
+	if config.RadiusKm <= 0 {
+		config.RadiusKm = defaultRadiusKm
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS alert_explanations (
+		alert_id TEXT PRIMARY KEY,
+		generated_at INTEGER NOT NULL,
+		payload BLOB NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create explanations table: %v", err)
+	}
+
+	return &Explainer{
+		db:       db,
+		alerts:   alertManager,
+		history:  history,
+		analyzer: a,
+		geo:      geo,
+		config:   config,
+	}, nil
+}
+
+// Handle schedules an explanation for critical alerts when they fire, if
+// automatic explanations are enabled. It is meant to be passed to
+// alerts.Manager.Subscribe.
+func (x *Explainer) Handle(e alerts.Event) {
+	if !x.config.Auto || e.Type != "alert" || e.State != alerts.StateFiring ||
+		e.Alert.Severity != "critical" || e.Alert.Silenced {
+		return
+	}
+
+	// Wait until the window after onset has been collected
+	delay := time.Until(e.Alert.StartsAt.Add(x.config.Window))
+	alertID := e.Alert.ID
+	time.AfterFunc(delay, func() {
+		if _, err := x.ExplainIncident(context.Background(), alertID); err != nil {
+			log.Printf("Failed to explain alert %s: %v", alertID, err)
+		}
+	})
+}
+
+// ExplainIncident gathers an alert's context, asks the model for probable
+// root causes and stores the result, replacing any earlier explanation
+func (x *Explainer) ExplainIncident(ctx context.Context, alertID string) (analyzer.Explanation, error) {
+	ic, err := x.Gather(ctx, alertID)
+	if err != nil {
+		return analyzer.Explanation{}, err
+	}
+
+	explanation, err := x.analyzer.ExplainIncident(ctx, ic)
+	if err != nil {
+		return analyzer.Explanation{}, err
+	}
+
+	payload, err := json.Marshal(explanation)
+	if err != nil {
+		return analyzer.Explanation{}, fmt.Errorf("failed to encode explanation: %v", err)
+	}
+	_, err = x.db.ExecContext(ctx, `INSERT OR REPLACE INTO alert_explanations (alert_id, generated_at, payload)
+		VALUES (?, ?, ?)`, alertID, explanation.GeneratedAt.UnixMilli(), payload)
+	if err != nil {
+		return analyzer.Explanation{}, fmt.Errorf("failed to store explanation: %v", err)
+	}
+
+	log.Printf("🔎 Explained alert %s: %d probable causes", alertID, len(explanation.Causes))
+	return explanation, nil
+}
+
+// Explanation returns the stored explanation of an alert
+func (x *Explainer) Explanation(ctx context.Context, alertID string) (analyzer.Explanation, error) {
+	var payload []byte
+	err := x.db.QueryRowContext(ctx, `SELECT payload FROM alert_explanations WHERE alert_id = ?`, alertID).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return analyzer.Explanation{}, ErrNotFound
+	}
+	if err != nil {
+		return analyzer.Explanation{}, fmt.Errorf("failed to load explanation: %v", err)
+	}
+
+	var explanation analyzer.Explanation
+	if err := json.Unmarshal(payload, &explanation); err != nil {
+		return analyzer.Explanation{}, fmt.Errorf("failed to decode explanation: %v", err)
+	}
+	explanation.Context.Window = x.config.Window
+	return explanation, nil
+}
+
+// Gather assembles the context of an alert: the metric windows around
+// onset, related alerts, terrain, emergency shares and maintenance windows
+func (x *Explainer) Gather(ctx context.Context, alertID string) (analyzer.IncidentContext, error) {
+	a, err := x.alerts.Get(ctx, alertID)
+	if err != nil {
+		return analyzer.IncidentContext{}, err
+	}
+
+	onset := a.StartsAt
+	from, to := onset.Add(-x.config.Window), onset.Add(x.config.Window)
+	ic := analyzer.IncidentContext{
+		AlertID:  a.ID,
+		State:    a.State,
+		StartsAt: onset,
+		Alert:    a.Alert,
+		Window:   x.config.Window,
+	}
+
+	samples, err := x.history.Range(ctx, a.ClinicID, from, to)
+	if err != nil {
+		return analyzer.IncidentContext{}, fmt.Errorf("failed to load metrics: %v", err)
+	}
+	// Alerts raised during a drill are explained from the samples the
+	// faults distorted, which the history leaves out
+	faulted, err := x.history.FaultedRange(ctx, a.ClinicID, from, to)
+	if err != nil {
+		return analyzer.IncidentContext{}, fmt.Errorf("failed to load fault-injected samples: %v", err)
+	}
+	samples = append(samples, faulted...)
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp.Before(samples[j].Timestamp) })
+	var before, after []models.Metrics
+	for _, m := range samples {
+		if m.Timestamp.Before(onset) {
+			before = append(before, m)
+		} else {
+			after = append(after, m)
+		}
+	}
+	ic.Before = windowStats(before)
+	ic.After = windowStats(after)
+	ic.InjectedFaults = injectedFaults(samples)
+
+	location, located := x.locate(a.ClinicID, samples)
+	ic.TerrainFactor = terrainFactor(samples)
+
+	related, err := x.related(ctx, a, from, to, location, located)
+	if err != nil {
+		return analyzer.IncidentContext{}, err
+	}
+	ic.Related = related
+
+	ic.EmergencyShares = []models.EmergencyShare{}
+	if x.geo != nil {
+		if shares := x.geo.EmergencyShares(a.ClinicID, onset.Add(-shareLookback)); shares != nil {
+			ic.EmergencyShares = shares
+		}
+	}
+
+	silences, err := x.alerts.SilencesDuring(ctx, a.ClinicID, from, to)
+	if err != nil {
+		return analyzer.IncidentContext{}, err
+	}
+	ic.Maintenance = []analyzer.MaintenanceWindow{}
+	for _, s := range silences {
+		ic.Maintenance = append(ic.Maintenance, analyzer.MaintenanceWindow{
+			ID:         s.ID,
+			Metric:     s.Metric,
+			Reason:     s.Reason,
+			StartsAt:   s.StartsAt,
+			EndsAt:     s.EndsAt,
+			Recurrence: s.Recurrence,
+			Cancelled:  s.CancelledAt != nil,
+		})
+	}
+	return ic, nil
+}
+
+// locate returns a clinic's coordinates from the clinic directory, or
+// failing that from its samples
+func (x *Explainer) locate(clinicID string, samples []models.Metrics) (models.GeoPoint, bool) {
+	if x.geo != nil {
+		if clinic, ok := x.geo.Clinic(clinicID); ok {
+			return clinic.Coordinates, true
+		}
+	}
+	for i := len(samples) - 1; i >= 0; i-- {
+		if p := samples[i].Coordinates; p.Latitude != 0 || p.Longitude != 0 {
+			return p, true
+		}
+	}
+	return models.GeoPoint{}, false
+}
+
+// related returns the other alerts that started in [from, to) at the same
+// clinic or one within the configured radius, nearest first
+func (x *Explainer) related(ctx context.Context, a alerts.Alert, from, to time.Time,
+	location models.GeoPoint, located bool) ([]analyzer.RelatedAlert, error) {
+	candidates, err := x.alerts.List(ctx, alerts.Filter{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	list := []analyzer.RelatedAlert{}
+	for _, other := range candidates {
+		if other.ID == a.ID {
+			continue
+		}
+		r := analyzer.RelatedAlert{
+			AlertID:     other.ID,
+			ClinicID:    other.ClinicID,
+			Severity:    other.Severity,
+			Metric:      other.Metric,
+			Description: other.Description,
+			State:       other.State,
+			StartsAt:    other.StartsAt,
+		}
+		if other.ClinicID != a.ClinicID {
+			// Other clinics are only related when both can be located
+			if !located || x.geo == nil {
+				continue
+			}
+			clinic, ok := x.geo.Clinic(other.ClinicID)
+			if !ok {
+				continue
+			}
+			r.DistanceKm = x.geo.CalculateDistance(location, clinic.Coordinates)
+			if r.DistanceKm > x.config.RadiusKm {
+				continue
+			}
+			r.DistanceKm = math.Round(r.DistanceKm*10) / 10
+			r.TerrainFactor = x.geo.TerrainFactor(location, clinic.Coordinates)
+		}
+		list = append(list, r)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].DistanceKm < list[j].DistanceKm })
+	return list, nil
+}
+
+// windowStats summarises every available metric over a window
+func windowStats(samples []models.Metrics) map[string]analyzer.WindowStats {
+	stats := make(map[string]analyzer.WindowStats)
+	for _, name := range models.MetricNames {
+		var s analyzer.WindowStats
+		for _, m := range samples {
+			v, ok := m.Value(name)
+			if !ok {
+				continue
+			}
+			if s.Samples == 0 || v < s.Min {
+				s.Min = v
+			}
+			if s.Samples == 0 || v > s.Max {
+				s.Max = v
+			}
+			s.Avg += v
+			s.Samples++
+		}
+		if s.Samples > 0 {
+			s.Avg /= float64(s.Samples)
+			stats[name] = s
+		}
+	}
+	return stats
+}
+
+// injectedFaults lists the fault types that distorted any sample
+func injectedFaults(samples []models.Metrics) []string {
+	seen := make(map[string]bool)
+	var list []string
+	for _, m := range samples {
+		for _, f := range m.Faults {
+			if !seen[f] {
+				seen[f] = true
+				list = append(list, f)
+			}
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// terrainFactor averages the terrain factor reported with the samples
+func terrainFactor(samples []models.Metrics) float64 {
+	var sum, count float64
+	for _, m := range samples {
+		if m.TerrainFactor > 0 {
+			sum += m.TerrainFactor
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / count
+}
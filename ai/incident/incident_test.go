@@ -0,0 +1,191 @@
+package incident
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// fakeHistory serves samples from memory, keeping fault-injected samples
+// apart like the store does
+type fakeHistory []models.Metrics
+
+func (h fakeHistory) Recent(ctx context.Context, clinicID string, limit int) ([]models.Metrics, error) {
+	return nil, nil
+}
+
+func (h fakeHistory) Range(ctx context.Context, clinicID string, from, to time.Time) ([]models.Metrics, error) {
+	return h.between(clinicID, from, to, false), nil
+}
+
+func (h fakeHistory) FaultedRange(ctx context.Context, clinicID string, from, to time.Time) ([]models.Metrics, error) {
+	return h.between(clinicID, from, to, true), nil
+}
+
+func (h fakeHistory) between(clinicID string, from, to time.Time, faulted bool) []models.Metrics {
+	var list []models.Metrics
+	for _, m := range h {
+		if m.ClinicID == clinicID && !m.Timestamp.Before(from) && m.Timestamp.Before(to) && (len(m.Faults) > 0) == faulted {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// fakeGeography places clinics on a line one kilometre per unit of longitude
+type fakeGeography struct {
+	clinics map[string]models.Clinic
+	shares  []models.EmergencyShare
+}
+
+func (g fakeGeography) Clinic(id string) (models.Clinic, bool) {
+	c, ok := g.clinics[id]
+	return c, ok
+}
+
+func (g fakeGeography) CalculateDistance(p1, p2 models.GeoPoint) float64 {
+	d := p1.Longitude - p2.Longitude
+	if d < 0 {
+		d = -d
+	}
+	return d
+}
+
+func (g fakeGeography) TerrainFactor(p1, p2 models.GeoPoint) float64 {
+	return 0.8
+}
+
+func (g fakeGeography) EmergencyShares(clinicID string, since time.Time) []models.EmergencyShare {
+	return g.shares
+}
+
+func clinicAt(id string, km float64) models.Clinic {
+	return models.Clinic{ID: id, Coordinates: models.GeoPoint{Longitude: km}}
+}
+
+func newTestExplainer(t *testing.T, llm analyzer.LLMClient, history fakeHistory, geo Geography) (*Explainer, *alerts.Manager) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "incident.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	am, err := alerts.NewManager(db, alerts.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := NewExplainer(db, am, history, analyzer.NewAnalyzer(llm, 0.8, 0), geo, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x, am
+}
+
+func TestGather(t *testing.T) {
+	ctx := context.Background()
+	onset := time.Now().Add(-20 * time.Minute).Truncate(time.Second)
+
+	var history fakeHistory
+	for i := -10; i < 10; i++ {
+		m := models.Metrics{ClinicID: "jootrh", Timestamp: onset.Add(time.Duration(i) * time.Minute), Latency: 40, TerrainFactor: 0.9}
+		if i >= 0 {
+			m.Latency, m.Faults = 400, []string{"latency"}
+		}
+		history = append(history, m)
+	}
+	geo := fakeGeography{
+		clinics: map[string]models.Clinic{
+			"jootrh":  clinicAt("jootrh", 0),
+			"kombewa": clinicAt("kombewa", 12),
+			"ahero":   clinicAt("ahero", 25),
+		},
+		shares: []models.EmergencyShare{{SourceID: "kombewa", TargetID: "jootrh", CanShare: true}},
+	}
+	x, am := newTestExplainer(t, &analyzer.FakeLLM{}, history, geo)
+
+	latency := models.Alert{Severity: "critical", Detector: "cusum", Metric: "latency", Description: "latency shift"}
+	for clinic, alert := range map[string]models.Alert{
+		"jootrh":  latency,
+		"kombewa": {Severity: "warning", Detector: "cusum", Metric: "packet_loss"},
+		"ahero":   {Severity: "warning", Detector: "cusum", Metric: "packet_loss"},
+		"siaya":   {Severity: "warning", Detector: "cusum", Metric: "packet_loss"},
+	} {
+		if err := am.Sync(ctx, clinic, nil, []models.Alert{alert}, onset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := am.CreateSilence(ctx, alerts.Silence{
+		ClinicID: "jootrh", StartsAt: onset.Add(-time.Hour), EndsAt: onset.Add(-5 * time.Minute), Reason: "ISP fibre splicing",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	open, _ := am.List(ctx, alerts.Filter{ClinicID: "jootrh"})
+	ic, err := x.Gather(ctx, open[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ic.Before["latency"].Avg != 40 || ic.After["latency"].Max != 400 || ic.Before["latency"].Samples != 10 {
+		t.Errorf("Unexpected windows: before %+v, after %+v", ic.Before["latency"], ic.After["latency"])
+	}
+	if len(ic.InjectedFaults) != 1 || ic.TerrainFactor != 0.9 {
+		t.Errorf("Unexpected faults %v or terrain factor %v", ic.InjectedFaults, ic.TerrainFactor)
+	}
+	// Ahero is too far away and siaya cannot be located
+	if len(ic.Related) != 1 || ic.Related[0].ClinicID != "kombewa" || ic.Related[0].DistanceKm != 12 || ic.Related[0].TerrainFactor != 0.8 {
+		t.Errorf("Unexpected related alerts %+v", ic.Related)
+	}
+	if len(ic.EmergencyShares) != 1 || len(ic.Maintenance) != 1 || ic.Maintenance[0].Reason != "ISP fibre splicing" {
+		t.Errorf("Unexpected shares %+v or maintenance %+v", ic.EmergencyShares, ic.Maintenance)
+	}
+
+	if _, err := x.Gather(ctx, "missing"); !errors.Is(err, alerts.ErrNotFound) {
+		t.Errorf("Expected alerts.ErrNotFound, got %v", err)
+	}
+}
+
+func TestExplainIncidentStoresResult(t *testing.T) {
+	ctx := context.Background()
+	llm := &analyzer.FakeLLM{Reply: func(analyzer.LLMRequest) (string, error) {
+		return `{"summary": "Uplink congestion", "causes": [
+			{"cause": "ISP outage", "confidence": 0.3, "evidence": ["packet loss at kombewa"], "next_steps": ["Call the ISP"]},
+			{"cause": "Uplink saturated", "confidence": 0.6, "evidence": ["bandwidth at 900 MB/s"], "next_steps": ["Check top talkers"]}
+		]}`, nil
+	}}
+	x, am := newTestExplainer(t, llm, nil, nil)
+
+	am.Sync(ctx, "jootrh", nil, []models.Alert{{Severity: "critical", Rule: "uplink-down", Description: "uplink down"}}, time.Now())
+	open, _ := am.List(ctx, alerts.Filter{})
+	alertID := open[0].ID
+
+	if _, err := x.Explanation(ctx, alertID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound before explaining, got %v", err)
+	}
+	explanation, err := x.ExplainIncident(ctx, alertID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Causes[0].Cause != "Uplink saturated" || explanation.AlertID != alertID {
+		t.Errorf("Expected causes ranked by confidence, got %+v", explanation)
+	}
+	if !strings.Contains(llm.Requests()[0].Prompt, `"rule": "uplink-down"`) {
+		t.Errorf("Prompt does not include the alert:\n%s", llm.Requests()[0].Prompt)
+	}
+
+	stored, err := x.Explanation(ctx, alertID)
+	if err != nil || stored.Summary != "Uplink congestion" || len(stored.Causes) != 2 || stored.Context.AlertID != alertID {
+		t.Errorf("Unexpected stored explanation %+v (%v)", stored, err)
+	}
+}
@@ -2,20 +2,35 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/Evarest-ke/healthnetai/alerts"
 	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/assistant"
 	"github.com/Evarest-ke/healthnetai/backend/database"
 	"github.com/Evarest-ke/healthnetai/backend/handlers"
+	"github.com/Evarest-ke/healthnetai/backend/middleware"
 	"github.com/Evarest-ke/healthnetai/collector"
+	"github.com/Evarest-ke/healthnetai/collector/faults"
+	"github.com/Evarest-ke/healthnetai/config"
+	"github.com/Evarest-ke/healthnetai/incident"
 	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/notify"
+	"github.com/Evarest-ke/healthnetai/oncall"
+	"github.com/Evarest-ke/healthnetai/report"
+	"github.com/Evarest-ke/healthnetai/rules"
 	"github.com/Evarest-ke/healthnetai/services/kisumu"
 	"github.com/Evarest-ke/healthnetai/services/websocket"
+	"github.com/Evarest-ke/healthnetai/store"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	ws "github.com/gorilla/websocket"
@@ -35,29 +50,130 @@ func main() {
 	// }
 	// log.Println("Migration completed successfully")
 
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("GEMINI_API_KEY environment variable not set")
-	}
-
 	// Get HealthSites.io API key from environment (optional when using mock data)
 	healthsitesKey := os.Getenv("HEALTHSITES_API_KEY")
 
+	cfg, err := config.Load("config.yaml")
+	if err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+
+	// Language model used by the analyzers. Without one, analysis falls back
+	// to the local thresholds.
+	// Every call is rate-limited, deduplicated and metered.
+	llmClient, err := analyzer.NewLLMClient(cfg.LLM)
+	var meteredLLM *analyzer.MeteredClient
+	if err != nil {
+		log.Printf("⚠️ LLM unavailable, using rule-based analysis only: %v", err)
+	} else {
+		meteredLLM = analyzer.NewMeteredClient(llmClient, cfg.LLM)
+		llmClient = meteredLLM
+	}
+
+	// Open the metrics history shared by the collector, analyzer and predictor
+	metricsStore, err := store.Open(cfg.Store)
+	if err != nil {
+		log.Fatal("Failed to open metrics store:", err)
+	}
+	defer metricsStore.Close()
+
 	// Initialize components
-	networkCollector := collector.NewCollector(6 * time.Second)
-	networkAnalyzer, err := analyzer.NewAnalyzer(apiKey, 0.8)
+	networkCollector := collector.NewCollector(6*time.Second, cfg.Collector, metricsStore)
+	clinicID := networkCollector.ClinicID()
+	// Prompt templates in the configured locale, and the thresholds they state
+	prompts, err := analyzer.LoadPrompts(cfg.Prompts)
+	if err != nil {
+		log.Fatal("Failed to load prompts:", err)
+	}
+	networkAnalyzer := analyzer.NewAnalyzer(llmClient, 0.8, cfg.LLM.Timeout)
+	networkAnalyzer.EnableCache(cfg.LLM.Cache)
+	networkAnalyzer.UsePrompts(prompts)
+	networkStatsAnalyzer := analyzer.NewNetworkStatsAnalyzer(llmClient, cfg.Stats)
+	networkStatsAnalyzer.EnableCache(cfg.LLM.Cache)
+	networkStatsAnalyzer.UsePrompts(prompts)
+	predictor := analyzer.NewPredictor(metricsStore, cfg.Forecast)
+
+	// Load alert rules and pick up edits to config.yaml without a restart
+	ruleEngine, err := rules.NewEngine("config.yaml")
+	if err != nil {
+		log.Fatal("Failed to load alert rules:", err)
+	}
+	go ruleEngine.Watch(context.Background(), 5*time.Second)
+
+	// Track alert state alongside the metrics history
+	alertManager, err := alerts.NewManager(metricsStore.DB(), cfg.Alerts)
+	if err != nil {
+		log.Fatal("Failed to initialize alert manager:", err)
+	}
+
+	// Notify on-duty staff of alert changes over the configured channels
+	dispatcher, err := notify.NewDispatcher(cfg.Notify, metricsStore.DB())
 	if err != nil {
-		log.Fatal("Failed to initialize analyzer:", err)
+		log.Fatal("Failed to initialize notifications:", err)
+	}
+	dispatcher.Start(context.Background(), 2)
+	alertManager.Subscribe(dispatcher.Handle)
+
+	// Escalate firing alerts that nobody acknowledges
+	onCall, err := oncall.NewManager(metricsStore.DB(), alertManager, dispatcher)
+	if err != nil {
+		log.Fatal("Failed to initialize on-call schedules:", err)
+	}
+	alertManager.Subscribe(onCall.Handle)
+	go onCall.Run(context.Background(), 30*time.Second)
+
+	// recentMetrics returns the last hour of samples for this host's clinic
+	recentMetrics := func(c *gin.Context) ([]models.Metrics, error) {
+		now := time.Now()
+		return metricsStore.Range(c.Request.Context(), clinicID, now.Add(-time.Hour), now.Add(time.Second))
 	}
-	predictor := analyzer.NewPredictor(10)
 
 	// Initialize Kisumu network service
 	kisumuNetwork := kisumu.NewNetworkService(healthsitesKey)
 
+	// Observe the clinics' network status on a schedule, keeping both
+	// windows of the dashboard statistics
+	if err := kisumuNetwork.TrackStatuses(metricsStore.DB(), 2*networkStatsAnalyzer.Window()); err != nil {
+		log.Fatal("Failed to initialize clinic status history:", err)
+	}
+	go kisumuNetwork.ObserveStatuses(context.Background())
+
+	// Explain incidents from the metrics, nearby alerts and maintenance around them
+	explainer, err := incident.NewExplainer(metricsStore.DB(), alertManager, metricsStore,
+		networkAnalyzer, kisumuNetwork, cfg.Incidents)
+	if err != nil {
+		log.Fatal("Failed to initialize incident analysis:", err)
+	}
+	alertManager.Subscribe(explainer.Handle)
+
+	// Answer natural-language questions with read-only tools over the API's data
+	networkAssistant := assistant.New(llmClient, metricsStore, alertManager, kisumuNetwork)
+
+	// Build and send the scheduled network health digests
+	reports, err := report.NewGenerator(metricsStore.DB(), metricsStore, alertManager, networkAnalyzer,
+		kisumuNetwork, dispatcher, cfg.Reports)
+	if err != nil {
+		log.Fatal("Failed to initialize reports:", err)
+	}
+	go reports.Run(context.Background(), time.Minute)
+
 	// Initialize WebSocket hub
 	wsHub := websocket.NewHub()
 	go wsHub.Run()
 
+	// Log and broadcast every alert state change
+	alertManager.Subscribe(func(event alerts.Event) {
+		a := event.Alert
+		silenced := ""
+		if a.Silenced {
+			silenced = " (silenced)"
+		}
+		log.Printf("🚨 Alert %s %s%s: %s: %s\n  ↳ %s", a.ID, event.State, silenced, a.Severity, a.Description, a.Recommended)
+		if data, err := json.Marshal(event); err == nil {
+			wsHub.Broadcast(data)
+		}
+	})
+
 	// WebSocket upgrader
 	upgrader := ws.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
@@ -99,7 +215,6 @@ func main() {
 
 	// Start metrics collection
 	metricsChan := networkCollector.Start()
-	var metrics []models.Metrics
 
 	// Initialize database
 	database.InitDB("./backend/database/healthnet.db")
@@ -117,8 +232,13 @@ func main() {
 	{
 		network := api.Group("/network")
 		{
-			// Get current metrics
+			// Get current metrics, including the per-interface breakdown
 			network.GET("/metrics", func(c *gin.Context) {
+				if latest, ok := networkCollector.Latest(); ok {
+					c.JSON(http.StatusOK, latest)
+					return
+				}
+
 				sysMetrics, err := networkCollector.SystemMetrics()
 				if err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -127,42 +247,122 @@ func main() {
 				c.JSON(http.StatusOK, sysMetrics)
 			})
 
+			// Get link quality: jitter, packet loss and rolling uptime
+			network.GET("/quality", func(c *gin.Context) {
+				latest, ok := networkCollector.Latest()
+				if !ok {
+					c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no samples collected yet"})
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{
+					"network": latest.Network,
+					"probes":  latest.Probes,
+				})
+			})
+
+			// Get aggregated metric history
+			network.GET("/metrics/history", func(c *gin.Context) {
+				q, err := parseHistoryQuery(c, clinicID)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				points, err := metricsStore.Query(c.Request.Context(), q)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"clinic_id":   q.ClinicID,
+					"metric":      q.Metric,
+					"aggregation": q.Aggregation,
+					"step":        q.Step.String(),
+					"resolution":  metricsStore.Resolution(q, time.Now()).String(),
+					"points":      points,
+				})
+			})
+
 			// Get alerts
 			network.GET("/alerts", func(c *gin.Context) {
-				if len(metrics) > 0 {
-					alerts := networkCollector.Baseline.DetectAnomalies(metrics[len(metrics)-1])
-					c.JSON(http.StatusOK, alerts)
-				} else {
-					c.JSON(http.StatusOK, []models.Alert{})
+				open, err := alertManager.List(c.Request.Context(), alerts.Filter{
+					ClinicID: c.DefaultQuery("clinic", clinicID),
+					States:   alerts.OpenStates,
+				})
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
 				}
+				c.JSON(http.StatusOK, gin.H{
+					"alerts":   open,
+					"silences": alertManager.Silences(time.Now(), true),
+				})
 			})
 
-			// Get predictions
+			// Forecasts with prediction intervals for a clinic, at one
+			// horizon or every configured one
 			network.GET("/predictions", func(c *gin.Context) {
-				predictions, err := predictor.PredictNextHour()
-				if err != nil {
+				horizons := predictor.Horizons()
+				if h := c.Query("horizon"); h != "" {
+					horizon, err := time.ParseDuration(h)
+					if err != nil || horizon <= 0 {
+						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid horizon %q", h)})
+						return
+					}
+					horizons = []time.Duration{horizon}
+				}
+
+				predictions, err := predictor.Forecast(c.Request.Context(), c.DefaultQuery("clinic", clinicID), time.Now(), horizons)
+				switch {
+				case errors.Is(err, analyzer.ErrInsufficientHistory):
+					c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				case err != nil:
 					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-					return
+				default:
+					c.JSON(http.StatusOK, predictions)
 				}
-				c.JSON(http.StatusOK, predictions)
 			})
 
 			// Get analysis
 			network.GET("/analysis", func(c *gin.Context) {
+				metrics, err := recentMetrics(c)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+
 				if len(metrics) >= 10 {
-					analysis, err := networkAnalyzer.AnalyzeMetrics(metrics)
+					analysis, err := networkAnalyzer.AnalyzeCached(c.Request.Context(), metrics)
 					if err != nil {
 						c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 						return
 					}
+					// Flag findings covered by a maintenance window for this clinic
+					now := time.Now()
+					for i := range analysis.Alerts {
+						analysis.Alerts[i].ClinicID = clinicID
+						analysis.Alerts[i].Silenced = len(alertManager.SilencedBy(analysis.Alerts[i], now)) > 0
+					}
 					c.JSON(http.StatusOK, analysis)
 				} else {
-					c.JSON(http.StatusOK, []models.Alert{})
+					c.JSON(http.StatusOK, analyzer.Analysis{Source: analyzer.SourceRules, Alerts: []models.Alert{}})
 				}
 			})
 
+			// Counts of usable, repaired and failed model responses
+			network.GET("/analysis/stats", func(c *gin.Context) {
+				c.JSON(http.StatusOK, networkAnalyzer.ParseStats())
+			})
+
 			// Get averages
 			network.GET("/averages", func(c *gin.Context) {
+				metrics, err := recentMetrics(c)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+
 				if len(metrics) > 0 {
 					averages := networkCollector.CalculateAverages(metrics)
 					c.JSON(http.StatusOK, averages)
@@ -177,26 +377,61 @@ func main() {
 				}
 			})
 
-			// Initialize network stats analyzer
-			networkStatsAnalyzer, err := analyzer.NewNetworkStatsAnalyzer(apiKey)
-			if err != nil {
-				log.Fatal("Failed to initialize network stats analyzer:", err)
+			// Dashboard statistics computed from the status history, shares
+			// and stored metrics
+			networkStats := func(c *gin.Context, commentary bool) (analyzer.NetworkStats, error) {
+				clinics, err := kisumuNetwork.GetClinics()
+				if err != nil {
+					return analyzer.NetworkStats{}, err
+				}
+
+				// Both the current and the previous window
+				now := time.Now()
+				since := now.Add(-2 * networkStatsAnalyzer.Window())
+				ids, err := metricsStore.ClinicIDs(c.Request.Context())
+				if err != nil {
+					return analyzer.NetworkStats{}, err
+				}
+				statuses, err := kisumuNetwork.StatusHistory(c.Request.Context(), since)
+				if err != nil {
+					return analyzer.NetworkStats{}, err
+				}
+				var metrics []models.Metrics
+				for _, id := range ids {
+					samples, err := metricsStore.Range(c.Request.Context(), id, since, now)
+					if err != nil {
+						return analyzer.NetworkStats{}, err
+					}
+					metrics = append(metrics, samples...)
+				}
+
+				return networkStatsAnalyzer.AnalyzeNetworkStats(c.Request.Context(), analyzer.StatsInput{
+					Now:        now,
+					Clinics:    clinics,
+					Statuses:   statuses,
+					Shares:     kisumuNetwork.EmergencyShares("", since),
+					Metrics:    metrics,
+					Commentary: commentary,
+				})
 			}
 
-			// Update the stats endpoint
+			// Dashboard tiles, each compared with the previous window
 			network.GET("/stats", func(c *gin.Context) {
-				clinics, err := kisumuNetwork.GetClinics()
+				stats, err := networkStats(c, false)
 				if err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 					return
 				}
+				c.JSON(http.StatusOK, stats.Stats)
+			})
 
-				stats, err := networkStatsAnalyzer.AnalyzeNetworkStats(metrics, clinics)
+			// The same statistics with the LLM's commentary on them
+			network.GET("/stats/commentary", func(c *gin.Context) {
+				stats, err := networkStats(c, true)
 				if err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 					return
 				}
-
 				c.JSON(http.StatusOK, stats)
 			})
 
@@ -236,16 +471,8 @@ func main() {
 						return
 					}
 
-					canShare, bandwidth := kisumuNetwork.CheckEmergencyBandwidthSharing(
-						req.SourceID,
-						req.TargetID,
-					)
-
-					c.JSON(http.StatusOK, gin.H{
-						"can_share":        canShare,
-						"bandwidth_factor": bandwidth,
-						"timestamp":        time.Now(),
-					})
+					share := kisumuNetwork.RequestEmergencyShare(req.SourceID, req.TargetID)
+					c.JSON(http.StatusOK, share)
 				})
 
 				// WebSocket endpoint for real-time metrics
@@ -268,32 +495,404 @@ func main() {
 				})
 			}
 		}
+
+		// Ask a question about the network in plain language
+		api.POST("/assistant/query", middleware.AuthRequired(), func(c *gin.Context) {
+			var req struct {
+				Question string `json:"question"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			answer, err := networkAssistant.Query(c.Request.Context(), req.Question)
+			switch {
+			case errors.Is(err, assistant.ErrInvalidQuestion):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, analyzer.ErrNoLLM):
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			case err != nil:
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusOK, answer)
+			}
+		})
+
+		// Calls made to the model, their tokens and cost, and how the
+		// cached analyses were served
+		api.GET("/admin/llm/usage", middleware.AuthRequired(), func(c *gin.Context) {
+			if meteredLLM == nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": analyzer.ErrNoLLM.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"usage": meteredLLM.Usage(),
+				"cache": gin.H{
+					"analysis":   networkAnalyzer.CacheStats(),
+					"commentary": networkStatsAnalyzer.CacheStats(),
+				},
+			})
+		})
+
+		reportsGroup := api.Group("/reports")
+		{
+			// Newest reports first, without their rendered forms
+			reportsGroup.GET("", func(c *gin.Context) {
+				limit := 20
+				if v := c.Query("limit"); v != "" {
+					var err error
+					if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+						return
+					}
+				}
+				list, err := reports.List(c.Request.Context(), limit)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, list)
+			})
+
+			// One report as JSON, or rendered with ?format=html or markdown
+			reportsGroup.GET("/:id", func(c *gin.Context) {
+				r, err := reports.Get(c.Request.Context(), c.Param("id"))
+				if errors.Is(err, report.ErrNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				switch format := c.Query("format"); format {
+				case "", "json":
+					c.JSON(http.StatusOK, r)
+				case "html":
+					c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(r.HTML))
+				case "markdown", "md":
+					c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(r.Markdown))
+				default:
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown format %q", format)})
+				}
+			})
+		}
+
+		silences := api.Group("/silences")
+		{
+			// List silences that have not expired; ?active=true for those in effect now
+			silences.GET("", func(c *gin.Context) {
+				c.JSON(http.StatusOK, alertManager.Silences(time.Now(), c.Query("active") == "true"))
+			})
+
+			// Create a silence or maintenance window
+			silences.POST("", middleware.AuthRequired(), func(c *gin.Context) {
+				var silence alerts.Silence
+				if err := c.ShouldBindJSON(&silence); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				silence.CreatedBy = currentUser(c)
+
+				created, err := alertManager.CreateSilence(c.Request.Context(), silence)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusCreated, created)
+			})
+
+			// End a silence early
+			silences.DELETE("/:id", middleware.AuthRequired(), func(c *gin.Context) {
+				cancelled, err := alertManager.CancelSilence(c.Request.Context(), c.Param("id"))
+				if errors.Is(err, alerts.ErrSilenceNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, cancelled)
+			})
+		}
+
+		faultsGroup := api.Group("/faults")
+		{
+			// List injected faults that have not ended; ?active=true for those running now
+			faultsGroup.GET("", func(c *gin.Context) {
+				c.JSON(http.StatusOK, networkCollector.Faults.List(time.Now(), c.Query("active") == "true"))
+			})
+
+			// Inject a time-boxed fault into the collected samples
+			faultsGroup.POST("", middleware.AuthRequired(), func(c *gin.Context) {
+				var spec faults.Spec
+				if err := c.ShouldBindJSON(&spec); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				fault, err := networkCollector.Faults.Add(spec, currentUser(c), time.Now())
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				log.Printf("Injecting %s fault %s for clinics %q until %s (user %s)",
+					fault.Type, fault.ID, fault.ClinicID, fault.EndsAt.Format(time.RFC3339), fault.CreatedBy)
+				c.JSON(http.StatusCreated, fault)
+			})
+
+			// End a fault early
+			faultsGroup.DELETE("/:id", middleware.AuthRequired(), func(c *gin.Context) {
+				fault, err := networkCollector.Faults.Cancel(c.Param("id"))
+				if errors.Is(err, faults.ErrNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				log.Printf("Cancelled %s fault %s", fault.Type, fault.ID)
+				c.JSON(http.StatusOK, fault)
+			})
+		}
+
+		oncallGroup := api.Group("/oncall")
+		{
+			// Who is on call now, optionally for one clinic (?clinic=jootrh)
+			oncallGroup.GET("", func(c *gin.Context) {
+				c.JSON(http.StatusOK, onCall.OnCall(c.Query("clinic"), time.Now()))
+			})
+
+			oncallGroup.GET("/rotations", func(c *gin.Context) {
+				c.JSON(http.StatusOK, onCall.Rotations())
+			})
+
+			oncallGroup.POST("/rotations", middleware.AuthRequired(), func(c *gin.Context) {
+				var rotation oncall.Rotation
+				if err := c.ShouldBindJSON(&rotation); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				rotation.CreatedBy = currentUser(c)
+
+				created, err := onCall.CreateRotation(c.Request.Context(), rotation)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusCreated, created)
+			})
+
+			oncallGroup.DELETE("/rotations/:id", middleware.AuthRequired(), func(c *gin.Context) {
+				if err := onCall.DeleteRotation(c.Request.Context(), c.Param("id")); err != nil {
+					respondOnCallError(c, err)
+					return
+				}
+				c.Status(http.StatusNoContent)
+			})
+
+			// Overrides hand a rotation to someone else for a window
+			oncallGroup.GET("/rotations/:id/overrides", func(c *gin.Context) {
+				c.JSON(http.StatusOK, onCall.Overrides(c.Param("id"), time.Now()))
+			})
+
+			oncallGroup.POST("/rotations/:id/overrides", middleware.AuthRequired(), func(c *gin.Context) {
+				var override oncall.Override
+				if err := c.ShouldBindJSON(&override); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				override.RotationID = c.Param("id")
+				override.CreatedBy = currentUser(c)
+
+				created, err := onCall.CreateOverride(c.Request.Context(), override)
+				if errors.Is(err, oncall.ErrNotFound) {
+					respondOnCallError(c, err)
+					return
+				}
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusCreated, created)
+			})
+
+			oncallGroup.DELETE("/overrides/:id", middleware.AuthRequired(), func(c *gin.Context) {
+				if err := onCall.DeleteOverride(c.Request.Context(), c.Param("id")); err != nil {
+					respondOnCallError(c, err)
+					return
+				}
+				c.Status(http.StatusNoContent)
+			})
+
+			// Escalation policies, matched oldest first against firing alerts
+			oncallGroup.GET("/policies", func(c *gin.Context) {
+				c.JSON(http.StatusOK, onCall.Policies())
+			})
+
+			oncallGroup.POST("/policies", middleware.AuthRequired(), func(c *gin.Context) {
+				var policy oncall.Policy
+				if err := c.ShouldBindJSON(&policy); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				policy.CreatedBy = currentUser(c)
+
+				created, err := onCall.CreatePolicy(c.Request.Context(), policy)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusCreated, created)
+			})
+
+			oncallGroup.DELETE("/policies/:id", middleware.AuthRequired(), func(c *gin.Context) {
+				if err := onCall.DeletePolicy(c.Request.Context(), c.Param("id")); err != nil {
+					respondOnCallError(c, err)
+					return
+				}
+				c.Status(http.StatusNoContent)
+			})
+		}
+
+		alertsGroup := api.Group("/alerts")
+		{
+			// Get the loaded alert rules and the outcome of the last reload
+			alertsGroup.GET("/rules", func(c *gin.Context) {
+				c.JSON(http.StatusOK, ruleEngine.Status())
+			})
+
+			// List alerts; state is open (default), all or a single state
+			alertsGroup.GET("", func(c *gin.Context) {
+				filter := alerts.Filter{ClinicID: c.Query("clinic"), States: alerts.OpenStates, Limit: 100}
+				switch state := c.DefaultQuery("state", "open"); state {
+				case "open":
+				case "all":
+					filter.States = nil
+				case alerts.StatePending, alerts.StateFiring, alerts.StateAcknowledged, alerts.StateResolved:
+					filter.States = []string{state}
+				default:
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown state %q", state)})
+					return
+				}
+				if v := c.Query("limit"); v != "" {
+					limit, err := strconv.Atoi(v)
+					if err != nil || limit <= 0 {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+						return
+					}
+					filter.Limit = limit
+				}
+
+				list, err := alertManager.List(c.Request.Context(), filter)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, list)
+			})
+
+			// Get one alert with its state history
+			alertsGroup.GET("/:id", func(c *gin.Context) {
+				alert, err := alertManager.Get(c.Request.Context(), c.Param("id"))
+				if err != nil {
+					respondAlertError(c, err)
+					return
+				}
+				history, err := alertManager.History(c.Request.Context(), alert.ID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{"alert": alert, "history": history})
+			})
+
+			// Escalation progress for one alert
+			alertsGroup.GET("/:id/escalation", func(c *gin.Context) {
+				escalation, err := onCall.Escalation(c.Request.Context(), c.Param("id"))
+				if err != nil {
+					respondOnCallError(c, err)
+					return
+				}
+				c.JSON(http.StatusOK, escalation)
+			})
+
+			// Stored root-cause analysis for one alert
+			alertsGroup.GET("/:id/explanation", func(c *gin.Context) {
+				explanation, err := explainer.Explanation(c.Request.Context(), c.Param("id"))
+				if errors.Is(err, incident.ErrNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, explanation)
+			})
+
+			// Ask the LLM for the probable root causes of an alert
+			alertsGroup.POST("/:id/explain", middleware.AuthRequired(), func(c *gin.Context) {
+				explanation, err := explainer.ExplainIncident(c.Request.Context(), c.Param("id"))
+				var parseErr *analyzer.ParseError
+				switch {
+				case errors.Is(err, alerts.ErrNotFound):
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				case errors.Is(err, analyzer.ErrNoLLM):
+					c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				case errors.As(err, &parseErr):
+					c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				case err != nil:
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				default:
+					c.JSON(http.StatusOK, explanation)
+				}
+			})
+
+			// Notification delivery log for one alert
+			alertsGroup.GET("/:id/notifications", func(c *gin.Context) {
+				deliveries, err := dispatcher.Deliveries(c.Request.Context(), c.Param("id"))
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, deliveries)
+			})
+
+			// Acknowledge or resolve an alert on behalf of the signed-in user
+			alertsGroup.POST("/:id/ack", middleware.AuthRequired(), func(c *gin.Context) {
+				alert, err := alertManager.Acknowledge(c.Request.Context(), c.Param("id"), currentUser(c))
+				if err != nil {
+					respondAlertError(c, err)
+					return
+				}
+				c.JSON(http.StatusOK, alert)
+			})
+
+			alertsGroup.POST("/:id/resolve", middleware.AuthRequired(), func(c *gin.Context) {
+				alert, err := alertManager.Resolve(c.Request.Context(), c.Param("id"), currentUser(c))
+				if err != nil {
+					respondAlertError(c, err)
+					return
+				}
+				c.JSON(http.StatusOK, alert)
+			})
+		}
 	}
 
 	// Start monitoring loop in a goroutine
 	go func() {
-		alertThrottle := time.NewTicker(1 * time.Minute)
-		defer alertThrottle.Stop()
-
 		for metric := range metricsChan {
-			select {
-			case <-alertThrottle.C:
-				if alerts := networkCollector.Baseline.DetectAnomalies(metric); len(alerts) > 0 {
-					log.Println("🚨 Baseline Anomalies Detected:")
-					for _, alert := range alerts {
-						log.Printf("• %s: %s\n  ↳ %s",
-							alert.Severity, alert.Description, alert.Recommended)
-					}
-				}
-			default:
+			// Evaluate against the baselines before this sample is learned
+			ruleEngine.Evaluate(metric)
+			firing := networkCollector.Baseline.DetectAnomalies(metric)
+			firing = append(firing, ruleEngine.Firing(metric.ClinicID)...)
+			if err := alertManager.Sync(context.Background(), metric.ClinicID,
+				ruleEngine.Pending(metric.ClinicID), firing, metric.Timestamp); err != nil {
+				log.Printf("Failed to update alerts: %v", err)
 			}
-			predictor.AddMetrics(metric)
-			metrics = append(metrics, metric)
 
-			// Keep only last hour of metrics (600 samples at 6-second intervals)
-			if len(metrics) > 600 {
-				metrics = metrics[1:]
-			}
+			networkCollector.Baseline.Observe(metric)
+			metricsStore.Add(metric)
 
 			// Broadcast metrics to WebSocket clients
 			if data, err := json.Marshal(metric); err == nil {
@@ -308,3 +907,73 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// currentUser returns the ID of the user authenticated by AuthRequired
+func currentUser(c *gin.Context) string {
+	if id, ok := c.Get("user_id"); ok && id != nil {
+		return fmt.Sprint(id)
+	}
+	return ""
+}
+
+// respondAlertError maps alert manager errors to HTTP responses
+func respondAlertError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, alerts.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, alerts.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// respondOnCallError maps on-call errors to HTTP responses
+func respondOnCallError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, oncall.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, oncall.ErrInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// parseHistoryQuery builds a store query from the metrics history endpoint's
+// query parameters. The range defaults to the last hour in one-minute steps.
+func parseHistoryQuery(c *gin.Context, defaultClinic string) (store.Query, error) {
+	now := time.Now()
+	q := store.Query{
+		ClinicID:    c.DefaultQuery("clinic", defaultClinic),
+		Metric:      c.DefaultQuery("metric", "latency"),
+		From:        now.Add(-time.Hour),
+		To:          now,
+		Step:        time.Minute,
+		Aggregation: c.DefaultQuery("agg", store.AggAvg),
+	}
+
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid from: %v", err)
+		}
+		q.From = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid to: %v", err)
+		}
+		q.To = t
+	}
+	if v := c.Query("step"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid step: %v", err)
+		}
+		q.Step = d
+	}
+
+	return q, q.Validate()
+}
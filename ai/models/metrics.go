@@ -5,21 +5,159 @@ import "time"
 
 // Metrics represents network performance metrics
 type Metrics struct {
-	Timestamp     time.Time
+	Timestamp time.Time
+	// Raw cumulative interface counters as reported by the kernel
 	BytesSent     uint64
 	BytesReceived uint64
 	PacketsSent   uint64
 	PacketsRecv   uint64
-	Latency       float64
-	Connections   int
-	Interfaces    []string
-	CPUUsage      float64
-	MemoryUsage   float64
-	DiskUsage     float64
+	// Per-second rates over the last collection interval
+	BytesSentRate   float64 `json:"bytes_sent_rate"`
+	BytesRecvRate   float64 `json:"bytes_recv_rate"`
+	PacketsSentRate float64 `json:"packets_sent_rate"`
+	PacketsRecvRate float64 `json:"packets_recv_rate"`
+	ErrorsRate      float64 `json:"errors_rate"`
+	DropsRate       float64 `json:"drops_rate"`
+	Latency         float64
+	// Unreachable is set when every latency probe failed, in which case
+	// Latency carries no measurement
+	Unreachable bool           `json:"unreachable"`
+	Probes      []ProbeResult  `json:"probes"`
+	Network     NetworkMetrics `json:"network"`
+	Connections int
+	Interfaces  []string
+	CPUUsage    float64
+	MemoryUsage float64
+	DiskUsage   float64
+	// Per-interface breakdown. The top-level counters and rates describe the
+	// uplink when one is configured, otherwise the sum of these interfaces.
+	InterfaceStats []InterfaceMetrics `json:"interface_stats"`
+	Uplink         string             `json:"uplink,omitempty"`
+	// UplinkMissing is set when an uplink is configured but was not found,
+	// so the top-level figures are the fallback sum instead
+	UplinkMissing bool `json:"uplink_missing,omitempty"`
 	// Add clinic-specific fields
 	ClinicID      string   `json:"clinic_id"`
 	Coordinates   GeoPoint `json:"coordinates"`
 	TerrainFactor float64  `json:"terrain_factor"` // Sentinel-2 derived factor
+	// Types of the injected faults that distorted this sample, if any
+	Faults []string `json:"faults,omitempty"`
+}
+
+// Bandwidth returns the combined send and receive rate in MB/s
+func (m Metrics) Bandwidth() float64 {
+	return (m.BytesSentRate + m.BytesRecvRate) / (1024 * 1024)
+}
+
+// PacketRate returns the combined packets sent and received per second
+func (m Metrics) PacketRate() float64 {
+	return m.PacketsSentRate + m.PacketsRecvRate
+}
+
+// MetricNames lists the scalar metrics that can be stored, queried and
+// referenced by name elsewhere in the backend
+var MetricNames = []string{
+	"latency",
+	"jitter",
+	"packet_loss",
+	"uptime",
+	"bandwidth",
+	"bytes_sent_rate",
+	"bytes_recv_rate",
+	"packets_rate",
+	"errors_rate",
+	"drops_rate",
+	"cpu_usage",
+	"memory_usage",
+	"disk_usage",
+	"connections",
+}
+
+// Value returns a scalar metric by name. Latency is reported as unavailable
+// when every probe failed, rather than as a misleading number.
+func (m Metrics) Value(name string) (float64, bool) {
+	switch name {
+	case "latency":
+		return m.Latency, !m.Unreachable
+	case "jitter":
+		return m.Network.Jitter, true
+	case "packet_loss":
+		return m.Network.PacketLoss, true
+	case "uptime":
+		return m.Network.Uptime, true
+	case "bandwidth":
+		return m.Bandwidth(), true
+	case "bytes_sent_rate":
+		return m.BytesSentRate, true
+	case "bytes_recv_rate":
+		return m.BytesRecvRate, true
+	case "packets_rate":
+		return m.PacketRate(), true
+	case "errors_rate":
+		return m.ErrorsRate, true
+	case "drops_rate":
+		return m.DropsRate, true
+	case "cpu_usage":
+		return m.CPUUsage, true
+	case "memory_usage":
+		return m.MemoryUsage, true
+	case "disk_usage":
+		return m.DiskUsage, true
+	case "connections":
+		return float64(m.Connections), true
+	}
+	return 0, false
+}
+
+// IsMetricName reports whether name is one of MetricNames
+func IsMetricName(name string) bool {
+	for _, n := range MetricNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ProbeResult summarises one collection interval of probes against a target.
+// Times are in milliseconds.
+type ProbeResult struct {
+	Target     string    `json:"target"`
+	Type       string    `json:"type"`
+	Address    string    `json:"address"`
+	Timestamp  time.Time `json:"timestamp"`
+	Sent       int       `json:"sent"`
+	Received   int       `json:"received"`
+	RTT        float64   `json:"rtt"` // Median of successful attempts
+	MinRTT     float64   `json:"min_rtt"`
+	MaxRTT     float64   `json:"max_rtt"`
+	Jitter     float64   `json:"jitter"`      // RFC 3550 estimate once smoothed by the collector
+	PacketLoss float64   `json:"packet_loss"` // Percentage
+	RTTs       []float64 `json:"rtts,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// InterfaceMetrics represents counters and rates for a single network interface
+type InterfaceMetrics struct {
+	Name            string   `json:"name"`
+	Up              bool     `json:"up"`
+	Uplink          bool     `json:"uplink"`
+	MTU             int      `json:"mtu"`
+	Flags           []string `json:"flags"`
+	BytesSent       uint64   `json:"bytes_sent"`
+	BytesReceived   uint64   `json:"bytes_received"`
+	PacketsSent     uint64   `json:"packets_sent"`
+	PacketsRecv     uint64   `json:"packets_recv"`
+	ErrorsIn        uint64   `json:"errors_in"`
+	ErrorsOut       uint64   `json:"errors_out"`
+	DropsIn         uint64   `json:"drops_in"`
+	DropsOut        uint64   `json:"drops_out"`
+	BytesSentRate   float64  `json:"bytes_sent_rate"`
+	BytesRecvRate   float64  `json:"bytes_recv_rate"`
+	PacketsSentRate float64  `json:"packets_sent_rate"`
+	PacketsRecvRate float64  `json:"packets_recv_rate"`
+	ErrorsRate      float64  `json:"errors_rate"`
+	DropsRate       float64  `json:"drops_rate"`
 }
 
 // GeoPoint represents geographical coordinates
@@ -44,14 +182,49 @@ type Alert struct {
 	Severity    string `json:"severity"`
 	Description string `json:"description"`
 	Recommended string `json:"recommended"`
+
+	// Baseline deviation, set by alerts raised from the baseline monitor
+	Metric   string          `json:"metric,omitempty"`
+	Value    float64         `json:"value,omitempty"`
+	Expected float64         `json:"expected,omitempty"`
+	ZScore   float64         `json:"z_score,omitempty"`
+	Detector string          `json:"detector,omitempty"` // baseline, ewma, cusum, seasonal-esd or rule
+	Score    float64         `json:"score,omitempty"`    // Detector statistic that triggered the alert
+	Evidence []EvidencePoint `json:"evidence,omitempty"` // Samples the detector based its decision on
+
+	// Set by alerts raised from declarative rules. Metric then holds the
+	// rule's expression and Metrics the metric names it references.
+	Rule     string            `json:"rule,omitempty"`
+	Metrics  []string          `json:"metrics,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	ClinicID string            `json:"clinic_id,omitempty"`
+
+	// Set while a silence or maintenance window covers the alert
+	Silenced bool `json:"silenced,omitempty"`
+
+	// Set by the analyzer: llm or rules
+	Source string `json:"source,omitempty"`
+}
+
+// EvidencePoint is one sample in an alert's evidence window
+type EvidencePoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
 }
 
-// Prediction represents a network performance prediction
+// Prediction is a forecast of one metric at one horizon, with its
+// prediction interval
 type Prediction struct {
-	Timestamp  time.Time
-	Metric     string // e.g., "bandwidth", "latency", "cpu"
-	Value      float64
-	Confidence float64
+	ClinicID  string    `json:"clinic_id"`
+	Metric    string    `json:"metric"`  // e.g. latency or bandwidth
+	Horizon   string    `json:"horizon"` // How far ahead, e.g. 15m or 24h
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Lower     float64   `json:"lower"`
+	Upper     float64   `json:"upper"`
+	Level     float64   `json:"level"`  // Coverage of [Lower, Upper], e.g. 0.95
+	Model     string    `json:"model"`  // holt_winters or holt
+	Points    int       `json:"points"` // History points fitted
 }
 
 // ConnectivityAnalysis represents network connectivity analysis results
@@ -62,12 +235,30 @@ type ConnectivityAnalysis struct {
 	Recommendations []string `json:"recommendations"`
 }
 
+// EmergencyShare records a request for one clinic to share bandwidth with
+// another
+type EmergencyShare struct {
+	SourceID        string    `json:"source_id"`
+	TargetID        string    `json:"target_id"`
+	CanShare        bool      `json:"can_share"`
+	BandwidthFactor float64   `json:"bandwidth_factor"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// ClinicStatus is a clinic's network status as observed at a point in time
+type ClinicStatus struct {
+	ClinicID  string    `json:"clinic_id"`
+	Status    string    `json:"status"` // e.g. online or offline
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NetworkMetrics summarises link quality for telemedicine use
 type NetworkMetrics struct {
-	Bandwidth      string    `json:"bandwidth"`       // e.g., "100Mbps"
-	Latency        string    `json:"latency"`         // e.g., "15ms"
-	PacketLoss     string    `json:"packet_loss"`     // e.g., "0.1%"
-	SignalStrength int       `json:"signal_strength"` // 0-100
-	Jitter         string    `json:"jitter"`          // e.g., "5ms"
-	Uptime         float64   `json:"uptime"`          // percentage
+	Bandwidth      float64   `json:"bandwidth"`       // Mbps
+	Latency        float64   `json:"latency"`         // ms
+	PacketLoss     float64   `json:"packet_loss"`     // percentage
+	SignalStrength int       `json:"signal_strength"` // 0-100, not measured by the collector
+	Jitter         float64   `json:"jitter"`          // ms, RFC 3550 estimate
+	Uptime         float64   `json:"uptime"`          // percentage over the rolling window
 	LastCheck      time.Time `json:"last_check"`
-} 
\ No newline at end of file
+}
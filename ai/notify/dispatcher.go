@@ -0,0 +1,538 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+)
+
+// Config mirrors the notify section of config.yaml
+type Config struct {
+	Channels []ChannelConfig `yaml:"channels"`
+	Routes   []Route         `yaml:"routes"`
+	// People to notify per clinic ID, e.g. the facility in-charge
+	Contacts map[string][]Recipient `yaml:"contacts"`
+	Retry    RetryConfig            `yaml:"retry"`
+}
+
+// ChannelConfig configures one named channel. String values may reference
+// environment variables as ${NAME} so secrets stay out of the file.
+type ChannelConfig struct {
+	Name    string        `yaml:"name"`
+	Type    string        `yaml:"type"` // webhook, smtp or sms
+	Subject string        `yaml:"subject"`
+	Body    string        `yaml:"body"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// webhook and sms
+	URL string `yaml:"url"`
+	// webhook
+	Secret string `yaml:"secret"`
+	// smtp
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	// sms
+	Format       string            `yaml:"format"`
+	Headers      map[string]string `yaml:"headers"`
+	Params       map[string]string `yaml:"params"`
+	ToField      string            `yaml:"to_field"`
+	MessageField string            `yaml:"message_field"`
+}
+
+// Route sends matching events to channels. Empty matchers match anything;
+// States defaults to firing only.
+type Route struct {
+	Clinics    []string    `yaml:"clinics"` // Clinic ID globs
+	Severities []string    `yaml:"severities"`
+	States     []string    `yaml:"states"`
+	Channels   []string    `yaml:"channels"`
+	Roles      []string    `yaml:"roles"`      // Contact roles at the alert's clinic, e.g. in_charge
+	Recipients []Recipient `yaml:"recipients"` // Fixed recipients, e.g. the county ICT team
+}
+
+func (r Route) matches(e alerts.Event) bool {
+	states := r.States
+	if len(states) == 0 {
+		states = []string{alerts.StateFiring}
+	}
+	if !contains(states, e.State) {
+		return false
+	}
+	if len(r.Severities) > 0 && !contains(r.Severities, e.Alert.Severity) {
+		return false
+	}
+	if len(r.Clinics) == 0 {
+		return true
+	}
+	for _, pattern := range r.Clinics {
+		if ok, _ := path.Match(pattern, e.Alert.ClinicID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryConfig controls redelivery of failed notifications
+type RetryConfig struct {
+	Attempts       int           `yaml:"attempts"`        // Including the first; default 4
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // Doubles per attempt; default 2s
+	MaxBackoff     time.Duration `yaml:"max_backoff"`     // Default 1m
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.Attempts <= 0 {
+		c.Attempts = 4
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 2 * time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Minute
+	}
+	return c
+}
+
+// backoff returns the wait before the given retry (1 for the first retry)
+func (c RetryConfig) backoff(retry int) time.Duration {
+	d := c.InitialBackoff << (retry - 1)
+	if d <= 0 || d > c.MaxBackoff {
+		return c.MaxBackoff
+	}
+	return d
+}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Delivery is one notification to one recipient over one channel
+type Delivery struct {
+	ID          int64      `json:"id"`
+	AlertID     string     `json:"alert_id"`
+	State       string     `json:"state"`       // Delivery state
+	AlertState  string     `json:"alert_state"` // Alert state change being notified
+	Channel     string     `json:"channel"`
+	Recipient   string     `json:"recipient"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// channel is a configured notifier with its templates
+type channel struct {
+	name      string
+	kind      string
+	notifier  Notifier
+	templates templates
+}
+
+// job is one delivery waiting to be sent
+type job struct {
+	id      int64
+	channel *channel
+	to      Recipient
+	msg     Message
+}
+
+// Dispatcher routes alert events to channels and records every delivery
+type Dispatcher struct {
+	db       *sql.DB
+	channels map[string]*channel
+	routes   []Route
+	contacts map[string][]Recipient
+	retry    RetryConfig
+
+	jobs  chan job
+	wg    sync.WaitGroup
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewDispatcher validates the configuration and creates the delivery log
+// table in db. Call Start to begin sending.
+func NewDispatcher(config Config, db *sql.DB) (*Dispatcher, error) {
+	d := &Dispatcher{
+		db:       db,
+		channels: make(map[string]*channel),
+		routes:   config.Routes,
+		contacts: config.Contacts,
+		retry:    config.Retry.withDefaults(),
+		jobs:     make(chan job, 256),
+		sleep:    sleepContext,
+	}
+
+	for _, cc := range config.Channels {
+		ch, err := newChannel(cc)
+		if err != nil {
+			return nil, fmt.Errorf("channel %q: %v", cc.Name, err)
+		}
+		if _, exists := d.channels[ch.name]; exists {
+			return nil, fmt.Errorf("channel %q: duplicate name", cc.Name)
+		}
+		d.channels[ch.name] = ch
+	}
+	for i, r := range config.Routes {
+		if len(r.Channels) == 0 {
+			return nil, fmt.Errorf("route %d: at least one channel is required", i+1)
+		}
+		for _, name := range r.Channels {
+			if _, ok := d.channels[name]; !ok {
+				return nil, fmt.Errorf("route %d: unknown channel %q", i+1, name)
+			}
+		}
+		for _, pattern := range r.Clinics {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("route %d: invalid clinic pattern %q", i+1, pattern)
+			}
+		}
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS notification_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		alert_id TEXT NOT NULL,
+		state TEXT NOT NULL,
+		alert_state TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		recipient TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		delivered_at INTEGER
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delivery log: %v", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_deliveries_alert ON notification_deliveries (alert_id)`); err != nil {
+		return nil, fmt.Errorf("failed to create delivery log: %v", err)
+	}
+	return d, nil
+}
+
+func newChannel(cc ChannelConfig) (*channel, error) {
+	if cc.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	timeout := cc.Timeout
+	if timeout <= 0 {
+		timeout = sendTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+
+	var n Notifier
+	switch cc.Type {
+	case TypeWebhook:
+		if cc.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		n = &WebhookNotifier{URL: os.ExpandEnv(cc.URL), Secret: os.ExpandEnv(cc.Secret), Client: client}
+	case TypeSMTP:
+		if cc.Host == "" || cc.From == "" {
+			return nil, fmt.Errorf("host and from are required")
+		}
+		port := cc.Port
+		if port == 0 {
+			port = 587
+		}
+		n = &SMTPNotifier{
+			Host:     os.ExpandEnv(cc.Host),
+			Port:     port,
+			Username: os.ExpandEnv(cc.Username),
+			Password: os.ExpandEnv(cc.Password),
+			From:     os.ExpandEnv(cc.From),
+			Timeout:  timeout,
+		}
+	case TypeSMS:
+		if cc.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		if cc.Format != "" && cc.Format != "form" && cc.Format != "json" {
+			return nil, fmt.Errorf("format must be form or json")
+		}
+		n = &SMSNotifier{
+			URL:          os.ExpandEnv(cc.URL),
+			Format:       cc.Format,
+			Headers:      expandAll(cc.Headers),
+			Params:       expandAll(cc.Params),
+			ToField:      cc.ToField,
+			MessageField: cc.MessageField,
+			Client:       client,
+		}
+	default:
+		return nil, fmt.Errorf("type must be webhook, smtp or sms (got %q)", cc.Type)
+	}
+
+	t, err := parseTemplates(cc.Type, cc.Subject, cc.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &channel{name: cc.Name, kind: cc.Type, notifier: n, templates: t}, nil
+}
+
+// Start runs the delivery workers until ctx is cancelled
+func (d *Dispatcher) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.jobs:
+					d.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+}
+
+// Wait blocks until the workers have stopped
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Handle routes an alert event to its channels. It is meant to be passed to
+// alerts.Manager.Subscribe. Silenced alerts are not notified; the manager
+// reports them again once their silences end.
+func (d *Dispatcher) Handle(e alerts.Event) {
+	if e.Alert.Silenced {
+		return
+	}
+
+	seen := make(map[target]bool)
+	for _, r := range d.routes {
+		if !r.matches(e) {
+			continue
+		}
+		recipients := append(append([]Recipient(nil), r.Recipients...), d.Contacts(e.Alert.ClinicID, r.Roles)...)
+		d.send(e, r.Channels, recipients, seen)
+	}
+}
+
+// Send notifies recipients of an event over the named channels, outside the
+// configured routes. It is used for escalations.
+func (d *Dispatcher) Send(e alerts.Event, channels []string, recipients []Recipient) error {
+	for _, name := range channels {
+		if !d.HasChannel(name) {
+			return fmt.Errorf("unknown channel %q", name)
+		}
+	}
+	d.send(e, channels, recipients, make(map[target]bool))
+	return nil
+}
+
+// HasChannel reports whether a channel is configured
+func (d *Dispatcher) HasChannel(name string) bool {
+	_, ok := d.channels[name]
+	return ok
+}
+
+// Contacts returns a clinic's contacts with any of the given roles
+func (d *Dispatcher) Contacts(clinicID string, roles []string) []Recipient {
+	var contacts []Recipient
+	for _, c := range d.contacts[clinicID] {
+		if contains(roles, c.Role) {
+			contacts = append(contacts, c)
+		}
+	}
+	return contacts
+}
+
+// target identifies one delivery address on one channel
+type target struct{ channel, address string }
+
+// send enqueues a message per channel and recipient, skipping targets
+// already in seen
+func (d *Dispatcher) send(e alerts.Event, channels []string, recipients []Recipient, seen map[target]bool) {
+	for _, name := range channels {
+		ch := d.channels[name]
+		for _, to := range ch.targets(recipients, seen) {
+			msg, err := ch.templates.render(e, to)
+			d.enqueue(ch, to, e.Alert.ID, e.State, msg, err)
+		}
+	}
+}
+
+// SendMessage delivers an already rendered message, such as a report, over
+// the named channels. render is called once per channel with its type.
+// Deliveries are logged under ref, with state as the alert state.
+func (d *Dispatcher) SendMessage(ref, state string, channels []string, recipients []Recipient,
+	render func(channelType string) Message) error {
+	for _, name := range channels {
+		if !d.HasChannel(name) {
+			return fmt.Errorf("unknown channel %q", name)
+		}
+	}
+	seen := make(map[target]bool)
+	for _, name := range channels {
+		ch := d.channels[name]
+		msg := render(ch.kind)
+		for _, to := range ch.targets(recipients, seen) {
+			d.enqueue(ch, to, ref, state, msg, nil)
+		}
+	}
+	return nil
+}
+
+// targets returns the recipients a channel delivers to, skipping those
+// already in seen and marking the rest
+func (ch *channel) targets(recipients []Recipient, seen map[target]bool) []Recipient {
+	if ch.kind == TypeWebhook {
+		// Webhooks are sent once per event, not per recipient
+		recipients = []Recipient{{}}
+	}
+	var list []Recipient
+	for _, to := range recipients {
+		address := to.Address(ch.kind)
+		if ch.kind != TypeWebhook && address == "" {
+			continue
+		}
+		key := target{ch.name, address}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		list = append(list, to)
+	}
+	return list
+}
+
+// enqueue records a delivery and queues it. A rendering error is recorded
+// as a failed delivery.
+func (d *Dispatcher) enqueue(ch *channel, to Recipient, ref, alertState string, msg Message, err error) {
+	address := to.Address(ch.kind)
+	if ch.kind == TypeWebhook {
+		address = "webhook"
+	}
+
+	state, lastError := DeliveryPending, ""
+	if err != nil {
+		state, lastError = DeliveryFailed, err.Error()
+	}
+
+	res, dbErr := d.db.Exec(`INSERT INTO notification_deliveries
+		(alert_id, state, alert_state, channel, recipient, last_error, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		ref, state, alertState, ch.name, address, lastError, time.Now().UnixMilli())
+	if dbErr != nil {
+		log.Printf("Failed to record notification for %s: %v", ref, dbErr)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to render %s notification for %s: %v", ch.name, ref, err)
+		return
+	}
+
+	id, _ := res.LastInsertId()
+	select {
+	case d.jobs <- job{id: id, channel: ch, to: to, msg: msg}:
+	default:
+		d.finish(id, DeliveryFailed, 0, "notification queue full")
+		log.Printf("Dropping %s notification for %s: queue full", ch.name, ref)
+	}
+}
+
+// deliver sends a job, retrying with exponential backoff
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	var err error
+	for attempt := 1; attempt <= d.retry.Attempts; attempt++ {
+		if attempt > 1 {
+			if d.sleep(ctx, d.retry.backoff(attempt-1)) != nil {
+				d.finish(j.id, DeliveryFailed, attempt-1, "cancelled during retry")
+				return
+			}
+		}
+
+		err = j.channel.notifier.Send(ctx, j.to, j.msg)
+		if err == nil {
+			d.finish(j.id, DeliveryDelivered, attempt, "")
+			return
+		}
+		log.Printf("Notification %d via %s failed (attempt %d/%d): %v",
+			j.id, j.channel.name, attempt, d.retry.Attempts, err)
+		d.finish(j.id, DeliveryPending, attempt, err.Error())
+	}
+	d.finish(j.id, DeliveryFailed, d.retry.Attempts, err.Error())
+}
+
+func (d *Dispatcher) finish(id int64, state string, attempts int, lastError string) {
+	var deliveredAt interface{}
+	if state == DeliveryDelivered {
+		deliveredAt = time.Now().UnixMilli()
+	}
+	if _, err := d.db.Exec(`UPDATE notification_deliveries
+		SET state = ?, attempts = ?, last_error = ?, delivered_at = ? WHERE id = ?`,
+		state, attempts, lastError, deliveredAt, id); err != nil {
+		log.Printf("Failed to update notification %d: %v", id, err)
+	}
+}
+
+// Deliveries returns the delivery log for an alert, oldest first
+func (d *Dispatcher) Deliveries(ctx context.Context, alertID string) ([]Delivery, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT id, alert_id, state, alert_state, channel, recipient,
+		attempts, last_error, created_at, delivered_at
+		FROM notification_deliveries WHERE alert_id = ? ORDER BY id`, alertID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var del Delivery
+		var createdAt int64
+		var deliveredAt sql.NullInt64
+		if err := rows.Scan(&del.ID, &del.AlertID, &del.State, &del.AlertState, &del.Channel, &del.Recipient,
+			&del.Attempts, &del.LastError, &createdAt, &deliveredAt); err != nil {
+			return nil, fmt.Errorf("failed to read delivery: %v", err)
+		}
+		del.CreatedAt = time.UnixMilli(createdAt)
+		if deliveredAt.Valid {
+			t := time.UnixMilli(deliveredAt.Int64)
+			del.DeliveredAt = &t
+		}
+		deliveries = append(deliveries, del)
+	}
+	return deliveries, rows.Err()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func expandAll(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = os.ExpandEnv(v)
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
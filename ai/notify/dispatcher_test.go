@@ -0,0 +1,283 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "notify.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// waitForDeliveries polls the delivery log until every delivery of an alert
+// has finished
+func waitForDeliveries(t *testing.T, d *Dispatcher, alertID string, n int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, err := d.Deliveries(context.Background(), alertID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := 0
+		for _, del := range deliveries {
+			if del.State != DeliveryPending {
+				done++
+			}
+		}
+		if len(deliveries) == n && done == n {
+			return deliveries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	deliveries, _ := d.Deliveries(context.Background(), alertID)
+	t.Fatalf("Timed out waiting for %d deliveries, have %+v", n, deliveries)
+	return nil
+}
+
+func TestDispatcherRoutesCriticalToInCharge(t *testing.T) {
+	var mu sync.Mutex
+	var smsTo []string
+	sms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		smsTo = append(smsTo, r.PostForm.Get("to"))
+		mu.Unlock()
+	}))
+	defer sms.Close()
+
+	var webhooks int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&webhooks, 1)
+	}))
+	defer hook.Close()
+
+	smtpServer := newSMTPServer(t)
+	host, port := smtpServer.hostPort(t)
+
+	d, err := NewDispatcher(Config{
+		Channels: []ChannelConfig{
+			{Name: "sms", Type: TypeSMS, URL: sms.URL},
+			{Name: "email", Type: TypeSMTP, Host: host, Port: port, From: "alerts@healthnet.example"},
+			{Name: "ops", Type: TypeWebhook, URL: hook.URL},
+		},
+		Routes: []Route{
+			{Severities: []string{"critical"}, Channels: []string{"sms", "email"}, Roles: []string{"in_charge"}},
+			{Channels: []string{"ops"}, States: []string{alerts.StateFiring, alerts.StateResolved}},
+		},
+		Contacts: map[string][]Recipient{
+			"kisumu-east": {
+				{Name: "Nurse Achieng", Role: "in_charge", Phone: "+254711111111", Email: "achieng@example.org"},
+				{Name: "Clerk", Role: "records", Phone: "+254722222222"},
+			},
+			"siaya": {{Name: "Dr. Ouma", Role: "in_charge", Phone: "+254733333333"}},
+		},
+	}, openTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx, 2)
+
+	critical := testEvent(alerts.StateFiring, "critical")
+	d.Handle(critical)
+	deliveries := waitForDeliveries(t, d, critical.Alert.ID, 3)
+
+	channels := map[string]string{}
+	for _, del := range deliveries {
+		if del.State != DeliveryDelivered || del.Attempts != 1 || del.AlertState != "firing" {
+			t.Errorf("Unexpected delivery %+v", del)
+		}
+		channels[del.Channel] = del.Recipient
+	}
+	if channels["sms"] != "+254711111111" || channels["email"] != "achieng@example.org" || channels["ops"] != "webhook" {
+		t.Errorf("Unexpected routing %v", channels)
+	}
+	if len(smsTo) != 1 || smsTo[0] != "+254711111111" || len(smtpServer.received()) != 1 || webhooks != 1 {
+		t.Errorf("Unexpected sends: sms %v, email %d, webhooks %d", smsTo, len(smtpServer.received()), webhooks)
+	}
+
+	// Warnings only reach the ops webhook
+	warning := testEvent(alerts.StateFiring, "warning")
+	warning.Alert.ID = "alt_warning"
+	d.Handle(warning)
+	if got := waitForDeliveries(t, d, "alt_warning", 1); got[0].Channel != "ops" {
+		t.Errorf("Expected only the webhook for a warning, got %+v", got)
+	}
+
+	// Silenced alerts are recorded by the manager but not notified
+	silenced := testEvent(alerts.StateFiring, "critical")
+	silenced.Alert.ID = "alt_silenced"
+	silenced.Alert.Silenced = true
+	d.Handle(silenced)
+	time.Sleep(50 * time.Millisecond)
+	if got, _ := d.Deliveries(context.Background(), "alt_silenced"); len(got) != 0 {
+		t.Errorf("Expected no deliveries for a silenced alert, got %+v", got)
+	}
+
+	// Once the silence ends the manager reports the alert again
+	silenced.Alert.Silenced = false
+	silenced.Change = alerts.ChangeUnsilenced
+	d.Handle(silenced)
+	waitForDeliveries(t, d, "alt_silenced", 3)
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	var calls int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer hook.Close()
+
+	d, err := NewDispatcher(Config{
+		Channels: []ChannelConfig{{Name: "ops", Type: TypeWebhook, URL: hook.URL}},
+		Routes:   []Route{{Channels: []string{"ops"}}},
+		Retry:    RetryConfig{Attempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second},
+	}, openTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var waits []time.Duration
+	d.sleep = func(ctx context.Context, wait time.Duration) error {
+		mu.Lock()
+		waits = append(waits, wait)
+		mu.Unlock()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx, 1)
+
+	e := testEvent(alerts.StateFiring, "critical")
+	d.Handle(e)
+	got := waitForDeliveries(t, d, e.Alert.ID, 1)[0]
+	if got.State != DeliveryDelivered || got.Attempts != 3 || got.LastError != "" {
+		t.Errorf("Unexpected delivery %+v", got)
+	}
+	if len(waits) != 2 || waits[0] != time.Second || waits[1] != 2*time.Second {
+		t.Errorf("Backoff waits = %v, want [1s 2s]", waits)
+	}
+
+	// A receiver that never recovers exhausts the attempts
+	atomic.StoreInt32(&calls, -100)
+	e.Alert.ID = "alt_failing"
+	d.Handle(e)
+	got = waitForDeliveries(t, d, "alt_failing", 1)[0]
+	if got.State != DeliveryFailed || got.Attempts != 4 || !strings.Contains(got.LastError, "503") {
+		t.Errorf("Unexpected delivery %+v", got)
+	}
+	if waits[len(waits)-1] != 3*time.Second {
+		t.Errorf("Expected backoff to be capped at 3s, got %v", waits)
+	}
+}
+
+func TestNewDispatcherValidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"unknown type", Config{Channels: []ChannelConfig{{Name: "x", Type: "pager"}}}, "type must be"},
+		{"missing url", Config{Channels: []ChannelConfig{{Name: "x", Type: TypeWebhook}}}, "url is required"},
+		{"bad template", Config{Channels: []ChannelConfig{{Name: "x", Type: TypeSMS, URL: "http://sms", Body: "{{.Nope"}}}, "body template"},
+		{"unknown channel", Config{Routes: []Route{{Channels: []string{"sms"}}}}, `unknown channel "sms"`},
+		{"duplicate", Config{Channels: []ChannelConfig{
+			{Name: "x", Type: TypeWebhook, URL: "http://a"}, {Name: "x", Type: TypeWebhook, URL: "http://b"},
+		}}, "duplicate name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDispatcher(tt.config, openTestDB(t))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewDispatcher error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherSendMessage(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []map[string]interface{}
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&p)
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	smtpServer := newSMTPServer(t)
+	host, port := smtpServer.hostPort(t)
+
+	d, err := NewDispatcher(Config{
+		Channels: []ChannelConfig{
+			{Name: "email", Type: TypeSMTP, Host: host, Port: port, From: "reports@healthnet.example"},
+			{Name: "ops", Type: TypeWebhook, URL: hook.URL},
+		},
+	}, openTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx, 1)
+
+	recipients := []Recipient{{Name: "County ICT", Email: "ict@kisumu.example"}, {Name: "No email"}}
+	var rendered []string
+	err = d.SendMessage("rpt_1", "report", []string{"email", "ops"}, recipients, func(channelType string) Message {
+		rendered = append(rendered, channelType)
+		return Message{Subject: "Daily digest", Body: "# Digest", HTML: "<h1>Digest</h1>",
+			Report: map[string]string{"id": "rpt_1"}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries := waitForDeliveries(t, d, "rpt_1", 2)
+	for _, del := range deliveries {
+		if del.State != DeliveryDelivered || del.AlertState != "report" {
+			t.Errorf("Unexpected delivery %+v", del)
+		}
+	}
+	if strings.Join(rendered, ",") != "smtp,webhook" {
+		t.Errorf("Rendered for %v, want once per channel", rendered)
+	}
+
+	got := smtpServer.received()
+	if len(got) != 1 || !strings.Contains(got[0].data, "multipart/alternative") ||
+		!strings.Contains(got[0].data, "<h1>Digest</h1>") || !strings.Contains(got[0].data, "# Digest") {
+		t.Errorf("Unexpected email %+v", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(payloads) != 1 || payloads[0]["type"] != "report" || payloads[0]["alert"] != nil {
+		t.Errorf("Unexpected webhook payloads %v", payloads)
+	}
+
+	if err := d.SendMessage("rpt_2", "report", []string{"sms"}, recipients, nil); err == nil {
+		t.Error("Expected an error for an unknown channel")
+	}
+}
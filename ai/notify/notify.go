@@ -0,0 +1,139 @@
+// Package notify delivers alert state changes over webhook, email and SMS
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+)
+
+// Channel types
+const (
+	TypeWebhook = "webhook"
+	TypeSMTP    = "smtp"
+	TypeSMS     = "sms"
+)
+
+// Recipient is who a message is addressed to. Webhooks ignore it.
+type Recipient struct {
+	Name  string `yaml:"name" json:"name"`
+	Role  string `yaml:"role" json:"role"` // e.g. in_charge
+	Email string `yaml:"email" json:"email,omitempty"`
+	Phone string `yaml:"phone" json:"phone,omitempty"` // E.164, e.g. +254712345678
+}
+
+// Address returns the part of the recipient a channel type delivers to
+func (r Recipient) Address(channelType string) string {
+	switch channelType {
+	case TypeSMTP:
+		return r.Email
+	case TypeSMS:
+		return r.Phone
+	}
+	return ""
+}
+
+// Message is a rendered notification
+type Message struct {
+	Subject string
+	Body    string
+	HTML    string // Optional HTML alternative of Body, used by email
+	Event   alerts.Event
+	Report  interface{} // Set instead of Event for scheduled reports
+}
+
+// Notifier delivers messages over one channel
+type Notifier interface {
+	Send(ctx context.Context, to Recipient, msg Message) error
+}
+
+// templateData is what subject and body templates are rendered with
+type templateData struct {
+	alerts.Alert
+	State     string
+	User      string
+	Recipient Recipient
+}
+
+// Default templates per channel type. SMS bodies are kept short enough to
+// fit a single message in most cases.
+var defaultTemplates = map[string][2]string{
+	TypeWebhook: {
+		`[{{.State | upper}}] {{.Severity}} alert at {{.ClinicID}}`,
+		`{{.Description}}`,
+	},
+	TypeSMTP: {
+		`[HealthNet {{.State | upper}}] {{.Severity}} at {{.ClinicID}}: {{.Description | truncate 80}}`,
+		`{{if .Recipient.Name}}Dear {{.Recipient.Name}},
+
+{{end}}An alert at {{.ClinicID}} is now {{.State}}{{if .User}} (by user {{.User}}){{end}}.
+
+Severity:    {{.Severity}}
+Alert:       {{.Description}}
+Recommended: {{.Recommended}}
+Started:     {{.StartsAt.Format "2006-01-02 15:04 MST"}}
+Alert ID:    {{.ID}}
+`,
+	},
+	TypeSMS: {
+		``,
+		`HealthNet {{.State | upper}} {{.Severity}} {{.ClinicID}}: {{.Description | truncate 90}}. {{.Recommended | truncate 40}}`,
+	},
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"truncate": func(n int, s string) string {
+		if len([]rune(s)) <= n {
+			return s
+		}
+		return string([]rune(s)[:n-1]) + "…"
+	},
+}
+
+// templates renders the subject and body of one channel
+type templates struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+func parseTemplates(channelType, subject, body string) (templates, error) {
+	defaults := defaultTemplates[channelType]
+	if subject == "" {
+		subject = defaults[0]
+	}
+	if body == "" {
+		body = defaults[1]
+	}
+
+	var t templates
+	var err error
+	if t.subject, err = template.New("subject").Funcs(templateFuncs).Parse(subject); err != nil {
+		return t, fmt.Errorf("subject template: %v", err)
+	}
+	if t.body, err = template.New("body").Funcs(templateFuncs).Parse(body); err != nil {
+		return t, fmt.Errorf("body template: %v", err)
+	}
+	return t, nil
+}
+
+func (t templates) render(e alerts.Event, to Recipient) (Message, error) {
+	data := templateData{Alert: e.Alert, State: e.State, User: e.User, Recipient: to}
+
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render subject: %v", err)
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render body: %v", err)
+	}
+	return Message{Subject: subject.String(), Body: body.String(), Event: e}, nil
+}
+
+// sendTimeout is the default time a channel may take to deliver one message
+const sendTimeout = 10 * time.Second
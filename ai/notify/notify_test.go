@@ -0,0 +1,311 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func testEvent(state, severity string) alerts.Event {
+	return alerts.Event{
+		Type:  "alert",
+		State: state,
+		Alert: alerts.Alert{
+			ID:       "alt_0123456789abcdef",
+			State:    state,
+			StartsAt: time.Date(2025, 3, 31, 8, 0, 0, 0, time.UTC),
+			Alert: models.Alert{
+				Severity:    severity,
+				Description: "latency-critical: latency = 250.00 > 200 for 1m0s",
+				Recommended: "Check the WAN uplink",
+				ClinicID:    "kisumu-east",
+			},
+		},
+	}
+}
+
+func render(t *testing.T, channelType string, e alerts.Event, to Recipient) Message {
+	t.Helper()
+	tmpl, err := parseTemplates(channelType, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := tmpl.render(e, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestWebhookSignsPayload(t *testing.T) {
+	var got webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + Sign("s3cret", r.Header.Get(TimestampHeader), body)
+		if r.Header.Get(SignatureHeader) != want {
+			t.Errorf("Signature = %q, want %q", r.Header.Get(SignatureHeader), want)
+		}
+		json.Unmarshal(body, &got)
+	}))
+	defer server.Close()
+
+	e := testEvent(alerts.StateFiring, "critical")
+	w := &WebhookNotifier{URL: server.URL, Secret: "s3cret"}
+	if err := w.Send(context.Background(), Recipient{}, render(t, TypeWebhook, e, Recipient{})); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "alert" || got.State != "firing" || got.Subject != "[FIRING] critical alert at kisumu-east" ||
+		!strings.Contains(got.Text, "latency = 250.00") {
+		t.Errorf("Unexpected payload %+v", got)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "receiver down", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	w := &WebhookNotifier{URL: server.URL}
+	err := w.Send(context.Background(), Recipient{}, Message{Event: testEvent(alerts.StateFiring, "warning")})
+	if err == nil || !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "receiver down") {
+		t.Errorf("Expected a 502 error, got %v", err)
+	}
+}
+
+func TestSMSGatewayForm(t *testing.T) {
+	var form url.Values
+	var apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		apiKey = r.Header.Get("apiKey")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	s := &SMSNotifier{
+		URL:     server.URL,
+		Headers: map[string]string{"apiKey": "key-123"},
+		Params:  map[string]string{"username": "healthnet", "from": "HEALTHNET"},
+	}
+	to := Recipient{Name: "Nurse Achieng", Phone: "+254712345678"}
+	msg := render(t, TypeSMS, testEvent(alerts.StateFiring, "critical"), to)
+	if err := s.Send(context.Background(), to, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if apiKey != "key-123" || form.Get("username") != "healthnet" || form.Get("from") != "HEALTHNET" ||
+		form.Get("to") != "+254712345678" || !strings.HasPrefix(form.Get("message"), "HealthNet FIRING critical kisumu-east: ") {
+		t.Errorf("Unexpected request: key %q form %v", apiKey, form)
+	}
+	if n := len([]rune(form.Get("message"))); n > 160 {
+		t.Errorf("SMS body is %d characters, want at most 160", n)
+	}
+}
+
+func TestSMSGatewayJSON(t *testing.T) {
+	var body map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer server.Close()
+
+	s := &SMSNotifier{URL: server.URL, Format: "json", ToField: "recipient", MessageField: "text"}
+	if err := s.Send(context.Background(), Recipient{Phone: "+254700000000"}, Message{Body: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if body["recipient"] != "+254700000000" || body["text"] != "hello" {
+		t.Errorf("Unexpected body %v", body)
+	}
+
+	if err := s.Send(context.Background(), Recipient{Name: "No phone"}, Message{}); err == nil {
+		t.Error("Expected an error for a recipient without a phone number")
+	}
+}
+
+// smtpServer is a minimal SMTP stand-in that records received messages
+type smtpServer struct {
+	addr     string
+	listener net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{addr: l.Addr().String(), listener: l}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var msg smtpMessage
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			msg = smtpMessage{from: strings.Trim(cmd[10:], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(cmd[8:], "<> "))
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func (s *smtpServer) hostPort(t *testing.T) (string, int) {
+	host, port, _ := net.SplitHostPort(s.addr)
+	p, err := net.LookupPort("tcp", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, p
+}
+
+func TestSMTPSendsMail(t *testing.T) {
+	server := newSMTPServer(t)
+	host, port := server.hostPort(t)
+
+	n := &SMTPNotifier{Host: host, Port: port, From: "alerts@healthnet.example"}
+	to := Recipient{Name: "Dr. Otieno", Email: "otieno@kisumu-east.example"}
+	msg := render(t, TypeSMTP, testEvent(alerts.StateFiring, "critical"), to)
+	if err := n.Send(context.Background(), to, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := server.received()
+	if len(got) != 1 {
+		t.Fatalf("Expected one message, got %d", len(got))
+	}
+	m := got[0]
+	if m.from != "alerts@healthnet.example" || len(m.to) != 1 || m.to[0] != "otieno@kisumu-east.example" {
+		t.Errorf("Unexpected envelope %+v", m)
+	}
+	for _, want := range []string{
+		"To: Dr. Otieno <otieno@kisumu-east.example>",
+		"Subject: [HealthNet FIRING] critical at kisumu-east: latency-critical",
+		"Dear Dr. Otieno,",
+		"Recommended: Check the WAN uplink",
+		"Alert ID:    alt_0123456789abcdef",
+	} {
+		if !strings.Contains(m.data, want) {
+			t.Errorf("Message missing %q:\n%s", want, m.data)
+		}
+	}
+}
+
+func TestSMTPTimesOutOnHungServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// Accept connections but never send the greeting
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := net.LookupPort("tcp", port)
+
+	n := &SMTPNotifier{Host: host, Port: p, From: "alerts@healthnet.example", Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	err = n.Send(context.Background(), Recipient{Email: "otieno@kisumu-east.example"}, Message{Subject: "s", Body: "b"})
+	if err == nil {
+		t.Fatal("Expected a hung server to fail the send")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %v despite a 100ms timeout", elapsed)
+	}
+}
+
+func TestSMTPRecipientCannotInjectHeaders(t *testing.T) {
+	n := &SMTPNotifier{From: "alerts@healthnet.example"}
+	data := string(n.compose(Recipient{Name: "Otieno\r\nBcc: attacker@example.com", Email: "otieno@kisumu-east.example"},
+		Message{Subject: "s", Body: "b"}))
+	if strings.Contains(data, "\r\nBcc:") {
+		t.Errorf("Recipient name injected a header:\n%s", data)
+	}
+}
@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SMSNotifier posts messages to an HTTP SMS gateway. The request layout is
+// configurable so one implementation covers gateways such as Africa's
+// Talking (form fields username, to, message, from and an apiKey header).
+type SMSNotifier struct {
+	URL          string
+	Format       string            // form (default) or json
+	Headers      map[string]string // e.g. apiKey
+	Params       map[string]string // Static fields, e.g. username and from
+	ToField      string            // Default "to"
+	MessageField string            // Default "message"
+	Client       *http.Client
+}
+
+func (s *SMSNotifier) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.Phone == "" {
+		return fmt.Errorf("recipient %q has no phone number", to.Name)
+	}
+
+	fields := make(map[string]string, len(s.Params)+2)
+	for k, v := range s.Params {
+		fields[k] = v
+	}
+	fields[fieldOr(s.ToField, "to")] = to.Phone
+	fields[fieldOr(s.MessageField, "message")] = msg.Body
+
+	var body []byte
+	contentType := "application/x-www-form-urlencoded"
+	if s.Format == "json" {
+		contentType = "application/json"
+		var err error
+		if body, err = json.Marshal(fields); err != nil {
+			return fmt.Errorf("failed to encode SMS request: %v", err)
+		}
+	} else {
+		form := url.Values{}
+		for k, v := range fields {
+			form.Set(k, v)
+		}
+		body = []byte(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create SMS request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return doRequest(s.Client, req)
+}
+
+func fieldOr(field, fallback string) string {
+	if strings.TrimSpace(field) == "" {
+		return fallback
+	}
+	return field
+}
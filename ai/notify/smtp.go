@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier sends plain-text email, with an HTML alternative when the
+// message has one
+type SMTPNotifier struct {
+	Host     string
+	Port     int
+	Username string // Authentication is skipped when empty
+	Password string
+	From     string
+	Timeout  time.Duration // Bounds the whole exchange; defaults to 10s
+}
+
+func (s *SMTPNotifier) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.Email == "" {
+		return fmt.Errorf("recipient %q has no email address", to.Name)
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = sendTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Host, strconv.Itoa(s.Port)))
+	if err != nil {
+		return err
+	}
+	// A server that stops responding must not hold the worker: every read
+	// and write fails at the deadline, and cancelling ctx closes the socket
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if err := s.deliver(c, to.Email, s.compose(to, msg)); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%v: %v", ctx.Err(), err)
+		}
+		return err
+	}
+	return nil
+}
+
+// deliver runs one SMTP transaction, upgrading to TLS when the server
+// offers it, as smtp.SendMail does
+func (s *SMTPNotifier) deliver(c *smtp.Client, rcpt string, data []byte) error {
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(rcpt); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// compose builds the RFC 5322 message
+func (s *SMTPNotifier) compose(to Recipient, msg Message) []byte {
+	recipient := to.Email
+	if to.Name != "" {
+		recipient = fmt.Sprintf("%s <%s>", to.Name, to.Email)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", headerSafe(recipient))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSafe(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	if msg.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		b.WriteString("\r\n")
+		b.WriteString(crlf(msg.Body))
+		return []byte(b.String())
+	}
+
+	w := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n", w.Boundary())
+	b.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", msg.Body},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		pw, _ := w.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		pw.Write([]byte(crlf(part.body)))
+	}
+	w.Close()
+	return []byte(b.String())
+}
+
+// crlf converts line endings to the CRLF required by SMTP
+func crlf(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
+
+// headerSafe strips line breaks so a value cannot inject extra headers
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook signature headers. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the channel secret, so receivers can
+// reject replayed requests.
+const (
+	SignatureHeader = "X-HealthNet-Signature"
+	TimestampHeader = "X-HealthNet-Timestamp"
+)
+
+// WebhookNotifier POSTs each event as JSON
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// webhookPayload is the JSON body of a webhook request
+type webhookPayload struct {
+	Type    string      `json:"type"`
+	State   string      `json:"state"`
+	User    string      `json:"user,omitempty"`
+	Subject string      `json:"subject"`
+	Text    string      `json:"text"`
+	Alert   interface{} `json:"alert,omitempty"`
+	Report  interface{} `json:"report,omitempty"`
+}
+
+func (w *WebhookNotifier) Send(ctx context.Context, _ Recipient, msg Message) error {
+	payload := webhookPayload{
+		Type:    "alert",
+		State:   msg.Event.State,
+		User:    msg.Event.User,
+		Subject: msg.Subject,
+		Text:    msg.Body,
+		Alert:   msg.Event.Alert,
+	}
+	if msg.Report != nil {
+		payload = webhookPayload{Type: "report", Subject: msg.Subject, Text: msg.Body, Report: msg.Report}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, timestamp, body))
+	}
+
+	return doRequest(w.Client, req)
+}
+
+// Sign returns the hex HMAC-SHA256 signature of a webhook body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// doRequest sends req and treats any non-2xx response as an error
+func doRequest(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = &http.Client{Timeout: sendTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(snippet))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,249 @@
+package oncall
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/notify"
+)
+
+// Escalation states. An escalation is active until the alert is
+// acknowledged or resolved, its last step has been notified, or its policy
+// is deleted.
+const (
+	EscalationActive       = "active"
+	EscalationAcknowledged = "acknowledged"
+	EscalationResolved     = "resolved"
+	EscalationCompleted    = "completed"
+	EscalationCancelled    = "cancelled"
+)
+
+// StateEscalated is the event state of escalation notices
+const StateEscalated = "escalated"
+
+// Escalation is the progress of one alert through its policy
+type Escalation struct {
+	AlertID   string    `json:"alert_id"`
+	PolicyID  string    `json:"policy_id"`
+	State     string    `json:"state"`
+	Step      int       `json:"step"`    // Number of steps notified so far
+	NextAt    time.Time `json:"next_at"` // When the next step is due while active
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Handle starts escalating alerts when they fire and stops when they are
+// acknowledged or resolved. When a firing alert's severity rises into a
+// different policy, escalation restarts under that policy. It is meant to be
+// passed to alerts.Manager.Subscribe.
+func (m *Manager) Handle(e alerts.Event) {
+	ctx := context.Background()
+	now := time.Now()
+
+	switch e.State {
+	case alerts.StateFiring:
+		// Silenced alerts are escalated too; escalate waits for the
+		// silence to end before notifying the first step
+		policy, ok := m.policyFor(e.Alert)
+		if !ok {
+			return
+		}
+		query := `INSERT OR IGNORE INTO alert_escalations
+			(alert_id, policy_id, state, step, next_at, updated_at) VALUES (?, ?, ?, 0, ?, ?)`
+		if e.Change == alerts.ChangeSeverity {
+			query = `INSERT INTO alert_escalations
+				(alert_id, policy_id, state, step, next_at, updated_at) VALUES (?, ?, ?, 0, ?, ?)
+				ON CONFLICT (alert_id) DO UPDATE SET policy_id = excluded.policy_id, state = excluded.state,
+					step = 0, next_at = excluded.next_at, updated_at = excluded.updated_at
+				WHERE alert_escalations.policy_id != excluded.policy_id
+					AND alert_escalations.state IN ('` + EscalationActive + `', '` + EscalationCompleted + `')`
+		}
+		_, err := m.db.ExecContext(ctx, query,
+			e.Alert.ID, policy.ID, EscalationActive, now.UnixMilli(), now.UnixMilli())
+		if err != nil {
+			log.Printf("Failed to start escalation for alert %s: %v", e.Alert.ID, err)
+			return
+		}
+		if e.Alert.Silenced {
+			return
+		}
+		// Notify the first step now rather than on the next tick
+		if err := m.Tick(ctx, now); err != nil {
+			log.Printf("Failed to escalate alerts: %v", err)
+		}
+	case alerts.StateAcknowledged, alerts.StateResolved:
+		m.escalateMu.Lock()
+		defer m.escalateMu.Unlock()
+		if err := m.stop(ctx, e.Alert.ID, e.State, now); err != nil {
+			log.Printf("Failed to stop escalation for alert %s: %v", e.Alert.ID, err)
+		}
+	}
+}
+
+// policyFor returns the oldest policy matching an alert
+func (m *Manager) policyFor(a alerts.Alert) (Policy, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, p := range m.sortedPolicies() {
+		if p.Matches(a.Alert) {
+			return p, true
+		}
+	}
+	return Policy{}, false
+}
+
+// Run notifies due escalation steps every interval until ctx is cancelled
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := m.Tick(ctx, now); err != nil {
+				log.Printf("Failed to escalate alerts: %v", err)
+			}
+		}
+	}
+}
+
+// Tick notifies every escalation step due at now
+func (m *Manager) Tick(ctx context.Context, now time.Time) error {
+	m.escalateMu.Lock()
+	defer m.escalateMu.Unlock()
+
+	rows, err := m.db.QueryContext(ctx, `SELECT alert_id, policy_id, state, step, next_at, updated_at
+		FROM alert_escalations WHERE state = ? AND next_at <= ? ORDER BY next_at`,
+		EscalationActive, now.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to load escalations: %v", err)
+	}
+	due, err := scanEscalations(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, esc := range due {
+		if err := m.escalate(ctx, esc, now); err != nil {
+			log.Printf("Failed to escalate alert %s: %v", esc.AlertID, err)
+		}
+	}
+	return nil
+}
+
+// escalate notifies an escalation's next step and schedules the one after
+func (m *Manager) escalate(ctx context.Context, esc Escalation, now time.Time) error {
+	a, err := m.alerts.Get(ctx, esc.AlertID)
+	if errors.Is(err, alerts.ErrNotFound) {
+		return m.stop(ctx, esc.AlertID, EscalationCancelled, now)
+	}
+	if err != nil {
+		return err
+	}
+	switch a.State {
+	case alerts.StateAcknowledged:
+		return m.stop(ctx, esc.AlertID, EscalationAcknowledged, now)
+	case alerts.StateResolved:
+		return m.stop(ctx, esc.AlertID, EscalationResolved, now)
+	}
+	if a.Silenced {
+		// Wait for the silence to end
+		return nil
+	}
+
+	m.mu.RLock()
+	policy, ok := m.policies[esc.PolicyID]
+	if !ok || esc.Step >= len(policy.Steps) {
+		m.mu.RUnlock()
+		return m.stop(ctx, esc.AlertID, EscalationCancelled, now)
+	}
+	step := policy.Steps[esc.Step]
+	var recipients []notify.Recipient
+	for _, id := range step.Rotations {
+		if r, ok := m.rotations[id]; ok {
+			recipients = append(recipients, m.onCall(r, now).Member)
+		}
+	}
+	m.mu.RUnlock()
+
+	recipients = append(recipients, m.sender.Contacts(a.ClinicID, step.Roles)...)
+	recipients = append(recipients, step.Recipients...)
+
+	var names []string
+	for _, r := range recipients {
+		names = append(names, r.Name)
+	}
+	log.Printf("⏫ Escalating alert %s to step %d/%d of %q: %s",
+		a.ID, esc.Step+1, len(policy.Steps), policy.Name, strings.Join(names, ", "))
+
+	event := alerts.Event{Type: "escalation", State: StateEscalated, Alert: a}
+	if err := m.sender.Send(event, step.Channels, recipients); err != nil {
+		return err
+	}
+
+	esc.Step++
+	state, nextAt := EscalationActive, now.Add(step.Timeout)
+	if esc.Step == len(policy.Steps) {
+		state = EscalationCompleted
+	}
+	_, err = m.db.ExecContext(ctx, `UPDATE alert_escalations SET state = ?, step = ?, next_at = ?, updated_at = ?
+		WHERE alert_id = ?`, state, esc.Step, nextAt.UnixMilli(), now.UnixMilli(), esc.AlertID)
+	if err != nil {
+		return fmt.Errorf("failed to update escalation: %v", err)
+	}
+	return nil
+}
+
+// stop ends an active escalation
+func (m *Manager) stop(ctx context.Context, alertID, state string, now time.Time) error {
+	_, err := m.db.ExecContext(ctx, `UPDATE alert_escalations SET state = ?, updated_at = ?
+		WHERE alert_id = ? AND state = ?`, state, now.UnixMilli(), alertID, EscalationActive)
+	if err != nil {
+		return fmt.Errorf("failed to stop escalation: %v", err)
+	}
+	return nil
+}
+
+// Escalation returns an alert's escalation
+func (m *Manager) Escalation(ctx context.Context, alertID string) (Escalation, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT alert_id, policy_id, state, step, next_at, updated_at
+		FROM alert_escalations WHERE alert_id = ?`, alertID)
+	if err != nil {
+		return Escalation{}, fmt.Errorf("failed to load escalation: %v", err)
+	}
+	list, err := scanEscalations(rows)
+	if err != nil {
+		return Escalation{}, err
+	}
+	if len(list) == 0 {
+		return Escalation{}, ErrNotFound
+	}
+	return list[0], nil
+}
+
+func scanEscalations(rows *sql.Rows) ([]Escalation, error) {
+	defer rows.Close()
+
+	var list []Escalation
+	for rows.Next() {
+		var esc Escalation
+		var nextAt, updatedAt int64
+		if err := rows.Scan(&esc.AlertID, &esc.PolicyID, &esc.State, &esc.Step, &nextAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read escalation: %v", err)
+		}
+		esc.NextAt = time.UnixMilli(nextAt)
+		esc.UpdatedAt = time.UnixMilli(updatedAt)
+		list = append(list, esc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read escalations: %v", err)
+	}
+	return list, nil
+}
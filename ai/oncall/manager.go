@@ -0,0 +1,390 @@
+// Package oncall keeps on-call rotations and escalation policies, and
+// escalates firing alerts that nobody acknowledges
+package oncall
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/notify"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInUse    = errors.New("rotation is used by an escalation policy")
+)
+
+// Sender delivers escalation notices. *notify.Dispatcher implements it.
+type Sender interface {
+	Send(e alerts.Event, channels []string, recipients []notify.Recipient) error
+	Contacts(clinicID string, roles []string) []notify.Recipient
+	HasChannel(name string) bool
+}
+
+// Manager stores rotations, overrides and policies, and runs escalations.
+// Rotations, unexpired overrides and policies are cached in memory; the
+// escalation state of each alert lives in the database so it survives a
+// restart.
+type Manager struct {
+	db     *sql.DB
+	alerts *alerts.Manager
+	sender Sender
+
+	mu        sync.RWMutex
+	rotations map[string]Rotation
+	overrides map[string]Override
+	policies  map[string]Policy
+
+	// escalateMu serialises escalation steps between Handle and Tick
+	escalateMu sync.Mutex
+}
+
+// NewManager creates the on-call tables in db and loads the stored
+// rotations and policies
+func NewManager(db *sql.DB, alertManager *alerts.Manager, sender Sender) (*Manager, error) {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS oncall_rotations (
+			id TEXT PRIMARY KEY,
+			payload BLOB NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS oncall_overrides (
+			id TEXT PRIMARY KEY,
+			rotation_id TEXT NOT NULL,
+			ends_at INTEGER NOT NULL,
+			payload BLOB NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS escalation_policies (
+			id TEXT PRIMARY KEY,
+			payload BLOB NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS alert_escalations (
+			alert_id TEXT PRIMARY KEY,
+			policy_id TEXT NOT NULL,
+			state TEXT NOT NULL,
+			step INTEGER NOT NULL,
+			next_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_escalations_due ON alert_escalations (state, next_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("failed to create on-call tables: %v", err)
+		}
+	}
+
+	m := &Manager{
+		db:        db,
+		alerts:    alertManager,
+		sender:    sender,
+		rotations: make(map[string]Rotation),
+		overrides: make(map[string]Override),
+		policies:  make(map[string]Policy),
+	}
+	if err := m.load(time.Now()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Manager) load(now time.Time) error {
+	load := func(query string, args []interface{}, into func([]byte) error) error {
+		rows, err := m.db.Query(query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to load on-call data: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var payload []byte
+			if err := rows.Scan(&payload); err != nil {
+				return fmt.Errorf("failed to read on-call data: %v", err)
+			}
+			if err := into(payload); err != nil {
+				return fmt.Errorf("failed to decode on-call data: %v", err)
+			}
+		}
+		return rows.Err()
+	}
+
+	err := load(`SELECT payload FROM oncall_rotations`, nil, func(payload []byte) error {
+		var r Rotation
+		err := json.Unmarshal(payload, &r)
+		m.rotations[r.ID] = r
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = load(`SELECT payload FROM oncall_overrides WHERE ends_at > ?`, []interface{}{now.UnixMilli()}, func(payload []byte) error {
+		var o Override
+		err := json.Unmarshal(payload, &o)
+		m.overrides[o.ID] = o
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return load(`SELECT payload FROM escalation_policies`, nil, func(payload []byte) error {
+		var p Policy
+		err := json.Unmarshal(payload, &p)
+		m.policies[p.ID] = p
+		return err
+	})
+}
+
+// CreateRotation validates and stores a rotation
+func (m *Manager) CreateRotation(ctx context.Context, r Rotation) (Rotation, error) {
+	if err := r.Validate(); err != nil {
+		return Rotation{}, err
+	}
+	r.ID = newID("rot_")
+	r.CreatedAt = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.put(ctx, `INSERT INTO oncall_rotations (id, payload) VALUES (?, ?)`, r.ID, r); err != nil {
+		return Rotation{}, err
+	}
+	m.rotations[r.ID] = r
+	return r, nil
+}
+
+// DeleteRotation removes a rotation and its overrides. Rotations that a
+// policy refers to cannot be deleted.
+func (m *Manager) DeleteRotation(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rotations[id]; !ok {
+		return ErrNotFound
+	}
+	for _, p := range m.policies {
+		for _, s := range p.Steps {
+			if contains(s.Rotations, id) {
+				return fmt.Errorf("%w %q", ErrInUse, p.Name)
+			}
+		}
+	}
+
+	if _, err := m.db.ExecContext(ctx, `DELETE FROM oncall_overrides WHERE rotation_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete overrides: %v", err)
+	}
+	if _, err := m.db.ExecContext(ctx, `DELETE FROM oncall_rotations WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete rotation: %v", err)
+	}
+	delete(m.rotations, id)
+	for oid, o := range m.overrides {
+		if o.RotationID == id {
+			delete(m.overrides, oid)
+		}
+	}
+	return nil
+}
+
+// Rotations returns every rotation ordered by name
+func (m *Manager) Rotations() []Rotation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []Rotation{}
+	for _, r := range m.rotations {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// CreateOverride validates and stores an override for a rotation
+func (m *Manager) CreateOverride(ctx context.Context, o Override) (Override, error) {
+	if err := o.Validate(); err != nil {
+		return Override{}, err
+	}
+	o.ID = newID("ovr_")
+	o.CreatedAt = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.rotations[o.RotationID]; !ok {
+		return Override{}, ErrNotFound
+	}
+	payload, err := json.Marshal(o)
+	if err != nil {
+		return Override{}, fmt.Errorf("failed to encode override: %v", err)
+	}
+	if _, err := m.db.ExecContext(ctx, `INSERT INTO oncall_overrides (id, rotation_id, ends_at, payload) VALUES (?, ?, ?, ?)`,
+		o.ID, o.RotationID, o.EndsAt.UnixMilli(), payload); err != nil {
+		return Override{}, fmt.Errorf("failed to store override: %v", err)
+	}
+	m.overrides[o.ID] = o
+	return o, nil
+}
+
+// DeleteOverride removes an override
+func (m *Manager) DeleteOverride(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.overrides[id]; !ok {
+		return ErrNotFound
+	}
+	if _, err := m.db.ExecContext(ctx, `DELETE FROM oncall_overrides WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete override: %v", err)
+	}
+	delete(m.overrides, id)
+	return nil
+}
+
+// Overrides returns a rotation's overrides that have not ended at now,
+// ordered by start time
+func (m *Manager) Overrides(rotationID string, now time.Time) []Override {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []Override{}
+	for _, o := range m.overrides {
+		if o.RotationID == rotationID && o.EndsAt.After(now) {
+			list = append(list, o)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartsAt.Before(list[j].StartsAt) })
+	return list
+}
+
+// OnCall returns who is on call at t for each rotation covering a clinic.
+// An empty clinic ID returns every rotation.
+func (m *Manager) OnCall(clinicID string, t time.Time) []OnCall {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []OnCall{}
+	for _, r := range m.rotations {
+		if clinicID != "" && !r.Matches(clinicID) {
+			continue
+		}
+		list = append(list, m.onCall(r, t))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RotationName < list[j].RotationName })
+	return list
+}
+
+// onCall resolves a rotation's member at t; the latest-starting active
+// override wins. Callers hold m.mu.
+func (m *Manager) onCall(r Rotation, t time.Time) OnCall {
+	member, _, end := r.ShiftAt(t)
+	oc := OnCall{RotationID: r.ID, RotationName: r.Name, Member: member, Until: end}
+
+	var override *Override
+	for _, o := range m.overrides {
+		if o.RotationID == r.ID && o.ActiveAt(t) && (override == nil || o.StartsAt.After(override.StartsAt)) {
+			o := o
+			override = &o
+		}
+	}
+	if override != nil {
+		oc.Member = override.Member
+		oc.OverrideID = override.ID
+		oc.Until = override.EndsAt
+	}
+	return oc
+}
+
+// CreatePolicy validates and stores an escalation policy
+func (m *Manager) CreatePolicy(ctx context.Context, p Policy) (Policy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotationExists := func(id string) bool {
+		_, ok := m.rotations[id]
+		return ok
+	}
+	if err := p.validate(rotationExists, m.sender.HasChannel); err != nil {
+		return Policy{}, err
+	}
+	p.ID = newID("pol_")
+	p.CreatedAt = time.Now()
+
+	if err := m.put(ctx, `INSERT INTO escalation_policies (id, payload) VALUES (?, ?)`, p.ID, p); err != nil {
+		return Policy{}, err
+	}
+	m.policies[p.ID] = p
+	return p, nil
+}
+
+// DeletePolicy removes a policy. Escalations already running under it stop
+// at their next step.
+func (m *Manager) DeletePolicy(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.policies[id]; !ok {
+		return ErrNotFound
+	}
+	if _, err := m.db.ExecContext(ctx, `DELETE FROM escalation_policies WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete policy: %v", err)
+	}
+	delete(m.policies, id)
+	return nil
+}
+
+// Policies returns every policy, oldest first. This is the order in which
+// they are matched against alerts.
+func (m *Manager) Policies() []Policy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sortedPolicies()
+}
+
+func (m *Manager) sortedPolicies() []Policy {
+	list := []Policy{}
+	for _, p := range m.policies {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// put stores a JSON payload under id
+func (m *Manager) put(ctx context.Context, query, id string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", id, err)
+	}
+	if _, err := m.db.ExecContext(ctx, query, id, payload); err != nil {
+		return fmt.Errorf("failed to store %s: %v", id, err)
+	}
+	return nil
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package oncall
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/notify"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// fakeSender records escalation notices instead of delivering them
+type fakeSender struct {
+	sent     [][]string // Recipient names per notice
+	contacts map[string][]notify.Recipient
+}
+
+func (s *fakeSender) Send(e alerts.Event, channels []string, recipients []notify.Recipient) error {
+	var names []string
+	for _, r := range recipients {
+		names = append(names, r.Name)
+	}
+	s.sent = append(s.sent, names)
+	return nil
+}
+
+func (s *fakeSender) Contacts(clinicID string, roles []string) []notify.Recipient {
+	var list []notify.Recipient
+	for _, c := range s.contacts[clinicID] {
+		if contains(roles, c.Role) {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+func (s *fakeSender) HasChannel(name string) bool {
+	return name == "sms" || name == "email"
+}
+
+func newTestManager(t *testing.T) (*Manager, *alerts.Manager, *fakeSender) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "oncall.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	am, err := alerts.NewManager(db, alerts.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &fakeSender{contacts: map[string][]notify.Recipient{
+		"jootrh": {{Name: "ICT Officer", Role: "ict_officer", Phone: "+254700000001"}},
+	}}
+	m, err := NewManager(db, am, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	am.Subscribe(m.Handle)
+	return m, am, sender
+}
+
+var monday = time.Date(2025, 3, 31, 8, 0, 0, 0, time.UTC)
+
+func member(name string) notify.Recipient {
+	return notify.Recipient{Name: name, Phone: "+2547" + strings.Repeat("1", 8)}
+}
+
+func TestRotationShiftAt(t *testing.T) {
+	weekly := Rotation{Period: PeriodWeekly, Start: monday, Members: []notify.Recipient{member("a"), member("b"), member("c")}}
+	daily := Rotation{Period: PeriodDaily, Start: monday, Members: []notify.Recipient{member("a"), member("b")}}
+
+	tests := []struct {
+		name     string
+		rotation Rotation
+		at       time.Time
+		want     string
+		start    time.Time
+	}{
+		{"first shift", weekly, monday, "a", monday},
+		{"second week", weekly, monday.Add(8 * 24 * time.Hour), "b", monday.Add(7 * 24 * time.Hour)},
+		{"wraps around", weekly, monday.Add(21 * 24 * time.Hour), "a", monday.Add(21 * 24 * time.Hour)},
+		{"before start", weekly, monday.Add(-time.Hour), "c", monday.Add(-7 * 24 * time.Hour)},
+		{"daily handoff", daily, monday.Add(24*time.Hour - time.Second), "a", monday},
+		{"daily next", daily, monday.Add(24 * time.Hour), "b", monday.Add(24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, start, end := tt.rotation.ShiftAt(tt.at)
+			if got.Name != tt.want || !start.Equal(tt.start) || end.Sub(start) != tt.rotation.period() {
+				t.Errorf("ShiftAt = %s [%v, %v), want %s from %v", got.Name, start, end, tt.want, tt.start)
+			}
+		})
+	}
+}
+
+func TestOnCallWithOverrides(t *testing.T) {
+	ctx := context.Background()
+	m, _, _ := newTestManager(t)
+
+	r, err := m.CreateRotation(ctx, Rotation{
+		Name: "JOOTRH ICT", ClinicID: "jootrh", Period: PeriodWeekly, Start: monday,
+		Members: []notify.Recipient{member("Otieno"), member("Wanjiru")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateRotation(ctx, Rotation{
+		Name: "Kisumu County", ClinicID: "*", Period: PeriodDaily, Start: monday,
+		Members: []notify.Recipient{member("County Lead")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cover, err := m.CreateOverride(ctx, Override{
+		RotationID: r.ID, Member: member("Akinyi"), Reason: "leave",
+		StartsAt: monday.Add(24 * time.Hour), EndsAt: monday.Add(48 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := m.OnCall("jootrh", monday.Add(36*time.Hour))
+	if len(got) != 2 || got[0].Member.Name != "Akinyi" || got[0].OverrideID != cover.ID ||
+		!got[0].Until.Equal(cover.EndsAt) || got[1].Member.Name != "County Lead" {
+		t.Errorf("Unexpected on-call during override: %+v", got)
+	}
+	if got := m.OnCall("jootrh", monday.Add(50*time.Hour)); got[0].Member.Name != "Otieno" || got[0].OverrideID != "" {
+		t.Errorf("Expected the rotation after the override, got %+v", got)
+	}
+	if got := m.OnCall("siaya", monday); len(got) != 1 || got[0].RotationName != "Kisumu County" {
+		t.Errorf("Expected only the county rotation for siaya, got %+v", got)
+	}
+
+	// Rotations survive a restart; overrides that have ended are dropped
+	reloaded, err := NewManager(m.db, m.alerts, m.sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Rotations()) != 2 || len(reloaded.Overrides(r.ID, monday)) != 0 {
+		t.Errorf("Unexpected reload: %+v, %+v", reloaded.Rotations(), reloaded.Overrides(r.ID, monday))
+	}
+}
+
+func TestPolicyValidation(t *testing.T) {
+	ctx := context.Background()
+	m, _, _ := newTestManager(t)
+
+	step := Step{Timeout: 10 * time.Minute, Roles: []string{"ict_officer"}, Channels: []string{"sms"}}
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string
+	}{
+		{"no steps", Policy{Name: "p"}, "at least one step"},
+		{"no timeout", Policy{Name: "p", Steps: []Step{{Roles: []string{"x"}, Channels: []string{"sms"}}, step}}, "step 1: timeout"},
+		{"no targets", Policy{Name: "p", Steps: []Step{{Channels: []string{"sms"}}}}, "rotation, role or recipient"},
+		{"unknown channel", Policy{Name: "p", Steps: []Step{{Roles: []string{"x"}, Channels: []string{"pager"}}}}, `unknown channel "pager"`},
+		{"unknown rotation", Policy{Name: "p", Steps: []Step{{Rotations: []string{"rot_x"}, Channels: []string{"sms"}}}}, `unknown rotation "rot_x"`},
+		{"bad severity", Policy{Name: "p", Severities: []string{"high"}, Steps: []Step{step}}, "severity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.CreatePolicy(ctx, tt.policy)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CreatePolicy error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	ctx := context.Background()
+	m, am, sender := newTestManager(t)
+
+	subCounty, err := m.CreateRotation(ctx, Rotation{
+		Name: "Kisumu Central sub-county", Period: PeriodWeekly, Start: monday,
+		Members: []notify.Recipient{member("Sub-county ICT")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := m.CreatePolicy(ctx, Policy{
+		Name: "JOOTRH critical", ClinicID: "jootrh", Severities: []string{"critical"},
+		Steps: []Step{
+			{Timeout: 10 * time.Minute, Roles: []string{"ict_officer"}, Channels: []string{"sms"}},
+			{Timeout: 10 * time.Minute, Rotations: []string{subCounty.ID}, Channels: []string{"sms"}},
+			{Recipients: []notify.Recipient{member("County Network Lead")}, Channels: []string{"sms", "email"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteRotation(ctx, subCounty.ID); !errors.Is(err, ErrInUse) {
+		t.Errorf("Expected a rotation used by a policy to be kept, got %v", err)
+	}
+
+	outage := models.Alert{Severity: "critical", Description: "uplink down", Detector: "connectivity"}
+	if err := am.Sync(ctx, "jootrh", nil, []models.Alert{outage}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	open, _ := am.List(ctx, alerts.Filter{ClinicID: "jootrh", States: alerts.OpenStates})
+	alertID := open[0].ID
+
+	// The first step is notified as soon as the alert fires
+	if len(sender.sent) != 1 || sender.sent[0][0] != "ICT Officer" {
+		t.Fatalf("Expected the ICT officer to be notified, got %v", sender.sent)
+	}
+	esc, err := m.Escalation(ctx, alertID)
+	if err != nil || esc.PolicyID != policy.ID || esc.State != EscalationActive || esc.Step != 1 {
+		t.Fatalf("Unexpected escalation %+v (%v)", esc, err)
+	}
+
+	now := time.Now()
+	m.Tick(ctx, now.Add(5*time.Minute))
+	if len(sender.sent) != 1 {
+		t.Fatalf("Escalated before the timeout: %v", sender.sent)
+	}
+	m.Tick(ctx, now.Add(11*time.Minute))
+	if len(sender.sent) != 2 || sender.sent[1][0] != "Sub-county ICT" {
+		t.Fatalf("Expected the sub-county on-call to be notified, got %v", sender.sent)
+	}
+
+	// Acknowledging stops the escalation before the county lead is paged
+	if _, err := am.Acknowledge(ctx, alertID, "7"); err != nil {
+		t.Fatal(err)
+	}
+	m.Tick(ctx, now.Add(30*time.Minute))
+	if len(sender.sent) != 2 {
+		t.Errorf("Escalated after acknowledgement: %v", sender.sent)
+	}
+	if esc, _ := m.Escalation(ctx, alertID); esc.State != EscalationAcknowledged {
+		t.Errorf("Escalation state = %s, want acknowledged", esc.State)
+	}
+
+	// Warnings do not match the policy
+	warning := models.Alert{Severity: "warning", Description: "latency high", Rule: "latency-warning"}
+	am.Sync(ctx, "jootrh", nil, []models.Alert{outage, warning}, time.Now())
+	if len(sender.sent) != 2 {
+		t.Errorf("Escalated a warning: %v", sender.sent)
+	}
+}
+
+func TestEscalationFollowsSeverityRise(t *testing.T) {
+	ctx := context.Background()
+	m, am, sender := newTestManager(t)
+
+	warnings, err := m.CreatePolicy(ctx, Policy{
+		Name: "warnings", Severities: []string{"warning"},
+		Steps: []Step{{Timeout: time.Hour, Roles: []string{"ict_officer"}, Channels: []string{"sms"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	critical, err := m.CreatePolicy(ctx, Policy{
+		Name: "critical", Severities: []string{"critical"},
+		Steps: []Step{{Timeout: time.Hour, Recipients: []notify.Recipient{member("County Network Lead")}, Channels: []string{"sms"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latency := models.Alert{Severity: "warning", Rule: "latency", Description: "latency high"}
+	am.Sync(ctx, "jootrh", nil, []models.Alert{latency}, time.Now())
+	open, _ := am.List(ctx, alerts.Filter{ClinicID: "jootrh", States: alerts.OpenStates})
+	if esc, _ := m.Escalation(ctx, open[0].ID); esc.PolicyID != warnings.ID {
+		t.Fatalf("Expected the warning policy, got %+v", esc)
+	}
+
+	latency.Severity = "critical"
+	am.Sync(ctx, "jootrh", nil, []models.Alert{latency}, time.Now())
+	esc, _ := m.Escalation(ctx, open[0].ID)
+	if esc.PolicyID != critical.ID || esc.Step != 1 {
+		t.Errorf("Expected escalation to restart under the critical policy, got %+v", esc)
+	}
+	if len(sender.sent) != 2 || sender.sent[1][0] != "County Network Lead" {
+		t.Errorf("Expected the critical policy's first step to be notified, got %v", sender.sent)
+	}
+}
+
+func TestEscalationWaitsForSilence(t *testing.T) {
+	ctx := context.Background()
+	m, am, sender := newTestManager(t)
+
+	if _, err := m.CreatePolicy(ctx, Policy{
+		Name:  "all clinics",
+		Steps: []Step{{Timeout: time.Hour, Roles: []string{"ict_officer"}, Channels: []string{"sms"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	silence, err := am.CreateSilence(ctx, alerts.Silence{
+		ClinicID: "jootrh", StartsAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Hour),
+		CreatedBy: "12", Reason: "generator test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outage := models.Alert{Severity: "critical", Detector: "connectivity"}
+	am.Sync(ctx, "jootrh", nil, []models.Alert{outage}, time.Now())
+	open, _ := am.List(ctx, alerts.Filter{ClinicID: "jootrh", States: alerts.OpenStates})
+	esc, err := m.Escalation(ctx, open[0].ID)
+	if err != nil || esc.State != EscalationActive || esc.Step != 0 {
+		t.Fatalf("Expected a waiting escalation for the silenced alert, got %+v (%v)", esc, err)
+	}
+	m.Tick(ctx, time.Now())
+	if len(sender.sent) != 0 {
+		t.Fatalf("Escalated a silenced alert: %v", sender.sent)
+	}
+
+	// The outage outlasts the silence
+	if _, err := am.CancelSilence(ctx, silence.ID); err != nil {
+		t.Fatal(err)
+	}
+	am.Sync(ctx, "jootrh", nil, []models.Alert{outage}, time.Now())
+	if len(sender.sent) != 1 || sender.sent[0][0] != "ICT Officer" {
+		t.Errorf("Expected escalation to start once the silence ended, got %v", sender.sent)
+	}
+}
+
+func TestEscalationCompletes(t *testing.T) {
+	ctx := context.Background()
+	m, am, sender := newTestManager(t)
+
+	if _, err := m.CreatePolicy(ctx, Policy{
+		Name: "all clinics",
+		Steps: []Step{
+			{Timeout: time.Minute, Roles: []string{"ict_officer"}, Channels: []string{"sms"}},
+			{Recipients: []notify.Recipient{member("County Network Lead")}, Channels: []string{"email"}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	am.Sync(ctx, "jootrh", nil, []models.Alert{{Severity: "critical", Detector: "connectivity"}}, time.Now())
+	now := time.Now()
+	m.Tick(ctx, now.Add(2*time.Minute))
+	m.Tick(ctx, now.Add(4*time.Minute))
+
+	if len(sender.sent) != 2 || sender.sent[1][0] != "County Network Lead" {
+		t.Errorf("Expected two steps, got %v", sender.sent)
+	}
+	open, _ := am.List(ctx, alerts.Filter{ClinicID: "jootrh", States: alerts.OpenStates})
+	if esc, _ := m.Escalation(ctx, open[0].ID); esc.State != EscalationCompleted || esc.Step != 2 {
+		t.Errorf("Unexpected escalation %+v", esc)
+	}
+}
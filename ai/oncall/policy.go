@@ -0,0 +1,128 @@
+package oncall
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/notify"
+)
+
+// Policy escalates unacknowledged firing alerts through ordered steps. The
+// first step is notified when the alert fires; each later step is notified
+// once the previous step's timeout passes without an acknowledgement.
+type Policy struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	ClinicID   string   `json:"clinic_id"`  // Clinic ID glob; empty matches any clinic
+	Severities []string `json:"severities"` // Empty matches any severity
+	Steps      []Step   `json:"steps"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Step notifies the people on call for its rotations, the alert clinic's
+// contacts with its roles, and any fixed recipients over its channels
+type Step struct {
+	Timeout    time.Duration      `json:"timeout"`
+	Rotations  []string           `json:"rotations"` // Rotation IDs
+	Roles      []string           `json:"roles"`     // Contact roles at the alert's clinic
+	Recipients []notify.Recipient `json:"recipients"`
+	Channels   []string           `json:"channels"`
+}
+
+// MarshalJSON reports Timeout as a duration string such as "10m0s"
+func (s Step) MarshalJSON() ([]byte, error) {
+	type plain Step
+	return json.Marshal(struct {
+		plain
+		Timeout string `json:"timeout"`
+	}{plain(s), s.Timeout.String()})
+}
+
+// UnmarshalJSON accepts Timeout as a duration string such as "10m"
+func (s *Step) UnmarshalJSON(data []byte) error {
+	type plain Step
+	var v struct {
+		plain
+		Timeout string `json:"timeout"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = Step(v.plain)
+	if v.Timeout == "" {
+		s.Timeout = 0
+		return nil
+	}
+	timeout, err := time.ParseDuration(v.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q: %v", v.Timeout, err)
+	}
+	s.Timeout = timeout
+	return nil
+}
+
+// validate checks the policy's matchers and steps. rotationExists and
+// channelExists look up the references.
+func (p Policy) validate(rotationExists, channelExists func(string) bool) error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if _, err := path.Match(p.ClinicID, ""); err != nil {
+		return fmt.Errorf("invalid clinic_id pattern %q: %v", p.ClinicID, err)
+	}
+	for _, severity := range p.Severities {
+		switch severity {
+		case "info", "warning", "critical":
+		default:
+			return fmt.Errorf("severity must be info, warning or critical (got %q)", severity)
+		}
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("at least one step is required")
+	}
+	for i, s := range p.Steps {
+		if s.Timeout <= 0 && i < len(p.Steps)-1 {
+			return fmt.Errorf("step %d: timeout is required", i+1)
+		}
+		if len(s.Rotations)+len(s.Roles)+len(s.Recipients) == 0 {
+			return fmt.Errorf("step %d: at least one rotation, role or recipient is required", i+1)
+		}
+		if len(s.Channels) == 0 {
+			return fmt.Errorf("step %d: at least one channel is required", i+1)
+		}
+		for _, id := range s.Rotations {
+			if !rotationExists(id) {
+				return fmt.Errorf("step %d: unknown rotation %q", i+1, id)
+			}
+		}
+		for _, name := range s.Channels {
+			if !channelExists(name) {
+				return fmt.Errorf("step %d: unknown channel %q", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the policy applies to an alert
+func (p Policy) Matches(a models.Alert) bool {
+	if p.ClinicID != "" {
+		if ok, _ := path.Match(p.ClinicID, a.ClinicID); !ok {
+			return false
+		}
+	}
+	if len(p.Severities) == 0 {
+		return true
+	}
+	for _, severity := range p.Severities {
+		if severity == a.Severity {
+			return true
+		}
+	}
+	return false
+}
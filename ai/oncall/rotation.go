@@ -0,0 +1,130 @@
+package oncall
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/notify"
+)
+
+// Rotation periods
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+// Rotation hands on-call duty for the matching clinics to the next member
+// every day or week, starting with the first member at Start. The time of
+// day (and weekday, for weekly rotations) of Start is the handoff time.
+type Rotation struct {
+	ID       string             `json:"id"`
+	Name     string             `json:"name"`
+	ClinicID string             `json:"clinic_id"` // Clinic ID glob, e.g. "kisumu-*"
+	Period   string             `json:"period"`
+	Start    time.Time          `json:"start"`
+	Members  []notify.Recipient `json:"members"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the rotation's schedule and members
+func (r Rotation) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if _, err := path.Match(r.ClinicID, ""); err != nil {
+		return fmt.Errorf("invalid clinic_id pattern %q: %v", r.ClinicID, err)
+	}
+	if r.Period != PeriodDaily && r.Period != PeriodWeekly {
+		return fmt.Errorf("period must be daily or weekly")
+	}
+	if r.Start.IsZero() {
+		return fmt.Errorf("start is required")
+	}
+	if len(r.Members) == 0 {
+		return fmt.Errorf("at least one member is required")
+	}
+	for i, m := range r.Members {
+		if m.Name == "" || m.Email == "" && m.Phone == "" {
+			return fmt.Errorf("member %d: name and an email or phone are required", i+1)
+		}
+	}
+	return nil
+}
+
+func (r Rotation) period() time.Duration {
+	if r.Period == PeriodWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Matches reports whether the rotation covers a clinic. An empty pattern
+// covers every clinic.
+func (r Rotation) Matches(clinicID string) bool {
+	if r.ClinicID == "" {
+		return true
+	}
+	ok, _ := path.Match(r.ClinicID, clinicID)
+	return ok
+}
+
+// ShiftAt returns the scheduled member at t and the shift's bounds,
+// ignoring overrides
+func (r Rotation) ShiftAt(t time.Time) (member notify.Recipient, start, end time.Time) {
+	period := r.period()
+	n := int64(t.Sub(r.Start) / period)
+	if t.Before(r.Start) && t.Sub(r.Start)%period != 0 {
+		n-- // Round towards the earlier shift
+	}
+	i := int(n % int64(len(r.Members)))
+	if i < 0 {
+		i += len(r.Members)
+	}
+	start = r.Start.Add(time.Duration(n) * period)
+	return r.Members[i], start, start.Add(period)
+}
+
+// Override hands a rotation's duty to someone else for a window, such as
+// a shift swap or leave cover
+type Override struct {
+	ID         string           `json:"id"`
+	RotationID string           `json:"rotation_id"`
+	Member     notify.Recipient `json:"member"`
+	StartsAt   time.Time        `json:"starts_at"`
+	EndsAt     time.Time        `json:"ends_at"`
+	Reason     string           `json:"reason"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the override's window and member
+func (o Override) Validate() error {
+	if o.StartsAt.IsZero() || o.EndsAt.IsZero() {
+		return fmt.Errorf("starts_at and ends_at are required")
+	}
+	if !o.EndsAt.After(o.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	if o.Member.Name == "" || o.Member.Email == "" && o.Member.Phone == "" {
+		return fmt.Errorf("member name and an email or phone are required")
+	}
+	return nil
+}
+
+// ActiveAt reports whether the override is in effect at t
+func (o Override) ActiveAt(t time.Time) bool {
+	return !t.Before(o.StartsAt) && t.Before(o.EndsAt)
+}
+
+// OnCall is who holds a rotation's duty at a point in time
+type OnCall struct {
+	RotationID   string           `json:"rotation_id"`
+	RotationName string           `json:"rotation_name"`
+	Member       notify.Recipient `json:"member"`
+	OverrideID   string           `json:"override_id,omitempty"`
+	Until        time.Time        `json:"until"`
+}
@@ -0,0 +1,499 @@
+package report
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/notify"
+	"github.com/Evarest-ke/healthnetai/store"
+)
+
+const (
+	// topAlerts bounds the alerts listed in a report
+	topAlerts = 10
+	// forecastHorizon is how far after the period clinics are forecast
+	forecastHorizon = time.Hour
+)
+
+// MetricsSource reads the metrics history. *store.SQLiteStore implements it.
+type MetricsSource interface {
+	store.History
+	store.Querier
+	Resolution(q store.Query, now time.Time) time.Duration
+	ClinicIDs(ctx context.Context) ([]string, error)
+}
+
+// Directory names clinics and records bandwidth shared between them.
+// *kisumu.NetworkService implements it.
+type Directory interface {
+	Clinic(id string) (models.Clinic, bool)
+	EmergencyShares(clinicID string, since time.Time) []models.EmergencyShare
+}
+
+// Sender delivers rendered reports. *notify.Dispatcher implements it.
+type Sender interface {
+	SendMessage(ref, state string, channels []string, recipients []notify.Recipient,
+		render func(channelType string) notify.Message) error
+	HasChannel(name string) bool
+}
+
+// Generator builds, stores and sends reports
+type Generator struct {
+	db        *sql.DB
+	metrics   MetricsSource
+	alerts    *alerts.Manager
+	analyzer  *analyzer.Analyzer // May be nil, in which case reports have no summary
+	directory Directory          // May be nil, in which case clinics are unnamed and shares not counted
+	sender    Sender             // May be nil, in which case reports are only stored
+	config    Config
+	loc       *time.Location
+}
+
+// NewGenerator checks the schedules' channels and creates the reports
+// table in db
+func NewGenerator(db *sql.DB, metrics MetricsSource, alertManager *alerts.Manager, a *analyzer.Analyzer,
+	directory Directory, sender Sender, config Config) (*Generator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	loc, _ := config.location()
+	for _, s := range config.Schedules {
+		for _, name := range s.Channels {
+			if sender == nil || !sender.HasChannel(name) {
+				return nil, fmt.Errorf("schedule %q: unknown channel %q", s.Name, name)
+			}
+		}
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS reports (
+		id TEXT PRIMARY KEY,
+		schedule TEXT NOT NULL,
+		period TEXT NOT NULL,
+		period_from INTEGER NOT NULL,
+		period_to INTEGER NOT NULL,
+		generated_at INTEGER NOT NULL,
+		payload BLOB NOT NULL,
+		markdown TEXT NOT NULL,
+		html TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reports table: %v", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_reports_schedule ON reports (schedule, period_to)`); err != nil {
+		return nil, fmt.Errorf("failed to create reports table: %v", err)
+	}
+
+	return &Generator{
+		db:        db,
+		metrics:   metrics,
+		alerts:    alertManager,
+		analyzer:  a,
+		directory: directory,
+		sender:    sender,
+		config:    config,
+		loc:       loc,
+	}, nil
+}
+
+// Run generates and sends due reports every interval until ctx is
+// cancelled
+func (g *Generator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := g.Tick(ctx, now); err != nil {
+				log.Printf("Failed to generate reports: %v", err)
+			}
+		}
+	}
+}
+
+// Tick generates and sends the latest digest of every schedule that has
+// not been generated yet. Missed digests are not caught up beyond the
+// latest one.
+func (g *Generator) Tick(ctx context.Context, now time.Time) error {
+	for _, s := range g.config.Schedules {
+		due := s.Due(now, g.loc)
+		var count int
+		err := g.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM reports WHERE schedule = ? AND period_to = ?`,
+			s.Name, due.UnixMilli()).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to check reports: %v", err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		r, err := g.Generate(ctx, s, s.Start(due), due, now)
+		if err != nil {
+			log.Printf("Failed to generate %s report: %v", s.Name, err)
+			continue
+		}
+		if err := g.Send(s, r); err != nil {
+			log.Printf("Failed to send report %s: %v", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// Generate builds a report for [from, to) over the schedule's clinics,
+// renders and stores it
+func (g *Generator) Generate(ctx context.Context, s Schedule, from, to, now time.Time) (Report, error) {
+	r, err := g.build(ctx, s, from, to, now)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if g.config.Summary && g.analyzer != nil {
+		summary, model, err := g.analyzer.ExecutiveSummary(ctx, r)
+		switch {
+		case errors.Is(err, analyzer.ErrNoLLM):
+		case err != nil:
+			log.Printf("Failed to summarise report %s: %v", r.ID, err)
+			r.SummaryError = err.Error()
+		default:
+			r.Summary, r.SummaryModel = summary, model
+		}
+	}
+
+	if r.Markdown, err = renderMarkdown(r); err != nil {
+		return Report{}, err
+	}
+	if r.HTML, err = renderHTML(r); err != nil {
+		return Report{}, err
+	}
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to encode report: %v", err)
+	}
+	_, err = g.db.ExecContext(ctx, `INSERT INTO reports
+		(id, schedule, period, period_from, period_to, generated_at, payload, markdown, html)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Schedule, r.Period, r.From.UnixMilli(), r.To.UnixMilli(), r.GeneratedAt.UnixMilli(),
+		payload, r.Markdown, r.HTML)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to store report: %v", err)
+	}
+
+	log.Printf("📊 Generated %s report %s for %d clinics", r.Period, r.ID, len(r.Clinics))
+	return r, nil
+}
+
+// Send delivers a report over the schedule's channels
+func (g *Generator) Send(s Schedule, r Report) error {
+	if len(s.Channels) == 0 {
+		return nil
+	}
+	if g.sender == nil {
+		return fmt.Errorf("no notification channels are configured")
+	}
+	return g.sender.SendMessage(r.ID, "report", s.Channels, s.Recipients, func(channelType string) notify.Message {
+		if channelType == notify.TypeSMS {
+			return notify.Message{Body: smsText(r)}
+		}
+		return notify.Message{Subject: subject(r), Body: r.Markdown, HTML: r.HTML, Report: r}
+	})
+}
+
+// Get returns a stored report
+func (g *Generator) Get(ctx context.Context, id string) (Report, error) {
+	var payload []byte
+	var r Report
+	err := g.db.QueryRowContext(ctx, `SELECT payload, markdown, html FROM reports WHERE id = ?`, id).
+		Scan(&payload, &r.Markdown, &r.HTML)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrNotFound
+	}
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to load report: %v", err)
+	}
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return Report{}, fmt.Errorf("failed to decode report: %v", err)
+	}
+	return r, nil
+}
+
+// List returns up to limit of the newest reports, without their rendered
+// forms
+func (g *Generator) List(ctx context.Context, limit int) ([]Report, error) {
+	rows, err := g.db.QueryContext(ctx, `SELECT payload FROM reports ORDER BY generated_at DESC, id LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %v", err)
+	}
+	defer rows.Close()
+
+	list := []Report{}
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, fmt.Errorf("failed to scan report: %v", err)
+		}
+		var r Report
+		if err := json.Unmarshal(payload, &r); err != nil {
+			return nil, fmt.Errorf("failed to decode report: %v", err)
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// build computes the report's figures from the stored data
+func (g *Generator) build(ctx context.Context, s Schedule, from, to, now time.Time) (Report, error) {
+	r := Report{
+		ID:          newID(),
+		Schedule:    s.Name,
+		Period:      s.Period,
+		From:        from,
+		To:          to,
+		GeneratedAt: now,
+		Clinics:     []ClinicSummary{},
+		TopAlerts:   []AlertSummary{},
+	}
+
+	ids, err := g.metrics.ClinicIDs(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	index := make(map[string]int)
+	var upSamples float64
+	var samples int
+	for _, id := range ids {
+		if !s.Matches(id) {
+			continue
+		}
+		c, err := g.clinic(ctx, id, from, to)
+		if err != nil {
+			return Report{}, err
+		}
+		if c.UptimePct != nil {
+			upSamples += *c.UptimePct / 100 * float64(c.Samples)
+			samples += c.Samples
+		}
+		if c.Forecast.Risk == RiskElevated || c.Forecast.Risk == RiskHigh {
+			r.Network.AtRisk++
+		}
+		index[id] = len(r.Clinics)
+		r.Clinics = append(r.Clinics, c)
+	}
+	r.Network.Clinics = len(r.Clinics)
+
+	if err := g.addAlerts(ctx, &r, s, index, now); err != nil {
+		return Report{}, err
+	}
+	g.addShares(&r, index)
+
+	if samples > 0 {
+		pct := round(100*upSamples/float64(samples), 2)
+		r.Network.UptimePct = &pct
+	}
+	sort.SliceStable(r.Clinics, func(i, j int) bool {
+		return uptimeOf(r.Clinics[i]) < uptimeOf(r.Clinics[j])
+	})
+	return r, nil
+}
+
+// clinic computes one clinic's uptime, latency distribution and forecast
+func (g *Generator) clinic(ctx context.Context, clinicID string, from, to time.Time) (ClinicSummary, error) {
+	c := ClinicSummary{ClinicID: clinicID}
+	if g.directory != nil {
+		if clinic, ok := g.directory.Clinic(clinicID); ok {
+			c.Name = clinic.Name
+		}
+	}
+
+	u, err := store.ComputeUptime(ctx, g.metrics, clinicID, from, to)
+	if err != nil {
+		return ClinicSummary{}, err
+	}
+	c.DowntimeHours = round(u.DowntimeHours, 2)
+	c.NoDataHours = round(u.NoDataHours, 2)
+	c.Samples = u.Samples
+	if u.Samples > 0 {
+		pct := round(u.Percent, 2)
+		c.UptimePct = &pct
+	}
+
+	q := store.Query{ClinicID: clinicID, Metric: "latency", From: from, To: to}
+	points, err := g.metrics.Query(ctx, q)
+	if err != nil {
+		return ClinicSummary{}, err
+	}
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.Value
+	}
+	c.Latency = Percentiles{
+		P50:     round(store.Percentile(values, 50), 1),
+		P95:     round(store.Percentile(values, 95), 1),
+		P99:     round(store.Percentile(values, 99), 1),
+		Samples: len(values),
+	}
+	if resolution := g.metrics.Resolution(q, time.Now()); resolution > 0 {
+		c.Latency.Resolution = resolution.String()
+	}
+
+	c.Forecast = g.forecast(ctx, clinicID, to)
+	return c, nil
+}
+
+// forecast predicts latency and bandwidth an hour after the period and
+// rates them against the alert thresholds. A threshold inside the
+// prediction interval raises the risk to elevated.
+func (g *Generator) forecast(ctx context.Context, clinicID string, to time.Time) Forecast {
+	predictions, err := analyzer.NewPredictor(g.metrics, analyzer.ForecastConfig{}).
+		Forecast(ctx, clinicID, to, []time.Duration{forecastHorizon})
+	if err != nil {
+		return Forecast{Risk: RiskUnknown}
+	}
+
+	// The configured limits, or the defaults without an analyzer
+	thresholds := analyzer.Thresholds
+	if g.analyzer != nil {
+		thresholds = g.analyzer.Thresholds
+	}
+
+	f := Forecast{Risk: RiskLow}
+	for _, p := range predictions {
+		switch p.Metric {
+		case "latency":
+			f.Latency, f.LatencyUpper = round(p.Value, 1), round(p.Upper, 1)
+		case "bandwidth":
+			f.Bandwidth, f.BandwidthUpper = round(p.Value, 2), round(p.Upper, 2)
+		default:
+			continue
+		}
+
+		warning, critical, ok := thresholds(p.Metric)
+		switch {
+		case !ok:
+		case p.Value > critical:
+			f.Risk = RiskHigh
+		case (p.Value > warning || p.Upper > critical) && f.Risk != RiskHigh:
+			f.Risk = RiskElevated
+		}
+	}
+	return f
+}
+
+// addAlerts counts the alerts that started during the report's period and
+// lists the most serious
+func (g *Generator) addAlerts(ctx context.Context, r *Report, s Schedule, index map[string]int, now time.Time) error {
+	list, err := g.alerts.List(ctx, alerts.Filter{From: r.From, To: r.To})
+	if err != nil {
+		return err
+	}
+
+	for _, a := range list {
+		if !s.Matches(a.ClinicID) {
+			continue
+		}
+		critical := a.Severity == "critical"
+		r.Network.Alerts++
+		if critical {
+			r.Network.CriticalAlerts++
+		}
+		if i, ok := index[a.ClinicID]; ok {
+			r.Clinics[i].Alerts++
+			if critical {
+				r.Clinics[i].CriticalAlerts++
+			}
+		}
+
+		end := now
+		if a.ResolvedAt != nil {
+			end = *a.ResolvedAt
+		}
+		r.TopAlerts = append(r.TopAlerts, AlertSummary{
+			ID:              a.ID,
+			ClinicID:        a.ClinicID,
+			Severity:        a.Severity,
+			State:           a.State,
+			Description:     a.Description,
+			StartsAt:        a.StartsAt,
+			DurationMinutes: round(end.Sub(a.StartsAt).Minutes(), 1),
+		})
+	}
+
+	sort.SliceStable(r.TopAlerts, func(i, j int) bool {
+		ci, cj := r.TopAlerts[i].Severity == "critical", r.TopAlerts[j].Severity == "critical"
+		if ci != cj {
+			return ci
+		}
+		return r.TopAlerts[i].DurationMinutes > r.TopAlerts[j].DurationMinutes
+	})
+	if len(r.TopAlerts) > topAlerts {
+		r.TopAlerts = r.TopAlerts[:topAlerts]
+	}
+	return nil
+}
+
+// addShares counts the emergency bandwidth shares requested during the
+// report's period
+func (g *Generator) addShares(r *Report, index map[string]int) {
+	if g.directory == nil {
+		return
+	}
+	type key struct {
+		source, target string
+		at             time.Time
+	}
+	seen := make(map[key]bool)
+	for id, i := range index {
+		for _, share := range g.directory.EmergencyShares(id, r.From) {
+			if !share.Timestamp.Before(r.To) {
+				continue
+			}
+			r.Clinics[i].Shares++
+			if share.CanShare {
+				r.Clinics[i].SharesGranted++
+			}
+
+			k := key{share.SourceID, share.TargetID, share.Timestamp}
+			if seen[k] {
+				continue // Between two clinics in the report
+			}
+			seen[k] = true
+			r.Network.Shares++
+			if share.CanShare {
+				r.Network.SharesGranted++
+			}
+		}
+	}
+}
+
+// uptimeOf sorts clinics without data last
+func uptimeOf(c ClinicSummary) float64 {
+	if c.UptimePct == nil {
+		return math.Inf(1)
+	}
+	return *c.UptimePct
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "rpt_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,153 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are shared by the Markdown and HTML templates
+var templateFuncs = map[string]interface{}{
+	"title": title,
+	"pct":   pct,
+	"date":  dateRange,
+	"cell":  cell,
+}
+
+var markdownTemplate = template.Must(template.New("markdown").Funcs(templateFuncs).Parse(
+	`# {{title .}}
+
+{{date .}}
+{{if .Summary}}
+{{.Summary}}
+{{end}}
+## Network
+
+- Clinics: {{.Network.Clinics}}
+- Uptime: {{pct .Network.UptimePct}}
+- Alerts: {{.Network.Alerts}} ({{.Network.CriticalAlerts}} critical)
+- Emergency bandwidth shares: {{.Network.Shares}} ({{.Network.SharesGranted}} granted)
+- Clinics at risk in the next hour: {{.Network.AtRisk}}
+
+## Clinics
+
+| Clinic | Uptime | Downtime (h) | Latency p50 / p95 / p99 (ms) | Alerts | Shares | Forecast risk |
+|---|---|---|---|---|---|---|
+{{range .Clinics}}| {{cell .ClinicID}}{{if .Name}} ({{cell .Name}}){{end}} | {{pct .UptimePct}} | {{.DowntimeHours}} | {{.Latency.P50}} / {{.Latency.P95}} / {{.Latency.P99}}{{if .Latency.Resolution}} (approx., {{.Latency.Resolution}} averages){{end}} | {{.Alerts}} ({{.CriticalAlerts}} critical) | {{.Shares}} | {{.Forecast.Risk}} |
+{{end}}
+## Top alerts
+{{if .TopAlerts}}
+| Severity | Clinic | Alert | Started | Duration (min) | State |
+|---|---|---|---|---|---|
+{{range .TopAlerts}}| {{.Severity}} | {{cell .ClinicID}} | {{cell .Description}} | {{.StartsAt.Format "2006-01-02 15:04"}} | {{.DurationMinutes}} | {{.State}} |
+{{end}}{{else}}
+No alerts started during the period.
+{{end}}
+Report {{.ID}}, generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}
+`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(templateFuncs).Parse(
+	`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{title .}}</title>
+<style>
+body { font-family: sans-serif; color: #222; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.risk-high, .critical { color: #b00020; font-weight: bold; }
+.risk-elevated, .warning { color: #b36b00; }
+</style>
+</head>
+<body>
+<h1>{{title .}}</h1>
+<p>{{date .}}</p>
+{{if .Summary}}<p>{{.Summary}}</p>
+{{end}}<h2>Network</h2>
+<ul>
+<li>Clinics: {{.Network.Clinics}}</li>
+<li>Uptime: {{pct .Network.UptimePct}}</li>
+<li>Alerts: {{.Network.Alerts}} ({{.Network.CriticalAlerts}} critical)</li>
+<li>Emergency bandwidth shares: {{.Network.Shares}} ({{.Network.SharesGranted}} granted)</li>
+<li>Clinics at risk in the next hour: {{.Network.AtRisk}}</li>
+</ul>
+<h2>Clinics</h2>
+<table>
+<tr><th>Clinic</th><th>Uptime</th><th>Downtime (h)</th><th>Latency p50 / p95 / p99 (ms)</th><th>Alerts</th><th>Shares</th><th>Forecast risk</th></tr>
+{{range .Clinics}}<tr><td>{{.ClinicID}}{{if .Name}} ({{.Name}}){{end}}</td><td>{{pct .UptimePct}}</td><td>{{.DowntimeHours}}</td><td>{{.Latency.P50}} / {{.Latency.P95}} / {{.Latency.P99}}{{if .Latency.Resolution}} (approx., {{.Latency.Resolution}} averages){{end}}</td><td>{{.Alerts}} ({{.CriticalAlerts}} critical)</td><td>{{.Shares}}</td><td class="risk-{{.Forecast.Risk}}">{{.Forecast.Risk}}</td></tr>
+{{end}}</table>
+<h2>Top alerts</h2>
+{{if .TopAlerts}}<table>
+<tr><th>Severity</th><th>Clinic</th><th>Alert</th><th>Started</th><th>Duration (min)</th><th>State</th></tr>
+{{range .TopAlerts}}<tr><td class="{{.Severity}}">{{.Severity}}</td><td>{{.ClinicID}}</td><td>{{.Description}}</td><td>{{.StartsAt.Format "2006-01-02 15:04"}}</td><td>{{.DurationMinutes}}</td><td>{{.State}}</td></tr>
+{{end}}</table>
+{{else}}<p>No alerts started during the period.</p>
+{{end}}<p><small>Report {{.ID}}, generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}</small></p>
+</body>
+</html>
+`))
+
+func renderMarkdown(r Report) (string, error) {
+	var b bytes.Buffer
+	if err := markdownTemplate.Execute(&b, r); err != nil {
+		return "", fmt.Errorf("failed to render report: %v", err)
+	}
+	return b.String(), nil
+}
+
+func renderHTML(r Report) (string, error) {
+	var b bytes.Buffer
+	if err := htmlTemplate.Execute(&b, r); err != nil {
+		return "", fmt.Errorf("failed to render report: %v", err)
+	}
+	return b.String(), nil
+}
+
+func title(r Report) string {
+	period := "Daily"
+	if r.Period == PeriodWeekly {
+		period = "Weekly"
+	}
+	return "HealthNet " + period + " Network Digest"
+}
+
+func pct(v *float64) string {
+	if v == nil {
+		return "no data"
+	}
+	return fmt.Sprintf("%.2f%%", *v)
+}
+
+// cell escapes a value for a Markdown table cell
+func cell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+func dateRange(r Report) string {
+	const layout = "Mon 2 Jan 2006 15:04"
+	return fmt.Sprintf("%s to %s", r.From.Format(layout), r.To.Format(layout+" MST"))
+}
+
+func subject(r Report) string {
+	return fmt.Sprintf("%s, %s", title(r), r.To.Format("2 Jan 2006"))
+}
+
+// smsText is a one-message digest pointing to the full report
+func smsText(r Report) string {
+	text := fmt.Sprintf("HealthNet %s digest %s: uptime %s, %d alerts (%d critical)",
+		r.Period, r.To.Format("2 Jan"), pct(r.Network.UptimePct),
+		r.Network.Alerts, r.Network.CriticalAlerts)
+	var risky []string
+	for _, c := range r.Clinics {
+		if c.Forecast.Risk == RiskHigh {
+			risky = append(risky, c.ClinicID)
+		}
+	}
+	if len(risky) > 0 {
+		text += ", high risk at " + strings.Join(risky, ", ")
+	}
+	return text + ". Report " + r.ID
+}
@@ -0,0 +1,250 @@
+// Package report builds scheduled network health digests from the stored
+// metrics, alerts and emergency shares, renders them as Markdown and HTML,
+// and sends them over the notification channels.
+package report
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/notify"
+)
+
+var ErrNotFound = errors.New("report not found")
+
+// Report periods
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+// Forecast risk levels
+const (
+	RiskUnknown  = "unknown" // Not enough history to forecast
+	RiskLow      = "low"
+	RiskElevated = "elevated" // A warning threshold is forecast to be crossed
+	RiskHigh     = "high"     // A critical threshold is forecast to be crossed
+)
+
+// Config mirrors the reports section of config.yaml
+type Config struct {
+	// Ask the LLM for an executive summary of each report
+	Summary bool `yaml:"summary"`
+	// IANA zone the schedules' times are in, e.g. Africa/Nairobi; defaults
+	// to the server's local time
+	Timezone  string     `yaml:"timezone"`
+	Schedules []Schedule `yaml:"schedules"`
+}
+
+// Schedule is one recurring digest. A daily digest covers the day before
+// At; a weekly one the week before At on Weekday.
+type Schedule struct {
+	Name       string             `yaml:"name"`
+	Period     string             `yaml:"period"`  // daily or weekly
+	At         string             `yaml:"at"`      // HH:MM; defaults to 07:00
+	Weekday    string             `yaml:"weekday"` // Weekly only; defaults to monday
+	Clinics    []string           `yaml:"clinics"` // Clinic ID globs; empty means every clinic
+	Channels   []string           `yaml:"channels"`
+	Recipients []notify.Recipient `yaml:"recipients"`
+}
+
+// Validate checks the schedules
+func (c Config) Validate() error {
+	if _, err := c.location(); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for i, s := range c.Schedules {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("schedule %d: %v", i+1, err)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("schedule %d: duplicate name %q", i+1, s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+func (c Config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", c.Timezone, err)
+	}
+	return loc, nil
+}
+
+// Validate checks the schedule's period, time and clinic patterns
+func (s Schedule) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.Period != PeriodDaily && s.Period != PeriodWeekly {
+		return fmt.Errorf("period must be daily or weekly")
+	}
+	if _, _, err := s.clock(); err != nil {
+		return err
+	}
+	if _, err := s.weekday(); err != nil {
+		return err
+	}
+	for _, pattern := range s.Clinics {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid clinic pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+func (s Schedule) clock() (hour, minute int, err error) {
+	at := s.At
+	if at == "" {
+		at = "07:00"
+	}
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return 0, 0, fmt.Errorf("at must be HH:MM (got %q)", s.At)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+func (s Schedule) weekday() (time.Weekday, error) {
+	if s.Weekday == "" {
+		return time.Monday, nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s.Weekday, d.String()) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", s.Weekday)
+}
+
+// Due returns the most recent scheduled time at or before now, which is
+// the end of the period the latest digest covers
+func (s Schedule) Due(now time.Time, loc *time.Location) time.Time {
+	hour, minute, _ := s.clock()
+	now = now.In(loc)
+	due := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc)
+	if due.After(now) {
+		due = due.AddDate(0, 0, -1)
+	}
+	if s.Period == PeriodWeekly {
+		weekday, _ := s.weekday()
+		for due.Weekday() != weekday {
+			due = due.AddDate(0, 0, -1)
+		}
+	}
+	return due
+}
+
+// Start returns the start of the period ending at end
+func (s Schedule) Start(end time.Time) time.Time {
+	if s.Period == PeriodWeekly {
+		return end.AddDate(0, 0, -7)
+	}
+	return end.AddDate(0, 0, -1)
+}
+
+// Matches reports whether the schedule covers a clinic
+func (s Schedule) Matches(clinicID string) bool {
+	if len(s.Clinics) == 0 {
+		return true
+	}
+	for _, pattern := range s.Clinics {
+		if ok, _ := path.Match(pattern, clinicID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Report is one network health digest
+type Report struct {
+	ID          string    `json:"id"`
+	Schedule    string    `json:"schedule,omitempty"`
+	Period      string    `json:"period"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	GeneratedAt time.Time `json:"generated_at"`
+
+	Summary      string `json:"summary,omitempty"` // Written by the LLM
+	SummaryModel string `json:"summary_model,omitempty"`
+	SummaryError string `json:"summary_error,omitempty"` // Why there is no summary
+
+	Network   NetworkSummary  `json:"network"`
+	Clinics   []ClinicSummary `json:"clinics"`    // Least uptime first
+	TopAlerts []AlertSummary  `json:"top_alerts"` // Critical first, then longest
+
+	// Rendered forms, stored alongside the report
+	Markdown string `json:"-"`
+	HTML     string `json:"-"`
+}
+
+// NetworkSummary totals the report over every clinic
+type NetworkSummary struct {
+	Clinics        int      `json:"clinics"`
+	UptimePct      *float64 `json:"uptime_pct"` // Over every sample; nil without data
+	Alerts         int      `json:"alerts"`
+	CriticalAlerts int      `json:"critical_alerts"`
+	Shares         int      `json:"emergency_shares"`
+	SharesGranted  int      `json:"emergency_shares_granted"`
+	AtRisk         int      `json:"clinics_at_risk"` // Elevated or high forecast risk
+}
+
+// ClinicSummary is one clinic's figures for the period
+type ClinicSummary struct {
+	ClinicID       string      `json:"clinic_id"`
+	Name           string      `json:"name,omitempty"`
+	UptimePct      *float64    `json:"uptime_pct"` // nil without data
+	DowntimeHours  float64     `json:"downtime_hours"`
+	NoDataHours    float64     `json:"no_data_hours"`
+	Samples        int         `json:"samples"`
+	Latency        Percentiles `json:"latency_ms"`
+	Alerts         int         `json:"alerts"`
+	CriticalAlerts int         `json:"critical_alerts"`
+	Shares         int         `json:"emergency_shares"` // Requests to or from the clinic
+	SharesGranted  int         `json:"emergency_shares_granted"`
+	Forecast       Forecast    `json:"forecast"`
+}
+
+// Percentiles summarises a metric's distribution
+type Percentiles struct {
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	Samples int     `json:"samples"`
+	// Bucket size of the rollups the figures were computed from, once the
+	// period reaches back past raw retention. Averaged buckets smooth out
+	// spikes, so the tail percentiles are then approximate and understated.
+	// Empty when computed from raw samples.
+	Resolution string `json:"resolution,omitempty"`
+}
+
+// Forecast is the risk of a threshold being crossed in the hour after the
+// period
+type Forecast struct {
+	Risk      string  `json:"risk"`
+	Latency   float64 `json:"latency_ms,omitempty"`
+	Bandwidth float64 `json:"bandwidth_mbs,omitempty"`
+	// Upper bounds of the 95% prediction intervals
+	LatencyUpper   float64 `json:"latency_upper_ms,omitempty"`
+	BandwidthUpper float64 `json:"bandwidth_upper_mbs,omitempty"`
+}
+
+// AlertSummary is an alert that started during the period
+type AlertSummary struct {
+	ID              string    `json:"id"`
+	ClinicID        string    `json:"clinic_id"`
+	Severity        string    `json:"severity"`
+	State           string    `json:"state"`
+	Description     string    `json:"description"`
+	StartsAt        time.Time `json:"starts_at"`
+	DurationMinutes float64   `json:"duration_minutes"`
+}
@@ -0,0 +1,292 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/alerts"
+	"github.com/Evarest-ke/healthnetai/analyzer"
+	"github.com/Evarest-ke/healthnetai/models"
+	"github.com/Evarest-ke/healthnetai/notify"
+	"github.com/Evarest-ke/healthnetai/store"
+)
+
+// fakeDirectory names clinics and serves emergency shares from memory
+type fakeDirectory struct {
+	shares []models.EmergencyShare
+}
+
+func (d fakeDirectory) Clinic(id string) (models.Clinic, bool) {
+	if id == "jootrh" {
+		return models.Clinic{ID: id, Name: "Jaramogi Oginga Odinga Teaching & Referral Hospital"}, true
+	}
+	return models.Clinic{}, false
+}
+
+func (d fakeDirectory) EmergencyShares(clinicID string, since time.Time) []models.EmergencyShare {
+	var list []models.EmergencyShare
+	for _, s := range d.shares {
+		if !s.Timestamp.Before(since) && (s.SourceID == clinicID || s.TargetID == clinicID) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// fakeSender records reports instead of delivering them
+type fakeSender struct {
+	mu       sync.Mutex
+	messages map[string]notify.Message // By channel type
+	refs     []string
+}
+
+func (s *fakeSender) SendMessage(ref, state string, channels []string, recipients []notify.Recipient,
+	render func(channelType string) notify.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs = append(s.refs, ref)
+	for _, kind := range []string{notify.TypeSMTP, notify.TypeSMS} {
+		s.messages[kind] = render(kind)
+	}
+	return nil
+}
+
+func (s *fakeSender) HasChannel(name string) bool { return name == "email" }
+
+// newTestGenerator stores two hours of samples ending at the returned
+// time: jootrh is unreachable for the second half hour, kombewa never
+func newTestGenerator(t *testing.T, llm analyzer.LLMClient, config Config) (*Generator, *alerts.Manager, *fakeSender, time.Time) {
+	t.Helper()
+	s, err := store.Open(store.Config{Path: filepath.Join(t.TempDir(), "metrics.db"), BatchSize: 1000, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	end := time.Now().Truncate(time.Hour)
+	start := end.Add(-2 * time.Hour)
+	var samples []models.Metrics
+	for i := 0; i < 120; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		down := i >= 30 && i < 60
+		samples = append(samples,
+			models.Metrics{ClinicID: "jootrh", Timestamp: ts, Latency: float64(20 + i%10), Unreachable: down},
+			models.Metrics{ClinicID: "kombewa", Timestamp: ts, Latency: 60})
+	}
+	if err := s.Write(context.Background(), samples); err != nil {
+		t.Fatal(err)
+	}
+
+	am, err := alerts.NewManager(s.DB(), alerts.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory := fakeDirectory{shares: []models.EmergencyShare{
+		{SourceID: "kombewa", TargetID: "jootrh", CanShare: true, Timestamp: start.Add(40 * time.Minute)},
+		{SourceID: "kombewa", TargetID: "ahero", CanShare: false, Timestamp: start.Add(50 * time.Minute)},
+		{SourceID: "kombewa", TargetID: "jootrh", CanShare: true, Timestamp: start.Add(-time.Hour)}, // Before the period
+	}}
+	sender := &fakeSender{messages: make(map[string]notify.Message)}
+	g, err := NewGenerator(s.DB(), s, am, analyzer.NewAnalyzer(llm, 0.8, 0), directory, sender, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, am, sender, end
+}
+
+func TestScheduleDue(t *testing.T) {
+	loc := time.UTC
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, loc) }
+	tests := []struct {
+		name     string
+		schedule Schedule
+		now      time.Time
+		want     time.Time
+	}{
+		{"daily after", Schedule{Period: PeriodDaily}, at(14, 9, 0), at(14, 7, 0)},
+		{"daily at", Schedule{Period: PeriodDaily}, at(14, 7, 0), at(14, 7, 0)},
+		{"daily before", Schedule{Period: PeriodDaily, At: "18:30"}, at(14, 9, 0), at(13, 18, 30)},
+		// 12 October 2026 is a Monday
+		{"weekly same day", Schedule{Period: PeriodWeekly}, at(12, 8, 0), at(12, 7, 0)},
+		{"weekly later", Schedule{Period: PeriodWeekly}, at(17, 8, 0), at(12, 7, 0)},
+		{"weekly before", Schedule{Period: PeriodWeekly, Weekday: "Friday"}, at(15, 8, 0), at(9, 7, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Due(tt.now, loc); !got.Equal(tt.want) {
+				t.Errorf("Due(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+
+	weekly := Schedule{Period: PeriodWeekly}
+	if got := weekly.Start(at(12, 7, 0)); !got.Equal(at(5, 7, 0)) {
+		t.Errorf("Start = %v, want a week earlier", got)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"no name", Config{Schedules: []Schedule{{Period: PeriodDaily}}}, "name is required"},
+		{"bad period", Config{Schedules: []Schedule{{Name: "d", Period: "hourly"}}}, "period must be"},
+		{"bad time", Config{Schedules: []Schedule{{Name: "d", Period: PeriodDaily, At: "7am"}}}, "HH:MM"},
+		{"bad weekday", Config{Schedules: []Schedule{{Name: "w", Period: PeriodWeekly, Weekday: "funday"}}}, "unknown weekday"},
+		{"bad pattern", Config{Schedules: []Schedule{{Name: "d", Period: PeriodDaily, Clinics: []string{"["}}}}, "invalid clinic pattern"},
+		{"duplicate", Config{Schedules: []Schedule{{Name: "d", Period: PeriodDaily}, {Name: "d", Period: PeriodWeekly}}}, "duplicate name"},
+		{"bad timezone", Config{Timezone: "Mars/Olympus"}, "invalid timezone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+	llm := &analyzer.FakeLLM{Reply: func(req analyzer.LLMRequest) (string, error) {
+		return "jootrh lost connectivity for half an hour.", nil
+	}}
+	g, am, _, end := newTestGenerator(t, llm, Config{Summary: true})
+	start := end.Add(-2 * time.Hour)
+
+	am.Sync(ctx, "jootrh", nil, []models.Alert{
+		{Severity: "warning", Rule: "latency-warning", Description: "latency high"},
+	}, start.Add(10*time.Minute))
+	am.Sync(ctx, "kombewa", nil, []models.Alert{
+		{Severity: "critical", Rule: "uplink-down", Description: "uplink down"},
+	}, start.Add(20*time.Minute))
+	am.Sync(ctx, "ahero", nil, []models.Alert{
+		{Severity: "critical", Rule: "uplink-down", Description: "uplink down"},
+	}, start.Add(20*time.Minute))
+
+	r, err := g.Generate(ctx, Schedule{Name: "daily", Period: PeriodDaily, Clinics: []string{"j*", "k*"}}, start, end, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Clinics) != 2 || r.Clinics[0].ClinicID != "jootrh" || r.Clinics[1].ClinicID != "kombewa" {
+		t.Fatalf("Expected jootrh (least uptime) then kombewa, got %+v", r.Clinics)
+	}
+	jootrh, kombewa := r.Clinics[0], r.Clinics[1]
+	if jootrh.UptimePct == nil || *jootrh.UptimePct != 75 || jootrh.DowntimeHours != 0.5 || jootrh.Samples != 120 {
+		t.Errorf("Unexpected jootrh uptime %+v", jootrh)
+	}
+	if jootrh.Name == "" || kombewa.Name != "" {
+		t.Errorf("Expected only jootrh to be named, got %q and %q", jootrh.Name, kombewa.Name)
+	}
+	if jootrh.Latency.Samples != 90 || jootrh.Latency.P50 != 24 || jootrh.Latency.P99 != 29 || jootrh.Latency.Resolution != "" {
+		t.Errorf("Unexpected jootrh latency %+v", jootrh.Latency)
+	}
+	if jootrh.Alerts != 1 || kombewa.CriticalAlerts != 1 {
+		t.Errorf("Unexpected alert counts %d and %d", jootrh.Alerts, kombewa.CriticalAlerts)
+	}
+	if jootrh.Shares != 1 || kombewa.Shares != 2 || kombewa.SharesGranted != 1 {
+		t.Errorf("Unexpected share counts %+v %+v", jootrh, kombewa)
+	}
+	if jootrh.Forecast.Risk != RiskLow || jootrh.Forecast.Latency == 0 {
+		t.Errorf("Unexpected forecast %+v", jootrh.Forecast)
+	}
+
+	n := r.Network
+	if n.Clinics != 2 || n.UptimePct == nil || *n.UptimePct != 87.5 || n.Alerts != 2 || n.CriticalAlerts != 1 ||
+		n.Shares != 2 || n.SharesGranted != 1 {
+		t.Errorf("Unexpected network summary %+v", n)
+	}
+	if len(r.TopAlerts) != 2 || r.TopAlerts[0].Severity != "critical" || r.TopAlerts[0].ClinicID != "kombewa" {
+		t.Errorf("Expected the critical kombewa alert first, got %+v", r.TopAlerts)
+	}
+	if r.Summary == "" || r.SummaryModel != analyzer.ProviderFake {
+		t.Errorf("Expected a summary, got %q (%s)", r.Summary, r.SummaryError)
+	}
+
+	for _, want := range []string{"# HealthNet Daily Network Digest", "| jootrh (Jaramogi", "| 75.00% | 0.5 |", "## Top alerts", "lost connectivity"} {
+		if !strings.Contains(r.Markdown, want) {
+			t.Errorf("Markdown missing %q:\n%s", want, r.Markdown)
+		}
+	}
+	if !strings.Contains(r.HTML, "Jaramogi Oginga Odinga Teaching &amp; Referral Hospital") {
+		t.Errorf("Expected escaped clinic name in HTML:\n%s", r.HTML)
+	}
+
+	// A week reaches past raw retention, so latency comes from rollups
+	weekly, err := g.Generate(ctx, Schedule{Name: "weekly", Period: PeriodWeekly}, end.Add(-7*24*time.Hour), end, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weekly.Clinics[0].Latency.Resolution != "1m0s" || !strings.Contains(weekly.Markdown, "(approx., 1m0s averages)") {
+		t.Errorf("Expected weekly latency to be labelled approximate, got %+v", weekly.Clinics[0].Latency)
+	}
+
+	stored, err := g.Get(ctx, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Markdown != r.Markdown || stored.HTML != r.HTML || len(stored.Clinics) != 2 || !stored.To.Equal(end) {
+		t.Errorf("Stored report differs: %+v", stored)
+	}
+	if _, err := g.Get(ctx, "rpt_missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGenerateWithoutLLM(t *testing.T) {
+	g, _, _, end := newTestGenerator(t, nil, Config{Summary: true})
+	r, err := g.Generate(context.Background(), Schedule{Name: "daily", Period: PeriodDaily}, end.Add(-time.Hour), end, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Summary != "" || r.SummaryError != "" {
+		t.Errorf("Expected no summary and no error without a model, got %q %q", r.Summary, r.SummaryError)
+	}
+	if !strings.Contains(r.Markdown, "No alerts started during the period.") {
+		t.Errorf("Expected an empty alert section:\n%s", r.Markdown)
+	}
+}
+
+func TestTickSendsOncePerPeriod(t *testing.T) {
+	ctx := context.Background()
+	schedule := Schedule{Name: "daily", Period: PeriodDaily, Channels: []string{"email"},
+		Recipients: []notify.Recipient{{Name: "County ICT", Email: "ict@kisumu.example"}}}
+	g, _, sender, end := newTestGenerator(t, nil, Config{Timezone: "UTC", Schedules: []Schedule{schedule}})
+
+	for i := 0; i < 2; i++ {
+		if err := g.Tick(ctx, end); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sender.refs) != 1 {
+		t.Fatalf("Expected one report to be sent, got %v", sender.refs)
+	}
+
+	list, err := g.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != sender.refs[0] || !list[0].To.Equal(schedule.Due(end, time.UTC)) {
+		t.Errorf("Unexpected reports %+v", list)
+	}
+	email, sms := sender.messages[notify.TypeSMTP], sender.messages[notify.TypeSMS]
+	if !strings.HasPrefix(email.Subject, "HealthNet Daily Network Digest") || email.HTML == "" || email.Report == nil {
+		t.Errorf("Unexpected email %+v", email)
+	}
+	if !strings.HasPrefix(sms.Body, "HealthNet daily digest") || !strings.HasSuffix(sms.Body, list[0].ID) {
+		t.Errorf("Unexpected SMS %q", sms.Body)
+	}
+
+	if _, err := NewGenerator(g.db, g.metrics, g.alerts, nil, nil, sender,
+		Config{Schedules: []Schedule{{Name: "d", Period: PeriodDaily, Channels: []string{"pager"}}}}); err == nil {
+		t.Error("Expected an error for an unknown channel")
+	}
+}
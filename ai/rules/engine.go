@@ -0,0 +1,256 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Engine evaluates a rule set against incoming samples and tracks, per rule
+// and clinic, how long each condition has held
+type Engine struct {
+	path string
+
+	mu       sync.RWMutex
+	rules    []Rule
+	modTime  time.Time
+	loadedAt time.Time
+	loadErr  error
+	states   map[stateKey]*ruleState
+}
+
+type stateKey struct {
+	rule     string
+	clinicID string
+}
+
+// ruleState tracks a rule whose condition currently holds for a clinic
+type ruleState struct {
+	since  time.Time
+	firing bool
+	alert  models.Alert
+}
+
+// Status describes the loaded rule set
+type Status struct {
+	Path     string    `json:"path"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Error    string    `json:"error,omitempty"` // Last reload error; the previous rules stay active
+	Rules    []Rule    `json:"rules"`
+}
+
+// NewEngine loads the rules from a config file. Unlike later reloads, an
+// invalid file here is an error. A missing file starts an empty rule set,
+// and Watch loads the file once it appears.
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{path: path, states: make(map[stateKey]*ruleState)}
+	if err := e.reload(); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		log.Printf("No alert rules file at %s, starting with no rules", path)
+	}
+	return e, nil
+}
+
+// NewEngineFromRules builds an engine over a fixed rule set
+func NewEngineFromRules(rules []Rule) (*Engine, error) {
+	compiled, err := Compile(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{rules: compiled, loadedAt: time.Now(), states: make(map[stateKey]*ruleState)}, nil
+}
+
+func (e *Engine) reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	rules, err := LoadFile(e.path)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.modTime = info.ModTime()
+	if err != nil {
+		e.loadErr = err
+		return err
+	}
+
+	// Keep the pending and firing state of rules that survived the reload
+	names := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		names[r.Name] = true
+	}
+	for key := range e.states {
+		if !names[key.rule] {
+			delete(e.states, key)
+		}
+	}
+
+	e.rules = rules
+	e.loadedAt = time.Now()
+	e.loadErr = nil
+	return nil
+}
+
+// Watch polls the config file's modification time and reloads the rules
+// when it changes. Invalid files are logged and the previous rules kept.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(e.path)
+			if err != nil {
+				continue
+			}
+			e.mu.RLock()
+			changed := !info.ModTime().Equal(e.modTime)
+			e.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := e.reload(); err != nil {
+				log.Printf("Keeping previous alert rules: %v", err)
+				continue
+			}
+			log.Printf("Reloaded %d alert rules from %s", len(e.Rules()), e.path)
+		}
+	}
+}
+
+// Rules returns the active rule set
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Rule(nil), e.rules...)
+}
+
+// Status returns the active rules and the outcome of the last reload
+func (e *Engine) Status() Status {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	status := Status{
+		Path:     e.path,
+		LoadedAt: e.loadedAt,
+		Rules:    append([]Rule{}, e.rules...),
+	}
+	if e.loadErr != nil {
+		status.Error = e.loadErr.Error()
+	}
+	return status
+}
+
+// Evaluate checks every rule that applies to the sample's clinic and
+// returns the alerts that started firing with this sample. A rule whose
+// expression cannot be evaluated, for example latency while all probes are
+// unreachable, keeps its current state.
+func (e *Engine) Evaluate(m models.Metrics) []models.Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := m.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var started []models.Alert
+	for i := range e.rules {
+		r := &e.rules[i]
+		if !r.Matches(m.ClinicID) {
+			continue
+		}
+		value, ok := r.expr.Eval(m)
+		if !ok {
+			continue
+		}
+
+		key := stateKey{rule: r.Name, clinicID: m.ClinicID}
+		if !comparisons[r.Op](value, r.Threshold) {
+			delete(e.states, key)
+			continue
+		}
+
+		state, exists := e.states[key]
+		if !exists {
+			state = &ruleState{since: now}
+			e.states[key] = state
+		}
+		state.alert = r.alert(m.ClinicID, value, now.Sub(state.since))
+		if !state.firing && now.Sub(state.since) >= r.For {
+			state.firing = true
+			started = append(started, state.alert)
+		}
+	}
+	return started
+}
+
+// Firing returns the alerts currently firing for a clinic
+func (e *Engine) Firing(clinicID string) []models.Alert {
+	return e.alerts(clinicID, true)
+}
+
+// Pending returns the alerts whose condition holds for a clinic but has
+// not yet lasted for the rule's for duration
+func (e *Engine) Pending(clinicID string) []models.Alert {
+	return e.alerts(clinicID, false)
+}
+
+func (e *Engine) alerts(clinicID string, firing bool) []models.Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var keys []stateKey
+	for key, state := range e.states {
+		if state.firing == firing && key.clinicID == clinicID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].rule < keys[j].rule })
+
+	alerts := make([]models.Alert, 0, len(keys))
+	for _, key := range keys {
+		alerts = append(alerts, e.states[key].alert)
+	}
+	return alerts
+}
+
+// alert builds the alert for a rule whose condition has held for held
+func (r *Rule) alert(clinicID string, value float64, held time.Duration) models.Alert {
+	description := r.Description
+	if description == "" {
+		description = r.Name
+	}
+	description = fmt.Sprintf("%s: %s = %.2f %s %g", description, r.Expr, value, r.Op, r.Threshold)
+	if r.For > 0 {
+		description += fmt.Sprintf(" for %s", held.Round(time.Second))
+	}
+
+	return models.Alert{
+		Severity:    r.Severity,
+		Description: description,
+		Recommended: r.Recommended,
+		Metric:      r.Expr,
+		Metrics:     r.expr.Metrics(),
+		Value:       value,
+		Expected:    r.Threshold,
+		Detector:    "rule",
+		Rule:        r.Name,
+		Labels:      r.Labels,
+		ClinicID:    clinicID,
+	}
+}
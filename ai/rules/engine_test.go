@@ -0,0 +1,240 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+var start = time.Date(2025, 3, 31, 8, 0, 0, 0, time.UTC)
+
+func sample(clinic string, offset time.Duration, latency float64) models.Metrics {
+	return models.Metrics{ClinicID: clinic, Timestamp: start.Add(offset), Latency: latency}
+}
+
+func TestEngineForDuration(t *testing.T) {
+	e, err := NewEngineFromRules([]Rule{{
+		Name: "slow", Expr: "latency", Op: ">", Threshold: 200, For: time.Minute,
+		Severity: "critical", Labels: map[string]string{"team": "network"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		offset  time.Duration
+		latency float64
+		started bool
+		firing  int
+	}{
+		{0, 250, false, 0}, // Pending
+		{30 * time.Second, 260, false, 0},
+		{60 * time.Second, 270, true, 1},
+		{90 * time.Second, 280, false, 1}, // Already firing
+		{120 * time.Second, 100, false, 0},
+		{150 * time.Second, 300, false, 0}, // The clock restarts
+	}
+	for _, step := range steps {
+		started := e.Evaluate(sample("kisumu-east", step.offset, step.latency))
+		if (len(started) == 1) != step.started {
+			t.Errorf("At %v: started = %v, want %v", step.offset, started, step.started)
+		}
+		if firing := e.Firing("kisumu-east"); len(firing) != step.firing {
+			t.Errorf("At %v: %d firing, want %d", step.offset, len(firing), step.firing)
+		}
+		pending := step.latency > 200 && step.firing == 0
+		if got := len(e.Pending("kisumu-east")) == 1; got != pending {
+			t.Errorf("At %v: pending = %v, want %v", step.offset, got, pending)
+		}
+	}
+
+	e.Evaluate(sample("kisumu-east", 200*time.Second, 300))
+	e.Evaluate(sample("kisumu-east", 215*time.Second, 300))
+	firing := e.Firing("kisumu-east")
+	if len(firing) != 1 {
+		t.Fatalf("Expected one firing alert, got %v", firing)
+	}
+	a := firing[0]
+	if a.Rule != "slow" || a.Severity != "critical" || a.Value != 300 || a.Expected != 200 ||
+		a.ClinicID != "kisumu-east" || a.Labels["team"] != "network" || len(a.Metrics) != 1 || a.Metrics[0] != "latency" {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+	if !strings.Contains(a.Description, "latency = 300.00 > 200 for 1m5s") {
+		t.Errorf("Unexpected description %q", a.Description)
+	}
+
+	// Unreachable samples carry no latency and leave the state alone
+	e.Evaluate(models.Metrics{ClinicID: "kisumu-east", Timestamp: start.Add(230 * time.Second), Unreachable: true})
+	if len(e.Firing("kisumu-east")) != 1 {
+		t.Error("Expected an unevaluable sample to keep the rule firing")
+	}
+}
+
+func TestEngineClinicSelector(t *testing.T) {
+	e, err := NewEngineFromRules([]Rule{{
+		Name: "kisumu-only", Expr: "latency", Op: ">=", Threshold: 100,
+		Severity: "warning", Clinics: []string{"kisumu-*"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := e.Evaluate(sample("kisumu-west", 0, 100)); len(got) != 1 {
+		t.Errorf("Expected the rule to fire immediately for a matching clinic, got %v", got)
+	}
+	if got := e.Evaluate(sample("siaya", 0, 500)); len(got) != 0 {
+		t.Errorf("Expected no alerts for a clinic outside the selector, got %v", got)
+	}
+	if len(e.Firing("siaya")) != 0 || len(e.Firing("kisumu-west")) != 1 {
+		t.Error("Firing alerts should be tracked per clinic")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile([]Rule{
+		{Name: "ok", Expr: "latency", Op: ">", Severity: "warning"},
+		{Name: "typo", Expr: "latncy", Op: ">", Severity: "warning"},
+		{Name: "bad-op", Expr: "latency", Op: "=>", Severity: "warning"},
+		{Name: "bad-severity", Expr: "latency", Op: ">", Severity: "urgent"},
+		{Expr: "latency", Op: ">", Severity: "warning"},
+		{Name: "ok", Expr: "jitter", Op: ">", Severity: "info"},
+		{Name: "bad-clinic", Expr: "latency", Op: ">", Severity: "info", Clinics: []string{"[kisumu"}},
+	})
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{
+		`rule 2 (typo): expr: unknown metric "latncy" at position 1`,
+		`rule 3 (bad-op): op must be one of`,
+		`rule 4 (bad-severity): severity must be info, warning or critical (got "urgent")`,
+		`rule 5 (): name is required`,
+		`rule 6 (ok): duplicate name`,
+		`rule 7 (bad-clinic): clinics: invalid pattern "[kisumu"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error missing %q:\n%v", want, err)
+		}
+	}
+}
+
+const rulesYAML = `
+collector:
+  clinic_id: local
+rules:
+  - name: slow
+    expr: latency
+    op: ">"
+    threshold: %THRESHOLD%
+    for: 30s
+    severity: warning
+    recommended: Check routing
+`
+
+func writeRules(t *testing.T, path, threshold string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Replace(rulesYAML, "%THRESHOLD%", threshold, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEngineHotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeRules(t, path, "200", time.Now().Add(-time.Hour))
+
+	e, err := NewEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := e.Rules()
+	if len(rules) != 1 || rules[0].Threshold != 200 || rules[0].For != 30*time.Second {
+		t.Fatalf("Unexpected rules: %+v", rules)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Watch(ctx, 10*time.Millisecond)
+
+	waitFor := func(cond func(Status) bool) Status {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if s := e.Status(); cond(s) {
+				return s
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Timed out waiting for reload: %+v", e.Status())
+		return Status{}
+	}
+
+	writeRules(t, path, "150", time.Now().Add(-30*time.Minute))
+	waitFor(func(s Status) bool { return len(s.Rules) == 1 && s.Rules[0].Threshold == 150 })
+
+	// A broken edit is reported but the previous rules stay active
+	writeRules(t, path, "high", time.Now())
+	s := waitFor(func(s Status) bool { return s.Error != "" })
+	if len(s.Rules) != 1 || s.Rules[0].Threshold != 150 {
+		t.Errorf("Expected the previous rules to stay active, got %+v", s.Rules)
+	}
+}
+
+func TestEngineWaitsForMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	e, err := NewEngine(path)
+	if err != nil {
+		t.Fatalf("Expected a missing file to start an empty rule set, got %v", err)
+	}
+	if rules := e.Rules(); len(rules) != 0 {
+		t.Fatalf("Expected no rules, got %+v", rules)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Watch(ctx, 10*time.Millisecond)
+
+	writeRules(t, path, "200", time.Now())
+	deadline := time.Now().Add(2 * time.Second)
+	for len(e.Rules()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rules := e.Rules(); len(rules) != 1 || rules[0].Threshold != 200 {
+		t.Errorf("Expected the rules to load once the file appeared, got %+v", rules)
+	}
+}
+
+func TestNewEngineInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeRules(t, path, "[1, 2]", time.Now())
+	if _, err := NewEngine(path); err == nil {
+		t.Error("Expected an error for an invalid rules file")
+	}
+}
+
+func TestRepoConfigRules(t *testing.T) {
+	rules, err := LoadFile("../config.yaml")
+	if err != nil {
+		t.Fatalf("config.yaml rules are invalid: %v", err)
+	}
+	if len(rules) == 0 {
+		t.Error("Expected config.yaml to ship default rules")
+	}
+}
+
+func TestRuleJSON(t *testing.T) {
+	data, err := json.Marshal(Rule{Name: "slow", Expr: "latency", Op: ">", Threshold: 200, For: 90 * time.Second, Severity: "warning"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); !strings.Contains(got, `"for":"1m30s"`) || !strings.Contains(got, `"expr":"latency"`) {
+		t.Errorf("Unexpected JSON %s", got)
+	}
+}
@@ -0,0 +1,263 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Expr is a compiled arithmetic expression over metric names, such as
+// "(bytes_sent_rate + bytes_recv_rate) * 8 / 1e6"
+type Expr struct {
+	source  string
+	root    node
+	metrics []string
+}
+
+// node is one term of a compiled expression. eval reports false when a
+// metric is unavailable or the expression divides by zero.
+type node interface {
+	eval(m models.Metrics) (float64, bool)
+}
+
+type number float64
+
+func (n number) eval(models.Metrics) (float64, bool) { return float64(n), true }
+
+type metric string
+
+func (name metric) eval(m models.Metrics) (float64, bool) { return m.Value(string(name)) }
+
+type negate struct{ operand node }
+
+func (n negate) eval(m models.Metrics) (float64, bool) {
+	v, ok := n.operand.eval(m)
+	return -v, ok
+}
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (b binary) eval(m models.Metrics) (float64, bool) {
+	l, ok := b.left.eval(m)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.right.eval(m)
+	if !ok {
+		return 0, false
+	}
+
+	switch b.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	default:
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+}
+
+// ParseExpr compiles an expression. Supported are numbers, metric names
+// from models.MetricNames, + - * /, unary minus and parentheses.
+func ParseExpr(source string) (*Expr, error) {
+	p := &parser{src: source}
+	p.next()
+
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.unexpected()
+	}
+	return &Expr{source: source, root: root, metrics: p.metrics}, nil
+}
+
+// Eval evaluates the expression against a sample
+func (e *Expr) Eval(m models.Metrics) (float64, bool) {
+	return e.root.eval(m)
+}
+
+// Metrics returns the metric names the expression references
+func (e *Expr) Metrics() []string {
+	return e.metrics
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // 1-based column
+}
+
+type parser struct {
+	src     string
+	pos     int
+	tok     token
+	err     error
+	metrics []string
+}
+
+// next scans the following token into p.tok
+func (p *parser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start + 1}
+		return
+	}
+
+	c := rune(p.src[p.pos])
+	switch {
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			isExponentSign := (c == '+' || c == '-') && p.pos > start && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')
+			if !(c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || isExponentSign) {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.src[start:p.pos], pos: start + 1}
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.src) {
+			c := rune(p.src[p.pos])
+			if !(unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_') {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start + 1}
+	default:
+		p.pos++
+		p.tok = token{kind: tokOp, text: p.src[start:p.pos], pos: start + 1}
+	}
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at position %d", p.tok.text, p.tok.pos)
+}
+
+// expr := term (('+' | '-') term)*
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := p.tok.text[0]
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term := unary (('*' | '/') unary)*
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/") {
+		op := p.tok.text[0]
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// unary := '-' unary | primary
+func (p *parser) unary() (node, error) {
+	if p.tok.kind == tokOp && p.tok.text == "-" {
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negate{operand}, nil
+	}
+	return p.primary()
+}
+
+// primary := number | metric | '(' expr ')'
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokNumber:
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		p.next()
+		return number(v), nil
+	case tok.kind == tokIdent:
+		if !models.IsMetricName(tok.text) {
+			return nil, fmt.Errorf("unknown metric %q at position %d (known: %s)",
+				tok.text, tok.pos, strings.Join(models.MetricNames, ", "))
+		}
+		p.metrics = appendUnique(p.metrics, tok.text)
+		p.next()
+		return metric(tok.text), nil
+	case tok.kind == tokOp && tok.text == "(":
+		p.next()
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokOp || p.tok.text != ")" {
+			if p.tok.kind == tokEOF {
+				return nil, fmt.Errorf("missing ) for ( at position %d", tok.pos)
+			}
+			return nil, p.unexpected()
+		}
+		p.next()
+		return inner, nil
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
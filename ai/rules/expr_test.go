@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func TestParseExpr(t *testing.T) {
+	m := models.Metrics{
+		Latency:       40,
+		BytesSentRate: 1.5e6,
+		BytesRecvRate: 0.5e6,
+		CPUUsage:      50,
+	}
+	m.Network.Jitter = 8
+
+	tests := []struct {
+		expr    string
+		want    float64
+		metrics []string
+	}{
+		{"latency", 40, []string{"latency"}},
+		{"42", 42, nil},
+		{"1e3", 1000, nil},
+		{"2.5e-1", 0.25, nil},
+		{"latency + cpu_usage * 2", 140, []string{"latency", "cpu_usage"}},
+		{"(latency + cpu_usage) * 2", 180, []string{"latency", "cpu_usage"}},
+		{"(bytes_sent_rate + bytes_recv_rate) * 8 / 1e6", 16, []string{"bytes_sent_rate", "bytes_recv_rate"}},
+		{"-latency + 100", 60, []string{"latency"}},
+		{"10 - 4 - 3", 3, nil},
+		{"latency / latency", 1, []string{"latency"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseExpr: %v", err)
+			}
+			got, ok := e.Eval(m)
+			if !ok || got != tt.want {
+				t.Errorf("Eval = %v, %v; want %v", got, ok, tt.want)
+			}
+			if strings.Join(e.Metrics(), ",") != strings.Join(tt.metrics, ",") {
+				t.Errorf("Metrics = %v, want %v", e.Metrics(), tt.metrics)
+			}
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"latncy > 5", `unknown metric "latncy" at position 1`},
+		{"latency >", `unexpected ">" at position 9`},
+		{"latency +", "unexpected end of expression"},
+		{"(latency + 1", "missing ) for ( at position 1"},
+		{"latency 5", `unexpected "5" at position 9`},
+		{"1.2.3", `invalid number "1.2.3" at position 1`},
+		{"", "unexpected end of expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseExpr(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseExpr(%q) error = %v, want %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalUnavailable(t *testing.T) {
+	e, _ := ParseExpr("latency * 2")
+	if _, ok := e.Eval(models.Metrics{Unreachable: true}); ok {
+		t.Error("Expected latency to be unavailable while unreachable")
+	}
+
+	e, _ = ParseExpr("cpu_usage / memory_usage")
+	if _, ok := e.Eval(models.Metrics{CPUUsage: 5}); ok {
+		t.Error("Expected division by zero to be unavailable")
+	}
+}
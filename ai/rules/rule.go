@@ -0,0 +1,136 @@
+// Package rules evaluates declarative alert rules loaded from config.yaml
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Comparison operators
+var comparisons = map[string]func(v, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// Rule is one alert rule. It fires for a clinic once Expr compared against
+// Threshold has held for at least For.
+type Rule struct {
+	Name        string            `yaml:"name" json:"name"`
+	Expr        string            `yaml:"expr" json:"expr"` // Arithmetic over metric names
+	Op          string            `yaml:"op" json:"op"`     // >, >=, <, <=, == or !=
+	Threshold   float64           `yaml:"threshold" json:"threshold"`
+	For         time.Duration     `yaml:"for" json:"-"`
+	Severity    string            `yaml:"severity" json:"severity"` // info, warning or critical
+	Description string            `yaml:"description" json:"description,omitempty"`
+	Recommended string            `yaml:"recommended" json:"recommended"`
+	Labels      map[string]string `yaml:"labels" json:"labels,omitempty"`
+	Clinics     []string          `yaml:"clinics" json:"clinics,omitempty"` // Clinic ID globs; empty matches all
+
+	expr *Expr
+}
+
+// MarshalJSON reports For as a duration string such as "5m0s"
+func (r Rule) MarshalJSON() ([]byte, error) {
+	type plain Rule
+	return json.Marshal(struct {
+		plain
+		For string `json:"for"`
+	}{plain(r), r.For.String()})
+}
+
+// compile validates the rule and parses its expression
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(r.Expr) == "" {
+		return fmt.Errorf("expr is required")
+	}
+	expr, err := ParseExpr(r.Expr)
+	if err != nil {
+		return fmt.Errorf("expr: %v", err)
+	}
+	if _, ok := comparisons[r.Op]; !ok {
+		return fmt.Errorf("op must be one of >, >=, <, <=, ==, != (got %q)", r.Op)
+	}
+	if r.For < 0 {
+		return fmt.Errorf("for must not be negative")
+	}
+	switch r.Severity {
+	case "info", "warning", "critical":
+	default:
+		return fmt.Errorf("severity must be info, warning or critical (got %q)", r.Severity)
+	}
+	for _, pattern := range r.Clinics {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("clinics: invalid pattern %q: %v", pattern, err)
+		}
+	}
+	r.expr = expr
+	return nil
+}
+
+// Matches reports whether the rule applies to a clinic
+func (r *Rule) Matches(clinicID string) bool {
+	if len(r.Clinics) == 0 {
+		return true
+	}
+	for _, pattern := range r.Clinics {
+		if ok, _ := path.Match(pattern, clinicID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile validates a rule set, returning an error that names every
+// invalid rule
+func Compile(rules []Rule) ([]Rule, error) {
+	compiled := make([]Rule, len(rules))
+	seen := make(map[string]bool)
+	var problems []string
+
+	for i, r := range rules {
+		if err := r.compile(); err != nil {
+			problems = append(problems, fmt.Sprintf("rule %d (%s): %v", i+1, r.Name, err))
+			continue
+		}
+		if seen[r.Name] {
+			problems = append(problems, fmt.Sprintf("rule %d (%s): duplicate name", i+1, r.Name))
+			continue
+		}
+		seen[r.Name] = true
+		compiled[i] = r
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid alert rules:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return compiled, nil
+}
+
+// LoadFile reads and validates the rules section of a config file
+func LoadFile(filename string) ([]Rule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filename, err)
+	}
+	return Compile(file.Rules)
+}
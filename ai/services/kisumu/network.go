@@ -1,10 +1,12 @@
 package kisumu
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
@@ -57,8 +59,23 @@ type NetworkService struct {
 	lastUpdate  time.Time
 	mode        string // "dev" or "prod"
 	apiKey      string
+
+	sharesMu sync.RWMutex
+	shares   []models.EmergencyShare // Most recent last
+
+	// Status history, set by TrackStatuses
+	statusDB        *sql.DB
+	statusRetention time.Duration
 }
 
+const (
+	// maxShares bounds the emergency share requests kept in memory
+	maxShares = 500
+	// refreshInterval is how often facilities are refreshed and their
+	// network status observed
+	refreshInterval = 15 * time.Minute
+)
+
 // NewNetworkService creates a new service - pass empty apiKey for dev mode
 func NewNetworkService(apiKey string) *NetworkService {
 	mode := modeProd
@@ -94,7 +111,7 @@ func NewNetworkService(apiKey string) *NetworkService {
 }
 
 func (s *NetworkService) refreshFacilities() {
-	ticker := time.NewTicker(15 * time.Minute)
+	ticker := time.NewTicker(refreshInterval)
 	defer ticker.Stop()
 
 	for {
@@ -175,6 +192,73 @@ func (s *NetworkService) CheckEmergencyBandwidthSharing(sourceID, targetID strin
 	return false, 0
 }
 
+// RequestEmergencyShare checks whether two clinics can share bandwidth and
+// records the request
+func (s *NetworkService) RequestEmergencyShare(sourceID, targetID string) models.EmergencyShare {
+	s.mu.RLock()
+	canShare, factor := s.CheckEmergencyBandwidthSharing(sourceID, targetID)
+	s.mu.RUnlock()
+
+	share := models.EmergencyShare{
+		SourceID:        sourceID,
+		TargetID:        targetID,
+		CanShare:        canShare,
+		BandwidthFactor: factor,
+		Timestamp:       time.Now(),
+	}
+
+	s.sharesMu.Lock()
+	s.shares = append(s.shares, share)
+	if len(s.shares) > maxShares {
+		s.shares = s.shares[len(s.shares)-maxShares:]
+	}
+	s.sharesMu.Unlock()
+	return share
+}
+
+// EmergencyShares returns the share requests made since a time that
+// involve a clinic, or every request when clinicID is empty, oldest first
+func (s *NetworkService) EmergencyShares(clinicID string, since time.Time) []models.EmergencyShare {
+	s.sharesMu.RLock()
+	defer s.sharesMu.RUnlock()
+
+	var list []models.EmergencyShare
+	for _, share := range s.shares {
+		if share.Timestamp.Before(since) || clinicID != "" && share.SourceID != clinicID && share.TargetID != clinicID {
+			continue
+		}
+		list = append(list, share)
+	}
+	return list
+}
+
+// Clinics returns the known clinics ordered by ID
+func (s *NetworkService) Clinics() []models.Clinic {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]models.Clinic, 0, len(s.clinics))
+	for _, clinic := range s.clinics {
+		list = append(list, clinic)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Clinic returns a known clinic by ID
+func (s *NetworkService) Clinic(id string) (models.Clinic, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clinic, ok := s.clinics[id]
+	return clinic, ok
+}
+
+// TerrainFactor estimates how much terrain obstructs the path between two
+// points
+func (s *NetworkService) TerrainFactor(p1, p2 models.GeoPoint) float64 {
+	return s.terrain.CalculateTerrainFactor(p1, p2)
+}
+
 func (s *NetworkService) GetClinicMetrics(clinicID string) (models.Metrics, error) {
 	s.mu.RLock()
 	clinic, ok := s.clinics[clinicID]
@@ -206,8 +290,8 @@ func (s *NetworkService) GetClinicMetrics(clinicID string) (models.Metrics, erro
 		CPUUsage:      float64(50 + time.Now().Second()%20),
 		MemoryUsage:   float64(60 + time.Now().Second()%15),
 		DiskUsage:     float64(40 + time.Now().Second()%10),
-		BytesSent:     uint64(1024 * (100 + time.Now().Second())),
-		BytesReceived: uint64(1024 * (150 + time.Now().Second())),
+		BytesSentRate: float64(1024 * (100 + time.Now().Second())),
+		BytesRecvRate: float64(1024 * (150 + time.Now().Second())),
 		Latency:       float64(20 + time.Now().Second()%10),
 	}
 
@@ -1,7 +1,14 @@
 package kisumu
 
 import (
+	"context"
+	"database/sql"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func TestEmergencyBandwidthSharing(t *testing.T) {
@@ -57,3 +64,56 @@ func TestGetClinicMetrics(t *testing.T) {
 		t.Errorf("Expected latitude -0.1833, got %f", metrics.Coordinates.Latitude)
 	}
 }
+
+func TestStatusHistory(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "statuses.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	service := NewNetworkService("test-key")
+	if err := service.TrackStatuses(db, time.Hour); err != nil {
+		t.Fatalf("Failed to track statuses: %v", err)
+	}
+	start := time.Now()
+
+	record := func(at time.Time, clinics ...models.Clinic) {
+		if err := service.recordStatuses(ctx, clinics, at); err != nil {
+			t.Fatalf("Failed to record statuses: %v", err)
+		}
+	}
+	record(start, models.Clinic{ID: "ahero-sub", NetworkStatus: "online"})
+	record(start.Add(time.Minute),
+		models.Clinic{ID: "ahero-sub", NetworkStatus: "offline"},
+		models.Clinic{ID: "lumumba-hc", NetworkStatus: "online"})
+
+	if got, _ := service.StatusHistory(ctx, start); len(got) != 3 {
+		t.Errorf("Expected 3 observations, got %+v", got)
+	}
+	// The observation holding at since is included
+	got, err := service.StatusHistory(ctx, start.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to read status history: %v", err)
+	}
+	if len(got) != 2 || got[0].ClinicID != "ahero-sub" || got[0].Status != "offline" {
+		t.Errorf("Unexpected observations %+v", got)
+	}
+
+	// Observations past retention and one refresh interval are expired
+	record(start.Add(2*time.Hour), models.Clinic{ID: "kombewa-dist", NetworkStatus: "online"})
+	got, _ = service.StatusHistory(ctx, time.Time{})
+	if len(got) != 1 || got[0].ClinicID != "kombewa-dist" {
+		t.Errorf("Expected expired observations to be deleted, got %+v", got)
+	}
+
+	service.RequestEmergencyShare("ahero-sub", "lumumba-hc")
+	service.RequestEmergencyShare("kombewa-dist", "lumumba-hc")
+	if n := len(service.EmergencyShares("", start)); n != 2 {
+		t.Errorf("Expected every share without a clinic, got %d", n)
+	}
+	if n := len(service.EmergencyShares("ahero-sub", start)); n != 1 {
+		t.Errorf("Expected one share involving ahero-sub, got %d", n)
+	}
+}
@@ -0,0 +1,119 @@
+package kisumu
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// TrackStatuses keeps the clinic status history in db, for retention. Call
+// it before serving requests, then run ObserveStatuses.
+func (s *NetworkService) TrackStatuses(db *sql.DB, retention time.Duration) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS clinic_statuses (
+			clinic_id TEXT NOT NULL,
+			ts INTEGER NOT NULL,
+			status TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_clinic_statuses_ts ON clinic_statuses (ts)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create clinic status table: %v", err)
+		}
+	}
+
+	s.statusDB = db
+	s.statusRetention = retention
+	return nil
+}
+
+// ObserveStatuses records every clinic's network status on the refresh
+// schedule until ctx is cancelled
+func (s *NetworkService) ObserveStatuses(ctx context.Context) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.observeStatusesAt(ctx, time.Now()); err != nil {
+			log.Printf("Failed to record clinic statuses: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// observeStatusesAt records every clinic's current network status
+func (s *NetworkService) observeStatusesAt(ctx context.Context, now time.Time) error {
+	if s.healthsites == nil {
+		return fmt.Errorf("healthsites client not initialized")
+	}
+	clinics, err := s.healthsites.GetKisumuFacilities()
+	if err != nil {
+		return fmt.Errorf("failed to get facilities: %v", err)
+	}
+	return s.recordStatuses(ctx, clinics, now)
+}
+
+// recordStatuses adds an observation of each clinic's network status to
+// the status history and expires those past retention. One refresh interval
+// more is kept, so the status holding at the start of the retained span is
+// still known.
+func (s *NetworkService) recordStatuses(ctx context.Context, clinics []models.Clinic, at time.Time) error {
+	tx, err := s.statusDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, clinic := range clinics {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO clinic_statuses (clinic_id, ts, status) VALUES (?, ?, ?)`,
+			clinic.ID, at.UnixMilli(), clinic.NetworkStatus); err != nil {
+			return fmt.Errorf("failed to record clinic status: %v", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM clinic_statuses WHERE ts < ?`,
+		at.Add(-s.statusRetention-refreshInterval).UnixMilli()); err != nil {
+		return fmt.Errorf("failed to expire clinic statuses: %v", err)
+	}
+	return tx.Commit()
+}
+
+// StatusHistory returns the clinic status observations made since a time,
+// along with each clinic's latest one before it, oldest first. It is empty
+// until TrackStatuses is called.
+func (s *NetworkService) StatusHistory(ctx context.Context, since time.Time) ([]models.ClinicStatus, error) {
+	if s.statusDB == nil {
+		return nil, nil
+	}
+
+	rows, err := s.statusDB.QueryContext(ctx,
+		`SELECT clinic_id, status, ts FROM clinic_statuses WHERE ts >= ?
+		UNION ALL
+		SELECT clinic_id, status, MAX(ts) FROM clinic_statuses WHERE ts < ? GROUP BY clinic_id
+		ORDER BY ts`,
+		since.UnixMilli(), since.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query clinic statuses: %v", err)
+	}
+	defer rows.Close()
+
+	var statuses []models.ClinicStatus
+	for rows.Next() {
+		var status models.ClinicStatus
+		var ts int64
+		if err := rows.Scan(&status.ClinicID, &status.Status, &ts); err != nil {
+			return nil, fmt.Errorf("failed to scan clinic status: %v", err)
+		}
+		status.Timestamp = time.UnixMilli(ts)
+		statuses = append(statuses, status)
+	}
+	return statuses, rows.Err()
+}
@@ -0,0 +1,410 @@
+// store/retention.go
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Tier is a rollup level: samples are summarised into Resolution-sized
+// buckets that are kept for Retention
+type Tier struct {
+	Resolution time.Duration `yaml:"resolution"`
+	Retention  time.Duration `yaml:"retention"`
+}
+
+// RetentionConfig controls how long raw samples and rollups are kept
+type RetentionConfig struct {
+	Raw             time.Duration `yaml:"raw"`
+	Tiers           []Tier        `yaml:"tiers"`
+	CompactInterval time.Duration `yaml:"compact_interval"`
+}
+
+// DefaultRetention keeps raw samples for two days, one-minute rollups for a
+// month and hourly rollups for two years
+var DefaultRetention = RetentionConfig{
+	Raw: 48 * time.Hour,
+	Tiers: []Tier{
+		{Resolution: time.Minute, Retention: 30 * 24 * time.Hour},
+		{Resolution: time.Hour, Retention: 2 * 365 * 24 * time.Hour},
+	},
+	CompactInterval: 5 * time.Minute,
+}
+
+func (r RetentionConfig) withDefaults() RetentionConfig {
+	if r.Raw == 0 {
+		r.Raw = DefaultRetention.Raw
+	}
+	if r.Tiers == nil {
+		r.Tiers = DefaultRetention.Tiers
+	}
+	if r.CompactInterval == 0 {
+		r.CompactInterval = DefaultRetention.CompactInterval
+	}
+	return r
+}
+
+// Validate checks that tiers get coarser and live longer, and that raw
+// samples outlive every tier's bucket so rollups can be built from them
+func (r RetentionConfig) Validate() error {
+	r = r.withDefaults()
+	if r.Raw < 0 || r.CompactInterval < 0 {
+		return fmt.Errorf("retention durations must not be negative")
+	}
+
+	prev := Tier{Retention: r.Raw}
+	for i, t := range r.Tiers {
+		if t.Resolution <= 0 {
+			return fmt.Errorf("tier %d: resolution must be positive", i)
+		}
+		if t.Resolution >= r.Raw {
+			return fmt.Errorf("tier %d: resolution %v must be shorter than raw retention %v", i, t.Resolution, r.Raw)
+		}
+		if t.Resolution <= prev.Resolution {
+			return fmt.Errorf("tier %d: resolutions must increase", i)
+		}
+		if t.Retention <= prev.Retention {
+			return fmt.Errorf("tier %d: retention %v must be longer than the previous level's %v", i, t.Retention, prev.Retention)
+		}
+		prev = t
+	}
+	return nil
+}
+
+func (s *SQLiteStore) createRollupTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS rollups (
+			resolution INTEGER NOT NULL,
+			clinic_id TEXT NOT NULL,
+			metric TEXT NOT NULL,
+			bucket INTEGER NOT NULL,
+			count INTEGER NOT NULL,
+			min REAL NOT NULL,
+			max REAL NOT NULL,
+			avg REAL NOT NULL,
+			p95 REAL NOT NULL,
+			PRIMARY KEY (resolution, clinic_id, metric, bucket)
+		)`,
+		`CREATE TABLE IF NOT EXISTS rollup_watermarks (
+			resolution INTEGER PRIMARY KEY,
+			watermark INTEGER NOT NULL
+		)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create rollup tables: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) compactLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.Retention.CompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Compact(context.Background(), time.Now()); err != nil {
+				log.Printf("Failed to compact metrics: %v", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Compact builds rollups for every completed bucket since the last run and
+// deletes data that has aged out of its tier
+func (s *SQLiteStore) Compact(ctx context.Context, now time.Time) error {
+	// Leave room for samples still queued in the batch writer
+	settled := now.Add(-s.config.FlushInterval)
+
+	for _, tier := range s.config.Retention.Tiers {
+		if err := s.rollup(ctx, tier, settled); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM metrics WHERE ts < ?`,
+		now.Add(-s.config.Retention.Raw).UnixMilli()); err != nil {
+		return fmt.Errorf("failed to expire raw samples: %v", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM faulted_metrics WHERE ts < ?`,
+		now.Add(-s.config.Retention.Raw).UnixMilli()); err != nil {
+		return fmt.Errorf("failed to expire fault-injected samples: %v", err)
+	}
+	for _, tier := range s.config.Retention.Tiers {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM rollups WHERE resolution = ? AND bucket < ?`,
+			int64(tier.Resolution/time.Second), now.Add(-tier.Retention).UnixMilli()); err != nil {
+			return fmt.Errorf("failed to expire %v rollups: %v", tier.Resolution, err)
+		}
+	}
+	return nil
+}
+
+// rollup summarises raw samples into the tier's buckets, from the tier's
+// watermark up to the last bucket that ended before settled
+func (s *SQLiteStore) rollup(ctx context.Context, tier Tier, settled time.Time) error {
+	res := int64(tier.Resolution / time.Millisecond)
+	end := settled.UnixMilli() / res * res
+
+	var watermark int64
+	err := s.db.QueryRowContext(ctx, `SELECT watermark FROM rollup_watermarks WHERE resolution = ?`,
+		int64(tier.Resolution/time.Second)).Scan(&watermark)
+	if err == sql.ErrNoRows {
+		var earliest sql.NullInt64
+		if err := s.db.QueryRowContext(ctx, `SELECT MIN(ts) FROM metrics`).Scan(&earliest); err != nil {
+			return fmt.Errorf("failed to find earliest sample: %v", err)
+		}
+		if !earliest.Valid {
+			return nil
+		}
+		watermark = earliest.Int64 / res * res
+	} else if err != nil {
+		return fmt.Errorf("failed to read watermark: %v", err)
+	}
+
+	// Work through the backlog in bounded windows to cap memory use
+	window := res * 360
+	if minWindow := int64(6 * time.Hour / time.Millisecond); window < minWindow {
+		window = minWindow / res * res
+	}
+
+	for watermark < end {
+		next := watermark + window
+		if next > end {
+			next = end
+		}
+		if err := s.rollupWindow(ctx, tier, watermark, next); err != nil {
+			return err
+		}
+		watermark = next
+	}
+	return nil
+}
+
+type rollupKey struct {
+	clinicID string
+	metric   string
+	bucket   int64
+}
+
+func (s *SQLiteStore) rollupWindow(ctx context.Context, tier Tier, from, to int64) error {
+	res := int64(tier.Resolution / time.Millisecond)
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT clinic_id, ts, %s FROM metrics WHERE ts >= ? AND ts < ?`,
+		strings.Join(models.MetricNames, ", ")), from, to)
+	if err != nil {
+		return fmt.Errorf("failed to read samples for rollup: %v", err)
+	}
+
+	buckets := make(map[rollupKey][]float64)
+	for rows.Next() {
+		var clinicID string
+		var ts int64
+		values := make([]sql.NullFloat64, len(models.MetricNames))
+		dest := []interface{}{&clinicID, &ts}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan sample for rollup: %v", err)
+		}
+
+		for i, v := range values {
+			if !v.Valid {
+				continue
+			}
+			k := rollupKey{clinicID: clinicID, metric: models.MetricNames[i], bucket: ts / res * res}
+			buckets[k] = append(buckets[k], v.Float64)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read samples for rollup: %v", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	resSeconds := int64(tier.Resolution / time.Second)
+	for k, values := range buckets {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO rollups (resolution, clinic_id, metric, bucket, count, min, max, avg, p95)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			resSeconds, k.clinicID, k.metric, k.bucket, len(values),
+			Aggregate(values, AggMin), Aggregate(values, AggMax),
+			Aggregate(values, AggAvg), Aggregate(values, AggP95)); err != nil {
+			return fmt.Errorf("failed to write rollup: %v", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO rollup_watermarks (resolution, watermark) VALUES (?, ?)`,
+		resSeconds, to); err != nil {
+		return fmt.Errorf("failed to update watermark: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// Resolution returns the granularity of the data a query will be answered
+// from: zero for raw samples, otherwise the tier's bucket size. It picks the
+// finest level whose retention still reaches back to the start of the
+// range, so a year-long report reads hourly rows instead of millions of
+// samples while recent ranges stay exact.
+func (s *SQLiteStore) Resolution(q Query, now time.Time) time.Duration {
+	if !q.From.Before(now.Add(-s.config.Retention.Raw)) {
+		return 0
+	}
+
+	tiers := s.config.Retention.Tiers
+	for _, t := range tiers {
+		if !q.From.Before(now.Add(-t.Retention)) {
+			return t.Resolution
+		}
+	}
+	if len(tiers) == 0 {
+		return 0
+	}
+	// Nothing reaches back that far; the longest-lived tier has the most
+	return tiers[len(tiers)-1].Resolution
+}
+
+// queryRollups answers a query from a rollup tier, merging stored buckets
+// into step-sized points. Averages are weighted by sample count; p95 uses
+// the largest bucket p95, an upper bound on the true value. Raw samples
+// newer than the tier's watermark fill in the tail that has not been
+// compacted yet.
+func (s *SQLiteStore) queryRollups(ctx context.Context, q Query, resolution time.Duration) ([]Point, error) {
+	var watermark int64
+	err := s.db.QueryRowContext(ctx, `SELECT watermark FROM rollup_watermarks WHERE resolution = ?`,
+		int64(resolution/time.Second)).Scan(&watermark)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read watermark: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT bucket, count, min, max, avg, p95 FROM rollups
+		WHERE resolution = ? AND clinic_id = ? AND metric = ? AND bucket >= ? AND bucket < ?
+		ORDER BY bucket`,
+		int64(resolution/time.Second), q.ClinicID, q.Metric, q.From.UnixMilli(), q.To.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %v", err)
+	}
+	defer rows.Close()
+
+	step := q.Step
+	if step < resolution {
+		step = resolution
+	}
+
+	type acc struct {
+		count              int
+		min, max, sum, p95 float64
+		raw                []float64
+	}
+	merged := make(map[int64]*acc)
+	for rows.Next() {
+		var bucket int64
+		var count int
+		var min, max, avg, p95 float64
+		if err := rows.Scan(&bucket, &count, &min, &max, &avg, &p95); err != nil {
+			return nil, fmt.Errorf("failed to scan rollup: %v", err)
+		}
+
+		k := int64(time.UnixMilli(bucket).Sub(q.From) / step)
+		a, ok := merged[k]
+		if !ok {
+			merged[k] = &acc{count: count, min: min, max: max, sum: avg * float64(count), p95: p95}
+			continue
+		}
+		a.count += count
+		a.sum += avg * float64(count)
+		if min < a.min {
+			a.min = min
+		}
+		if max > a.max {
+			a.max = max
+		}
+		if p95 > a.p95 {
+			a.p95 = p95
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rollups: %v", err)
+	}
+
+	tailFrom := q.From
+	if wm := time.UnixMilli(watermark); watermark > 0 && wm.After(tailFrom) {
+		tailFrom = wm
+	}
+	if tailFrom.Before(q.To) {
+		tail, err := s.rawSamples(ctx, Query{
+			ClinicID: q.ClinicID, Metric: q.Metric, From: tailFrom, To: q.To,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, smp := range tail {
+			k := int64(smp.ts.Sub(q.From) / step)
+			a, ok := merged[k]
+			if !ok {
+				a = &acc{min: smp.value, max: smp.value}
+				merged[k] = a
+			}
+			a.raw = append(a.raw, smp.value)
+		}
+	}
+
+	keys := make([]int64, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	points := make([]Point, 0, len(keys))
+	for _, k := range keys {
+		a := merged[k]
+		if len(a.raw) > 0 {
+			a.count += len(a.raw)
+			for _, v := range a.raw {
+				a.sum += v
+				a.min = math.Min(a.min, v)
+				a.max = math.Max(a.max, v)
+			}
+			a.p95 = math.Max(a.p95, Percentile(a.raw, 95))
+		}
+
+		p := Point{Timestamp: q.From.Add(time.Duration(k) * step), Count: a.count}
+		switch q.Aggregation {
+		case AggMin:
+			p.Value = a.min
+		case AggMax:
+			p.Value = a.max
+		case AggP95:
+			p.Value = a.p95
+		default:
+			p.Value = a.sum / float64(a.count)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func TestRetentionValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  RetentionConfig
+		wantErr bool
+	}{
+		{name: "Defaults", config: RetentionConfig{}},
+		{name: "Custom", config: RetentionConfig{Raw: 24 * time.Hour, Tiers: []Tier{{Resolution: 5 * time.Minute, Retention: 90 * 24 * time.Hour}}}},
+		{name: "Tier coarser than raw retention", config: RetentionConfig{Raw: time.Hour, Tiers: []Tier{{Resolution: 2 * time.Hour, Retention: 720 * time.Hour}}}, wantErr: true},
+		{name: "Tier shorter-lived than raw", config: RetentionConfig{Raw: 48 * time.Hour, Tiers: []Tier{{Resolution: time.Minute, Retention: time.Hour}}}, wantErr: true},
+		{name: "Resolutions out of order", config: RetentionConfig{Tiers: []Tier{
+			{Resolution: time.Hour, Retention: 720 * time.Hour},
+			{Resolution: time.Minute, Retention: 8760 * time.Hour},
+		}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompactRollsUpAndExpires(t *testing.T) {
+	s, err := Open(Config{
+		Path:          filepath.Join(t.TempDir(), "metrics.db"),
+		FlushInterval: time.Hour,
+		Retention: RetentionConfig{
+			Raw: 48 * time.Hour,
+			Tiers: []Tier{
+				{Resolution: time.Minute, Retention: 30 * 24 * time.Hour},
+				{Resolution: time.Hour, Retention: 2 * 365 * 24 * time.Hour},
+			},
+			CompactInterval: time.Hour,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	old := now.Add(-72 * time.Hour).Truncate(time.Hour)
+
+	// Two minutes of 6-second samples three days ago: latency 1..20
+	var batch []models.Metrics
+	for i := 0; i < 20; i++ {
+		batch = append(batch, models.Metrics{
+			ClinicID:  "kch-001",
+			Timestamp: old.Add(time.Duration(i) * 6 * time.Second),
+			Latency:   float64(i + 1),
+		})
+	}
+	recent := now.Add(-10 * time.Minute)
+	batch = append(batch, models.Metrics{ClinicID: "kch-001", Timestamp: recent, Latency: 50})
+	if err := s.Write(ctx, batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err := s.Compact(ctx, now); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	raw, err := s.Range(ctx, "kch-001", old, now)
+	if err != nil {
+		t.Fatalf("Range failed: %v", err)
+	}
+	if len(raw) != 1 || raw[0].Latency != 50 {
+		t.Fatalf("Expected only the recent raw sample to survive, got %d samples", len(raw))
+	}
+
+	q := Query{ClinicID: "kch-001", Metric: "latency", From: old, To: old.Add(time.Hour), Step: time.Minute}
+	if res := s.Resolution(q, now); res != time.Minute {
+		t.Fatalf("Expected a 3-day-old range to use the 1m tier, got %v", res)
+	}
+
+	for _, tt := range []struct {
+		agg  string
+		want []float64
+	}{
+		{agg: AggAvg, want: []float64{5.5, 15.5}},
+		{agg: AggMin, want: []float64{1, 11}},
+		{agg: AggMax, want: []float64{10, 20}},
+		{agg: AggP95, want: []float64{10, 20}},
+	} {
+		q.Aggregation = tt.agg
+		points, err := s.Query(ctx, q)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if len(points) != 2 {
+			t.Fatalf("Expected 2 one-minute buckets, got %+v", points)
+		}
+		for i, p := range points {
+			if p.Value != tt.want[i] || p.Count != 10 {
+				t.Errorf("%s bucket %d = %+v, want %v", tt.agg, i, p, tt.want[i])
+			}
+		}
+	}
+
+	// Hourly step over the same range merges the minute buckets
+	q.Step, q.Aggregation = time.Hour, AggAvg
+	points, err := s.Query(ctx, q)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(points) != 1 || points[0].Value != 10.5 || points[0].Count != 20 {
+		t.Errorf("Expected one weighted hourly point of 10.5, got %+v", points)
+	}
+
+	// A year-old range is answered from the hourly tier
+	yearAgo := Query{ClinicID: "kch-001", Metric: "latency", From: now.Add(-365 * 24 * time.Hour), To: now}
+	if res := s.Resolution(yearAgo, now); res != time.Hour {
+		t.Errorf("Expected a year-long range to use the 1h tier, got %v", res)
+	}
+
+	// Running again must not double-count buckets
+	if err := s.Compact(ctx, now); err != nil {
+		t.Fatalf("Second compact failed: %v", err)
+	}
+	q.Step = time.Minute
+	points, _ = s.Query(ctx, q)
+	if len(points) != 2 || points[0].Count != 10 {
+		t.Errorf("Expected compaction to be idempotent, got %+v", points)
+	}
+}
@@ -0,0 +1,488 @@
+// store/sqlite.go
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Config controls where samples are stored and how often they are written
+type Config struct {
+	Path          string        `yaml:"path"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// Samples held in memory while the database is failing; the oldest are
+	// dropped beyond this
+	MaxPending int             `yaml:"max_pending"`
+	Retention  RetentionConfig `yaml:"retention"`
+}
+
+const (
+	defaultPath          = "./data/metrics.db"
+	defaultBatchSize     = 50
+	defaultFlushInterval = 30 * time.Second
+	defaultMaxPending    = 10000
+)
+
+// SQLiteStore is an embedded MetricsStore. Each sample is stored as a row of
+// scalar metric columns for fast range queries, plus the full sample as JSON.
+// Samples distorted by injected faults are stored only as JSON in a table of
+// their own, which queries, rollups and Range never read.
+type SQLiteStore struct {
+	db     *sql.DB
+	config Config
+
+	mu      sync.Mutex
+	pending []models.Metrics
+	dropped int // Samples dropped from the front of pending so far
+
+	// Held exclusively while a batch moves from pending to the database, and
+	// shared by readers, so a sample is never missing from both or in both
+	flushMu sync.RWMutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open creates or opens the SQLite database and starts the batch writer
+func Open(config Config) (*SQLiteStore, error) {
+	if config.Path == "" {
+		config.Path = defaultPath
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = defaultMaxPending
+	}
+	if config.MaxPending < config.BatchSize {
+		config.MaxPending = config.BatchSize
+	}
+	if err := config.Retention.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid retention: %v", err)
+	}
+	config.Retention = config.Retention.withDefaults()
+
+	if dir := filepath.Dir(config.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create store directory: %v", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", config.Path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metrics store: %v", err)
+	}
+	// SQLite allows one writer at a time; a single connection avoids
+	// "database is locked" errors between the flusher and API handlers
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{
+		db:     db,
+		config: config,
+		done:   make(chan struct{}),
+	}
+	if err := s.createTables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.wg.Add(2)
+	go s.flushLoop()
+	go s.compactLoop()
+
+	return s, nil
+}
+
+// DB exposes the underlying database so other subsystems can keep their
+// tables alongside the metrics
+func (s *SQLiteStore) DB() *sql.DB {
+	return s.db
+}
+
+func (s *SQLiteStore) createTables() error {
+	var columns []string
+	for _, name := range models.MetricNames {
+		columns = append(columns, fmt.Sprintf("%s REAL", name))
+	}
+
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS metrics (
+			clinic_id TEXT NOT NULL,
+			ts INTEGER NOT NULL,
+			%s,
+			payload BLOB NOT NULL
+		)`, strings.Join(columns, ",\n\t\t\t")),
+		`CREATE INDEX IF NOT EXISTS idx_metrics_clinic_ts ON metrics (clinic_id, ts)`,
+		`CREATE TABLE IF NOT EXISTS faulted_metrics (
+			clinic_id TEXT NOT NULL,
+			ts INTEGER NOT NULL,
+			payload BLOB NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_faulted_metrics_clinic_ts ON faulted_metrics (clinic_id, ts)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create metrics table: %v", err)
+		}
+	}
+	return s.createRollupTables()
+}
+
+// Add queues a sample; the batch is written once it reaches BatchSize or
+// when the flush interval elapses. Fault-injected samples are written
+// straight away, apart from the history.
+func (s *SQLiteStore) Add(m models.Metrics) {
+	if len(m.Faults) > 0 {
+		if err := s.Write(context.Background(), []models.Metrics{m}); err != nil {
+			log.Printf("Failed to store fault-injected sample: %v", err)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	s.pending = append(s.pending, m)
+	full := len(s.pending) >= s.config.BatchSize
+	dropped := len(s.pending) - s.config.MaxPending
+	if dropped > 0 {
+		s.pending = s.pending[dropped:]
+		s.dropped += dropped
+	}
+	s.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("Metrics store backlog full, dropped %d oldest sample(s)", dropped)
+	}
+	if full {
+		if err := s.Flush(context.Background()); err != nil {
+			log.Printf("Failed to flush metrics: %v", err)
+		}
+	}
+}
+
+// Flush writes all queued samples. They stay queued, and visible to
+// readers, until the write commits; on failure the next flush retries them.
+func (s *SQLiteStore) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := append([]models.Metrics(nil), s.pending...)
+	dropped := s.dropped
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := s.Write(ctx, batch); err != nil {
+		return err
+	}
+
+	// Add may have queued more samples, or dropped some of the batch from
+	// the front, while the write ran; only the written samples leave the queue
+	s.mu.Lock()
+	written := len(batch) - (s.dropped - dropped)
+	if written > 0 {
+		s.pending = s.pending[written:]
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SQLiteStore) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(context.Background()); err != nil {
+				log.Printf("Failed to flush metrics: %v", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Write stores samples in a single transaction, routing fault-injected
+// samples to their own table
+func (s *SQLiteStore) Write(ctx context.Context, metrics []models.Metrics) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.Repeat("?, ", len(models.MetricNames)+2) + "?"
+	query := fmt.Sprintf("INSERT INTO metrics (clinic_id, ts, %s, payload) VALUES (%s)",
+		strings.Join(models.MetricNames, ", "), placeholders)
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, m := range metrics {
+		payload, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to marshal sample: %v", err)
+		}
+
+		if len(m.Faults) > 0 {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO faulted_metrics (clinic_id, ts, payload) VALUES (?, ?, ?)`,
+				m.ClinicID, m.Timestamp.UnixMilli(), payload); err != nil {
+				return fmt.Errorf("failed to insert fault-injected sample: %v", err)
+			}
+			continue
+		}
+
+		args := []interface{}{m.ClinicID, m.Timestamp.UnixMilli()}
+		for _, name := range models.MetricNames {
+			if v, ok := m.Value(name); ok {
+				args = append(args, v)
+			} else {
+				args = append(args, nil)
+			}
+		}
+		args = append(args, payload)
+
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return fmt.Errorf("failed to insert sample: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// pendingFor returns queued samples for a clinic in [from, to)
+func (s *SQLiteStore) pendingFor(clinicID string, from, to time.Time) []models.Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []models.Metrics
+	for _, m := range s.pending {
+		if m.ClinicID == clinicID && !m.Timestamp.Before(from) && m.Timestamp.Before(to) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// Range returns every sample for a clinic in [from, to), including samples
+// still waiting to be flushed
+func (s *SQLiteStore) Range(ctx context.Context, clinicID string, from, to time.Time) ([]models.Metrics, error) {
+	s.flushMu.RLock()
+	defer s.flushMu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT payload FROM metrics WHERE clinic_id = ? AND ts >= ? AND ts < ? ORDER BY ts`,
+		clinicID, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics: %v", err)
+	}
+
+	result, err := scanPayloads(rows)
+	if err != nil {
+		return nil, err
+	}
+	return append(result, s.pendingFor(clinicID, from, to)...), nil
+}
+
+// FaultedRange returns every fault-injected sample for a clinic in [from, to)
+func (s *SQLiteStore) FaultedRange(ctx context.Context, clinicID string, from, to time.Time) ([]models.Metrics, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT payload FROM faulted_metrics WHERE clinic_id = ? AND ts >= ? AND ts < ? ORDER BY ts`,
+		clinicID, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fault-injected samples: %v", err)
+	}
+	return scanPayloads(rows)
+}
+
+// Recent returns up to limit of the newest samples for a clinic, oldest first
+func (s *SQLiteStore) Recent(ctx context.Context, clinicID string, limit int) ([]models.Metrics, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	s.flushMu.RLock()
+	defer s.flushMu.RUnlock()
+
+	pending := s.pendingFor(clinicID, time.Time{}, time.Now().Add(time.Hour))
+	if len(pending) >= limit {
+		return pending[len(pending)-limit:], nil
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT payload FROM (
+			SELECT payload, ts FROM metrics WHERE clinic_id = ? ORDER BY ts DESC LIMIT ?
+		) ORDER BY ts`,
+		clinicID, limit-len(pending))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics: %v", err)
+	}
+
+	result, err := scanPayloads(rows)
+	if err != nil {
+		return nil, err
+	}
+	return append(result, pending...), nil
+}
+
+// ClinicIDs returns every clinic with stored or queued samples or rollups,
+// sorted
+func (s *SQLiteStore) ClinicIDs(ctx context.Context) ([]string, error) {
+	s.flushMu.RLock()
+	defer s.flushMu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT clinic_id FROM metrics UNION SELECT DISTINCT clinic_id FROM rollups`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clinics: %v", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan clinic: %v", err)
+		}
+		seen[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list clinics: %v", err)
+	}
+	rows.Close()
+
+	s.mu.Lock()
+	for _, m := range s.pending {
+		seen[m.ClinicID] = true
+	}
+	s.mu.Unlock()
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func scanPayloads(rows *sql.Rows) ([]models.Metrics, error) {
+	defer rows.Close()
+
+	var result []models.Metrics
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, fmt.Errorf("failed to scan sample: %v", err)
+		}
+		var m models.Metrics
+		if err := json.Unmarshal(payload, &m); err != nil {
+			return nil, fmt.Errorf("failed to decode sample: %v", err)
+		}
+		result = append(result, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read samples: %v", err)
+	}
+	return result, nil
+}
+
+// Query aggregates one metric into step-sized buckets, reading from raw
+// samples or a rollup tier depending on how far back the range starts (see
+// Resolution). Step only sets the bucket size of the result.
+func (s *SQLiteStore) Query(ctx context.Context, q Query) ([]Point, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	if resolution := s.Resolution(q, time.Now()); resolution > 0 {
+		return s.queryRollups(ctx, q, resolution)
+	}
+
+	samples, err := s.rawSamples(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return bucketize(samples, q.From, q.Step, q.Aggregation), nil
+}
+
+// rawSamples reads one metric's raw values, including queued samples
+func (s *SQLiteStore) rawSamples(ctx context.Context, q Query) ([]sample, error) {
+	s.flushMu.RLock()
+	defer s.flushMu.RUnlock()
+
+	// q.Metric is checked against models.MetricNames by Validate, so it is
+	// safe to use as a column name
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT ts, %s FROM metrics
+		WHERE clinic_id = ? AND ts >= ? AND ts < ? AND %s IS NOT NULL
+		ORDER BY ts`, q.Metric, q.Metric),
+		q.ClinicID, q.From.UnixMilli(), q.To.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics: %v", err)
+	}
+	defer rows.Close()
+
+	var samples []sample
+	for rows.Next() {
+		var ts int64
+		var value float64
+		if err := rows.Scan(&ts, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan sample: %v", err)
+		}
+		samples = append(samples, sample{ts: time.UnixMilli(ts), value: value})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read samples: %v", err)
+	}
+
+	for _, m := range s.pendingFor(q.ClinicID, q.From, q.To) {
+		if v, ok := m.Value(q.Metric); ok {
+			samples = append(samples, sample{ts: m.Timestamp, value: v})
+		}
+	}
+	return samples, nil
+}
+
+// Close flushes queued samples and closes the database
+func (s *SQLiteStore) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	if err := s.Flush(context.Background()); err != nil {
+		log.Printf("Failed to flush metrics on close: %v", err)
+	}
+	return s.db.Close()
+}
+
+var (
+	_ MetricsStore   = (*SQLiteStore)(nil)
+	_ FaultedHistory = (*SQLiteStore)(nil)
+)
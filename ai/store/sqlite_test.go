@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+func openTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := Open(Config{
+		Path:          filepath.Join(t.TempDir(), "metrics.db"),
+		BatchSize:     1000,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestWriteAndRange(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+
+	var batch []models.Metrics
+	for i := 0; i < 10; i++ {
+		batch = append(batch, models.Metrics{
+			ClinicID:  "kch-001",
+			Timestamp: start.Add(time.Duration(i) * 6 * time.Second),
+			Latency:   float64(20 + i),
+			CPUUsage:  float64(i),
+		})
+	}
+	batch = append(batch, models.Metrics{ClinicID: "jootrh-001", Timestamp: start, Latency: 99})
+
+	if err := s.Write(ctx, batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	got, err := s.Range(ctx, "kch-001", start, start.Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("Range failed: %v", err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("Expected 5 samples in range, got %d", len(got))
+	}
+	if got[0].Latency != 20 || got[4].Latency != 24 || got[0].ClinicID != "kch-001" {
+		t.Errorf("Unexpected samples: first %+v, last %+v", got[0], got[4])
+	}
+
+	recent, err := s.Recent(ctx, "kch-001", 3)
+	if err != nil {
+		t.Fatalf("Recent failed: %v", err)
+	}
+	if len(recent) != 3 || recent[0].Latency != 27 || recent[2].Latency != 29 {
+		t.Errorf("Expected the three newest samples oldest first, got %+v", recent)
+	}
+
+	s.Add(models.Metrics{ClinicID: "ahero-001", Timestamp: start})
+	if ids, err := s.ClinicIDs(ctx); err != nil || len(ids) != 3 || ids[0] != "ahero-001" || ids[2] != "kch-001" {
+		t.Errorf("Unexpected clinic IDs %v (err %v)", ids, err)
+	}
+}
+
+func TestPendingSamplesAreVisible(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	s.Add(models.Metrics{ClinicID: "local", Timestamp: now.Add(-2 * time.Second), Latency: 10})
+	s.Add(models.Metrics{ClinicID: "local", Timestamp: now.Add(-time.Second), Latency: 30})
+
+	recent, err := s.Recent(ctx, "local", 10)
+	if err != nil || len(recent) != 2 {
+		t.Fatalf("Expected 2 queued samples, got %d (err %v)", len(recent), err)
+	}
+
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	points, err := s.Query(ctx, Query{
+		ClinicID: "local", Metric: "latency", From: now.Add(-time.Minute), To: now, Step: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(points) != 1 || points[0].Value != 20 || points[0].Count != 2 {
+		t.Errorf("Expected one averaged bucket of 20ms, got %+v", points)
+	}
+}
+
+func TestFaultedSamplesStayOutOfHistory(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	s.Add(models.Metrics{ClinicID: "local", Timestamp: now.Add(-2 * time.Second), Latency: 20})
+	s.Add(models.Metrics{ClinicID: "local", Timestamp: now.Add(-time.Second), Unreachable: true, Faults: []string{"outage"}})
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	got, err := s.Range(ctx, "local", now.Add(-time.Minute), now)
+	if err != nil || len(got) != 1 || len(got[0].Faults) != 0 {
+		t.Fatalf("Expected only the real sample in the history, got %+v (err %v)", got, err)
+	}
+	points, err := s.Query(ctx, Query{ClinicID: "local", Metric: "packet_loss", From: now.Add(-time.Minute), To: now, Step: time.Minute})
+	if err != nil || len(points) != 1 || points[0].Count != 1 {
+		t.Errorf("Expected the drill to be left out of queries, got %+v (err %v)", points, err)
+	}
+
+	faulted, err := s.FaultedRange(ctx, "local", now.Add(-time.Minute), now)
+	if err != nil || len(faulted) != 1 || faulted[0].Faults[0] != "outage" {
+		t.Errorf("Expected the drill sample to be kept apart, got %+v (err %v)", faulted, err)
+	}
+}
+
+func TestFailedFlushKeepsNewestSamples(t *testing.T) {
+	s, err := Open(Config{
+		Path:          filepath.Join(t.TempDir(), "metrics.db"),
+		BatchSize:     1000,
+		FlushInterval: time.Hour,
+		MaxPending:    1000,
+	})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour)
+
+	// Hide the table so writes fail the way a broken database would
+	if _, err := s.DB().Exec(`ALTER TABLE metrics RENAME TO metrics_offline`); err != nil {
+		t.Fatalf("Failed to rename table: %v", err)
+	}
+	for i := 0; i < 1200; i++ {
+		s.Add(models.Metrics{ClinicID: "local", Timestamp: start.Add(time.Duration(i) * time.Second), Latency: float64(i)})
+	}
+	if err := s.Flush(ctx); err == nil {
+		t.Fatalf("Expected the flush to fail")
+	}
+
+	if got := len(s.pendingFor("local", start, start.Add(time.Hour))); got != 1000 {
+		t.Fatalf("Expected the backlog capped at 1000 samples, got %d", got)
+	}
+
+	if _, err := s.DB().Exec(`ALTER TABLE metrics_offline RENAME TO metrics`); err != nil {
+		t.Fatalf("Failed to restore table: %v", err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	got, err := s.Range(ctx, "local", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Range failed: %v", err)
+	}
+	if len(got) != 1000 || got[0].Latency != 200 || got[999].Latency != 1199 {
+		t.Errorf("Expected the newest 1000 samples once, got %d from %v", len(got), got[0].Latency)
+	}
+}
+
+func TestQueryAggregations(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+
+	var batch []models.Metrics
+	for i := 1; i <= 20; i++ {
+		batch = append(batch, models.Metrics{
+			ClinicID:  "kch-001",
+			Timestamp: start.Add(time.Duration(i-1) * 6 * time.Second),
+			Latency:   float64(i),
+		})
+	}
+	// All probes failed: must not count as a latency sample
+	batch = append(batch, models.Metrics{
+		ClinicID: "kch-001", Timestamp: start.Add(30 * time.Second), Latency: 1000, Unreachable: true,
+	})
+	if err := s.Write(ctx, batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	tests := []struct {
+		agg  string
+		want []float64
+	}{
+		{agg: AggAvg, want: []float64{5.5, 15.5}},
+		{agg: AggMin, want: []float64{1, 11}},
+		{agg: AggMax, want: []float64{10, 20}},
+		{agg: AggP95, want: []float64{10, 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.agg, func(t *testing.T) {
+			points, err := s.Query(ctx, Query{
+				ClinicID: "kch-001", Metric: "latency",
+				From: start, To: start.Add(2 * time.Minute), Step: time.Minute, Aggregation: tt.agg,
+			})
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(points) != len(tt.want) {
+				t.Fatalf("Expected %d buckets, got %+v", len(tt.want), points)
+			}
+			for i, p := range points {
+				if p.Value != tt.want[i] || p.Count != 10 {
+					t.Errorf("Bucket %d = %+v, want value %v from 10 samples", i, p, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := s.Query(ctx, Query{ClinicID: "kch-001", Metric: "ssid", From: start, To: start.Add(time.Hour)}); err == nil {
+		t.Errorf("Expected an error for an unknown metric")
+	}
+}
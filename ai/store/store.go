@@ -0,0 +1,189 @@
+// store/store.go
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Evarest-ke/healthnetai/models"
+)
+
+// Supported aggregations for range queries
+const (
+	AggAvg = "avg"
+	AggMin = "min"
+	AggMax = "max"
+	AggP95 = "p95"
+)
+
+// History is the read side of the metrics store, shared by the analyzer,
+// predictor and baseline monitor
+type History interface {
+	// Recent returns up to limit of the newest samples for a clinic, oldest first
+	Recent(ctx context.Context, clinicID string, limit int) ([]models.Metrics, error)
+	// Range returns every sample for a clinic in [from, to), oldest first
+	Range(ctx context.Context, clinicID string, from, to time.Time) ([]models.Metrics, error)
+}
+
+// FaultedHistory also serves the samples distorted by injected faults. They
+// are kept apart from the history so that drills never show up as real
+// downtime or skew baselines and forecasts, but an incident raised by a
+// drill still needs them as context.
+type FaultedHistory interface {
+	History
+	// FaultedRange returns every fault-injected sample for a clinic in
+	// [from, to), oldest first
+	FaultedRange(ctx context.Context, clinicID string, from, to time.Time) ([]models.Metrics, error)
+}
+
+// MetricsStore persists collector samples and answers aggregated range queries
+type MetricsStore interface {
+	History
+
+	// Add queues a sample for the next batch write
+	Add(m models.Metrics)
+	// Write stores samples immediately in a single transaction
+	Write(ctx context.Context, metrics []models.Metrics) error
+	// Query aggregates one metric into step-sized buckets
+	Query(ctx context.Context, q Query) ([]Point, error)
+	// Resolution reports whether a query is answered from raw samples (zero)
+	// or from a rollup tier of the returned bucket size
+	Resolution(q Query, now time.Time) time.Duration
+	// Flush writes any queued samples
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+// Query selects one metric for one clinic over a time range
+type Query struct {
+	ClinicID    string
+	Metric      string
+	From        time.Time
+	To          time.Time
+	Step        time.Duration // Zero returns every sample unaggregated
+	Aggregation string        // avg, min, max or p95; defaults to avg
+}
+
+// Validate checks the metric name, range and aggregation
+func (q *Query) Validate() error {
+	if q.ClinicID == "" {
+		return fmt.Errorf("clinic is required")
+	}
+	if !models.IsMetricName(q.Metric) {
+		return fmt.Errorf("unknown metric %q", q.Metric)
+	}
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	if q.Step < 0 {
+		return fmt.Errorf("step must not be negative")
+	}
+	if q.Aggregation == "" {
+		q.Aggregation = AggAvg
+	}
+	switch q.Aggregation {
+	case AggAvg, AggMin, AggMax, AggP95:
+	default:
+		return fmt.Errorf("unknown aggregation %q", q.Aggregation)
+	}
+	return nil
+}
+
+// Point is one bucket of an aggregated series
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Count     int       `json:"count"`
+}
+
+// Aggregate reduces a set of values using one of the supported aggregations
+func Aggregate(values []float64, agg string) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	switch agg {
+	case AggMin:
+		min := values[0]
+		for _, v := range values[1:] {
+			min = math.Min(min, v)
+		}
+		return min
+	case AggMax:
+		max := values[0]
+		for _, v := range values[1:] {
+			max = math.Max(max, v)
+		}
+		return max
+	case AggP95:
+		return Percentile(values, 95)
+	default:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+}
+
+// Percentile returns the nearest-rank percentile p (0-100) of values
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+type sample struct {
+	ts    time.Time
+	value float64
+}
+
+// bucketize groups samples into step-sized buckets aligned to from and
+// aggregates each bucket. A zero step returns every sample as its own point.
+func bucketize(samples []sample, from time.Time, step time.Duration, agg string) []Point {
+	if step == 0 {
+		points := make([]Point, 0, len(samples))
+		for _, s := range samples {
+			points = append(points, Point{Timestamp: s.ts, Value: s.value, Count: 1})
+		}
+		return points
+	}
+
+	buckets := make(map[int64][]float64)
+	var keys []int64
+	for _, s := range samples {
+		k := int64(s.ts.Sub(from) / step)
+		if _, ok := buckets[k]; !ok {
+			keys = append(keys, k)
+		}
+		buckets[k] = append(buckets[k], s.value)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	points := make([]Point, 0, len(keys))
+	for _, k := range keys {
+		values := buckets[k]
+		points = append(points, Point{
+			Timestamp: from.Add(time.Duration(k) * step),
+			Value:     Aggregate(values, agg),
+			Count:     len(values),
+		})
+	}
+	return points
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Querier answers aggregated range queries. *SQLiteStore implements it.
+type Querier interface {
+	Query(ctx context.Context, q Query) ([]Point, error)
+}
+
+// Uptime is how often a clinic's probes got through over a range
+type Uptime struct {
+	Percent       float64 // Of the samples taken; zero when there are none
+	DowntimeHours float64
+	NoDataHours   float64 // Time without any samples
+	Samples       int
+}
+
+// ComputeUptime compares, bucket by bucket, the samples taken (packet loss
+// is always recorded) with those where a probe got through (latency is
+// only recorded then)
+func ComputeUptime(ctx context.Context, q Querier, clinicID string, from, to time.Time) (Uptime, error) {
+	step := time.Hour
+	if to.Sub(from) <= 48*time.Hour {
+		step = 5 * time.Minute
+	}
+	query := func(metric string) ([]Point, error) {
+		return q.Query(ctx, Query{ClinicID: clinicID, Metric: metric, From: from, To: to, Step: step})
+	}
+	taken, err := query("packet_loss")
+	if err != nil {
+		return Uptime{}, err
+	}
+	reachable, err := query("latency")
+	if err != nil {
+		return Uptime{}, err
+	}
+	up := make(map[int64]int, len(reachable))
+	for _, pt := range reachable {
+		up[pt.Timestamp.Unix()] = pt.Count
+	}
+
+	var u Uptime
+	var upSamples int
+	for _, pt := range taken {
+		if pt.Count == 0 {
+			continue
+		}
+		ok := up[pt.Timestamp.Unix()]
+		u.Samples += pt.Count
+		upSamples += ok
+		u.DowntimeHours += step.Hours() * float64(pt.Count-ok) / float64(pt.Count)
+	}
+	buckets := math.Ceil(float64(to.Sub(from)) / float64(step))
+	u.NoDataHours = math.Max(0, buckets-float64(len(taken))) * step.Hours()
+	if u.Samples > 0 {
+		u.Percent = 100 * float64(upSamples) / float64(u.Samples)
+	}
+	return u, nil
+}